@@ -0,0 +1,168 @@
+package cspheader
+
+import (
+	"container/list"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ReportKey groups violation reports that describe the same problem
+type ReportKey struct {
+	EffectiveDirective string
+	BlockedHost        string // the blocked-uri host, or the blocked-uri itself for values like "inline" or "eval"
+	DocumentPath       string
+}
+
+// AggregatedReport summarizes the violation reports seen for a key during a window
+type AggregatedReport struct {
+	Key       ReportKey
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Sample is the first report seen for the key in the window
+	Sample ViolationReport
+}
+
+// ReportAggregator deduplicates violation reports.  A single broken page can generate thousands of identical
+// reports per minute; the aggregator counts them by ReportKey and calls fn once per key each time the window
+// flushes.  It is safe for concurrent use.
+type ReportAggregator struct {
+	fn      func(AggregatedReport)
+	maxKeys int
+
+	mu sync.Mutex
+	// lru holds *AggregatedReport, most recently seen at the front
+	lru  *list.List
+	keys map[ReportKey]*list.Element
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// DefaultReportWindow is the flush interval used by NewReportAggregator when window is not positive
+const DefaultReportWindow = time.Minute
+
+// NewReportAggregator starts an aggregator that flushes to fn every window.  At most maxKeys keys are tracked at a
+// time; when a new key would exceed that, the least recently seen key is flushed early to make room.
+// Call Close to stop the aggregator and flush what remains.
+func NewReportAggregator(window time.Duration, maxKeys int, fn func(AggregatedReport)) *ReportAggregator {
+	if window <= 0 {
+		window = DefaultReportWindow
+	}
+	if maxKeys <= 0 {
+		maxKeys = 1
+	}
+
+	ra := &ReportAggregator{
+		fn:      fn,
+		maxKeys: maxKeys,
+		lru:     list.New(),
+		keys:    map[ReportKey]*list.Element{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go ra.run(window)
+	return ra
+}
+
+func (ra *ReportAggregator) run(window time.Duration) {
+	defer close(ra.done)
+
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ra.Flush()
+		case <-ra.stop:
+			ra.Flush()
+			return
+		}
+	}
+}
+
+// Add counts a violation report
+func (ra *ReportAggregator) Add(vr ViolationReport) {
+	key := newReportKey(vr)
+	now := time.Now()
+
+	var evicted *AggregatedReport
+
+	ra.mu.Lock()
+	if el, ok := ra.keys[key]; ok {
+		agg := el.Value.(*AggregatedReport)
+		agg.Count++
+		agg.LastSeen = now
+		ra.lru.MoveToFront(el)
+	} else {
+		if ra.lru.Len() >= ra.maxKeys {
+			oldest := ra.lru.Back()
+			evicted = ra.lru.Remove(oldest).(*AggregatedReport)
+			delete(ra.keys, evicted.Key)
+		}
+		ra.keys[key] = ra.lru.PushFront(&AggregatedReport{
+			Key:       key,
+			Count:     1,
+			FirstSeen: now,
+			LastSeen:  now,
+			Sample:    vr,
+		})
+	}
+	ra.mu.Unlock()
+
+	// call out without holding the lock
+	if evicted != nil {
+		ra.fn(*evicted)
+	}
+}
+
+// Flush calls fn for every key seen since the last flush and resets the counts
+func (ra *ReportAggregator) Flush() {
+	ra.mu.Lock()
+	pending := make([]*AggregatedReport, 0, ra.lru.Len())
+	for el := ra.lru.Back(); el != nil; el = el.Prev() {
+		pending = append(pending, el.Value.(*AggregatedReport))
+	}
+	ra.lru.Init()
+	ra.keys = map[ReportKey]*list.Element{}
+	ra.mu.Unlock()
+
+	for _, agg := range pending {
+		ra.fn(*agg)
+	}
+}
+
+// Close stops the aggregator's window and flushes any remaining reports.  Reports added after Close are held
+// until Flush is called.
+func (ra *ReportAggregator) Close() {
+	ra.once.Do(func() {
+		close(ra.stop)
+	})
+	<-ra.done
+}
+
+// Handler returns a ReportHandler that feeds the aggregator
+func (ra *ReportAggregator) Handler(opts ...ReportHandlerOption) http.Handler {
+	return ReportHandler(ra.Add, opts...)
+}
+
+func newReportKey(vr ViolationReport) ReportKey {
+	key := ReportKey{
+		EffectiveDirective: vr.EffectiveDirective,
+		BlockedHost:        vr.BlockedURI,
+		DocumentPath:       vr.DocumentURI,
+	}
+
+	if u, err := url.Parse(vr.BlockedURI); err == nil && len(u.Host) > 0 {
+		key.BlockedHost = u.Host
+	}
+	if u, err := url.Parse(vr.DocumentURI); err == nil {
+		key.DocumentPath = u.Path
+	}
+	return key
+}
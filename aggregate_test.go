@@ -0,0 +1,151 @@
+package cspheader
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewReportKey(t *testing.T) {
+	tests := []struct {
+		name string
+		vr   ViolationReport
+		want ReportKey
+	}{
+		{"url", ViolationReport{EffectiveDirective: "img-src", BlockedURI: "https://cdn.example.com/a.png?v=1", DocumentURI: "https://example.com/a?b=c"},
+			ReportKey{EffectiveDirective: "img-src", BlockedHost: "cdn.example.com", DocumentPath: "/a"}},
+		{"inline", ViolationReport{EffectiveDirective: "script-src-elem", BlockedURI: "inline", DocumentURI: "https://example.com/"},
+			ReportKey{EffectiveDirective: "script-src-elem", BlockedHost: "inline", DocumentPath: "/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newReportKey(tt.vr); got != tt.want {
+				t.Errorf("newReportKey() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportAggregator(t *testing.T) {
+	var c collector
+	ra := NewReportAggregator(time.Hour, 10, c.add)
+	defer ra.Close()
+
+	image := ViolationReport{EffectiveDirective: "img-src", BlockedURI: "https://cdn.example.com/a.png", DocumentURI: "https://example.com/"}
+	otherImage := image
+	otherImage.BlockedURI = "https://cdn.example.com/b.png"
+	script := ViolationReport{EffectiveDirective: "script-src-elem", BlockedURI: "inline", DocumentURI: "https://example.com/"}
+	for _, vr := range []ViolationReport{image, otherImage, script, image} {
+		ra.Add(vr)
+	}
+	ra.Flush()
+
+	got := c.take()
+	if len(got) != 2 {
+		t.Fatalf("Flush() reported %d keys, want 2: %+v", len(got), got)
+	}
+	counts := map[string]int{}
+	for _, agg := range got {
+		counts[agg.Key.EffectiveDirective] = agg.Count
+	}
+	if counts["img-src"] != 3 || counts["script-src-elem"] != 1 {
+		t.Errorf("Flush() counts = %v, want img-src 3 and script-src-elem 1", counts)
+	}
+	for _, agg := range got {
+		if agg.Key.EffectiveDirective == "img-src" && agg.Sample.BlockedURI != image.BlockedURI {
+			t.Errorf("Sample = %+v, want the first report %+v", agg.Sample, image)
+		}
+	}
+
+	ra.Flush()
+	if got := c.take(); len(got) != 0 {
+		t.Errorf("second Flush() = %+v, want nothing", got)
+	}
+}
+
+func TestReportAggregatorClose(t *testing.T) {
+	var c collector
+	ra := NewReportAggregator(time.Hour, 10, c.add)
+	ra.Add(ViolationReport{EffectiveDirective: "img-src", BlockedURI: "inline"})
+	ra.Close()
+	ra.Close()
+
+	if got := c.take(); len(got) != 1 {
+		t.Errorf("Close() flushed %+v, want one report", got)
+	}
+}
+
+func TestReportAggregatorConcurrentAdd(t *testing.T) {
+	var c collector
+	ra := NewReportAggregator(time.Hour, 10, c.add)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ra.Add(ViolationReport{EffectiveDirective: "img-src", BlockedURI: "inline"})
+			}
+		}()
+	}
+	wg.Wait()
+	ra.Close()
+
+	got := c.take()
+	if len(got) != 1 || got[0].Count != 800 {
+		t.Errorf("Close() flushed %+v, want one key counted 800 times", got)
+	}
+}
+
+func TestReportAggregatorEviction(t *testing.T) {
+	var c collector
+	ra := NewReportAggregator(time.Hour, 2, c.add)
+	defer ra.Close()
+
+	for _, directive := range []string{"img-src", "font-src", "img-src", "media-src"} {
+		ra.Add(ViolationReport{EffectiveDirective: directive, BlockedURI: "inline"})
+	}
+
+	// font-src is the least recently seen when media-src arrives
+	got := c.take()
+	if len(got) != 1 || got[0].Key.EffectiveDirective != "font-src" {
+		t.Errorf("evicted = %+v, want font-src", got)
+	}
+}
+
+func TestReportAggregatorWindow(t *testing.T) {
+	flushed := make(chan AggregatedReport, 1)
+	ra := NewReportAggregator(10*time.Millisecond, 10, func(agg AggregatedReport) { flushed <- agg })
+	defer ra.Close()
+
+	ra.Add(ViolationReport{EffectiveDirective: "img-src", BlockedURI: "inline"})
+	select {
+	case agg := <-flushed:
+		if agg.Count != 1 {
+			t.Errorf("Count = %d, want 1", agg.Count)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the window did not flush")
+	}
+}
+
+func (c *collector) add(agg AggregatedReport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reports = append(c.reports, agg)
+}
+
+func (c *collector) take() []AggregatedReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reports := c.reports
+	c.reports = nil
+	return reports
+}
+
+// collector gathers flushed reports for the aggregator tests
+type collector struct {
+	mu      sync.Mutex
+	reports []AggregatedReport
+}
@@ -0,0 +1,142 @@
+package cspheader
+
+// addSources adds values to a directive, skipping any already present.  A directive that was 'none' (Allow false)
+// becomes one allowing only the added values, rather than inheriting anything from default-src.
+func addSources(cso *CSPSourceOptions, values ...string) {
+	cso.Allow = true
+	for _, v := range values {
+		if !containsString(cso.Values, v) {
+			cso.Values = append(cso.Values, v)
+		}
+	}
+}
+
+func containsString(values []string, v string) bool {
+	for _, existing := range values {
+		if existing == v {
+			return true
+		}
+	}
+	return false
+}
+
+// GTMOption configures AllowGoogleTagManager
+type GTMOption func(*gtmConfig)
+
+type gtmConfig struct {
+	preview      bool
+	nonce        bool
+	unsafeInline bool
+}
+
+// GTMWithPreview also allows Tag Manager's preview mode, which frames the site and loads its own scripts, styles,
+// and images.
+func GTMWithPreview() GTMOption {
+	return func(cfg *gtmConfig) {
+		cfg.preview = true
+	}
+}
+
+// GTMWithNonce is for the nonce-aware GTM snippet: script-src gets NoncePlaceholder (if it carries no nonce
+// already) so the snippet can be nonced per request.
+func GTMWithNonce() GTMOption {
+	return func(cfg *gtmConfig) {
+		cfg.nonce = true
+	}
+}
+
+// GTMWithUnsafeInline is the fallback for the standard inline GTM snippet: script-src gets 'unsafe-inline'.
+func GTMWithUnsafeInline() GTMOption {
+	return func(cfg *gtmConfig) {
+		cfg.unsafeInline = true
+	}
+}
+
+// AllowGoogleTagManager adds the hosts Google Tag Manager and Google Analytics need to the directives that need
+// them, without removing anything already configured.  Calling it more than once does not add duplicates.
+// https://developers.google.com/tag-platform/security/guides/csp
+func AllowGoogleTagManager(p *Policy, opts ...GTMOption) {
+	cfg := &gtmConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	addSources(&p.CSP.ScriptSrc, "https://www.googletagmanager.com")
+	addSources(&p.CSP.ImgSrc,
+		"https://www.google-analytics.com",
+		"https://www.googletagmanager.com",
+	)
+	// GA4 sends hits to region specific endpoints (e.g. region1.google-analytics.com) as well as analytics.google.com
+	addSources(&p.CSP.ConnectSrc,
+		"https://www.google-analytics.com",
+		"https://*.google-analytics.com",
+		"https://analytics.google.com",
+		"https://*.analytics.google.com",
+	)
+
+	if cfg.nonce && !p.CSP.ScriptSrc.hasNonce() {
+		p.CSP.ScriptSrc.NonceBase64Value = NoncePlaceholder
+	}
+	if cfg.unsafeInline {
+		p.CSP.ScriptSrc.UnsafeInline = true
+	}
+
+	if cfg.preview {
+		addSources(&p.CSP.FrameSrc, "https://www.googletagmanager.com")
+		addSources(&p.CSP.ScriptSrc, "https://tagmanager.google.com")
+		addSources(&p.CSP.StyleSrc, "https://tagmanager.google.com", "https://fonts.googleapis.com")
+		addSources(&p.CSP.ImgSrc, "https://ssl.gstatic.com", "https://www.gstatic.com")
+		addSources(&p.CSP.FontSrc, "https://fonts.gstatic.com")
+	}
+}
+
+// AllowStripe adds the hosts Stripe Elements and Checkout need.  Directives that were 'none' allow only the Stripe
+// hosts afterwards, so nothing else in the policy is loosened.  Calling it more than once has no further effect.
+// https://docs.stripe.com/security/guide#content-security-policy
+func AllowStripe(p *Policy) {
+	addSources(&p.CSP.ScriptSrc, "https://js.stripe.com")
+	addSources(&p.CSP.FrameSrc, "https://js.stripe.com", "https://hooks.stripe.com")
+	addSources(&p.CSP.ConnectSrc, "https://api.stripe.com")
+}
+
+// VideoProvider is a video host that AllowVideoEmbeds knows how to allow
+type VideoProvider string
+
+const (
+	VideoYouTube         VideoProvider = "youtube"
+	VideoYouTubeNoCookie VideoProvider = "youtube-nocookie"
+	VideoVimeo           VideoProvider = "vimeo"
+)
+
+// videoProviderHosts holds the embed (frame) hosts and the thumbnail (img) hosts for each provider
+var videoProviderHosts = map[VideoProvider]struct {
+	frame []string
+	img   []string
+}{
+	VideoYouTube:         {frame: []string{"https://www.youtube.com"}, img: []string{"https://i.ytimg.com"}},
+	VideoYouTubeNoCookie: {frame: []string{"https://www.youtube-nocookie.com"}, img: []string{"https://i.ytimg.com"}},
+	VideoVimeo:           {frame: []string{"https://player.vimeo.com"}, img: []string{"https://i.vimeocdn.com"}},
+}
+
+// AllowVideoEmbeds allows embedding players from the given providers.  Player hosts are added to frame-src and to
+// child-src (for browsers that predate frame-src), and thumbnail hosts to img-src.  Unknown providers are ignored.
+func AllowVideoEmbeds(p *Policy, providers ...VideoProvider) {
+	for _, provider := range providers {
+		hosts, ok := videoProviderHosts[provider]
+		if !ok {
+			continue
+		}
+		addSources(&p.CSP.FrameSrc, hosts.frame...)
+		addSources(&p.CSP.ChildSrc, hosts.frame...)
+		addSources(&p.CSP.ImgSrc, hosts.img...)
+	}
+}
+
+// AllowGoogleFonts adds the Google Fonts stylesheet host to style-src and style-src-elem and the font file host to
+// font-src.  Existing keywords are kept; 'unsafe-inline' is not enabled.
+// https://developers.google.com/fonts/docs/getting_started
+func AllowGoogleFonts(p *Policy) {
+	addSources(&p.CSP.StyleSrc, "https://fonts.googleapis.com")
+	addSources(&p.CSP.StyleSrcElem, "https://fonts.googleapis.com")
+	addSources(&p.CSP.FontSrc, "https://fonts.gstatic.com")
+}
@@ -0,0 +1,143 @@
+package cspheader
+
+import "testing"
+
+func TestAllowGoogleTagManager(t *testing.T) {
+	const connect = "connect-src: +https://*.analytics.google.com, +https://*.google-analytics.com, " +
+		"+https://analytics.google.com, +https://www.google-analytics.com\n"
+	tests := []struct {
+		name string
+		opts []GTMOption
+		want string
+	}{
+		{
+			name: "default",
+			want: connect +
+				"img-src: +https://www.google-analytics.com, +https://www.googletagmanager.com\n" +
+				"script-src: +https://www.googletagmanager.com",
+		},
+		{
+			name: "nonce",
+			opts: []GTMOption{GTMWithNonce()},
+			want: connect +
+				"img-src: +https://www.google-analytics.com, +https://www.googletagmanager.com\n" +
+				"script-src: +https://www.googletagmanager.com, +'nonce-*'",
+		},
+		{
+			name: "unsafe-inline and preview",
+			opts: []GTMOption{GTMWithUnsafeInline(), GTMWithPreview()},
+			want: connect +
+				"font-src: +https://fonts.gstatic.com\n" +
+				"+frame-src https://www.googletagmanager.com\n" +
+				"img-src: +https://ssl.gstatic.com, +https://www.google-analytics.com, +https://www.googletagmanager.com, +https://www.gstatic.com\n" +
+				"script-src: +'unsafe-inline', +https://tagmanager.google.com, +https://www.googletagmanager.com\n" +
+				"style-src: +https://fonts.googleapis.com, +https://tagmanager.google.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allowDiff(t, func(p *Policy) { AllowGoogleTagManager(p, tt.opts...) })
+			if got != tt.want {
+				t.Errorf("diff =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowGoogleTagManagerKeepsNonce(t *testing.T) {
+	pol := SecurityOptionsStaticSite()
+	pol.CSP.ScriptSrc.NonceBase64Value = "YWJj"
+	AllowGoogleTagManager(&pol, GTMWithNonce())
+	if pol.CSP.ScriptSrc.NonceBase64Value != "YWJj" {
+		t.Errorf("NonceBase64Value = %q, want the configured nonce kept", pol.CSP.ScriptSrc.NonceBase64Value)
+	}
+}
+
+// allowDiff applies allow twice to the static site preset and returns how the header changed
+func allowDiff(t *testing.T, allow func(*Policy)) string {
+	t.Helper()
+	before := SecurityOptionsStaticSite()
+	after := SecurityOptionsStaticSite()
+	allow(&after)
+	allow(&after)
+	d, err := CompareHeaders(renderCSP(t, before), renderCSP(t, after))
+	if err != nil {
+		t.Fatalf("CompareHeaders() error = %v", err)
+	}
+	return d.String()
+}
+
+func TestAllowStripe(t *testing.T) {
+	const want = "connect-src: +https://api.stripe.com\n" +
+		"+frame-src https://hooks.stripe.com https://js.stripe.com\n" +
+		"script-src: +https://js.stripe.com"
+	if got := allowDiff(t, AllowStripe); got != want {
+		t.Errorf("diff =\n%s\nwant\n%s", got, want)
+	}
+
+	// a directive that was 'none' allows only the Stripe hosts
+	pol := SecurityOptionsStaticSite()
+	pol.CSP.ConnectSrc = CSPSourceOptions{Allow: false}
+	AllowStripe(&pol)
+	got, err := pol.CSP.ConnectSrc.Parse(defaultTemplate("SourceOption", TemplateTextSourceOption))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got != "https://api.stripe.com" {
+		t.Errorf("connect-src = %q, want only https://api.stripe.com", got)
+	}
+}
+
+func TestAllowVideoEmbeds(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []VideoProvider
+		want      string
+	}{
+		{"none", nil, ""},
+		{
+			name:      "youtube",
+			providers: []VideoProvider{VideoYouTube},
+			want: "+child-src https://www.youtube.com\n" +
+				"+frame-src https://www.youtube.com\n" +
+				"img-src: +https://i.ytimg.com",
+		},
+		{
+			name:      "youtube-nocookie",
+			providers: []VideoProvider{VideoYouTubeNoCookie},
+			want: "+child-src https://www.youtube-nocookie.com\n" +
+				"+frame-src https://www.youtube-nocookie.com\n" +
+				"img-src: +https://i.ytimg.com",
+		},
+		{
+			name:      "youtube, vimeo and an unknown provider",
+			providers: []VideoProvider{VideoYouTube, VideoVimeo, "dailymotion"},
+			want: "+child-src https://player.vimeo.com https://www.youtube.com\n" +
+				"+frame-src https://player.vimeo.com https://www.youtube.com\n" +
+				"img-src: +https://i.vimeocdn.com, +https://i.ytimg.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allowDiff(t, func(p *Policy) { AllowVideoEmbeds(p, tt.providers...) })
+			if got != tt.want {
+				t.Errorf("diff =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowGoogleFonts(t *testing.T) {
+	const want = "font-src: +https://fonts.gstatic.com\n" +
+		"style-src: +https://fonts.googleapis.com\n" +
+		"+style-src-elem https://fonts.googleapis.com"
+	if got := allowDiff(t, AllowGoogleFonts); got != want {
+		t.Errorf("diff =\n%s\nwant\n%s", got, want)
+	}
+
+	pol := SecurityOptionsStaticSite()
+	AllowGoogleFonts(&pol)
+	if pol.CSP.StyleSrc.UnsafeInline || !pol.CSP.StyleSrc.AllowSelf {
+		t.Errorf("style-src = %+v, want 'self' kept and no 'unsafe-inline'", pol.CSP.StyleSrc)
+	}
+}
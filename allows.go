@@ -0,0 +1,57 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrSelfOriginRequired is returned by Allows when 'self' has to be matched or a relative URL resolved, and the
+// Policy has no SelfOrigin
+var ErrSelfOriginRequired = errors.New("policy has no SelfOrigin to match 'self' or resolve a relative URL against")
+
+// Allows reports whether the policy permits loading resource under the named fetch directive, e.g.
+// Allows("script-src", "https://evil.example/x.js").  The directive is resolved through its fallback list as by
+// EffectiveDirective; if no directive applies, the load is allowed.  'self' and relative URLs are resolved
+// against SelfOrigin.
+//
+// Each source expression is matched as by MatchSource.  Only the source list's URL based expressions are evaluated.
+// Nonces and hashes cannot be matched by URL alone, so a list of only those allows nothing, and a script-src list
+// with 'strict-dynamic' allows nothing by URL, as browsers supporting it ignore host and scheme sources.
+func (pol *Policy) Allows(directive, resource string) (bool, error) {
+	resolved, cso, err := pol.EffectiveDirective(directive)
+	if err != nil {
+		return false, err
+	}
+	if cso.Unset {
+		return true, nil
+	}
+
+	u, err := url.Parse(resource)
+	if err != nil {
+		return false, err
+	}
+	var self *url.URL
+	if len(pol.SelfOrigin) > 0 {
+		self, err = url.Parse(pol.SelfOrigin)
+		if err != nil {
+			return false, fmt.Errorf("self origin: %w", err)
+		}
+	}
+	exprs := cso.sourceExpressions()
+	if strings.HasPrefix(resolved, DirectiveScriptSrc) && containsString(exprs, SourceStrictDynamic) {
+		return false, nil
+	}
+
+	for _, expr := range exprs {
+		matched, err := MatchSource(expr, u, self)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,161 @@
+package cspheader
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name      string
+		directive string
+		resource  string
+		want      bool
+	}{
+		{"self script", DirectiveScriptSrc, "https://example.com/app.js", true},
+		{"relative script", DirectiveScriptSrc, "/app.js", true},
+		{"cdn path", DirectiveScriptSrc, "https://cdn.example.com/js/app.js", true},
+		{"cdn outside path", DirectiveScriptSrc, "https://cdn.example.com/css/app.css", false},
+		{"other host", DirectiveScriptSrc, "https://evil.example/x.js", false},
+		{"data image", DirectiveImgSrc, "data:image/png;base64,AAAA", true},
+		{"wildcard image", DirectiveImgSrc, "https://a.images.example.com/x.png", true},
+		{"image not self", DirectiveImgSrc, "https://example.com/x.png", false},
+		{"none", DirectiveObjectSrc, "https://example.com/x.swf", false},
+		{"nonce only", DirectiveStyleSrc, "https://example.com/x.css", false},
+		{"falls back to default-src", DirectiveFontSrc, "https://example.com/x.woff2", true},
+		{"fallback denies other hosts", DirectiveFontSrc, "https://fonts.example.org/x.woff2", false},
+		{"unset falls back to default-src", DirectiveConnectSrc, "https://example.com/api", true},
+		{"script-src-elem falls back to script-src", DirectiveScriptSrcElem, "https://cdn.example.com/js/a.js", true},
+		{"worker-src falls back to script-src", DirectiveWorkerSrc, "https://evil.example/w.js", false},
+	}
+	pol := allowsPolicy()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pol.Allows(tt.directive, tt.resource)
+			if err != nil {
+				t.Fatalf("Allows(%q, %q) error = %v", tt.directive, tt.resource, err)
+			}
+			if got != tt.want {
+				t.Errorf("Allows(%q, %q) = %v, want %v", tt.directive, tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowsErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		origin    string
+		directive string
+		resource  string
+		wantErr   error
+	}{
+		{"self without origin", "", DirectiveScriptSrc, "https://example.com/app.js", ErrSelfOriginRequired},
+		{"relative without origin", "", DirectiveImgSrc, "/x.png", ErrSelfOriginRequired},
+		{"unknown directive", "https://example.com", "scripts-src", "https://example.com/", ErrUnknownDirective},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := allowsPolicy()
+			pol.SelfOrigin = tt.origin
+			_, err := pol.Allows(tt.directive, tt.resource)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Allows(%q, %q) error = %v, want %v", tt.directive, tt.resource, err, tt.wantErr)
+			}
+		})
+	}
+
+	pol := allowsPolicy()
+	_, err := pol.Allows(DirectiveSandbox, "https://example.com/")
+	var de *DirectiveError
+	if !errors.As(err, &de) || de.Directive != DirectiveSandbox {
+		t.Errorf("Allows(sandbox) error = %v, want a *DirectiveError for a directive without a source list", err)
+	}
+}
+
+func TestAllowsStrictDynamic(t *testing.T) {
+	pol := allowsPolicy()
+	pol.CSP.ScriptSrc.StrictDynamic = true
+	pol.CSP.ScriptSrc.NonceBase64Value = "abc123"
+	for _, directive := range []string{DirectiveScriptSrc, DirectiveScriptSrcElem} {
+		got, err := pol.Allows(directive, "https://cdn.example.com/js/app.js")
+		if err != nil {
+			t.Fatalf("Allows(%q) error = %v", directive, err)
+		}
+		if got {
+			t.Errorf("Allows(%q) = true, want false as 'strict-dynamic' ignores host sources", directive)
+		}
+	}
+}
+
+func TestAllowsWithoutDirective(t *testing.T) {
+	pol := Policy{OmitZeroDirectives: true}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+	pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	got, err := pol.Allows(DirectiveImgSrc, "https://anywhere.example/x.png")
+	if err != nil {
+		t.Fatalf("Allows() error = %v", err)
+	}
+	if !got {
+		t.Errorf("Allows() = false, want true where no directive applies")
+	}
+}
+
+func TestAllowsZeroDirective(t *testing.T) {
+	// without OmitZeroDirectives, a fetch directive at its zero value renders 'none' rather than falling back
+	pol := allowsPolicy()
+	pol.OmitZeroDirectives = false
+	got, err := pol.Allows(DirectiveFontSrc, "https://example.com/x.woff2")
+	if err != nil {
+		t.Fatalf("Allows() error = %v", err)
+	}
+	if got {
+		t.Errorf("Allows() = true, want false for a zero font-src")
+	}
+}
+
+func allowsPolicy() Policy {
+	pol := Policy{SelfOrigin: "https://example.com", OmitZeroDirectives: true}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{"https://cdn.example.com/js/"}}
+	pol.CSP.ImgSrc = CSPSourceOptions{Allow: true, Values: []string{"data:", "*.images.example.com"}}
+	pol.CSP.ObjectSrc = CSPSourceOptions{Allow: true, Values: []string{SourceNone}}
+	pol.CSP.StyleSrc = CSPSourceOptions{Allow: true, NonceBase64Value: "abc123"}
+	pol.CSP.ConnectSrc = CSPSourceOptions{Unset: true}
+	return pol
+}
+
+func TestAllowsPresets(t *testing.T) {
+	react := SecurityOptionsReactJS()
+	vue := SecurityOptionsVue(VueOptions{})
+	tests := []struct {
+		name      string
+		policy    Policy
+		directive string
+		resource  string
+		want      bool
+	}{
+		{"ReactJS script", react, DirectiveScriptSrc, "https://example.com/app.js", true},
+		{"ReactJS dropped script-src-elem", react, DirectiveScriptSrcElem, "https://example.com/app.js", true},
+		{"ReactJS dropped worker-src", react, DirectiveWorkerSrc, "https://example.com/w.js", true},
+		{"ReactJS worker other host", react, DirectiveWorkerSrc, "https://evil.example/w.js", false},
+		{"ReactJS img-src to default-src", react, DirectiveImgSrc, "https://example.com/x.png", false},
+		{"Vue dropped script-src-elem", vue, DirectiveScriptSrcElem, "https://example.com/app.js", true},
+		{"Vue dropped style-src-elem", vue, DirectiveStyleSrcElem, "https://example.com/app.css", true},
+		{"Vue blob worker", vue, DirectiveWorkerSrc, "blob:https://example.com/1b2c", true},
+		{"Vue media-src to default-src", vue, DirectiveMediaSrc, "https://example.com/x.mp4", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := tt.policy
+			pol.SelfOrigin = "https://example.com"
+			got, err := pol.Allows(tt.directive, tt.resource)
+			if err != nil {
+				t.Fatalf("Allows(%q, %q) error = %v", tt.directive, tt.resource, err)
+			}
+			if got != tt.want {
+				t.Errorf("Allows(%q, %q) = %v, want %v", tt.directive, tt.resource, got, tt.want)
+			}
+		})
+	}
+}
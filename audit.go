@@ -0,0 +1,232 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity ranks an audit Finding
+type Severity int
+
+const (
+	// SeverityInfo is a suggestion, e.g. for compatibility with older browsers
+	SeverityInfo Severity = iota
+	// SeverityMedium is a weakness that is exploitable in some circumstances
+	SeverityMedium
+	// SeverityHigh is a weakness that largely defeats the policy, e.g. allowing inline script
+	SeverityHigh
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// FindingCode identifies the rule behind a Finding
+type FindingCode string
+
+const (
+	// FindingMissingScriptSrc is a policy with neither script-src nor default-src, so any script may load
+	FindingMissingScriptSrc FindingCode = "missing-script-src"
+	// FindingScriptUnsafeInline is 'unsafe-inline' in script-src without a nonce or hash to override it
+	FindingScriptUnsafeInline FindingCode = "script-unsafe-inline"
+	// FindingBroadScriptSource is *, or a scheme such as https: or data:, in script-src or object-src
+	FindingBroadScriptSource FindingCode = "broad-script-source"
+	// FindingMissingObjectSrc is object-src not resolving to 'none', which permits plugin content
+	FindingMissingObjectSrc FindingCode = "missing-object-src"
+	// FindingMissingBaseURI is a policy without base-uri, which permits <base> injection
+	FindingMissingBaseURI FindingCode = "missing-base-uri"
+	// FindingStrictDynamicWithoutNonce is 'strict-dynamic' without a nonce or hash, which blocks all script
+	FindingStrictDynamicWithoutNonce FindingCode = "strict-dynamic-without-nonce"
+	// FindingStrictDynamicNoFallback is 'strict-dynamic' without the 'unsafe-inline' and https: fallbacks for
+	// browsers that do not support it
+	FindingStrictDynamicNoFallback FindingCode = "strict-dynamic-no-fallback"
+	// FindingDefaultSrcWildcard is *, or a scheme such as https: or data:, in default-src
+	FindingDefaultSrcWildcard FindingCode = "default-src-wildcard"
+	// FindingMissingFrameAncestors is a policy leaving frame-ancestors out, so any site may frame the page
+	FindingMissingFrameAncestors FindingCode = "missing-frame-ancestors"
+)
+
+// Finding is a weakness reported by Audit
+type Finding struct {
+	Severity  Severity
+	Code      FindingCode
+	Directive string
+	Message   string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("[%s] %s: %s (%s)", f.Severity, f.Directive, f.Message, f.Code)
+}
+
+// broadSources are source expressions that allow loading from practically anywhere
+var broadSources = []string{"*", "http:", "https:", "data:", "blob:", "filesystem:"}
+
+// Audit scores the policy in the manner of Google's CSP Evaluator, returning its weaknesses, most severe first.
+// Unlike the warnings from LoadWithWarnings, which flag options that do not do what they appear to, findings are
+// about what the policy lets an attacker do.  Directives are resolved through their fallbacks, so a script-src left
+// out is audited as the default-src that applies in its place.
+func (pol *Policy) Audit() []Finding {
+	var findings []Finding
+	add := func(severity Severity, code FindingCode, directive, format string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Severity:  severity,
+			Code:      code,
+			Directive: directive,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	resolved, script := pol.resolveDirective(DirectiveScriptSrc)
+	if script == nil {
+		add(SeverityHigh, FindingMissingScriptSrc, DirectiveScriptSrc,
+			"neither script-src nor default-src is set, so script may load from anywhere")
+	} else {
+		via := viaMessage(DirectiveScriptSrc, resolved)
+		sources := script.sourceSet()
+		nonceOrHash := hasNonceOrHash(sources)
+
+		if sources[SourceUnsafeInline] && !nonceOrHash {
+			add(SeverityHigh, FindingScriptUnsafeInline, DirectiveScriptSrc,
+				"'unsafe-inline'%s allows inline script, including injected script; use a nonce or hash", via)
+		}
+		// browsers supporting 'strict-dynamic' ignore host and scheme sources, which are left for those that do not
+		if !sources[SourceStrictDynamic] || !nonceOrHash {
+			for _, v := range broadSourcesIn(sources) {
+				add(SeverityHigh, FindingBroadScriptSource, DirectiveScriptSrc,
+					"%s%s allows script from hosts an attacker can serve from", v, via)
+			}
+		}
+		if sources[SourceStrictDynamic] {
+			if !nonceOrHash {
+				add(SeverityMedium, FindingStrictDynamicWithoutNonce, DirectiveScriptSrc,
+					"'strict-dynamic'%s without a nonce or hash trusts no script, so none will load", via)
+			} else if !sources[SourceUnsafeInline] || !sources["https:"] {
+				add(SeverityInfo, FindingStrictDynamicNoFallback, DirectiveScriptSrc,
+					"'strict-dynamic'%s without 'unsafe-inline' and https: blocks script in browsers that do "+
+						"not support it", via)
+			}
+		}
+	}
+
+	resolved, object := pol.resolveDirective(DirectiveObjectSrc)
+	switch {
+	case object == nil:
+		add(SeverityHigh, FindingMissingObjectSrc, DirectiveObjectSrc,
+			"neither object-src nor default-src is set, so plugin content may load from anywhere; "+
+				"set object-src 'none'")
+	case !isNoneSet(object.sourceSet()):
+		via := viaMessage(DirectiveObjectSrc, resolved)
+		broad := broadSourcesIn(object.sourceSet())
+		for _, v := range broad {
+			add(SeverityHigh, FindingBroadScriptSource, DirectiveObjectSrc,
+				"%s%s allows plugin content from hosts an attacker can serve from", v, via)
+		}
+		if len(broad) == 0 {
+			add(SeverityMedium, FindingMissingObjectSrc, DirectiveObjectSrc,
+				"object-src%s is not 'none', so plugin content may be able to run script", via)
+		}
+	}
+
+	if _, base := pol.resolveDirective(DirectiveBaseURI); base == nil {
+		add(SeverityHigh, FindingMissingBaseURI, DirectiveBaseURI,
+			"base-uri is not set and has no fallback, so an injected <base> can redirect relative script URLs; "+
+				"set base-uri 'none' or 'self'")
+	}
+
+	// frame-ancestors has no fallback, and is not a source list directive to resolve
+	if pol.CSP.FrameAncestors.Unset {
+		add(SeverityMedium, FindingMissingFrameAncestors, DirectiveFrameAncestors,
+			"frame-ancestors is not set, so any site may frame the page for clickjacking; "+
+				"set frame-ancestors 'none' or 'self'")
+	}
+
+	if _, def := pol.resolveDirective(DirectiveDefaultSrc); def != nil {
+		for _, v := range broadSourcesIn(def.sourceSet()) {
+			add(SeverityMedium, FindingDefaultSrcWildcard, DirectiveDefaultSrc,
+				"%s allows every directive falling back to default-src to load from practically anywhere", v)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity > findings[j].Severity
+	})
+	return findings
+}
+
+// ErrWeakBaseline is returned by CheckBaseline for a directive that does not meet the baseline
+var ErrWeakBaseline = errors.New("does not meet the baseline")
+
+// CheckBaseline checks the hardening every policy should have, whatever else it allows: object-src must resolve to
+// 'none', directly or through default-src, and base-uri must be 'none' or 'self'.  Without them, a tight
+// script-src can be sidestepped with plugin content or an injected <base>.  It returns a DirectiveError wrapping
+// ErrWeakBaseline for each directive that falls short.
+func (pol *Policy) CheckBaseline() error {
+	var errs []error
+
+	resolved, object := pol.resolveDirective(DirectiveObjectSrc)
+	switch {
+	case object == nil:
+		errs = append(errs, &DirectiveError{Directive: DirectiveObjectSrc,
+			Err: fmt.Errorf("%w: neither object-src nor default-src is set; set object-src 'none'", ErrWeakBaseline)})
+	case !isNoneSet(object.sourceSet()):
+		errs = append(errs, &DirectiveError{Directive: DirectiveObjectSrc,
+			Err: fmt.Errorf("%w: object-src%s must be 'none'", ErrWeakBaseline, viaMessage(DirectiveObjectSrc, resolved))})
+	}
+
+	_, base := pol.resolveDirective(DirectiveBaseURI)
+	switch {
+	case base == nil:
+		errs = append(errs, &DirectiveError{Directive: DirectiveBaseURI,
+			Err: fmt.Errorf("%w: base-uri is not set; set base-uri 'none' or 'self'", ErrWeakBaseline)})
+	case !isNoneSet(base.sourceSet()) && !(len(base.sourceSet()) == 1 && base.sourceSet()[SourceSelf]):
+		errs = append(errs, &DirectiveError{Directive: DirectiveBaseURI,
+			Err: fmt.Errorf("%w: base-uri must be 'none' or 'self'", ErrWeakBaseline)})
+	}
+
+	return errors.Join(errs...)
+}
+
+// viaMessage notes the fallback a directive was resolved to, if any, for a Finding's message
+func viaMessage(name, resolved string) string {
+	if name == resolved {
+		return ""
+	}
+	return " (via " + resolved + ")"
+}
+
+// broadSourcesIn returns the broadSources in sources, in the order of broadSources
+func broadSourcesIn(sources map[string]bool) []string {
+	var found []string
+	for _, v := range broadSources {
+		if sources[v] {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+// isNoneSet reports whether sources is exactly 'none'
+func isNoneSet(sources map[string]bool) bool {
+	return len(sources) == 1 && sources[SourceNone]
+}
+
+// hasNonceOrHash reports whether any source is a nonce or hash
+func hasNonceOrHash(sources map[string]bool) bool {
+	for v := range sources {
+		if strings.HasPrefix(v, "'nonce-") || isQuotedPrefix(v, "sha256-") || isQuotedPrefix(v, "sha384-") ||
+			isQuotedPrefix(v, "sha512-") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package cspheader
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Policy)
+		want   []FindingCode
+	}{
+		{"baseline", func(p *Policy) {}, nil},
+		{"unsafe-inline", func(p *Policy) {
+			p.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true, UnsafeInline: true}
+		}, []FindingCode{FindingScriptUnsafeInline}},
+		{"unsafe-inline overridden by a nonce", func(p *Policy) {
+			p.CSP.ScriptSrc = CSPSourceOptions{Allow: true, UnsafeInline: true, NonceBase64Value: "YWJj"}
+		}, nil},
+		{"broad script sources", func(p *Policy) {
+			p.CSP.ScriptSrc = CSPSourceOptions{Allow: true, Values: []string{"data:", "https:"}}
+		}, []FindingCode{FindingBroadScriptSource, FindingBroadScriptSource}},
+		{"strict-dynamic", func(p *Policy) {
+			p.CSP.ScriptSrc = CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj", StrictDynamic: true}
+		}, []FindingCode{FindingStrictDynamicNoFallback}},
+		{"strict-dynamic with fallbacks", func(p *Policy) {
+			p.CSP.ScriptSrc = CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj", StrictDynamic: true,
+				UnsafeInline: true, Values: []string{"https:"}}
+		}, nil},
+		{"strict-dynamic without a nonce", func(p *Policy) {
+			p.CSP.ScriptSrc = CSPSourceOptions{Allow: true, StrictDynamic: true}
+		}, []FindingCode{FindingStrictDynamicWithoutNonce}},
+		{"no script-src or default-src", func(p *Policy) {
+			p.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+			p.CSP.ScriptSrc = CSPSourceOptions{Unset: true}
+		}, []FindingCode{FindingMissingScriptSrc}},
+		{"object-src through default-src", func(p *Policy) {
+			p.CSP.ObjectSrc = CSPSourceOptions{Unset: true}
+		}, []FindingCode{FindingMissingObjectSrc}},
+		{"no object-src or default-src", func(p *Policy) {
+			p.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+			p.CSP.ObjectSrc = CSPSourceOptions{Unset: true}
+		}, []FindingCode{FindingMissingObjectSrc}},
+		{"broad object-src", func(p *Policy) {
+			p.CSP.ObjectSrc = CSPSourceOptions{Allow: true, Values: []string{"*"}}
+		}, []FindingCode{FindingBroadScriptSource}},
+		{"no base-uri", func(p *Policy) {
+			p.CSP.BaseURI = CSPSourceOptions{Unset: true}
+		}, []FindingCode{FindingMissingBaseURI}},
+		{"no frame-ancestors", func(p *Policy) {
+			p.CSP.FrameAncestors = FrameAncestorOptions{Unset: true}
+		}, []FindingCode{FindingMissingFrameAncestors}},
+		{"frame-ancestors self", func(p *Policy) {
+			p.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, AllowSelf: true}
+		}, nil},
+		{"default-src wildcard", func(p *Policy) {
+			p.CSP.DefaultSrc = CSPSourceOptions{Allow: true, Values: []string{"*"}}
+		}, []FindingCode{FindingDefaultSrcWildcard}},
+		{"most severe first", func(p *Policy) {
+			p.CSP.DefaultSrc = CSPSourceOptions{Allow: true, Values: []string{"*"}}
+			p.CSP.BaseURI = CSPSourceOptions{Unset: true}
+		}, []FindingCode{FindingMissingBaseURI, FindingDefaultSrcWildcard}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := auditBaseline()
+			tt.modify(&pol)
+			findings := pol.Audit()
+
+			var got []FindingCode
+			for i, f := range findings {
+				got = append(got, f.Code)
+				if i > 0 && f.Severity > findings[i-1].Severity {
+					t.Errorf("finding %s is more severe than the one before it", f)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Audit() = %v, want %v", findings, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditMessages(t *testing.T) {
+	pol := auditBaseline()
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true, UnsafeInline: true}
+	pol.CSP.ScriptSrc = CSPSourceOptions{Unset: true}
+	pol.CSP.ObjectSrc = CSPSourceOptions{Unset: true}
+
+	findings := pol.Audit()
+	if len(findings) != 2 {
+		t.Fatalf("Audit() = %v, want script and object findings", findings)
+	}
+	for _, f := range findings {
+		if !strings.Contains(f.Message, "(via default-src)") {
+			t.Errorf("%s does not name the default-src it was resolved through", f)
+		}
+	}
+	if findings[0].Severity != SeverityHigh || findings[1].Severity != SeverityMedium {
+		t.Errorf("severities = %s, %s, want high, medium", findings[0].Severity, findings[1].Severity)
+	}
+
+	want := "[high] script-src: 'unsafe-inline' (via default-src) allows inline script, including injected script; " +
+		"use a nonce or hash (script-unsafe-inline)"
+	if got := findings[0].String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := Severity(7).String(); got != "Severity(7)" {
+		t.Errorf("Severity(7).String() = %q", got)
+	}
+}
+
+func TestAuditPresets(t *testing.T) {
+	for name, pol := range presets() {
+		t.Run(name, func(t *testing.T) {
+			for _, f := range pol.Audit() {
+				if f.Severity == SeverityHigh {
+					t.Errorf("preset has a high severity finding: %s", f)
+				}
+			}
+		})
+	}
+}
+
+// auditBaseline returns a policy Audit finds nothing in: default-src 'self', with script-src, object-src, and
+// base-uri 'none'
+func auditBaseline() Policy {
+	var pol Policy
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	return pol
+}
+
+func TestCheckBaseline(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Policy)
+		want   []string // directives falling short
+	}{
+		{"baseline", func(p *Policy) {}, nil},
+		{"base-uri self", func(p *Policy) { p.CSP.BaseURI = CSPSourceOptions{Allow: true, AllowSelf: true} }, nil},
+		{"object-src through default-src 'none'", func(p *Policy) {
+			p.CSP.DefaultSrc = CSPSourceOptions{}
+			p.CSP.ObjectSrc = CSPSourceOptions{Unset: true}
+		}, nil},
+		{"object-src through default-src 'self'", func(p *Policy) {
+			p.CSP.ObjectSrc = CSPSourceOptions{Unset: true}
+		}, []string{DirectiveObjectSrc}},
+		{"no object-src or default-src", func(p *Policy) {
+			p.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+			p.CSP.ObjectSrc = CSPSourceOptions{Unset: true}
+		}, []string{DirectiveObjectSrc}},
+		{"no base-uri", func(p *Policy) { p.CSP.BaseURI = CSPSourceOptions{Unset: true} }, []string{DirectiveBaseURI}},
+		{"base-uri with a host", func(p *Policy) {
+			p.CSP.BaseURI = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{"https://a.example.com"}}
+		}, []string{DirectiveBaseURI}},
+		{"both", func(p *Policy) {
+			p.CSP.ObjectSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+			p.CSP.BaseURI = CSPSourceOptions{Unset: true}
+		}, []string{DirectiveObjectSrc, DirectiveBaseURI}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := auditBaseline()
+			tt.modify(&pol)
+			err := pol.CheckBaseline()
+			if (err != nil) != (len(tt.want) > 0) {
+				t.Fatalf("CheckBaseline() error = %v, want errors for %v", err, tt.want)
+			}
+			if err == nil {
+				return
+			}
+			if !errors.Is(err, ErrWeakBaseline) {
+				t.Errorf("CheckBaseline() error = %v, want %v", err, ErrWeakBaseline)
+			}
+			var got []string
+			for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+				var de *DirectiveError
+				if errors.As(e, &de) {
+					got = append(got, de.Directive)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckBaseline() directives = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBaselinePresets(t *testing.T) {
+	for name, pol := range presets() {
+		if err := pol.CheckBaseline(); err != nil {
+			t.Errorf("%s: CheckBaseline() error = %v", name, err)
+		}
+	}
+}
+
+func TestAuditRedundantDirective(t *testing.T) {
+	// a script-src the same as default-src is dropped from the header, so it is audited through default-src
+	pol := auditBaseline()
+	pol.CSP.DefaultSrc.UnsafeInline = true
+	pol.CSP.ScriptSrc = pol.CSP.DefaultSrc
+	findings := pol.Audit()
+	if len(findings) != 1 || !strings.Contains(findings[0].Message, "(via default-src)") {
+		t.Errorf("Audit() = %v, want one script-src finding via default-src", findings)
+	}
+
+	pol.KeepRedundantDirectives = true
+	findings = pol.Audit()
+	if len(findings) != 1 || strings.Contains(findings[0].Message, "(via default-src)") {
+		t.Errorf("Audit() with KeepRedundantDirectives = %v, want one finding on script-src itself", findings)
+	}
+}
+
+func TestCheckBaselineRedundantDirective(t *testing.T) {
+	// an object-src the same as default-src is dropped from the header, so it is checked through default-src
+	pol := auditBaseline()
+	pol.CSP.ObjectSrc = pol.CSP.DefaultSrc
+	err := pol.CheckBaseline()
+	if !errors.Is(err, ErrWeakBaseline) || !strings.Contains(err.Error(), "object-src (via default-src) must be 'none'") {
+		t.Errorf("CheckBaseline() error = %v, want object-src via default-src", err)
+	}
+}
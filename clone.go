@@ -0,0 +1,103 @@
+package cspheader
+
+import (
+	"text/template"
+)
+
+// Clone returns a deep copy of the Policy, so that a preset can be copied and modified without the copies sharing
+// slices or maps.  The directives rendered by the last Load or Compile are copied too.  Templates are cloned; the
+// CompiledPolicy is not modified once built and is shared.
+func (pol Policy) Clone() Policy {
+	c := pol
+
+	for _, name := range directiveOrder {
+		cso := c.sourceOptionsByName(name)
+		if cso == nil {
+			continue
+		}
+		*cso = cso.Clone()
+	}
+	c.CSP.FrameAncestors = pol.CSP.FrameAncestors.Clone()
+	c.CSP.ReportURI.Values = cloneStrings(pol.CSP.ReportURI.Values)
+
+	if pol.ReportOnlyCandidate != nil {
+		candidate := pol.ReportOnlyCandidate.Clone()
+		c.ReportOnlyCandidate = &candidate
+	}
+	if pol.Additional != nil {
+		c.Additional = make([]Policy, len(pol.Additional))
+		for i, additional := range pol.Additional {
+			c.Additional[i] = additional.Clone()
+		}
+	}
+
+	if pol.ReportTo.Groups != nil {
+		c.ReportTo.Groups = make([]ReportToGroup, len(pol.ReportTo.Groups))
+		for i, g := range pol.ReportTo.Groups {
+			if g.Endpoints != nil {
+				g.Endpoints = append(make([]ReportToEndpoint, 0, len(g.Endpoints)), g.Endpoints...)
+			}
+			c.ReportTo.Groups[i] = g
+		}
+	}
+	c.ReportingEndpoints = copyDirectives(pol.ReportingEndpoints)
+	c.CustomDirectives = copyDirectives(pol.CustomDirectives)
+
+	c.SourceOptionTemplate = cloneTemplate(pol.SourceOptionTemplate)
+	c.SandboxOptionTemplate = cloneTemplate(pol.SandboxOptionTemplate)
+	c.FrameAncestorOptionsTemplate = cloneTemplate(pol.FrameAncestorOptionsTemplate)
+	c.UnquotedOptionsTemplate = cloneTemplate(pol.UnquotedOptionsTemplate)
+	c.UnquotedOptionTemplate = cloneTemplate(pol.UnquotedOptionTemplate)
+	if pol.TemplateFuncs != nil {
+		c.TemplateFuncs = make(template.FuncMap, len(pol.TemplateFuncs))
+		for k, v := range pol.TemplateFuncs {
+			c.TemplateFuncs[k] = v
+		}
+	}
+
+	c.cspStaticDirectives = copyDirectives(pol.cspStaticDirectives)
+	c.cspDynamicDirectives = copyDirectives(pol.cspDynamicDirectives)
+	if pol.warnings != nil {
+		c.warnings = append(make([]Warning, 0, len(pol.warnings)), pol.warnings...)
+	}
+
+	return c
+}
+
+// Clone returns a copy of the options that shares no slices with cso
+func (cso CSPSourceOptions) Clone() CSPSourceOptions {
+	cso.Values = cloneStrings(cso.Values)
+	cso.Nonces = cloneStrings(cso.Nonces)
+	if cso.Hashes != nil {
+		cso.Hashes = append(make([]Hash, 0, len(cso.Hashes)), cso.Hashes...)
+	}
+	return cso
+}
+
+// Clone returns a copy of the options that shares no slices with fao.  An Unset frame-ancestors stays Unset, with
+// the sources it would otherwise render.
+func (fao FrameAncestorOptions) Clone() FrameAncestorOptions {
+	fao.HostSources = cloneStrings(fao.HostSources)
+	fao.SchemeSources = cloneStrings(fao.SchemeSources)
+	return fao
+}
+
+// cloneStrings copies s, keeping a nil slice nil
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(s)), s...)
+}
+
+func cloneTemplate(t *template.Template) *template.Template {
+	if t == nil {
+		return nil
+	}
+	c, err := t.Clone()
+	if err != nil {
+		// text/template does not fail to clone; the error is shared with html/template
+		return t
+	}
+	return c
+}
@@ -0,0 +1,96 @@
+package cspheader
+
+import (
+	"reflect"
+	"testing"
+	"text/template"
+)
+
+func TestClone(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Policy)
+	}{
+		{"source values", func(p *Policy) { p.CSP.ScriptSrc.Values[0] = "https://evil.example" }},
+		{"nonces", func(p *Policy) { p.CSP.ScriptSrc.Nonces[0] = "ZXZpbA==" }},
+		{"hashes", func(p *Policy) { p.CSP.ScriptSrc.Hashes[0].Base64 = "ZXZpbA==" }},
+		{"frame-ancestors hosts", func(p *Policy) { p.CSP.FrameAncestors.HostSources[0] = "https://evil.example" }},
+		{"frame-ancestors schemes", func(p *Policy) { p.CSP.FrameAncestors.SchemeSources[0] = "http:" }},
+		{"report-uri", func(p *Policy) { p.CSP.ReportURI.Values[0] = "/elsewhere" }},
+		{"report-to groups", func(p *Policy) { p.ReportTo.Groups[0].Group = "other" }},
+		{"report-to endpoints", func(p *Policy) { p.ReportTo.Groups[0].Endpoints[0].URL = "https://evil.example" }},
+		{"reporting endpoints", func(p *Policy) { p.ReportingEndpoints["csp"] = "https://evil.example" }},
+		{"custom directives", func(p *Policy) { p.CustomDirectives["trusted-types"] = "none" }},
+		{"template funcs", func(p *Policy) { p.TemplateFuncs["lower"] = func(s string) string { return s } }},
+		{"report-only candidate", func(p *Policy) { p.ReportOnlyCandidate.CSP.ImgSrc.Values[0] = "https://evil.example" }},
+		{"additional policies", func(p *Policy) { p.Additional[0].CSP.ScriptSrc.Values[0] = "https://evil.example" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := clonablePolicy()
+			c := pol.Clone()
+			tt.mutate(&c)
+
+			if !pol.Equal(clonablePolicy()) || len(pol.TemplateFuncs) != 1 {
+				t.Errorf("mutating the clone changed the original")
+			}
+		})
+	}
+}
+
+func TestCloneLoaded(t *testing.T) {
+	pol := SecurityOptionsReactJS()
+	if _, err := pol.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	c := pol.Clone()
+	for k := range c.cspStaticDirectives {
+		c.cspStaticDirectives[k] = "changed"
+	}
+	for k, v := range pol.cspStaticDirectives {
+		if v == "changed" {
+			t.Errorf("directive %s shared with the clone", k)
+		}
+	}
+
+	// a nil slice stays nil, so a clone compares the same under reflect
+	var zero CSPSourceOptions
+	if got := zero.Clone(); !reflect.DeepEqual(got, zero) {
+		t.Errorf("CSPSourceOptions{}.Clone() = %+v, want the zero value", got)
+	}
+}
+
+func TestCloneRendersTheSame(t *testing.T) {
+	policies := presets()
+	absent := SecurityOptionsStaticSite()
+	absent.CSP.FrameAncestors = FrameAncestorOptions{Unset: true, Allow: true, HostSources: []string{"https://partner.example"}}
+	policies["absent frame-ancestors"] = absent
+	for name, pol := range policies {
+		t.Run(name, func(t *testing.T) {
+			if got, want := renderCSP(t, pol.Clone()), renderCSP(t, pol); got != want {
+				t.Errorf("clone header = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// clonablePolicy sets every slice and map that Clone copies
+func clonablePolicy() Policy {
+	pol := SecurityOptionsReactJS()
+	pol.CSP.ScriptSrc.Values = []string{"https://cdn.example.com"}
+	pol.CSP.ScriptSrc.Nonces = []string{"YWJj"}
+	pol.CSP.ScriptSrc.Hashes = []Hash{{Algorithm: HashSHA256, Base64: emptySHA256}}
+	pol.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, HostSources: []string{"https://partner.example"}, SchemeSources: []string{"https:"}}
+	pol.CSP.ReportURI.Values = []string{"/csp"}
+	pol.ReportTo.Groups = []ReportToGroup{{Group: "csp", Endpoints: []ReportToEndpoint{{URL: "https://example.com/r"}}}}
+	pol.ReportingEndpoints = map[string]string{"csp": "https://example.com/r"}
+	pol.CustomDirectives = map[string]string{"trusted-types": "default"}
+	pol.TemplateFuncs = template.FuncMap{"upper": func(s string) string { return s }}
+	candidate := SecurityOptionsStaticSite()
+	candidate.CSP.ImgSrc.Values = []string{"https://img.example.com"}
+	pol.ReportOnlyCandidate = &candidate
+	var additional Policy
+	additional.CSP.ScriptSrc = CSPSourceOptions{Allow: true, Values: []string{"https://a.example.com"}}
+	pol.Additional = []Policy{additional}
+	return pol
+}
@@ -0,0 +1,96 @@
+package cspheader
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CloudFrontMaxCSPBytes is the longest Content-Security-Policy value a CloudFront response headers policy accepts
+const CloudFrontMaxCSPBytes = 1783
+
+// cloudFrontInput mirrors the input of aws cloudfront create-response-headers-policy --cli-input-json
+// https://docs.aws.amazon.com/cloudfront/latest/APIReference/API_ResponseHeadersPolicyConfig.html
+type cloudFrontInput struct {
+	ResponseHeadersPolicyConfig cloudFrontPolicyConfig
+}
+
+type cloudFrontPolicyConfig struct {
+	Name                  string
+	Comment               string                     `json:",omitempty"`
+	SecurityHeadersConfig *cloudFrontSecurityHeaders `json:",omitempty"`
+	CustomHeadersConfig   *cloudFrontCustomHeaders   `json:",omitempty"`
+}
+
+type cloudFrontSecurityHeaders struct {
+	ContentSecurityPolicy cloudFrontCSP
+}
+
+type cloudFrontCSP struct {
+	Override              bool
+	ContentSecurityPolicy string
+}
+
+type cloudFrontCustomHeaders struct {
+	Quantity int
+	Items    []cloudFrontCustomHeader
+}
+
+type cloudFrontCustomHeader struct {
+	Header   string
+	Value    string
+	Override bool
+}
+
+// ExportCloudFront renders the policy as the JSON input of aws cloudfront create-response-headers-policy
+// --cli-input-json, for a response headers policy with the given name.  The Content-Security-Policy header goes in
+// SecurityHeadersConfig, overriding any header from the origin; the report-only, Report-To, and Reporting-Endpoints
+// headers, which CloudFront has no dedicated setting for, are custom headers, likewise overriding the origin.
+//
+// CloudFront limits the Content-Security-Policy value to CloudFrontMaxCSPBytes; a longer policy is an error wrapping
+// ErrHeaderTooLarge.  name must be 1 to 128 letters, digits, hyphens, or underscores.
+func (pol *Policy) ExportCloudFront(name string) ([]byte, error) {
+	err := validateCloudFrontName(name)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := pol.exportHeaders()
+	if err != nil {
+		return nil, err
+	}
+
+	config := cloudFrontPolicyConfig{Name: name}
+	var custom []cloudFrontCustomHeader
+	for _, h := range headers {
+		if h.name != HeaderContentSecurityPolicy {
+			custom = append(custom, cloudFrontCustomHeader{Header: h.name, Value: h.value, Override: true})
+			continue
+		}
+		if len(h.value) > CloudFrontMaxCSPBytes {
+			return nil, fmt.Errorf("exporting cloudfront policy: %w: %d bytes is over CloudFront's limit of %d",
+				ErrHeaderTooLarge, len(h.value), CloudFrontMaxCSPBytes)
+		}
+		config.SecurityHeadersConfig = &cloudFrontSecurityHeaders{
+			ContentSecurityPolicy: cloudFrontCSP{Override: true, ContentSecurityPolicy: h.value},
+		}
+	}
+	if len(custom) > 0 {
+		config.CustomHeadersConfig = &cloudFrontCustomHeaders{Quantity: len(custom), Items: custom}
+	}
+
+	return json.MarshalIndent(cloudFrontInput{ResponseHeadersPolicyConfig: config}, "", "  ")
+}
+
+// validateCloudFrontName checks a response headers policy name against CloudFront's constraints
+func validateCloudFrontName(name string) error {
+	if len(name) == 0 || len(name) > 128 {
+		return fmt.Errorf("cloudfront policy name must be 1 to 128 characters, got %d", len(name))
+	}
+	for _, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return fmt.Errorf("cloudfront policy name %q must be letters, digits, hyphens, or underscores", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package cspheader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportCloudFront(t *testing.T) {
+	reportTo := `{"group":"csp","max_age":3600,"endpoints":[{"url":"https://r.example.com/csp"}]}`
+	tests := []struct {
+		name   string
+		policy func() *Policy
+		want   cloudFrontPolicyConfig
+	}{
+		{
+			name: "static site",
+			policy: func() *Policy {
+				pol := SecurityOptionsStaticSite()
+				return &pol
+			},
+			want: cloudFrontPolicyConfig{
+				Name: "site",
+				SecurityHeadersConfig: &cloudFrontSecurityHeaders{ContentSecurityPolicy: cloudFrontCSP{
+					Override: true,
+					ContentSecurityPolicy: "default-src 'none'; connect-src 'self'; font-src 'self'; img-src 'self' data:; " +
+						"script-src 'self'; style-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'; " +
+						"upgrade-insecure-requests;",
+				}},
+			},
+		},
+		{
+			name:   "Report-To as a custom header",
+			policy: exportPolicy,
+			want: cloudFrontPolicyConfig{
+				Name:                  "site",
+				SecurityHeadersConfig: &cloudFrontSecurityHeaders{ContentSecurityPolicy: cloudFrontCSP{Override: true, ContentSecurityPolicy: exportCSP}},
+				CustomHeadersConfig: &cloudFrontCustomHeaders{Quantity: 1, Items: []cloudFrontCustomHeader{
+					{Header: HeaderReportTo, Value: reportTo, Override: true},
+				}},
+			},
+		},
+		{
+			name: "report-only",
+			policy: func() *Policy {
+				pol := exportPolicy()
+				pol.ReportOnly = true
+				return pol
+			},
+			want: cloudFrontPolicyConfig{
+				Name: "site",
+				CustomHeadersConfig: &cloudFrontCustomHeaders{Quantity: 2, Items: []cloudFrontCustomHeader{
+					{Header: HeaderContentSecurityPolicyReportOnly, Value: exportCSP, Override: true},
+					{Header: HeaderReportTo, Value: reportTo, Override: true},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.policy().ExportCloudFront("site")
+			if err != nil {
+				t.Fatalf("ExportCloudFront() error = %v", err)
+			}
+			var got cloudFrontInput
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v\n%s", err, b)
+			}
+			if !reflect.DeepEqual(got.ResponseHeadersPolicyConfig, tt.want) {
+				t.Errorf("ExportCloudFront() =\n%s\nwant %+v", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportCloudFrontErrors(t *testing.T) {
+	large := SecurityOptionsStaticSite()
+	for i := 0; i < 100; i++ {
+		large.CSP.ImgSrc.Values = append(large.CSP.ImgSrc.Values, fmt.Sprintf("https://img%d.example.com", i))
+	}
+	nonce := SecurityOptionsStrict()
+
+	tests := []struct {
+		name    string
+		pol     *Policy
+		polName string
+		wantErr error // nil for errors without a sentinel
+	}{
+		{"empty name", exportPolicy(), "", nil},
+		{"long name", exportPolicy(), strings.Repeat("a", 129), nil},
+		{"name with a space", exportPolicy(), "my policy", nil},
+		{"too large", &large, "site", ErrHeaderTooLarge},
+		{"per-request nonce", &nonce, "site", ErrNonceRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.pol.ExportCloudFront(tt.polName)
+			if err == nil {
+				t.Fatal("ExportCloudFront() error = nil, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExportCloudFront() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := exportPolicy().ExportCloudFront(strings.Repeat("a_-9", 32)); err != nil {
+		t.Errorf("ExportCloudFront() of a 128 character name error = %v", err)
+	}
+}
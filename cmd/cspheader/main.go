@@ -0,0 +1,215 @@
+// Command cspheader generates, validates, and compares Content-Security-Policy headers, for use in CI and by teams
+// not writing Go.
+//
+//	cspheader generate -config policy.json [-format header|nginx|apache|caddy|meta]
+//	cspheader validate [-severity info|medium|high] "<header value>"
+//	cspheader diff old.txt new.txt
+//
+// generate reads a policy in the JSON or YAML form (by the file's extension; - reads JSON from stdin) and prints
+// its headers.  validate parses a header value and prints its audit findings, exiting 1 if any is at or above
+// -severity.  diff prints the directive by directive difference between two files each holding a header value,
+// exiting 1 if the second loosens the first.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tristanfisher/cspheader"
+)
+
+const usage = `usage:
+  cspheader generate -config policy.json [-format header|nginx|apache|caddy|meta]
+  cspheader validate [-severity info|medium|high] "<header value>"
+  cspheader diff old.txt new.txt
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit status: 0 on success, 1 for findings or differences
+// worth failing a build over, and 2 for usage errors or anything that could not be read or parsed
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var err error
+	status := 0
+	switch args[0] {
+	case "generate":
+		err = generate(args[1:], stdin, stdout, stderr)
+	case "validate":
+		status, err = validate(args[1:], stdout, stderr)
+	case "diff":
+		status, err = diff(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "cspheader %s: %v\n", args[0], err)
+		return 2
+	}
+	return status
+}
+
+func generate(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	config := fs.String("config", "", "policy file in the JSON or YAML form, or - for JSON on stdin")
+	format := fs.String("format", "header", "output format: header, nginx, apache, caddy, or meta")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(*config) == 0 || fs.NArg() > 0 {
+		return errors.New("expected -config and no arguments")
+	}
+
+	pol, err := loadPolicy(*config, stdin)
+	if err != nil {
+		return err
+	}
+
+	var out string
+	switch *format {
+	case "header":
+		var buf bytes.Buffer
+		err = pol.RenderHeaderBlock(&buf)
+		out = strings.ReplaceAll(buf.String(), "\r\n", "\n")
+	case "nginx":
+		out, err = pol.ExportNginx()
+	case "apache":
+		out, err = pol.ExportApache()
+	case "caddy":
+		out, err = pol.ExportCaddy()
+	case "meta":
+		var dropped []string
+		out, dropped, err = pol.MetaElement()
+		for _, d := range dropped {
+			fmt.Fprintln(stderr, "warning:", d)
+		}
+		out += "\n"
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(stdout, out)
+	return err
+}
+
+// loadPolicy reads a policy file, choosing the YAML or JSON loader by its extension
+func loadPolicy(path string, stdin io.Reader) (cspheader.Policy, error) {
+	if path == "-" {
+		return cspheader.NewPolicyFromJSON(stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return cspheader.Policy{}, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return cspheader.NewPolicyFromYAML(f)
+	}
+	return cspheader.NewPolicyFromJSON(f)
+}
+
+func validate(args []string, stdout, stderr io.Writer) (int, error) {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	severityName := fs.String("severity", cspheader.SeverityHigh.String(),
+		"exit 1 if there is a finding at or above this severity: info, medium, or high")
+	err := fs.Parse(args)
+	if err != nil {
+		return 0, err
+	}
+	if fs.NArg() != 1 {
+		return 0, errors.New("expected one header value")
+	}
+	threshold, err := parseSeverity(*severityName)
+	if err != nil {
+		return 0, err
+	}
+
+	pol, err := cspheader.ParsePolicy(fs.Arg(0))
+	if err != nil {
+		return 0, err
+	}
+
+	status := 0
+	for _, f := range pol.Audit() {
+		fmt.Fprintln(stdout, f)
+		if f.Severity >= threshold {
+			status = 1
+		}
+	}
+	return status, nil
+}
+
+func parseSeverity(name string) (cspheader.Severity, error) {
+	for _, s := range []cspheader.Severity{cspheader.SeverityInfo, cspheader.SeverityMedium, cspheader.SeverityHigh} {
+		if strings.EqualFold(name, s.String()) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q", name)
+}
+
+func diff(args []string, stdout, stderr io.Writer) (int, error) {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	err := fs.Parse(args)
+	if err != nil {
+		return 0, err
+	}
+	if fs.NArg() != 2 {
+		return 0, errors.New("expected two files")
+	}
+
+	headers := make([]string, 2)
+	for i, path := range fs.Args() {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		headers[i] = strings.TrimSpace(string(b))
+	}
+
+	d, err := cspheader.CompareHeaders(headers[0], headers[1])
+	if err != nil {
+		return 0, err
+	}
+	if d.Equal() {
+		return 0, nil
+	}
+	_, err = fmt.Fprintln(stdout, d)
+	if err != nil {
+		return 0, err
+	}
+	if d.IsLoosening() {
+		return 1, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tristanfisher/cspheader"
+)
+
+func TestRun(t *testing.T) {
+	header := wantHeaderBlock(t)
+	json, err := os.ReadFile(fixture + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict := writeFile(t, "strict.txt", "default-src 'none'; script-src 'self'; object-src 'none'; base-uri 'none'\n")
+	loose := writeFile(t, "loose.txt", "default-src 'none'; script-src 'self' https:; object-src 'none'; base-uri 'none'\n")
+	nonce := writeFile(t, "nonce.json", `{"csp": {"script-src": {"allow": true, "nonce-base64-value": "CSP_NONCE_PLACEHOLDER"}}}`)
+
+	tests := []struct {
+		name         string
+		args         []string
+		stdin        string
+		wantStatus   int
+		wantStdout   string // exact, or a substring with wantContains
+		wantContains bool
+		wantStderr   string // a substring
+	}{
+		{name: "no command", wantStatus: 2, wantStderr: "usage:"},
+		{name: "help", args: []string{"help"}, wantStdout: usage},
+		{name: "unknown command", args: []string{"deploy"}, wantStatus: 2, wantStderr: `unknown command "deploy"`},
+
+		{name: "generate yaml", args: []string{"generate", "-config", fixture + ".yaml"}, wantStdout: header},
+		{name: "generate json", args: []string{"generate", "-config", fixture + ".json"}, wantStdout: header},
+		{name: "generate stdin", args: []string{"generate", "-config", "-"}, stdin: string(json), wantStdout: header},
+		{
+			name:         "generate nginx",
+			args:         []string{"generate", "-config", fixture + ".yaml", "-format", "nginx"},
+			wantStdout:   `add_header Content-Security-Policy "default-src 'self';`,
+			wantContains: true,
+		},
+		{
+			name:         "generate apache",
+			args:         []string{"generate", "-config", fixture + ".yaml", "-format", "apache"},
+			wantStdout:   `Header always set Content-Security-Policy "default-src 'self';`,
+			wantContains: true,
+		},
+		{
+			name:         "generate caddy",
+			args:         []string{"generate", "-config", fixture + ".yaml", "-format", "caddy"},
+			wantStdout:   "header {\n\tContent-Security-Policy \"default-src 'self';",
+			wantContains: true,
+		},
+		{
+			name:         "generate meta",
+			args:         []string{"generate", "-config", fixture + ".yaml", "-format", "meta"},
+			wantStdout:   `<meta http-equiv="Content-Security-Policy" content="default-src &#39;self&#39;;`,
+			wantContains: true,
+			wantStderr:   "warning: frame-ancestors is not supported in a meta element",
+		},
+		{name: "generate without config", args: []string{"generate"}, wantStatus: 2, wantStderr: "expected -config"},
+		{
+			name:       "generate unknown format",
+			args:       []string{"generate", "-config", fixture + ".yaml", "-format", "iis"},
+			wantStatus: 2,
+			wantStderr: `unknown format "iis"`,
+		},
+		{name: "generate missing file", args: []string{"generate", "-config", "missing.json"}, wantStatus: 2, wantStderr: "missing.json"},
+		{name: "generate needs nonce", args: []string{"generate", "-config", nonce}, wantStatus: 2, wantStderr: "per-request nonce is required"},
+		{name: "generate help", args: []string{"generate", "-h"}, wantStderr: "-config"},
+
+		{name: "validate clean", args: []string{"validate", "default-src 'none'; script-src 'self'; object-src 'none'; base-uri 'none'; frame-ancestors 'none'"}},
+		{
+			name:         "validate finding",
+			args:         []string{"validate", "script-src 'unsafe-inline'; object-src 'none'; base-uri 'none'"},
+			wantStatus:   1,
+			wantStdout:   "[high] script-src: 'unsafe-inline' allows inline script",
+			wantContains: true,
+		},
+		{
+			name:         "validate below severity",
+			args:         []string{"validate", "-severity", "medium", "default-src 'self'; object-src 'none'; base-uri 'none'; frame-ancestors 'none'; script-src 'self' 'strict-dynamic' 'nonce-abc123'"},
+			wantStdout:   "[info] script-src: 'strict-dynamic' without",
+			wantContains: true,
+		},
+		{name: "validate unknown severity", args: []string{"validate", "-severity", "critical", "default-src 'self'"}, wantStatus: 2, wantStderr: `unknown severity "critical"`},
+		{name: "validate no header", args: []string{"validate"}, wantStatus: 2, wantStderr: "expected one header value"},
+		{name: "validate unparsable", args: []string{"validate", "navigate-to 'self'"}, wantStatus: 2, wantStderr: "unsupported directive"},
+
+		{name: "diff equal", args: []string{"diff", strict, strict}},
+		{name: "diff tightening", args: []string{"diff", loose, strict}, wantStdout: "script-src", wantContains: true},
+		{name: "diff loosening", args: []string{"diff", strict, loose}, wantStatus: 1, wantStdout: "script-src", wantContains: true},
+		{name: "diff one file", args: []string{"diff", strict}, wantStatus: 2, wantStderr: "expected two files"},
+		{name: "diff missing file", args: []string{"diff", strict, "missing.txt"}, wantStatus: 2, wantStderr: "missing.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if status != tt.wantStatus {
+				t.Errorf("run(%q) = %d, want %d; stderr:\n%s", tt.args, status, tt.wantStatus, stderr.String())
+			}
+			if tt.wantContains && !strings.Contains(stdout.String(), tt.wantStdout) ||
+				!tt.wantContains && stdout.String() != tt.wantStdout {
+				t.Errorf("run(%q) stdout:\n%s\nwant:\n%s", tt.args, stdout.String(), tt.wantStdout)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("run(%q) stderr:\n%s\nwant it to contain %q", tt.args, stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+// wantHeaderBlock is the header block of the fixture as the library renders it, with LF line endings
+func wantHeaderBlock(t *testing.T) string {
+	t.Helper()
+	f, err := os.Open(fixture + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pol, err := cspheader.NewPolicyFromJSON(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = pol.RenderHeaderBlock(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.ReplaceAll(buf.String(), "\r\n", "\n")
+}
+
+// writeFile writes content to name in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fixture is a policy of the library's YAML fixtures that renders without a per-request nonce
+var fixture = filepath.Join("..", "..", "testdata", "yaml", "options")
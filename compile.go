@@ -0,0 +1,457 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// ErrNotCompiled is returned when per-request rendering is requested from a Policy that has not been loaded or compiled
+var ErrNotCompiled = errors.New("policy has not been compiled: call Load or Compile first")
+
+// ErrNonceRequired is returned when a policy using NoncePlaceholder is rendered without a per-request nonce
+var ErrNonceRequired = errors.New("a per-request nonce is required: render with HeaderWithNonce or the middleware's WithNonce option")
+
+// CompiledPolicy is a Policy whose templates have been parsed and whose static directives have been rendered.
+// Compile once and Render per request: only the directives carrying a nonce are re-rendered on each call.
+//
+// A CompiledPolicy holds its own copy of everything it renders and is not modified once Compile returns, so it is
+// safe for concurrent use, and later changes to the Policy do not affect it.  A Policy is not: share the
+// CompiledPolicy between goroutines rather than calling Load or HeaderWithNonce on a shared Policy.  The one thing
+// shared with the Policy is SourceOptionTemplate, which must not be modified after Compile.
+type CompiledPolicy struct {
+	reportOnly         bool
+	reportTo           string
+	reportingEndpoints string
+
+	sourceOptionTemplate *template.Template
+
+	staticDirectives  map[string]string
+	dynamicDirectives map[string]string
+	// nonceDirectives are the source options of dynamic directives that set NonceBase64Value or Nonces.  they are
+	// re-rendered with the per-request nonce.  hash-only directives do not vary per request.
+	nonceDirectives map[string]CSPSourceOptions
+	// customDirectives are rendered after the known directives, in customOrder
+	customDirectives map[string]string
+	customOrder      []string
+
+	// candidate is the compiled ReportOnlyCandidate, if any
+	candidate *CompiledPolicy
+	// additional are the compiled Additional policies
+	additional []*CompiledPolicy
+
+	warnings []Warning
+}
+
+// Compile does all template parsing, error checking, and static rendering of a Policy.
+func (pol *Policy) Compile() (*CompiledPolicy, error) {
+	err := pol.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := &CompiledPolicy{
+		reportOnly:           pol.ReportOnly,
+		reportTo:             pol.reportToString,
+		reportingEndpoints:   pol.reportingEndpointsString,
+		sourceOptionTemplate: pol.SourceOptionTemplate,
+		staticDirectives:     copyDirectives(pol.cspStaticDirectives),
+		dynamicDirectives:    copyDirectives(pol.cspDynamicDirectives),
+		nonceDirectives:      map[string]CSPSourceOptions{},
+		customDirectives:     copyDirectives(pol.CustomDirectives),
+		customOrder:          sortedCustomDirectives(pol.CustomDirectives),
+		warnings:             append([]Warning(nil), pol.warnings...),
+	}
+
+	for k := range pol.cspDynamicDirectives {
+		cso := pol.sourceOptionsByName(k)
+		if cso != nil && cso.hasNonce() {
+			compiled.nonceDirectives[k] = cso.Clone()
+		}
+	}
+
+	// policies delivered alongside this one, whose reporting configuration is combined with this one's
+	var subs []*Policy
+	if pol.ReportOnlyCandidate != nil {
+		if pol.ReportOnly {
+			return nil, errors.New("a report-only candidate requires the policy itself to be enforced")
+		}
+
+		candidate := *pol.ReportOnlyCandidate
+		candidate.ReportOnly = true
+		candidate.ReportOnlyCandidate = nil
+		compiled.candidate, err = compiled.compileSubPolicy(pol, &candidate, "report-only candidate")
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, &candidate)
+	}
+
+	for i := range pol.Additional {
+		additional := pol.Additional[i]
+		label := fmt.Sprintf("additional policy %d", i)
+		if additional.ReportOnlyCandidate != nil || len(additional.Additional) > 0 {
+			return nil, fmt.Errorf("%s: an additional policy cannot have a report-only candidate or additional policies "+
+				"of its own", label)
+		}
+
+		additionalCompiled, err := compiled.compileSubPolicy(pol, &additional, label)
+		if err != nil {
+			return nil, err
+		}
+		compiled.additional = append(compiled.additional, additionalCompiled)
+		subs = append(subs, &additional)
+	}
+
+	// Reporting-Endpoint names are shared between the policies.  the first policy to name an endpoint wins a
+	// conflict, and this policy wins over all of them.
+	var endpoints map[string]string
+	for i := len(subs) - 1; i >= 0; i-- {
+		if subs[i].reportingEndpointsString == pol.reportingEndpointsString {
+			continue
+		}
+		if endpoints == nil {
+			endpoints = map[string]string{}
+		}
+		for k, v := range subs[i].ReportingEndpoints {
+			endpoints[k] = v
+		}
+	}
+	if endpoints != nil {
+		for k, v := range pol.ReportingEndpoints {
+			endpoints[k] = v
+		}
+		compiled.reportingEndpoints, err = renderReportingEndpoints(endpoints)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pol.compiled = compiled
+	return compiled, nil
+}
+
+// compileSubPolicy compiles sub, a policy delivered alongside pol, adding its warnings and Report-To groups to
+// compiled.  sub may reference a group configured on pol, so takes pol's reporting configuration if it has none.
+func (compiled *CompiledPolicy) compileSubPolicy(pol, sub *Policy, label string) (*CompiledPolicy, error) {
+	if len(sub.ReportTo.ReportTo) == 0 && len(sub.ReportTo.Groups) == 0 {
+		sub.ReportTo = pol.ReportTo
+	}
+	if len(sub.ReportingEndpoints) == 0 {
+		sub.ReportingEndpoints = pol.ReportingEndpoints
+	}
+
+	subCompiled, err := sub.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", label, err)
+	}
+	for _, w := range subCompiled.warnings {
+		w.Message = label + ": " + w.Message
+		compiled.warnings = append(compiled.warnings, w)
+	}
+
+	if sub.reportToString != pol.reportToString && !containsReportTo(compiled.reportTo, sub.reportToString) {
+		compiled.reportTo = joinReportTo(compiled.reportTo, sub.reportToString)
+	}
+	return subCompiled, nil
+}
+
+// MustCompile is like Compile but panics if the Policy cannot be compiled, for policies built at program start.  The
+// panic value is the error Compile would return.
+func (pol *Policy) MustCompile() *CompiledPolicy {
+	compiled, err := pol.Compile()
+	if err != nil {
+		panic(err)
+	}
+	return compiled
+}
+
+// HeaderWithNonce returns the map of headers to set for a single request, reusing the directives rendered by the
+// last Load or Compile and re-rendering only those carrying a nonce, with nonce substituted.
+// Changes made to the Policy after the last Load or Compile are not reflected.
+func (pol *Policy) HeaderWithNonce(nonce string) (map[string]string, error) {
+	if pol.compiled == nil {
+		return nil, ErrNotCompiled
+	}
+	return pol.compiled.Render(nonce)
+}
+
+// StaticDirectives returns a copy of the compiled directives that do not vary per page.
+func (cp *CompiledPolicy) StaticDirectives() map[string]string {
+	return copyDirectives(cp.staticDirectives)
+}
+
+// DynamicDirectives returns a copy of the compiled directives that carry a nonce or hash.
+func (cp *CompiledPolicy) DynamicDirectives() map[string]string {
+	return copyDirectives(cp.dynamicDirectives)
+}
+
+// Render returns the map of headers to set, substituting nonce into each directive that sets NonceBase64Value or
+// Nonces.  The per-request nonce replaces all of the directive's configured nonces.
+// An empty nonce renders the nonces as configured on the Policy.  A header sent for more than one policy, as with
+// Additional policies, is one value joining them with ", "; use Header for a value per policy.
+func (cp *CompiledPolicy) Render(nonce string) (map[string]string, error) {
+	return cp.render(nonce, cp.reportOnly)
+}
+
+// Header is Render returning an http.Header, in which a header sent for more than one policy, such as
+// Content-Security-Policy with Additional policies, has a value per policy rather than one joined value
+func (cp *CompiledPolicy) Header(nonce string) (http.Header, error) {
+	return cp.header(nonce, cp.reportOnly)
+}
+
+// render is Render with the choice of enforcing or report-only header made by the caller.  the values of a header
+// sent more than once are joined with ", ", which browsers read as a list of policies.
+func (cp *CompiledPolicy) render(nonce string, reportOnly bool) (map[string]string, error) {
+	fields, err := cp.headerFields(nonce, reportOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	cspTable := make(map[string]string, len(fields))
+	for _, f := range fields {
+		if v, ok := cspTable[f.name]; ok {
+			cspTable[f.name] = v + ", " + f.value
+			continue
+		}
+		cspTable[f.name] = f.value
+	}
+	return cspTable, nil
+}
+
+// header is Header with the choice of enforcing or report-only header made by the caller
+func (cp *CompiledPolicy) header(nonce string, reportOnly bool) (http.Header, error) {
+	fields, err := cp.headerFields(nonce, reportOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	h := make(http.Header, len(fields))
+	for _, f := range fields {
+		h.Add(f.name, f.value)
+	}
+	return h, nil
+}
+
+// headerField is a single header line
+type headerField struct {
+	name, value string
+}
+
+// headerFields renders the policy's headers in the order they are sent: the policy, the report-only candidate, the
+// additional policies, Report-To, and Reporting-Endpoints.  a header name repeats for each policy sent under it.
+// reportOnly chooses the header of the policy itself; additional policies keep their own.
+func (cp *CompiledPolicy) headerFields(nonce string, reportOnly bool) ([]headerField, error) {
+	resultantCSP, err := cp.directiveString(nil, nonce)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]headerField, 0, 4+len(cp.additional))
+	fields = append(fields, headerField{cspHeaderName(reportOnly), resultantCSP})
+
+	// the candidate is only delivered alongside an enforced policy, where the report-only header is free
+	if cp.candidate != nil && !reportOnly {
+		candidateCSP, err := cp.candidate.directiveString(nil, nonce)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, headerField{HeaderContentSecurityPolicyReportOnly, candidateCSP})
+	}
+
+	for _, additional := range cp.additional {
+		additionalCSP, err := additional.directiveString(nil, nonce)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, headerField{cspHeaderName(additional.reportOnly), additionalCSP})
+	}
+
+	if len(cp.reportTo) > 0 {
+		fields = append(fields, headerField{HeaderReportTo, cp.reportTo})
+	}
+	if len(cp.reportingEndpoints) > 0 {
+		fields = append(fields, headerField{HeaderReportingEndpoints, cp.reportingEndpoints})
+	}
+	return fields, nil
+}
+
+// cspHeaderName returns the header a policy is sent under
+func cspHeaderName(reportOnly bool) string {
+	if reportOnly {
+		return HeaderContentSecurityPolicyReportOnly
+	}
+	return HeaderContentSecurityPolicy
+}
+
+// joinReportTo combines Report-To header values, which are a comma separated list of group objects
+func joinReportTo(values ...string) string {
+	nonEmpty := make([]string, 0, len(values))
+	for _, v := range values {
+		if len(v) > 0 {
+			nonEmpty = append(nonEmpty, v)
+		}
+	}
+	return strings.Join(nonEmpty, ", ")
+}
+
+// containsReportTo reports whether v is one of the Report-To values joined by joinReportTo
+func containsReportTo(joined, v string) bool {
+	return joined == v || strings.HasPrefix(joined, v+", ") || strings.HasSuffix(joined, ", "+v) ||
+		strings.Contains(joined, ", "+v+", ")
+}
+
+// directiveOrder is the order directives are rendered in: default-src first, then the remaining fetch directives
+// alphabetically, followed by document, navigation, reporting, and 'other' directives.
+// a stable order keeps the header byte-identical across calls for the same Policy.
+var directiveOrder = []string{
+	// Fetch directives
+	DirectiveDefaultSrc,
+	DirectiveChildSrc,
+	DirectiveConnectSrc,
+	DirectiveFencedFrameSrc,
+	DirectiveFontSrc,
+	DirectiveFrameSrc,
+	DirectiveImgSrc,
+	DirectiveManifestSrc,
+	DirectiveMediaSrc,
+	DirectiveObjectSrc,
+	DirectivePrefetchSrc,
+	DirectiveScriptSrc,
+	DirectiveScriptSrcAttr,
+	DirectiveScriptSrcElem,
+	DirectiveStyleSrc,
+	DirectiveStyleSrcAttr,
+	DirectiveStyleSrcElem,
+	DirectiveWorkerSrc,
+
+	// Document directives
+	DirectiveBaseURI,
+	DirectiveSandbox,
+
+	// Navigation directives
+	DirectiveFormAction,
+	DirectiveFrameAncestors,
+
+	// Reporting directives
+	DirectiveReportURI,
+	DirectiveReportTo,
+
+	// 'Other' directives
+	DirectiveBlockAllMixedContent,
+	DirectiveUpgradeInsecureRequests,
+}
+
+// directiveString flattens the rendered directives into a header value in directiveOrder, followed by the custom
+// directives, skipping any directive in exclude.  a non-empty nonce re-renders the nonce-bearing directives.
+func (cp *CompiledPolicy) directiveString(exclude map[string]bool, nonce string) (string, error) {
+	var sb strings.Builder
+	err := cp.writeDirectives(&sb, exclude, nonce)
+	if err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// writeDirectives is directiveString writing to w.  the nonce is checked before anything is written, so w only
+// receives partial output if w itself or a custom template fails.
+func (cp *CompiledPolicy) writeDirectives(w io.Writer, exclude map[string]bool, nonce string) error {
+	err := cp.checkNonce(exclude, nonce)
+	if err != nil {
+		return err
+	}
+
+	dw := &directiveWriter{w: w}
+	for _, k := range directiveOrder {
+		if exclude[k] {
+			continue
+		}
+
+		v, ok := cp.staticDirectives[k]
+		if !ok {
+			v = cp.dynamicDirectives[k]
+			cso, isNonce := cp.nonceDirectives[k]
+			if isNonce && len(nonce) > 0 {
+				cso.NonceBase64Value = nonce
+				cso.Nonces = nil
+				v, err = cso.Parse(cp.sourceOptionTemplate)
+				if err != nil {
+					return &DirectiveError{Directive: k, Err: err}
+				}
+			}
+		}
+		// only include keys where there is a value
+		if len(v) == 0 {
+			continue
+		}
+
+		// valueless directives are stored with their own name as the value so that they are not skipped as unset
+		if v == k {
+			v = ""
+		}
+		dw.directive(k, v)
+	}
+
+	for _, k := range cp.customOrder {
+		if exclude[k] {
+			continue
+		}
+		dw.directive(k, strings.TrimSpace(cp.customDirectives[k]))
+	}
+
+	return dw.err
+}
+
+// checkNonce returns the error rendering with nonce would hit: a missing nonce for a policy using
+// NoncePlaceholder, or a nonce with control characters or otherwise not a base64 value.
+func (cp *CompiledPolicy) checkNonce(exclude map[string]bool, nonce string) error {
+	for _, k := range directiveOrder {
+		cso, isNonce := cp.nonceDirectives[k]
+		if !isNonce || exclude[k] {
+			continue
+		}
+		if len(nonce) == 0 && cso.hasNoncePlaceholder() {
+			return &DirectiveError{Directive: k, Err: ErrNonceRequired}
+		}
+		if len(nonce) > 0 {
+			err := validateControlCharacters("nonce", nonce)
+			if err == nil && !isBase64Value(trimNonce(nonce)) {
+				err = fmt.Errorf("nonce %q: %w", nonce, ErrInvalidNonce)
+			}
+			if err != nil {
+				return &DirectiveError{Directive: k, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// directiveWriter writes "name value;" pairs separated by a single space, keeping the first write error
+type directiveWriter struct {
+	w       io.Writer
+	written bool
+	err     error
+}
+
+func (dw *directiveWriter) directive(name, value string) {
+	// we just don't want a trailing space.
+	if dw.written {
+		dw.writeString(" ")
+	}
+	dw.written = true
+	dw.writeString(name)
+	if len(value) > 0 {
+		dw.writeString(" ")
+		dw.writeString(value)
+	}
+	dw.writeString(";")
+}
+
+func (dw *directiveWriter) writeString(s string) {
+	if dw.err != nil {
+		return
+	}
+	_, dw.err = io.WriteString(dw.w, s)
+}
@@ -0,0 +1,475 @@
+package cspheader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// BenchmarkCompiledRenderNonce re-renders only the directives carrying a nonce
+func BenchmarkCompiledRenderNonce(b *testing.B) {
+	pol := noncePolicy()
+	compiled, err := pol.Compile()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := compiled.Render("cmVxdWVzdA")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCompiledRenderStatic renders a policy without nonces from its compiled directives
+func BenchmarkCompiledRenderStatic(b *testing.B) {
+	pol := SecurityOptionsReactJS()
+	compiled, err := pol.Compile()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := compiled.Render("")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoad renders every directive on every call, as a handler calling Load per request would
+func BenchmarkLoad(b *testing.B) {
+	pol := noncePolicy()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := pol.Load()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCompiledRenderMatchesLoad(t *testing.T) {
+	for name, pol := range map[string]Policy{
+		"static": SecurityOptionsReactJS(),
+		"nonce":  noncePolicy(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			loaded := pol.Clone()
+			want, err := loaded.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			compiled, err := pol.Compile()
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			got, err := compiled.Render("")
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Render(\"\") = %v, want Load's %v", got, want)
+			}
+		})
+	}
+}
+
+// noncePolicy is a typical nonce-based policy, with a configured nonce so that Load can render it too
+func noncePolicy() Policy {
+	pol := SecurityOptionsReactJS()
+	pol.CSP.ScriptSrc.NonceBase64Value = "configured"
+	pol.CSP.StyleSrc = CSPSourceOptions{Allow: true, AllowSelf: true, NonceBase64Value: "configured"}
+	return pol
+}
+
+func TestCompiledRenderNonce(t *testing.T) {
+	pol := noncePolicy()
+	compiled, err := pol.Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if got := compiled.DynamicDirectives(); len(got) != 2 || len(got[DirectiveScriptSrc]) == 0 || len(got[DirectiveStyleSrc]) == 0 {
+		t.Errorf("DynamicDirectives() = %v, want script-src and style-src", got)
+	}
+	if _, ok := compiled.StaticDirectives()[DirectiveScriptSrc]; ok {
+		t.Errorf("StaticDirectives() includes script-src, which carries a nonce")
+	}
+
+	for _, nonce := range []string{"first", "second"} {
+		headers, err := compiled.Render(nonce)
+		if err != nil {
+			t.Fatalf("Render(%q) error = %v", nonce, err)
+		}
+		csp := headers[HeaderContentSecurityPolicy]
+		if strings.Count(csp, "'nonce-"+nonce+"'") != 2 || strings.Contains(csp, "configured") {
+			t.Errorf("Render(%q) = %q, want the nonce in script-src and style-src in place of the configured one", nonce, csp)
+		}
+	}
+}
+
+func TestCompiledRenderReplacesAllNonces(t *testing.T) {
+	pol := Policy{}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, NonceBase64Value: "one", Nonces: []string{"two", "three"}}
+	compiled, err := pol.Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		nonce string
+		want  string
+	}{
+		{"", "script-src 'nonce-one' 'nonce-two' 'nonce-three';"},
+		{"request", "script-src 'nonce-request';"},
+	}
+	for _, tt := range tests {
+		headers, err := compiled.Render(tt.nonce)
+		if err != nil {
+			t.Fatalf("Render(%q) error = %v", tt.nonce, err)
+		}
+		if !strings.Contains(headers[HeaderContentSecurityPolicy], tt.want) {
+			t.Errorf("Render(%q) = %q, want %q", tt.nonce, headers[HeaderContentSecurityPolicy], tt.want)
+		}
+	}
+}
+
+func BenchmarkHeaderWithNonce(b *testing.B) {
+	pol := SecurityOptionsStrict()
+	pol.MustCompile()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := pol.HeaderWithNonce("cmVxdWVzdA")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoadPerRequest sets the request's nonce and calls Load, the alternative to HeaderWithNonce
+func BenchmarkLoadPerRequest(b *testing.B) {
+	pol := SecurityOptionsStrict()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pol.CSP.ScriptSrc.NonceBase64Value = "cmVxdWVzdA"
+		_, err := pol.Load()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestHeaderWithNonce(t *testing.T) {
+	pol := SecurityOptionsStrict()
+	_, err := pol.HeaderWithNonce("abc123")
+	if !errors.Is(err, ErrNotCompiled) {
+		t.Errorf("HeaderWithNonce() before Compile error = %v, want %v", err, ErrNotCompiled)
+	}
+
+	pol.MustCompile()
+	headers, err := pol.HeaderWithNonce("abc123")
+	if err != nil {
+		t.Fatalf("HeaderWithNonce() error = %v", err)
+	}
+	if !strings.Contains(headers[HeaderContentSecurityPolicy], "'nonce-abc123'") {
+		t.Errorf("HeaderWithNonce() = %q, want the nonce", headers[HeaderContentSecurityPolicy])
+	}
+
+	// changes after Compile are not reflected until the next Compile
+	pol.CSP.ScriptSrc.Values = append(pol.CSP.ScriptSrc.Values, "https://cdn.example.com")
+	headers, err = pol.HeaderWithNonce("abc123")
+	if err != nil {
+		t.Fatalf("HeaderWithNonce() error = %v", err)
+	}
+	if strings.Contains(headers[HeaderContentSecurityPolicy], "cdn.example.com") {
+		t.Errorf("HeaderWithNonce() = %q, want the policy as compiled", headers[HeaderContentSecurityPolicy])
+	}
+}
+
+func TestCompileReportOnlyCandidate(t *testing.T) {
+	const (
+		enforcedGroup  = `{"group":"enforced","max_age":3600,"endpoints":[{"url":"https://r.example.com/enforced"}]}`
+		candidateGroup = `{"group":"candidate","max_age":3600,"endpoints":[{"url":"https://r.example.com/candidate"}]}`
+	)
+	// enforced allows script from 'self' and reports to its own group
+	enforced := func() Policy {
+		var pol Policy
+		pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+		pol.CSP.ReportTo = UnquotedOption{Value: "enforced"}
+		pol.ReportTo.ReportTo = enforcedGroup
+		return pol
+	}
+	// candidate trials dropping script-src 'self' for a nonce
+	candidate := func() *Policy {
+		var pol Policy
+		pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj"}
+		pol.CSP.ReportURI = UnquotedOptions{Values: []string{"/csp"}}
+		return &pol
+	}
+
+	tests := []struct {
+		name           string
+		policy         func() Policy
+		wantCSP        string
+		wantReportOnly string
+		wantReportTo   string
+		wantErr        string
+	}{
+		{
+			name: "both headers",
+			policy: func() Policy {
+				pol := enforced()
+				pol.ReportOnlyCandidate = candidate()
+				return pol
+			},
+			wantCSP: "default-src 'none'; script-src 'self'; base-uri 'none'; form-action 'none'; " +
+				"frame-ancestors 'none'; report-to enforced;",
+			wantReportOnly: "default-src 'none'; script-src 'nonce-YWJj'; base-uri 'none'; form-action 'none'; " +
+				"frame-ancestors 'none'; report-uri /csp;",
+			wantReportTo: enforcedGroup,
+		},
+		{
+			name: "candidate reporting to the policy's group",
+			policy: func() Policy {
+				pol := enforced()
+				pol.ReportOnlyCandidate = candidate()
+				pol.ReportOnlyCandidate.CSP.ReportURI = UnquotedOptions{}
+				pol.ReportOnlyCandidate.CSP.ReportTo = UnquotedOption{Value: "enforced"}
+				return pol
+			},
+			wantCSP: "default-src 'none'; script-src 'self'; base-uri 'none'; form-action 'none'; " +
+				"frame-ancestors 'none'; report-to enforced;",
+			wantReportOnly: "default-src 'none'; script-src 'nonce-YWJj'; base-uri 'none'; form-action 'none'; " +
+				"frame-ancestors 'none'; report-to enforced;",
+			wantReportTo: enforcedGroup,
+		},
+		{
+			name: "candidate's own group joined into Report-To",
+			policy: func() Policy {
+				pol := enforced()
+				pol.ReportOnlyCandidate = candidate()
+				pol.ReportOnlyCandidate.CSP.ReportURI = UnquotedOptions{}
+				pol.ReportOnlyCandidate.CSP.ReportTo = UnquotedOption{Value: "candidate"}
+				pol.ReportOnlyCandidate.ReportTo.ReportTo = candidateGroup
+				return pol
+			},
+			wantCSP: "default-src 'none'; script-src 'self'; base-uri 'none'; form-action 'none'; " +
+				"frame-ancestors 'none'; report-to enforced;",
+			wantReportOnly: "default-src 'none'; script-src 'nonce-YWJj'; base-uri 'none'; form-action 'none'; " +
+				"frame-ancestors 'none'; report-to candidate;",
+			wantReportTo: enforcedGroup + ", " + candidateGroup,
+		},
+		{
+			name: "candidate without a reporting directive",
+			policy: func() Policy {
+				pol := enforced()
+				pol.ReportOnlyCandidate = candidate()
+				pol.ReportOnlyCandidate.CSP.ReportURI = UnquotedOptions{}
+				return pol
+			},
+			wantErr: "report-only candidate: report-only policies require report-uri or report-to to be set",
+		},
+		{
+			name: "policy itself report-only",
+			policy: func() Policy {
+				pol := enforced()
+				pol.ReportOnly = true
+				pol.ReportOnlyCandidate = candidate()
+				return pol
+			},
+			wantErr: "a report-only candidate requires the policy itself to be enforced",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := tt.policy()
+			compiled, err := pol.Compile()
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Compile() error = %v, want %q", err, tt.wantErr)
+				}
+				if _, err := pol.Load(); err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			want := map[string]string{
+				HeaderContentSecurityPolicy:           tt.wantCSP,
+				HeaderContentSecurityPolicyReportOnly: tt.wantReportOnly,
+				HeaderReportTo:                        tt.wantReportTo,
+			}
+			rendered, err := compiled.Render("")
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			loaded, err := pol.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			for name, headers := range map[string]map[string]string{"Render": rendered, "Load": loaded} {
+				if !reflect.DeepEqual(headers, want) {
+					t.Errorf("%s() = %v, want %v", name, headers, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  func() Policy
+		wantErr error
+	}{
+		{
+			name: "unquoted keyword",
+			policy: func() Policy {
+				pol := Policy{}
+				pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, Values: []string{"self"}}
+				return pol
+			},
+			wantErr: ErrUnquotedKeyword,
+		},
+		{
+			name: "invalid source value",
+			policy: func() Policy {
+				pol := Policy{}
+				pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, Values: []string{"a.example.com; object-src *"}}
+				return pol
+			},
+			wantErr: ErrInvalidSourceValue,
+		},
+		{
+			name: "header too large",
+			policy: func() Policy {
+				pol := Policy{MaxHeaderBytes: 32}
+				pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, Values: []string{"https://a-long-host-name.example.com"}}
+				return pol
+			},
+			wantErr: ErrHeaderTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := tt.policy()
+			_, err := pol.Compile()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Compile() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMustCompile(t *testing.T) {
+	pol := SecurityOptionsStaticSite()
+	if pol.MustCompile() == nil {
+		t.Fatalf("MustCompile() = nil")
+	}
+
+	invalid := SecurityOptionsStaticSite()
+	invalid.CSP.ScriptSrc.NonceBase64Value = "abc; def"
+	v := mustPanic(func() { invalid.MustCompile() })
+	if err, ok := v.(error); !ok || !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("MustCompile() panicked with %v, want %v", v, ErrInvalidNonce)
+	}
+}
+
+// TestCompiledPolicyConcurrentUse renders a shared CompiledPolicy from many goroutines, each with its own nonce,
+// and compares every output with the one rendered before the goroutines started.  Run it with -race.
+func TestCompiledPolicyConcurrentUse(t *testing.T) {
+	pol := layeredWriterPolicy()
+	pol.CSP.ScriptSrc.NonceBase64Value = NoncePlaceholder
+	compiled, err := pol.Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	pol.MustCompile()
+
+	const goroutines, iterations = 16, 50
+	nonce := func(g int) string { return fmt.Sprintf("bm9uY2U%d", g) }
+	type expected struct {
+		render map[string]string
+		block  string
+	}
+	want := make([]expected, goroutines)
+	for g := range want {
+		want[g].render, err = compiled.Render(nonce(g))
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		var buf bytes.Buffer
+		err = compiled.RenderHeaderBlock(&buf, nonce(g))
+		if err != nil {
+			t.Fatalf("RenderHeaderBlock() error = %v", err)
+		}
+		want[g].block = buf.String()
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			errs <- func() error {
+				var buf bytes.Buffer
+				for i := 0; i < iterations; i++ {
+					got, err := compiled.Render(nonce(g))
+					if err != nil {
+						return err
+					}
+					if !reflect.DeepEqual(got, want[g].render) {
+						return fmt.Errorf("Render(%q) = %v, want %v", nonce(g), got, want[g].render)
+					}
+
+					h, err := compiled.Header(nonce(g))
+					if err != nil {
+						return err
+					}
+					if got := strings.Join(h.Values(HeaderContentSecurityPolicy), ", "); got != want[g].render[HeaderContentSecurityPolicy] {
+						return fmt.Errorf("Header(%q) = %q, want %q", nonce(g), got, want[g].render[HeaderContentSecurityPolicy])
+					}
+
+					buf.Reset()
+					err = compiled.RenderHeaderBlock(&buf, nonce(g))
+					if err != nil {
+						return err
+					}
+					if buf.String() != want[g].block {
+						return fmt.Errorf("RenderHeaderBlock(%q) wrote %q, want %q", nonce(g), buf.String(), want[g].block)
+					}
+
+					got, err = pol.HeaderWithNonce(nonce(g))
+					if err != nil {
+						return err
+					}
+					if !reflect.DeepEqual(got, want[g].render) {
+						return fmt.Errorf("HeaderWithNonce(%q) = %v, want %v", nonce(g), got, want[g].render)
+					}
+				}
+				return nil
+			}()
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -31,92 +31,250 @@ Resources:
 - https://report-uri.com/home/generate
 */
 
+// Header keys returned by Load
+const (
+	HeaderContentSecurityPolicy           = "Content-Security-Policy"
+	HeaderContentSecurityPolicyReportOnly = "Content-Security-Policy-Report-Only"
+	HeaderReportTo                        = "Report-To"
+	HeaderReportingEndpoints              = "Reporting-Endpoints"
+)
+
 // Policy is a list of the directives that make up our CSP.
 type Policy struct {
-	SourceOptionTemplateText string
-	SourceOptionTemplate     *template.Template
-
-	SandboxOptionTemplateText string
-	SandboxOptionTemplate     *template.Template
-
-	FrameAncestorOptionsTemplateText string
-	FrameAncestorOptionsTemplate     *template.Template
-
-	UnquotedOptionsTextTemplateText string
-	UnquotedOptionsTemplate         *template.Template
-
-	UnquotedOptionTextTemplateText string
-	UnquotedOptionTemplate         *template.Template
-
-	// parsed csp and report-to are stored separately for future usage
-	// in per-page generation without having to parse an entire CSP
-	cspString      string
-	reportToString string
-
+	// ReportOnly renders the policy under Content-Security-Policy-Report-Only instead of Content-Security-Policy.
+	// violations are reported but not enforced, which is the usual way to roll out or tune a policy.
+	ReportOnly bool `json:"report-only,omitempty"`
+
+	// ReportOnlyCandidate is an optional second policy delivered as Content-Security-Policy-Report-Only alongside
+	// this (enforced) policy.  This is the usual way to trial a stricter policy while the current one stays in force.
+	// The candidate may use its own report-to group; its Report-To configuration is combined with this policy's.
+	ReportOnlyCandidate *Policy `json:"report-only-candidate,omitempty"`
+
+	// Additional are further policies delivered alongside this one, each as its own Content-Security-Policy header,
+	// or Content-Security-Policy-Report-Only if it is ReportOnly.  This is how a team's policy is layered on top of a
+	// platform's.  Browsers enforce every policy independently, so a load must be allowed by all of them: the
+	// effective policy is their intersection, and an additional policy can only tighten this one, never loosen it.
+	// Like the candidate, an additional policy may use this policy's Report-To group, and its own Report-To
+	// configuration is combined with this policy's.
+	//
+	// Load and Render return a map, so a header sent for more than one policy is a single value joining them with
+	// ", ", which browsers read as a list of policies.  LoadHeaders, Apply, and the middleware send each as its own
+	// header line.
+	Additional []Policy `json:"additional,omitempty"`
+
+	// OmitDeprecatedDirectives drops directives that browsers no longer implement from the rendered header:
+	// prefetch-src, and report-uri when report-to is set.  Note that Firefox still only reports via report-uri.
+	OmitDeprecatedDirectives bool `json:"omit-deprecated-directives,omitempty"`
+
+	// Strict makes Load and Compile fail on contradictory source options that are otherwise silently ignored by the
+	// template or by browsers.  See ErrContradictorySourceOptions.
+	Strict bool `json:"strict,omitempty"`
+
+	// QuoteKeywordValues single-quotes keyword sources given unquoted in Values (self becomes 'self').  Otherwise
+	// Load and Compile fail with ErrUnquotedKeyword, as an unquoted keyword is read by browsers as a host name.
+	// Values that are already quoted are unaffected either way.
+	QuoteKeywordValues bool `json:"quote-keyword-values,omitempty"`
+
+	// NormalizeIDN converts internationalized host names in source values, frame-ancestors, and report endpoints to
+	// their ASCII (punycode) form, which is the only form browsers match.  Load and Compile assign the converted
+	// values back to the Policy.
+	NormalizeIDN bool `json:"normalize-idn,omitempty"`
+
+	// KeepRedundantDirectives keeps fetch directives whose value is identical to default-src, which are otherwise
+	// dropped from the header as browsers fall back to default-src anyway.  Note that this includes every fetch
+	// directive left at its zero value, which renders 'none', unless OmitZeroDirectives is set.
+	KeepRedundantDirectives bool `json:"keep-redundant-directives,omitempty"`
+
+	// OmitZeroDirectives treats fetch directives left at their zero value as Unset, so that they are left out of the
+	// header and browsers apply their fallback (usually to default-src).  Without it, a zero valued directive renders
+	// 'none'.  With it, 'none' is written explicitly as CSPSourceOptions{Allow: true, Values: []string{SourceNone}}.
+	// default-src, base-uri, and form-action, which have no fallback, are unaffected.
+	OmitZeroDirectives bool `json:"omit-zero-directives,omitempty"`
+
+	// MaxHeaderBytes limits the size of the rendered Content-Security-Policy header value, as some CDNs and proxies
+	// reject or truncate large headers.  Unset, a header over DefaultMaxHeaderBytes is reported as a
+	// WarnHeaderTooLarge warning; set, a header over MaxHeaderBytes fails Load and Compile with ErrHeaderTooLarge.
+	// A negative value disables the check.
+	MaxHeaderBytes int `json:"max-header-bytes,omitempty"`
+
+	// The *Template fields are parsed by Load from the TemplateText fields.  Templates for the default texts are
+	// parsed once and shared between policies, so must not be modified.
+	SourceOptionTemplateText string             `json:"source-option-template-text,omitempty"`
+	SourceOptionTemplate     *template.Template `json:"-"`
+
+	SandboxOptionTemplateText string             `json:"sandbox-option-template-text,omitempty"`
+	SandboxOptionTemplate     *template.Template `json:"-"`
+
+	FrameAncestorOptionsTemplateText string             `json:"frame-ancestor-options-template-text,omitempty"`
+	FrameAncestorOptionsTemplate     *template.Template `json:"-"`
+
+	UnquotedOptionsTextTemplateText string             `json:"unquoted-options-template-text,omitempty"`
+	UnquotedOptionsTemplate         *template.Template `json:"-"`
+
+	UnquotedOptionTextTemplateText string             `json:"unquoted-option-template-text,omitempty"`
+	UnquotedOptionTemplate         *template.Template `json:"-"`
+
+	// TemplateFuncs are made available to every template parsed by Load, e.g. for a custom SourceOptionTemplateText.
+	// Names must not shadow the text/template builtins such as len or print.
+	TemplateFuncs template.FuncMap `json:"-"`
+
+	// the parsed directives of the last Load/Compile.  static and dynamic directives are stored separately
+	// for usage in per-page generation without having to parse an entire CSP
 	cspStaticDirectives map[string]string
 	// cspDynamicDirectives is for per-page
 	cspDynamicDirectives map[string]string
+	// reportToString and reportingEndpointsString are the rendered Report-To and Reporting-Endpoints headers
+	reportToString           string
+	reportingEndpointsString string
+	compiled                 *CompiledPolicy
+	// warnings are the non-fatal findings of the last Load/Compile
+	warnings []Warning
 
 	CSP struct {
 		// Fetch directives
 
 		// DefaultSrc is used when a fetch directive is absent
 		// note that 'self' includes the scheme (e.g. https://)
-		DefaultSrc CSPSourceOptions
+		DefaultSrc CSPSourceOptions `json:"default-src"`
 
 		// ChildSrc controls web workers and embedded frames, such as
 		// embedding videos from other domains
-		ChildSrc    CSPSourceOptions
-		ConnectSrc  CSPSourceOptions
-		FontSrc     CSPSourceOptions
-		FrameSrc    CSPSourceOptions
-		ImgSrc      CSPSourceOptions
-		ManifestSrc CSPSourceOptions
-		MediaSrc    CSPSourceOptions
-		ObjectSrc   CSPSourceOptions
-		PrefetchSrc CSPSourceOptions
+		ChildSrc    CSPSourceOptions `json:"child-src"`
+		ConnectSrc  CSPSourceOptions `json:"connect-src"`
+		FontSrc     CSPSourceOptions `json:"font-src"`
+		FrameSrc    CSPSourceOptions `json:"frame-src"`
+		ImgSrc      CSPSourceOptions `json:"img-src"`
+		ManifestSrc CSPSourceOptions `json:"manifest-src"`
+		MediaSrc    CSPSourceOptions `json:"media-src"`
+		ObjectSrc   CSPSourceOptions `json:"object-src"`
+		PrefetchSrc CSPSourceOptions `json:"prefetch-src"`
 		// ScriptSrc is likely of specific interest
 		// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Security-Policy/script-src#examples
-		ScriptSrc     CSPSourceOptions
-		ScriptSrcElem CSPSourceOptions
-		ScriptSrcAttr CSPSourceOptions
-		StyleSrc      CSPSourceOptions
-		StyleSrcElem  CSPSourceOptions
-		StyleSrcAttr  CSPSourceOptions
-		WorkerSrc     CSPSourceOptions
+		ScriptSrc     CSPSourceOptions `json:"script-src"`
+		ScriptSrcElem CSPSourceOptions `json:"script-src-elem"`
+		ScriptSrcAttr CSPSourceOptions `json:"script-src-attr"`
+		StyleSrc      CSPSourceOptions `json:"style-src"`
+		StyleSrcElem  CSPSourceOptions `json:"style-src-elem"`
+		StyleSrcAttr  CSPSourceOptions `json:"style-src-attr"`
+		WorkerSrc     CSPSourceOptions `json:"worker-src"`
+		// FencedFrameSrc controls <fencedframe> (Chrome's Privacy Sandbox ads APIs).  only https: scheme sources and
+		// https URLs are meaningful; fenced frames are always cross-origin, so 'self' and 'unsafe-inline' do nothing.
+		FencedFrameSrc CSPSourceOptions `json:"fenced-frame-src"`
 
 		// Document directives
-		BaseURI CSPSourceOptions
-		Sandbox SandboxOptions
+		BaseURI CSPSourceOptions `json:"base-uri"`
+		Sandbox SandboxOptions   `json:"sandbox"`
 
 		// Navigation directives
-		FormAction     CSPSourceOptions
-		FrameAncestors FrameAncestorOptions
+		FormAction     CSPSourceOptions     `json:"form-action"`
+		FrameAncestors FrameAncestorOptions `json:"frame-ancestors"`
 		// NavigateTo (CSPSourceOptions) is experimental and doesn't look like it will be supported, so don't bother
 
 		// Reporting directives
 		// ReportURI is deprecated, but still required for firefox
-		ReportURI UnquotedOptions
+		ReportURI UnquotedOptions `json:"report-uri"`
 		// ReportTo is the more modern reporting option for SecurityPolicyViolationEvent: https://w3c.github.io/reporting/
 		// it requires and references a ReportTo keyed header value
-		ReportTo UnquotedOption
+		ReportTo UnquotedOption `json:"report-to"`
 
 		// 'Other' directives
-		UpgradeInsecureRequests bool
-	}
+		UpgradeInsecureRequests bool `json:"upgrade-insecure-requests,omitempty"`
+		// BlockAllMixedContent is deprecated in favor of UpgradeInsecureRequests, but is still honored by older browsers
+		// that don't support it
+		BlockAllMixedContent bool `json:"block-all-mixed-content,omitempty"`
+	} `json:"csp"`
+
+	// CustomDirectives are rendered verbatim after the known directives, keyed by name, for directives this package
+	// does not support yet.  An empty value renders the name alone.  A custom directive replaces a known directive of
+	// the same name, with a WarnOverriddenDirective warning.
+	CustomDirectives map[string]string `json:"custom-directives,omitempty"`
 
 	// ReportTo are sent at the browser's leisure; reports may not be sent immediately
 	ReportTo struct {
-		// Report-To is the configuration for report-to in the Content-Security-Policy header (604800 is a week)
+		// Groups is the typed configuration for the Report-To header, marshaled to a comma separated list of JSON
+		// objects by Load.  e.g. separate groups for CSP violations and for NEL.
+		Groups []ReportToGroup `json:"groups,omitempty"`
+
+		// Report-To is the raw configuration for report-to in the Content-Security-Policy header (604800 is a week)
+		// if set, it overrides Groups.
 		// example: Report-To: {"group": "catchAll-endpoint", "max-age": 604800, "endpoints: [ {"url": "https://localhost.localdomain/csp-reports"} ]}
-		ReportTo string
-	}
+		ReportTo string `json:"raw,omitempty"`
+	} `json:"report-to"`
+
+	// ReportingEndpoints maps endpoint names to URLs for the Reporting-Endpoints header, which has replaced Report-To
+	// in Chrome.  The CSP report-to directive resolves against either header, and both may be set during the transition.
+	// example: Reporting-Endpoints: default="https://localhost.localdomain/csp-reports"
+	ReportingEndpoints map[string]string `json:"reporting-endpoints,omitempty"`
+
+	// AllowInsecureReportEndpoints permits plain http report endpoints, e.g. for local development.  reports include
+	// page URLs, so they should not otherwise be sent over cleartext.
+	AllowInsecureReportEndpoints bool `json:"allow-insecure-report-endpoints,omitempty"`
+
+	// SelfOrigin is the origin of the pages the policy protects, e.g. https://example.com, against which Allows
+	// matches 'self' and resolves relative URLs.  It does not affect the rendered header.
+	SelfOrigin string `json:"self-origin,omitempty"`
 }
 
 // Load parses, roughly error-checks, and converts a Policy object into a map of headers that can be set
 // CSP steps across a single header key boundary when using 'report-to'
-func (pol Policy) Load() (map[string]string, error) {
+// The parsed directives are retained on the Policy and can be inspected with StaticDirectives and DynamicDirectives.
+// Non-fatal findings are discarded; use LoadWithWarnings to see them.
+func (pol *Policy) Load() (map[string]string, error) {
+	headers, _, err := pol.LoadWithWarnings()
+	return headers, err
+}
+
+// MustLoad is like Load but panics if the Policy cannot be loaded, for policies built at program start.  The panic
+// value is the error Load would return.
+func (pol *Policy) MustLoad() map[string]string {
+	headers, err := pol.Load()
+	if err != nil {
+		panic(err)
+	}
+	return headers
+}
+
+// String returns the Content-Security-Policy header value, for logging, tests, and proxy configuration.  It reuses
+// the directives rendered by the last Load or Compile, compiling the Policy first if it has not been; as with
+// HeaderWithNonce, changes made to the Policy afterwards are not reflected.  A Policy that fails to render returns
+// "<invalid csp: err>" rather than an empty string.
+func (pol *Policy) String() string {
+	var sb strings.Builder
+	err := pol.Render(&sb)
+	if err != nil {
+		return fmt.Sprintf("<invalid csp: %v>", err)
+	}
+	return sb.String()
+}
+
+// StaticDirectives returns a copy of the directives rendered by the last Load or Compile that do not vary per page.
+// It returns nil if the Policy has not been loaded.
+func (pol *Policy) StaticDirectives() map[string]string {
+	return copyDirectives(pol.cspStaticDirectives)
+}
+
+// DynamicDirectives returns a copy of the directives rendered by the last Load or Compile that carry a nonce or
+// hash and so are unique per page load.  It returns nil if the Policy has not been loaded.
+func (pol *Policy) DynamicDirectives() map[string]string {
+	return copyDirectives(pol.cspDynamicDirectives)
+}
+
+func copyDirectives(directives map[string]string) map[string]string {
+	if directives == nil {
+		return nil
+	}
+	c := make(map[string]string, len(directives))
+	for k, v := range directives {
+		c[k] = v
+	}
+	return c
+}
+
+// parseDirectives parses templates, runs pre-flight checks, and renders each directive into
+// cspStaticDirectives and cspDynamicDirectives
+func (pol *Policy) parseDirectives() error {
 	var err error
+	pol.warnings = nil
 
 	// Default templates
 
@@ -140,46 +298,111 @@ func (pol Policy) Load() (map[string]string, error) {
 		pol.UnquotedOptionTextTemplateText = TemplateTextUnquotedOption
 	}
 
-	// Whether we used our default template texts or not, parse onto a *Template
+	// Whether we used our default template texts or not, parse onto a *Template (default texts reuse a shared parse)
+	err = validateTemplateFuncs(pol.TemplateFuncs)
+	if err != nil {
+		return err
+	}
 
-	pol.SourceOptionTemplate, err = template.New("SourceOption").Parse(pol.SourceOptionTemplateText)
+	pol.SourceOptionTemplate, err = parseTemplate("SourceOption", pol.SourceOptionTemplateText, pol.TemplateFuncs)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	pol.SandboxOptionTemplate, err = template.New("Sandbox").Parse(pol.SandboxOptionTemplateText)
+	pol.SandboxOptionTemplate, err = parseTemplate("Sandbox", pol.SandboxOptionTemplateText, pol.TemplateFuncs)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	pol.FrameAncestorOptionsTemplate, err = template.New("FrameAncestorOptions").Parse(pol.FrameAncestorOptionsTemplateText)
+	pol.FrameAncestorOptionsTemplate, err = parseTemplate("FrameAncestorOptions", pol.FrameAncestorOptionsTemplateText, pol.TemplateFuncs)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	pol.UnquotedOptionsTemplate, err = template.New("UnquotedOptions").Parse(pol.UnquotedOptionsTextTemplateText)
+	pol.UnquotedOptionsTemplate, err = parseTemplate("UnquotedOptions", pol.UnquotedOptionsTextTemplateText, pol.TemplateFuncs)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	pol.UnquotedOptionTemplate, err = template.New("UnquotedOption").Parse(pol.UnquotedOptionTextTemplateText)
+	pol.UnquotedOptionTemplate, err = parseTemplate("UnquotedOption", pol.UnquotedOptionTextTemplateText, pol.TemplateFuncs)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// pre-flight
+	if pol.NormalizeIDN {
+		err = pol.normalizeIDN()
+		if err != nil {
+			return err
+		}
+	}
+	err = pol.validateCustomDirectives()
+	if err != nil {
+		return err
+	}
 
 	// compound checks
-	if len(pol.CSP.ReportTo.Value) != 0 {
-		if len(pol.ReportTo.ReportTo) == 0 {
+	if pol.ReportOnly && len(pol.CSP.ReportURI.Values) == 0 && len(pol.CSP.ReportTo.Value) == 0 {
+		// the browser would silently drop every violation
+		return errors.New("report-only policies require report-uri or report-to to be set")
+	}
+	if pol.ReportOnly && pol.CSP.Sandbox != (SandboxOptions{}) {
+		pol.warn(WarnReportOnlySandbox, "sandbox",
+			"sandbox is ignored in Content-Security-Policy-Report-Only; it will be neither enforced nor reported")
+	}
+
+	// values that would otherwise be rendered verbatim into the header
+	err = validateControlCharacters("ReportTo.ReportTo", pol.ReportTo.ReportTo)
+	if err != nil {
+		return &ReportToError{Err: err}
+	}
+	err = pol.CSP.FrameAncestors.validate("frame-ancestors")
+	if err != nil {
+		return err
+	}
+	err = validateSourceValues("report-uri", pol.CSP.ReportURI.Values)
+	if err != nil {
+		return err
+	}
+	err = validateSourceValues("report-to", []string{pol.CSP.ReportTo.Value})
+	if err != nil {
+		return err
+	}
+
+	pol.reportToString, err = pol.reportToHeader()
+	if err != nil {
+		return &ReportToError{Err: err}
+	}
+
+	pol.reportingEndpointsString, err = renderReportingEndpoints(pol.ReportingEndpoints)
+	if err != nil {
+		return &ReportToError{Err: err}
+	}
+
+	err = pol.validateReportEndpoints()
+	if err != nil {
+		return &ReportToError{Err: err}
+	}
+
+	// a match in Reporting-Endpoints satisfies report-to on its own
+	_, inReportingEndpoints := pol.ReportingEndpoints[pol.CSP.ReportTo.Value]
+	if len(pol.CSP.ReportTo.Value) != 0 && !inReportingEndpoints {
+		if len(pol.reportToString) == 0 {
 			// a strong argument could be made that we do not want check this as a user could be configuring this
 			// external to CSP
-			return nil, errors.New("report-to is required if Content-Security-Policy: report-to <value> is set")
+			return &ReportToError{
+				Group: pol.CSP.ReportTo.Value,
+				Err:   errors.New("report-to or reporting-endpoints is required if Content-Security-Policy: report-to <value> is set"),
+			}
 		}
 
-		// look into pol.ReportTo.ReportTo for a matching csp.report-to
-		if !strings.Contains(pol.ReportTo.ReportTo, pol.CSP.ReportTo.Value) {
-			return nil, errors.New("report-to target not found")
+		// look into the Report-To header for a matching csp.report-to
+		found, err := pol.hasReportToGroup(pol.CSP.ReportTo.Value)
+		if err != nil {
+			return &ReportToError{Group: pol.CSP.ReportTo.Value, Err: err}
+		}
+		if !found {
+			return &ReportToError{Group: pol.CSP.ReportTo.Value, Err: ErrReportToGroupNotFound}
 		}
 	}
 
@@ -190,22 +413,23 @@ func (pol Policy) Load() (map[string]string, error) {
 	// default-src is handled explicitly outside of a loop
 	sourceOptFetchDirectives := map[string]CSPSourceOptions{
 		// Fetch directives
-		"child-src":       pol.CSP.ChildSrc,
-		"connect-src":     pol.CSP.ConnectSrc,
-		"font-src":        pol.CSP.FontSrc,
-		"frame-src":       pol.CSP.FrameSrc,
-		"img-src":         pol.CSP.ImgSrc,
-		"manifest-src":    pol.CSP.ManifestSrc,
-		"media-src":       pol.CSP.MediaSrc,
-		"object-src":      pol.CSP.ObjectSrc,
-		"prefetch-src":    pol.CSP.PrefetchSrc,
-		"script-src":      pol.CSP.ScriptSrc,
-		"script-src-elem": pol.CSP.ScriptSrcElem,
-		"script-src-attr": pol.CSP.ScriptSrcAttr,
-		"style-src":       pol.CSP.StyleSrc,
-		"style-src-elem":  pol.CSP.StyleSrcElem,
-		"style-src-attr":  pol.CSP.StyleSrcAttr,
-		"worker-src":      pol.CSP.WorkerSrc,
+		"child-src":        pol.CSP.ChildSrc,
+		"connect-src":      pol.CSP.ConnectSrc,
+		"font-src":         pol.CSP.FontSrc,
+		"frame-src":        pol.CSP.FrameSrc,
+		"img-src":          pol.CSP.ImgSrc,
+		"manifest-src":     pol.CSP.ManifestSrc,
+		"media-src":        pol.CSP.MediaSrc,
+		"object-src":       pol.CSP.ObjectSrc,
+		"prefetch-src":     pol.CSP.PrefetchSrc,
+		"script-src":       pol.CSP.ScriptSrc,
+		"script-src-elem":  pol.CSP.ScriptSrcElem,
+		"script-src-attr":  pol.CSP.ScriptSrcAttr,
+		"style-src":        pol.CSP.StyleSrc,
+		"style-src-elem":   pol.CSP.StyleSrcElem,
+		"style-src-attr":   pol.CSP.StyleSrcAttr,
+		"worker-src":       pol.CSP.WorkerSrc,
+		"fenced-frame-src": pol.CSP.FencedFrameSrc,
 	}
 	sourceOptNonFetchDirectives := map[string]CSPSourceOptions{
 		// Document directives
@@ -215,9 +439,52 @@ func (pol Policy) Load() (map[string]string, error) {
 		"form-action": pol.CSP.FormAction,
 	}
 
-	pol.cspStaticDirectives["default-src"], err = pol.CSP.DefaultSrc.Parse(pol.SourceOptionTemplate)
-	if err != nil {
-		return nil, err
+	// unset directives are left out of the header entirely
+	for k, v := range sourceOptFetchDirectives {
+		if v.Unset || (pol.OmitZeroDirectives && v.isZero()) {
+			delete(sourceOptFetchDirectives, k)
+		}
+	}
+	for k, v := range sourceOptNonFetchDirectives {
+		if v.Unset {
+			delete(sourceOptNonFetchDirectives, k)
+		}
+	}
+
+	// an unset default-src leaves every fetch directive that isn't set unrestricted
+	sourceOptDefaultDirective := map[string]CSPSourceOptions{}
+	if !pol.CSP.DefaultSrc.Unset {
+		sourceOptDefaultDirective["default-src"] = pol.CSP.DefaultSrc
+	}
+
+	// validate source options before rendering anything
+	for _, directives := range []map[string]CSPSourceOptions{sourceOptDefaultDirective, sourceOptFetchDirectives, sourceOptNonFetchDirectives} {
+		for k, v := range directives {
+			err = v.validate(k)
+			if err != nil {
+				return err
+			}
+			if pol.Strict {
+				err = v.validateStrict(k)
+				if err != nil {
+					return err
+				}
+			}
+			if !pol.QuoteKeywordValues {
+				err = v.validateKeywordValues(k)
+				if err != nil {
+					return err
+				}
+			}
+			pol.warnSourceOptions(k, v)
+		}
+	}
+
+	if !pol.CSP.DefaultSrc.Unset {
+		pol.cspStaticDirectives["default-src"], err = pol.CSP.DefaultSrc.Parse(pol.SourceOptionTemplate)
+		if err != nil {
+			return &DirectiveError{Directive: "default-src", Err: err}
+		}
 	}
 
 	// range over our fetch directives and remove any settings that match our default exactly.
@@ -226,17 +493,22 @@ func (pol Policy) Load() (map[string]string, error) {
 
 		policyDirectiveText, err := v.Parse(pol.SourceOptionTemplate)
 		if err != nil {
-			return nil, err
+			return &DirectiveError{Directive: k, Err: err}
 		}
 		// if the policy would be redundant...
-		if pol.cspStaticDirectives["default-src"] == policyDirectiveText {
+		defaultSrc, hasDefaultSrc := pol.cspStaticDirectives["default-src"]
+		if !pol.KeepRedundantDirectives && hasDefaultSrc && defaultSrc == policyDirectiveText {
+			// directives left at their zero value are expected to be dropped
+			if !v.isZero() {
+				pol.warn(WarnRedundantDirective, k, "dropped as it is identical to default-src; set KeepRedundantDirectives to keep it")
+			}
 			continue
 		}
 
 		// these options are unique per page load or script tag.  set aside for efficient
 		// generation when the user wants to do a per-page load.  this allows for generation of a total
 		// CSP and then swapping out only the string portion that includes hashes or nonces.
-		if len(v.NonceBase64Value) > 0 || len(v.HashAlgorithmBase64Value) > 0 {
+		if v.isDynamic() {
 			pol.cspDynamicDirectives[k] = policyDirectiveText
 			continue
 		}
@@ -247,71 +519,83 @@ func (pol Policy) Load() (map[string]string, error) {
 		// these options are unique per page load or script tag.  set aside for efficient
 		// generation when the user wants to do a per-page load.  this allows for generation of a total
 		// CSP and then swapping out only the string portion that includes hashes or nonces.
-		if len(v.NonceBase64Value) > 0 || len(v.HashAlgorithmBase64Value) > 0 {
+		if v.isDynamic() {
 			pol.cspDynamicDirectives[k], err = v.Parse(pol.SourceOptionTemplate)
 			if err != nil {
-				return nil, err
+				return &DirectiveError{Directive: k, Err: err}
 			}
 			continue
 		}
 		pol.cspStaticDirectives[k], err = v.Parse(pol.SourceOptionTemplate)
 		if err != nil {
-			return nil, err
+			return &DirectiveError{Directive: k, Err: err}
 		}
 	}
 
 	// Document directives
+	if pol.CSP.Sandbox.AllowDownloadsWithoutUserActivation {
+		pol.warn(WarnBrowserCompat, "sandbox", "allow-downloads-without-user-activation is not supported by every browser")
+	}
+	if pol.CSP.Sandbox.AllowStorageAccessByUserActivation {
+		pol.warn(WarnBrowserCompat, "sandbox", "allow-storage-access-by-user-activation is not supported by every browser")
+	}
 	pol.cspStaticDirectives["sandbox"], err = pol.CSP.Sandbox.Parse(pol.SandboxOptionTemplate)
 	if err != nil {
-		return nil, err
+		return &DirectiveError{Directive: "sandbox", Err: err}
+	}
+	if pol.CSP.Sandbox.Enabled && len(pol.cspStaticDirectives["sandbox"]) == 0 {
+		pol.cspStaticDirectives["sandbox"] = "sandbox"
 	}
 
 	// Navigation directives
-	pol.cspStaticDirectives["frame-ancestors"], err = pol.CSP.FrameAncestors.Parse(pol.FrameAncestorOptionsTemplate)
-	if err != nil {
-		return nil, err
+	pol.cspStaticDirectives["frame-ancestors"] = ""
+	if !pol.CSP.FrameAncestors.Unset {
+		pol.cspStaticDirectives["frame-ancestors"], err = pol.CSP.FrameAncestors.Parse(pol.FrameAncestorOptionsTemplate)
+		if err != nil {
+			return &DirectiveError{Directive: "frame-ancestors", Err: err}
+		}
 	}
 
 	//Reporting directives
 	pol.cspStaticDirectives["report-uri"], err = pol.CSP.ReportURI.Parse(pol.UnquotedOptionsTemplate)
 	if err != nil {
-		return nil, err
+		return &DirectiveError{Directive: "report-uri", Err: err}
 	}
 
 	pol.cspStaticDirectives["report-to"], err = pol.CSP.ReportTo.Parse(pol.UnquotedOptionTemplate)
 	if err != nil {
-		return nil, err
+		return &DirectiveError{Directive: "report-to", Err: err}
 	}
 
 	//
 	// 'Other' directives
+	// valueless directives are marked present with their own name
 	pol.cspStaticDirectives["upgrade-insecure-requests"] = ""
 	if pol.CSP.UpgradeInsecureRequests {
 		pol.cspStaticDirectives["upgrade-insecure-requests"] = "upgrade-insecure-requests"
 	}
-
-	// probably a way to do this without this allocation.  we just don't want a trailing space.
-	activeCSPs := make([]string, 0)
-	// flatten out static and dynamic directives into resultantCSP.  only include keys where there is a value.
-	for k, v := range pol.cspStaticDirectives {
-		if len(v) == 0 {
-			continue
+	pol.cspStaticDirectives["block-all-mixed-content"] = ""
+	if pol.CSP.BlockAllMixedContent {
+		pol.cspStaticDirectives["block-all-mixed-content"] = "block-all-mixed-content"
+		if pol.CSP.UpgradeInsecureRequests {
+			pol.warn(WarnSupersededDirective, "block-all-mixed-content",
+				"upgrade-insecure-requests supersedes block-all-mixed-content in browsers that support both")
 		}
-		activeCSPs = append(activeCSPs, fmt.Sprintf("%s %s;", k, v))
 	}
-	for k, v := range pol.cspDynamicDirectives {
-		if len(v) == 0 {
-			continue
+
+	if prefetch, ok := sourceOptFetchDirectives["prefetch-src"]; ok && !prefetch.isZero() {
+		pol.warn(WarnDeprecatedDirective, "prefetch-src",
+			"prefetch-src was removed from the spec and is no longer implemented by browsers; rely on default-src instead")
+	}
+	if pol.OmitDeprecatedDirectives {
+		delete(pol.cspStaticDirectives, "prefetch-src")
+		delete(pol.cspDynamicDirectives, "prefetch-src")
+		if len(pol.CSP.ReportTo.Value) > 0 {
+			delete(pol.cspStaticDirectives, "report-uri")
 		}
-		activeCSPs = append(activeCSPs, fmt.Sprintf("%s %s;", k, v))
 	}
-	resultantCSP := strings.Join(activeCSPs, " ")
 
-	cspTable := make(map[string]string, 0)
-	cspTable["Content-Security-Policy"] = resultantCSP
-	if len(pol.ReportTo.ReportTo) > 0 {
-		cspTable["Report-To"] = pol.ReportTo.ReportTo
-	}
+	pol.overrideDirectives()
 
-	return cspTable, nil
+	return pol.checkHeaderSize()
 }
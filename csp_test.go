@@ -0,0 +1,435 @@
+package cspheader
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReportOnly(t *testing.T) {
+	for _, reportOnly := range []bool{false, true} {
+		pol := SecurityOptionsReactJS()
+		pol.ReportOnly = reportOnly
+		headers, err := pol.Load()
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+
+		want, other := HeaderContentSecurityPolicy, HeaderContentSecurityPolicyReportOnly
+		if reportOnly {
+			want, other = other, want
+		}
+		if len(headers[want]) == 0 {
+			t.Errorf("ReportOnly %v: Load() = %v, want %s", reportOnly, headers, want)
+		}
+		if _, ok := headers[other]; ok {
+			t.Errorf("ReportOnly %v: Load() = %v, want no %s", reportOnly, headers, other)
+		}
+	}
+}
+
+func TestReportOnlyRequiresReporting(t *testing.T) {
+	pol := SecurityOptionsStaticSite()
+	pol.ReportOnly = true
+	_, err := pol.Load()
+	if err == nil || !strings.Contains(err.Error(), "require report-uri or report-to") {
+		t.Errorf("Load() error = %v, want report-only without reporting rejected", err)
+	}
+}
+
+func TestDirectiveOrder(t *testing.T) {
+	pol := everyDirectivePolicy()
+	first, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	csp := first[HeaderContentSecurityPolicy]
+
+	var names []string
+	for _, directive := range strings.Split(strings.TrimSuffix(csp, ";"), "; ") {
+		names = append(names, strings.Fields(directive)[0])
+	}
+	if strings.Join(names, " ") != strings.Join(directiveOrder, " ") {
+		t.Errorf("directives rendered in the order\n%v\nwant\n%v", names, directiveOrder)
+	}
+
+	for i := 0; i < 20; i++ {
+		again := everyDirectivePolicy()
+		headers, err := again.Load()
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if headers[HeaderContentSecurityPolicy] != csp {
+			t.Fatalf("Load() = %q, then %q", csp, headers[HeaderContentSecurityPolicy])
+		}
+	}
+}
+
+// everyDirectivePolicy sets every directive this package renders
+func everyDirectivePolicy() Policy {
+	pol := Policy{KeepRedundantDirectives: true}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	pol.CSP.Sandbox = SandboxOptions{AllowScripts: true}
+	pol.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, AllowSelf: true}
+	pol.CSP.ReportURI = UnquotedOptions{Values: []string{"/csp"}}
+	pol.CSP.ReportTo = UnquotedOption{Value: "csp"}
+	pol.ReportingEndpoints = map[string]string{"csp": "https://reports.example.com/csp"}
+	pol.CSP.BlockAllMixedContent = true
+	pol.CSP.UpgradeInsecureRequests = true
+	return pol
+}
+
+func TestPolicyDirectiveAccessors(t *testing.T) {
+	pol := noncePolicy()
+	pol.CSP.ImgSrc = CSPSourceOptions{Allow: true, Hashes: []Hash{{Algorithm: HashSHA256, Base64: "abc="}}}
+	if pol.StaticDirectives() != nil || pol.DynamicDirectives() != nil {
+		t.Fatalf("directives of a Policy not yet loaded are not nil")
+	}
+	_, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	static, dynamic := pol.StaticDirectives(), pol.DynamicDirectives()
+	for _, name := range []string{DirectiveScriptSrc, DirectiveStyleSrc, DirectiveImgSrc} {
+		if _, ok := dynamic[name]; !ok {
+			t.Errorf("DynamicDirectives() = %v, want %s, which carries a nonce or hash", dynamic, name)
+		}
+		if _, ok := static[name]; ok {
+			t.Errorf("StaticDirectives() includes %s", name)
+		}
+	}
+	defaultSrc := static[DirectiveDefaultSrc]
+	if len(defaultSrc) == 0 {
+		t.Errorf("StaticDirectives() = %v, want default-src", static)
+	}
+
+	static[DirectiveDefaultSrc] = "*"
+	delete(dynamic, DirectiveScriptSrc)
+	if pol.StaticDirectives()[DirectiveDefaultSrc] != defaultSrc || len(pol.DynamicDirectives()[DirectiveScriptSrc]) == 0 {
+		t.Errorf("modifying the returned maps changed the Policy's directives")
+	}
+}
+
+// renderCSP compiles pol and returns its Content-Security-Policy (or report-only) header value
+func renderCSP(t *testing.T, pol Policy) string {
+	t.Helper()
+	compiled, err := pol.Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	headers, err := compiled.Render("abc123")
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	return headers[cspHeaderName(pol.ReportOnly)]
+}
+
+func TestBlockAllMixedContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		upgrade     bool
+		wantSuffix  string
+		wantWarning bool
+	}{
+		{"alone", false, "frame-ancestors 'none'; block-all-mixed-content;", false},
+		{"with upgrade-insecure-requests", true, "frame-ancestors 'none'; block-all-mixed-content; upgrade-insecure-requests;", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsServerRendered()
+			pol.CSP.BlockAllMixedContent = true
+			pol.CSP.UpgradeInsecureRequests = tt.upgrade
+			got, warnings := loadWithWarnings(t, pol)
+			if !strings.HasSuffix(got, tt.wantSuffix) {
+				t.Errorf("header = %q, want it to end with %q", got, tt.wantSuffix)
+			}
+			if strings.Count(got, "block-all-mixed-content") != 1 {
+				t.Errorf("header = %q, want block-all-mixed-content once", got)
+			}
+			if hasWarning(warnings, WarnSupersededDirective, "block-all-mixed-content") != tt.wantWarning {
+				t.Errorf("warnings = %v, want superseded warning %v", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestFencedFrameSrc(t *testing.T) {
+	https := CSPSourceOptions{Allow: true, Values: []string{SchemeHTTPS}}
+	tests := []struct {
+		name         string
+		defaultSrc   CSPSourceOptions
+		fenced       CSPSourceOptions
+		want         string // the fenced-frame-src directive, empty when it is left out
+		wantWarnings int
+	}{
+		{"scheme source", CSPSourceOptions{}, https, "fenced-frame-src https:;", 0},
+		{"identical to default-src", https, https, "", 0},
+		{"self and unsafe-inline", CSPSourceOptions{}, CSPSourceOptions{Allow: true, AllowSelf: true, UnsafeInline: true},
+			"fenced-frame-src 'self' 'unsafe-inline';", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsServerRendered()
+			pol.CSP.DefaultSrc = tt.defaultSrc
+			pol.CSP.FencedFrameSrc = tt.fenced
+			got, warnings := loadWithWarnings(t, pol)
+			if len(tt.want) > 0 && !strings.Contains(got, tt.want) {
+				t.Errorf("header = %q, want it to contain %q", got, tt.want)
+			}
+			if len(tt.want) == 0 && strings.Contains(got, "fenced-frame-src") {
+				t.Errorf("header = %q, want no fenced-frame-src", got)
+			}
+			var fencedWarnings int
+			for _, w := range warnings {
+				if w.Directive == "fenced-frame-src" && w.Code == WarnIneffectiveSource {
+					fencedWarnings++
+				}
+			}
+			if fencedWarnings != tt.wantWarnings {
+				t.Errorf("warnings = %v, want %d about fenced-frame-src", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestSandboxUserActivationTokens(t *testing.T) {
+	pol := SecurityOptionsServerRendered()
+	pol.CSP.Sandbox = SandboxOptions{AllowDownloadsWithoutUserActivation: true, AllowStorageAccessByUserActivation: true}
+	got, warnings := loadWithWarnings(t, pol)
+	if want := "sandbox allow-downloads-without-user-activation allow-storage-access-by-user-activation;"; !strings.Contains(got, want) {
+		t.Errorf("header = %q, want it to contain %q", got, want)
+	}
+	var compat int
+	for _, w := range warnings {
+		if w.Code == WarnBrowserCompat && w.Directive == DirectiveSandbox {
+			compat++
+		}
+	}
+	if compat != 2 {
+		t.Errorf("warnings = %v, want a browser-compat warning for each token", warnings)
+	}
+}
+
+func TestBareSandbox(t *testing.T) {
+	tests := []struct {
+		name    string
+		sandbox SandboxOptions
+		want    string // the sandbox directive, empty when it is left out
+	}{
+		{"disabled", SandboxOptions{}, ""},
+		{"enabled with no tokens", SandboxOptions{Enabled: true}, "; sandbox;"},
+		{"enabled with tokens", SandboxOptions{Enabled: true, AllowForms: true}, "; sandbox allow-forms;"},
+		{"tokens imply enabled", SandboxOptions{AllowForms: true}, "; sandbox allow-forms;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsServerRendered()
+			pol.CSP.Sandbox = tt.sandbox
+			got := renderCSP(t, pol)
+			if len(tt.want) > 0 && !strings.Contains(got, tt.want) {
+				t.Errorf("header = %q, want it to contain %q", got, tt.want)
+			}
+			if len(tt.want) == 0 && strings.Contains(got, "sandbox") {
+				t.Errorf("header = %q, want no sandbox", got)
+			}
+		})
+	}
+}
+
+func TestKeepRedundantDirectives(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		pol := SecurityOptionsServerRendered()
+		// explicitly set, so its removal is warned about; a directive left at its zero value is dropped quietly
+		pol.CSP.ObjectSrc = CSPSourceOptions{Allow: true, Values: []string{SourceNone}}
+		pol.KeepRedundantDirectives = keep
+		header, warnings := loadWithWarnings(t, pol)
+		if got := strings.Contains(header, "object-src 'none';"); got != keep {
+			t.Errorf("KeepRedundantDirectives %v: header = %q, want object-src %v", keep, header, keep)
+		}
+		if got := hasWarning(warnings, WarnRedundantDirective, "object-src"); got == keep {
+			t.Errorf("KeepRedundantDirectives %v: warnings = %v, want a redundant-directive warning %v", keep, warnings, !keep)
+		}
+	}
+}
+
+func TestUnsetDirectives(t *testing.T) {
+	tests := []struct {
+		name      string
+		scriptSrc CSPSourceOptions
+		want      string // script-src in the header, empty when it is left out
+		effective string // the directive script-src-elem resolves to
+	}{
+		{"none", CSPSourceOptions{Allow: true, Values: []string{SourceNone}}, "script-src 'none';", "script-src"},
+		{"unset", CSPSourceOptions{Unset: true}, "", "default-src"},
+		{"unset overrides other fields", CSPSourceOptions{Unset: true, Allow: true, AllowSelf: true}, "", "default-src"},
+		{"set", CSPSourceOptions{Allow: true, AllowSelf: true}, "script-src 'self';", "script-src"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsServerRendered()
+			pol.OmitZeroDirectives = true
+			pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, Values: []string{SchemeHTTPS}}
+			pol.CSP.ScriptSrc = tt.scriptSrc
+			got := renderCSP(t, pol)
+			if len(tt.want) > 0 && !strings.Contains(got, tt.want) {
+				t.Errorf("header = %q, want it to contain %q", got, tt.want)
+			}
+			if len(tt.want) == 0 && strings.Contains(got, "script-src ") {
+				t.Errorf("header = %q, want no script-src", got)
+			}
+
+			resolved, _, err := pol.EffectiveDirective("script-src-elem")
+			if err != nil {
+				t.Fatalf("EffectiveDirective() error = %v", err)
+			}
+			if resolved != tt.effective {
+				t.Errorf("EffectiveDirective(script-src-elem) = %q, want %q", resolved, tt.effective)
+			}
+		})
+	}
+}
+
+func TestUnsetFrameAncestors(t *testing.T) {
+	pol := SecurityOptionsServerRendered()
+	pol.CSP.FrameAncestors = FrameAncestorOptions{Unset: true, Allow: true, AllowSelf: true}
+	got := renderCSP(t, pol)
+	if strings.Contains(got, "frame-ancestors") {
+		t.Errorf("header = %q, want frame-ancestors left out", got)
+	}
+}
+
+func TestUnsetDefaultSrc(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy func() Policy
+		want   string
+	}{
+		{
+			name: "frame-ancestors only",
+			policy: func() Policy {
+				pol := Policy{OmitZeroDirectives: true}
+				pol.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+				pol.CSP.BaseURI = CSPSourceOptions{Unset: true}
+				pol.CSP.FormAction = CSPSourceOptions{Unset: true}
+				return pol
+			},
+			want: "frame-ancestors 'none';",
+		},
+		{
+			name: "zero fetch directives without OmitZeroDirectives",
+			policy: func() Policy {
+				pol := Policy{}
+				pol.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+				pol.CSP.BaseURI = CSPSourceOptions{Unset: true}
+				pol.CSP.FormAction = CSPSourceOptions{Unset: true}
+				pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+				return pol
+			},
+			want: "child-src 'none'; connect-src 'none'; fenced-frame-src 'none'; font-src 'none'; frame-src 'none'; " +
+				"img-src 'none'; manifest-src 'none'; media-src 'none'; object-src 'none'; prefetch-src 'none'; " +
+				"script-src 'self'; script-src-attr 'none'; script-src-elem 'none'; style-src 'none'; " +
+				"style-src-attr 'none'; style-src-elem 'none'; worker-src 'none'; frame-ancestors 'none';",
+		},
+		{
+			name: "script-src only",
+			policy: func() Policy {
+				pol := Policy{OmitZeroDirectives: true}
+				pol.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+				pol.CSP.BaseURI = CSPSourceOptions{Unset: true}
+				pol.CSP.FormAction = CSPSourceOptions{Unset: true}
+				pol.CSP.FrameAncestors = FrameAncestorOptions{Unset: true}
+				pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+				return pol
+			},
+			want: "script-src 'self';",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderCSP(t, tt.policy())
+			if got != tt.want {
+				t.Errorf("header = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyString(t *testing.T) {
+	for name, pol := range map[string]Policy{
+		"StaticSite":     SecurityOptionsStaticSite(),
+		"ReactJS":        SecurityOptionsReactJS(),
+		"ServerRendered": SecurityOptionsServerRendered(WithCDNHosts("https://cdn.example.com")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// before Load, String compiles the policy itself
+			got := pol.String()
+			headers, err := pol.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if want := headers[HeaderContentSecurityPolicy]; got != want {
+				t.Errorf("String() = %q, want %q", got, want)
+			}
+			if again := fmt.Sprint(&pol); again != got {
+				t.Errorf("String() = %q, then %q", got, again)
+			}
+		})
+	}
+}
+
+func TestPolicyStringInvalid(t *testing.T) {
+	pol := SecurityOptionsServerRendered()
+	pol.CSP.ImgSrc.Values = []string{"self"}
+	got := pol.String()
+	if !strings.HasPrefix(got, "<invalid csp: ") || !strings.Contains(got, ErrUnquotedKeyword.Error()) {
+		t.Errorf("String() = %q, want an invalid csp diagnostic", got)
+	}
+}
+
+func TestMustLoad(t *testing.T) {
+	invalid := SecurityOptionsStaticSite()
+	invalid.CSP.ImgSrc.Values = []string{"https://a.example.com; script-src *"}
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		wantPanic bool
+	}{
+		{"valid", SecurityOptionsStaticSite(), false},
+		{"invalid source", invalid, true},
+		{"report-only without reporting", Policy{ReportOnly: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := tt.policy.Clone()
+			want, wantErr := pol.Load()
+
+			pol = tt.policy.Clone()
+			var got map[string]string
+			v := mustPanic(func() { got = pol.MustLoad() })
+			if (v != nil) != tt.wantPanic {
+				t.Fatalf("MustLoad() panicked with %v, want panic %v", v, tt.wantPanic)
+			}
+			if !tt.wantPanic {
+				if got[HeaderContentSecurityPolicy] != want[HeaderContentSecurityPolicy] {
+					t.Errorf("MustLoad() = %v, want %v", got, want)
+				}
+				return
+			}
+			err, ok := v.(error)
+			if !ok || err.Error() != wantErr.Error() {
+				t.Errorf("MustLoad() panicked with %v, want the Load error %v", v, wantErr)
+			}
+		})
+	}
+}
+
+// mustPanic calls f and returns the value it panicked with, or nil if it returned
+func mustPanic(f func()) (v interface{}) {
+	defer func() {
+		v = recover()
+	}()
+	f()
+	return nil
+}
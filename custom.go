@@ -0,0 +1,70 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidCustomDirective is returned for a custom directive whose name is not a lowercase directive name, or
+// whose value would end the directive or the header early.
+var ErrInvalidCustomDirective = errors.New("invalid custom directive")
+
+func (pol *Policy) validateCustomDirectives() error {
+	for name, value := range pol.CustomDirectives {
+		if !isDirectiveName(name) {
+			return &DirectiveError{
+				Directive: name,
+				Err:       fmt.Errorf("%w: names are lowercase letters, digits, and '-'", ErrInvalidCustomDirective),
+			}
+		}
+		// a ',' would start a second policy
+		if strings.ContainsAny(value, ";,") {
+			return &DirectiveError{Directive: name, Err: fmt.Errorf("%w: a value must not contain ';' or ','", ErrInvalidCustomDirective)}
+		}
+		err := validateControlCharacters("value", value)
+		if err != nil {
+			return &DirectiveError{Directive: name, Err: fmt.Errorf("%w: %w", ErrInvalidCustomDirective, err)}
+		}
+	}
+	return nil
+}
+
+// isDirectiveName checks against the directive-name grammar, restricted to lowercase as directive names are
+// case-insensitive and rendered lowercase.
+// https://www.w3.org/TR/CSP3/#grammardef-directive-name
+func isDirectiveName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z') && !isDigit(c) && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// overrideDirectives removes the known directives that a custom directive replaces
+func (pol *Policy) overrideDirectives() {
+	for _, name := range sortedCustomDirectives(pol.CustomDirectives) {
+		if len(pol.cspStaticDirectives[name]) == 0 && len(pol.cspDynamicDirectives[name]) == 0 {
+			continue
+		}
+		pol.warn(WarnOverriddenDirective, name, "replaced by the custom directive of the same name")
+		delete(pol.cspStaticDirectives, name)
+		delete(pol.cspDynamicDirectives, name)
+	}
+}
+
+// sortedCustomDirectives returns the custom directive names in the order they are rendered
+func sortedCustomDirectives(custom map[string]string) []string {
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,64 @@
+package cspheader
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCustomDirectives(t *testing.T) {
+	const base = "default-src 'none'; connect-src 'self'; font-src 'self'; img-src 'self' data:; script-src 'self'; style-src 'self'; " +
+		"base-uri 'none'; form-action 'none'; frame-ancestors 'none'; upgrade-insecure-requests;"
+	tests := []struct {
+		name   string
+		custom map[string]string
+		want   string
+	}{
+		{"none", nil, base},
+		{
+			name:   "sorted after the known directives",
+			custom: map[string]string{"trusted-types": "default", "require-trusted-types-for": "'script'"},
+			want:   base + " require-trusted-types-for 'script'; trusted-types default;",
+		},
+		{"valueless", map[string]string{"webrtc": ""}, base + " webrtc;"},
+		{
+			name:   "overrides a known directive",
+			custom: map[string]string{"script-src": "'self' https://cdn.example.com"},
+			want: strings.Replace(base, "script-src 'self'; ", "", 1) +
+				" script-src 'self' https://cdn.example.com;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsStaticSite()
+			pol.CustomDirectives = tt.custom
+			if got := renderCSP(t, pol); got != tt.want {
+				t.Errorf("header = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomDirectivesInvalid(t *testing.T) {
+	tests := []struct {
+		name, value string
+	}{
+		{"Trusted-Types", "default"},
+		{"trusted types", "default"},
+		{"", "default"},
+		{"trusted-types", "default; script-src *"},
+		{"trusted-types", "default, script-src *"},
+		{"trusted-types", "default\r\nSet-Cookie: a=b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.value, func(t *testing.T) {
+			pol := SecurityOptionsStaticSite()
+			pol.CustomDirectives = map[string]string{tt.name: tt.value}
+			_, err := pol.Load()
+			var de *DirectiveError
+			if !errors.Is(err, ErrInvalidCustomDirective) || !errors.As(err, &de) || de.Directive != tt.name {
+				t.Errorf("Load() error = %v, want %v for %q", err, ErrInvalidCustomDirective, tt.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package cspheader
+
+import (
+	"strings"
+)
+
+// dedupeValues drops repeated source expressions, keeping the first of each in order.  values is returned as is
+// when there is nothing to drop.
+func dedupeValues(values []string) []string {
+	if len(values) < 2 {
+		return values
+	}
+
+	seen := make(map[string]bool, len(values))
+	var deduped []string
+	for i, v := range values {
+		key := dedupeKey(v)
+		if !seen[key] {
+			seen[key] = true
+			if deduped != nil {
+				deduped = append(deduped, v)
+			}
+			continue
+		}
+		if deduped == nil {
+			deduped = append(make([]string, 0, len(values)-1), values[:i]...)
+		}
+	}
+	if deduped == nil {
+		return values
+	}
+	return deduped
+}
+
+// dedupeKey is the form of a source expression compared for duplicates.  schemes, hosts, ports, and keywords are
+// case-insensitive; paths, nonces, and hashes are not.
+func dedupeKey(v string) string {
+	if strings.HasPrefix(v, "'") {
+		if sourceKeywords[strings.ToLower(strings.Trim(v, "'"))] {
+			return strings.ToLower(v)
+		}
+		return v
+	}
+
+	start := 0
+	if i := strings.Index(v, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	if i := strings.IndexByte(v[start:], '/'); i >= 0 {
+		return strings.ToLower(v[:start+i]) + v[start+i:]
+	}
+	return strings.ToLower(v)
+}
@@ -0,0 +1,63 @@
+package cspheader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDedupeOnLoad(t *testing.T) {
+	pol := SecurityOptionsServerRendered()
+	pol.CSP.ImgSrc.Values = []string{SchemeData, "cdn.example.com", SchemeData, "CDN.example.com"}
+	pol.CSP.FrameAncestors = FrameAncestorOptions{
+		Allow:         true,
+		HostSources:   []string{"a.example.com", "A.example.com"},
+		SchemeSources: []string{SchemeHTTPS, SchemeHTTPS},
+	}
+	pol.CSP.ReportURI = UnquotedOptions{Values: []string{"/csp-reports", "/csp-reports"}}
+	headers, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	header := headers[HeaderContentSecurityPolicy]
+	for _, want := range []string{
+		"img-src 'self' data: cdn.example.com;",
+		"frame-ancestors a.example.com https:;",
+		"report-uri /csp-reports;",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("header = %q, want it to contain %q", header, want)
+		}
+	}
+}
+
+func TestDedupeValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{"nothing to drop", []string{"'self'", "data:", "cdn.example.com"}, []string{"'self'", "data:", "cdn.example.com"}},
+		{"first seen order", []string{"cdn.example.com", "'self'", "data:", "data:", "cdn.example.com", "'self'"},
+			[]string{"cdn.example.com", "'self'", "data:"}},
+		{"host and scheme case", []string{"https://CDN.example.com", "https://cdn.example.com", "HTTPS:", "https:"},
+			[]string{"https://CDN.example.com", "HTTPS:"}},
+		{"keyword case", []string{"'self'", "'SELF'"}, []string{"'self'"}},
+		{"path case", []string{"https://cdn.example.com/App.js", "https://CDN.example.com/app.js"},
+			[]string{"https://cdn.example.com/App.js", "https://CDN.example.com/app.js"}},
+		{"nonce and hash case", []string{"'nonce-YWJj'", "'nonce-ywjj'", "'sha256-YWJj'", "'sha256-ywjj'"},
+			[]string{"'nonce-YWJj'", "'nonce-ywjj'", "'sha256-YWJj'", "'sha256-ywjj'"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := append([]string(nil), tt.values...)
+			got := dedupeValues(values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dedupeValues(%q) = %q, want %q", tt.values, got, tt.want)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("dedupeValues(%q) modified its argument to %q", tt.values, values)
+			}
+		})
+	}
+}
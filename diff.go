@@ -0,0 +1,259 @@
+package cspheader
+
+import (
+	"strings"
+)
+
+// DirectiveChange is how a directive differs between two policies
+type DirectiveChange int
+
+const (
+	// DirectiveChanged is a directive in both policies with different values
+	DirectiveChanged DirectiveChange = iota
+	// DirectiveAdded is a directive only in the second policy
+	DirectiveAdded
+	// DirectiveRemoved is a directive only in the first policy
+	DirectiveRemoved
+)
+
+// DirectiveDiff is the difference in one directive between two policies.  For an added or removed directive, all
+// of its values are listed as Added or Removed respectively.
+type DirectiveDiff struct {
+	Directive string
+	Change    DirectiveChange
+	Added     []string
+	Removed   []string
+}
+
+func (dd DirectiveDiff) String() string {
+	switch dd.Change {
+	case DirectiveAdded:
+		return strings.TrimSpace("+" + dd.Directive + " " + strings.Join(dd.Added, " "))
+	case DirectiveRemoved:
+		return strings.TrimSpace("-" + dd.Directive + " " + strings.Join(dd.Removed, " "))
+	}
+
+	changes := make([]string, 0, len(dd.Added)+len(dd.Removed))
+	for _, v := range dd.Added {
+		changes = append(changes, "+"+v)
+	}
+	for _, v := range dd.Removed {
+		changes = append(changes, "-"+v)
+	}
+	return dd.Directive + ": " + strings.Join(changes, ", ")
+}
+
+// Diff is the difference between two policies, directive by directive, in the order Normalize writes them
+type Diff struct {
+	Directives []DirectiveDiff
+
+	loosening  bool
+	tightening bool
+}
+
+// String lists the changes one directive per line, e.g. "script-src: +cdn.example.com, -'unsafe-inline'".  An
+// added or removed directive is written with its values, prefixed with + or -.
+func (d Diff) String() string {
+	lines := make([]string, len(d.Directives))
+	for i, dd := range d.Directives {
+		lines[i] = dd.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Equal reports whether there are no differences
+func (d Diff) Equal() bool {
+	return len(d.Directives) == 0
+}
+
+// IsLoosening is a heuristic for whether the second policy allows anything the first did not.  It is true if a
+// source is added to a source list, 'none' or 'strict-dynamic' is removed, a sandbox token is added, a directive
+// other than a reporting directive is removed, or a fetch directive is added with sources its fallback in the
+// first policy did not allow.  Unknown directives are not considered.
+func (d Diff) IsLoosening() bool {
+	return d.loosening
+}
+
+// IsTightening is the IsLoosening heuristic applied in reverse: whether the first policy allows anything the second
+// does not.  A diff can be both loosening and tightening, e.g. when one host is swapped for another.
+func (d Diff) IsTightening() bool {
+	return d.tightening
+}
+
+// CompareHeaders returns the differences between two Content-Security-Policy header values, from a to b.  Both are
+// compared in their Normalize form, so differences in directive order, value order, whitespace, or insignificant
+// case are not reported.  Nonce values vary per response, so nonces are compared by presence only and written as
+// 'nonce-*'.
+func CompareHeaders(a, b string) (Diff, error) {
+	da, err := normalizedDirectives(a)
+	if err != nil {
+		return Diff{}, err
+	}
+	db, err := normalizedDirectives(b)
+	if err != nil {
+		return Diff{}, err
+	}
+
+	var diff Diff
+	for _, name := range unionNames(da.names, db.names) {
+		va, inA := da.values[name]
+		vb, inB := db.values[name]
+
+		dd := DirectiveDiff{Directive: name}
+		switch {
+		case !inA:
+			dd.Change = DirectiveAdded
+			dd.Added = vb
+			if addedLoosens(name, vb, da) {
+				diff.loosening = true
+			}
+			if removedLoosens(name) {
+				diff.tightening = true
+			}
+		case !inB:
+			dd.Change = DirectiveRemoved
+			dd.Removed = va
+			if removedLoosens(name) {
+				diff.loosening = true
+			}
+			if addedLoosens(name, va, db) {
+				diff.tightening = true
+			}
+		default:
+			dd.Added = subtractStrings(vb, va)
+			dd.Removed = subtractStrings(va, vb)
+			if len(dd.Added) == 0 && len(dd.Removed) == 0 {
+				continue
+			}
+			if changeLoosens(name, dd.Added, dd.Removed) {
+				diff.loosening = true
+			}
+			if changeLoosens(name, dd.Removed, dd.Added) {
+				diff.tightening = true
+			}
+		}
+		diff.Directives = append(diff.Directives, dd)
+	}
+	return diff, nil
+}
+
+// Drift compares the policy as configured with liveHeader, the Content-Security-Policy value a browser actually
+// receives, e.g. as fetched through a CDN or proxy that rewrites headers.  The Diff is from the configured policy to
+// the live one: Added values are in the live header only, and Removed values are missing from it.  IsLoosening
+// reports drift that makes the live policy more permissive than intended, and IsTightening drift that makes it
+// stricter.  The policy is compiled first if it has not been; nonces are compared by presence only, as by
+// CompareHeaders.
+func (pol *Policy) Drift(liveHeader string) (Diff, error) {
+	if pol.compiled == nil {
+		_, err := pol.Compile()
+		if err != nil {
+			return Diff{}, err
+		}
+	}
+
+	// any nonce will do: CompareHeaders compares nonces by presence
+	configured, err := pol.compiled.directiveString(nil, "drift")
+	if err != nil {
+		return Diff{}, err
+	}
+	return CompareHeaders(configured, liveHeader)
+}
+
+// headerDirectives is a normalized header value split into its directives
+type headerDirectives struct {
+	names  []string
+	values map[string][]string
+}
+
+// normalizedDirectives normalizes header and splits it into directives, with nonce values replaced by 'nonce-*'
+func normalizedDirectives(header string) (headerDirectives, error) {
+	normalized, err := Normalize(header)
+	if err != nil {
+		return headerDirectives{}, err
+	}
+
+	hd := headerDirectives{values: map[string][]string{}}
+	for _, rawDirective := range strings.Split(normalized, ";") {
+		tokens := strings.Fields(rawDirective)
+		if len(tokens) == 0 {
+			continue
+		}
+		values := make([]string, 0, len(tokens)-1)
+		for _, v := range tokens[1:] {
+			if strings.HasPrefix(v, "'nonce-") {
+				v = "'nonce-*'"
+			}
+			if !containsString(values, v) {
+				values = append(values, v)
+			}
+		}
+		hd.names = append(hd.names, tokens[0])
+		hd.values[tokens[0]] = values
+	}
+	return hd, nil
+}
+
+// unionNames merges two lists of directive names in Normalize order
+func unionNames(a, b []string) []string {
+	names := append([]string(nil), a...)
+	for _, name := range b {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sortDirectiveNames(names)
+	return names
+}
+
+// subtractStrings returns the values in a that are not in b
+func subtractStrings(a, b []string) []string {
+	var diff []string
+	for _, v := range a {
+		if !containsString(b, v) {
+			diff = append(diff, v)
+		}
+	}
+	return diff
+}
+
+func isDirectiveKnown(name string) bool {
+	return containsString(directiveOrder, name)
+}
+
+// changeLoosens applies the IsLoosening heuristic to a directive present in both policies
+func changeLoosens(name string, added, removed []string) bool {
+	switch {
+	case name == DirectiveSandbox:
+		return len(added) > 0
+	case name == DirectiveFrameAncestors, (&Policy{}).sourceOptionsByName(name) != nil:
+		for _, v := range added {
+			if v != SourceNone && v != SourceReportSample {
+				return true
+			}
+		}
+		return containsString(removed, SourceNone) || containsString(removed, SourceStrictDynamic)
+	}
+	return false
+}
+
+// removedLoosens applies the IsLoosening heuristic to a directive only in the first policy: removing any known
+// directive other than a reporting directive loosens the policy
+func removedLoosens(name string) bool {
+	return name != DirectiveReportURI && name != DirectiveReportTo && isDirectiveKnown(name)
+}
+
+// addedLoosens applies the IsLoosening heuristic to a directive only in the second policy.  a fetch directive
+// loosens the policy if it allows a source that its fallback in the first policy did not.
+func addedLoosens(name string, values []string, before headerDirectives) bool {
+	if (&Policy{}).sourceOptionsByName(name) == nil {
+		return false
+	}
+
+	for _, fallback := range directiveFallbacks[name] {
+		if allowed, ok := before.values[fallback]; ok {
+			return changeLoosens(name, subtractStrings(values, allowed), nil)
+		}
+	}
+	// without a directive or a fallback, the first policy did not restrict this at all
+	return false
+}
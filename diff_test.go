@@ -0,0 +1,161 @@
+package cspheader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareHeaders(t *testing.T) {
+	tests := []struct {
+		name           string
+		a, b           string
+		want           string
+		wantLoosening  bool
+		wantTightening bool
+	}{
+		{"same", "default-src 'self'", "default-src 'self'", "", false, false},
+		{"reordered", "img-src b.example a.example; default-src 'self';", "default-src 'self'; img-src a.example b.example", "", false, false},
+		{"nonces by presence", "script-src 'nonce-abc'", "script-src 'nonce-def'", "", false, false},
+		{"host added", "img-src 'self'", "img-src 'self' cdn.example", "img-src: +cdn.example", true, false},
+		{"host removed", "img-src 'self' cdn.example", "img-src 'self'", "img-src: -cdn.example", false, true},
+		{"host swapped", "img-src a.example", "img-src b.example", "img-src: +b.example, -a.example", true, true},
+		{"none removed", "object-src 'none'", "object-src 'self'", "object-src: +'self', -'none'", true, false},
+		{"strict-dynamic removed", "script-src 'nonce-a' 'strict-dynamic'", "script-src 'nonce-a'", "script-src: -'strict-dynamic'", true, true},
+		{"report-sample added", "script-src 'self'", "script-src 'self' 'report-sample'", "script-src: +'report-sample'", false, false},
+		{"sandbox token added", "sandbox", "sandbox allow-scripts", "sandbox: +allow-scripts", true, false},
+		{"sandbox token removed", "sandbox allow-scripts", "sandbox", "sandbox: -allow-scripts", false, true},
+		{"directive removed", "default-src 'self'; object-src 'none'", "default-src 'self'", "-object-src 'none'", true, false},
+		{"directive added", "default-src 'self'", "default-src 'self'; object-src 'none'", "+object-src 'none'", false, true},
+		{"reporting directive removed", "default-src 'self'; report-uri /csp", "default-src 'self'", "-report-uri /csp", false, false},
+		{"fetch directive beyond its fallback", "default-src 'self'", "default-src 'self'; img-src 'self' data:", "+img-src 'self' data:", true, true},
+		{"fetch directive within its fallback", "default-src 'self' data:", "default-src 'self' data:; img-src data:", "+img-src data:", false, true},
+		{"valueless directive added", "default-src 'self'", "default-src 'self'; upgrade-insecure-requests", "+upgrade-insecure-requests", false, true},
+		{"unknown directive", "default-src 'self'", "default-src 'self'; trusted-types default", "+trusted-types default", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := CompareHeaders(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("CompareHeaders() error = %v", err)
+			}
+			if got := d.String(); got != tt.want {
+				t.Errorf("diff = %q, want %q", got, tt.want)
+			}
+			if d.Equal() != (len(tt.want) == 0) {
+				t.Errorf("Equal() = %v for diff %q", d.Equal(), tt.want)
+			}
+			if d.IsLoosening() != tt.wantLoosening || d.IsTightening() != tt.wantTightening {
+				t.Errorf("IsLoosening(), IsTightening() = %v, %v, want %v, %v",
+					d.IsLoosening(), d.IsTightening(), tt.wantLoosening, tt.wantTightening)
+			}
+
+			// the reverse diff swaps loosening and tightening
+			r, err := CompareHeaders(tt.b, tt.a)
+			if err != nil {
+				t.Fatalf("CompareHeaders() error = %v", err)
+			}
+			if r.IsLoosening() != tt.wantTightening || r.IsTightening() != tt.wantLoosening {
+				t.Errorf("reversed IsLoosening(), IsTightening() = %v, %v, want %v, %v",
+					r.IsLoosening(), r.IsTightening(), tt.wantTightening, tt.wantLoosening)
+			}
+		})
+	}
+}
+
+func TestCompareHeadersErrors(t *testing.T) {
+	for _, tt := range []struct{ a, b string }{
+		{"default-src 'self', img-src *", "default-src 'self'"},
+		{"default-src 'self'", "default-src 'self', img-src *"},
+	} {
+		if _, err := CompareHeaders(tt.a, tt.b); err == nil {
+			t.Errorf("CompareHeaders(%q, %q) error = nil, want an error", tt.a, tt.b)
+		}
+	}
+}
+
+func TestDrift(t *testing.T) {
+	const configured = "default-src 'none'; connect-src 'self'; font-src 'self'; img-src 'self' data:; script-src 'self'; " +
+		"style-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'; upgrade-insecure-requests;"
+	tests := []struct {
+		name           string
+		live           string
+		want           string
+		wantLoosening  bool
+		wantTightening bool
+	}{
+		{"identical", configured, "", false, false},
+		{
+			name: "reordered by a proxy",
+			live: "upgrade-insecure-requests; frame-ancestors 'none'; form-action 'none'; base-uri 'none'; style-src 'self'; " +
+				"script-src 'self'; img-src data: 'self'; font-src 'self'; connect-src 'self'; default-src 'none'",
+		},
+		{
+			name:          "host added by a CDN",
+			live:          strings.Replace(configured, "script-src 'self'", "script-src 'self' https://cdn.example.com", 1),
+			want:          "script-src: +https://cdn.example.com",
+			wantLoosening: true,
+		},
+		{
+			name:          "directive stripped",
+			live:          strings.Replace(configured, " frame-ancestors 'none';", "", 1),
+			want:          "-frame-ancestors 'none'",
+			wantLoosening: true,
+		},
+		{
+			name:           "source stripped",
+			live:           strings.Replace(configured, "img-src 'self' data:", "img-src 'self'", 1),
+			want:           "img-src: -data:",
+			wantTightening: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsStaticSite()
+			d, err := pol.Drift(tt.live)
+			if err != nil {
+				t.Fatalf("Drift() error = %v", err)
+			}
+			if got := d.String(); got != tt.want {
+				t.Errorf("Drift() = %q, want %q", got, tt.want)
+			}
+			if d.IsLoosening() != tt.wantLoosening || d.IsTightening() != tt.wantTightening {
+				t.Errorf("IsLoosening(), IsTightening() = %v, %v, want %v, %v",
+					d.IsLoosening(), d.IsTightening(), tt.wantLoosening, tt.wantTightening)
+			}
+		})
+	}
+}
+
+func TestDriftErrors(t *testing.T) {
+	invalid := SecurityOptionsStaticSite()
+	invalid.CSP.ImgSrc.Values = []string{"https://a.example.com;"}
+	if _, err := invalid.Drift("default-src 'self'"); err == nil {
+		t.Errorf("Drift() of an invalid policy error = nil, want an error")
+	}
+
+	pol := SecurityOptionsStaticSite()
+	if _, err := pol.Drift("default-src 'self', img-src *"); err == nil {
+		t.Errorf("Drift() of a policy list error = nil, want an error")
+	}
+}
+
+func TestDriftNonce(t *testing.T) {
+	pol := SecurityOptionsStrict()
+	live := "object-src 'none'; script-src https: 'unsafe-inline' 'nonce-ZnJvbS10aGUtY2Ru' 'strict-dynamic'; " +
+		"base-uri 'none'; report-to default;"
+	d, err := pol.Drift(live)
+	if err != nil {
+		t.Fatalf("Drift() error = %v", err)
+	}
+	if !d.Equal() {
+		t.Errorf("Drift() = %q, want nonces compared by presence only", d)
+	}
+
+	d, err = pol.Drift(strings.Replace(live, " 'nonce-ZnJvbS10aGUtY2Ru'", "", 1))
+	if err != nil {
+		t.Fatalf("Drift() error = %v", err)
+	}
+	if got, want := d.String(), "script-src: -'nonce-*'"; got != want {
+		t.Errorf("Drift() without the nonce = %q, want %q", got, want)
+	}
+}
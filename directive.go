@@ -0,0 +1,201 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Directive names
+const (
+	// Fetch directives
+	DirectiveDefaultSrc     = "default-src"
+	DirectiveChildSrc       = "child-src"
+	DirectiveConnectSrc     = "connect-src"
+	DirectiveFencedFrameSrc = "fenced-frame-src"
+	DirectiveFontSrc        = "font-src"
+	DirectiveFrameSrc       = "frame-src"
+	DirectiveImgSrc         = "img-src"
+	DirectiveManifestSrc    = "manifest-src"
+	DirectiveMediaSrc       = "media-src"
+	DirectiveObjectSrc      = "object-src"
+	DirectivePrefetchSrc    = "prefetch-src"
+	DirectiveScriptSrc      = "script-src"
+	DirectiveScriptSrcAttr  = "script-src-attr"
+	DirectiveScriptSrcElem  = "script-src-elem"
+	DirectiveStyleSrc       = "style-src"
+	DirectiveStyleSrcAttr   = "style-src-attr"
+	DirectiveStyleSrcElem   = "style-src-elem"
+	DirectiveWorkerSrc      = "worker-src"
+
+	// Document directives
+	DirectiveBaseURI = "base-uri"
+	DirectiveSandbox = "sandbox"
+
+	// Navigation directives
+	DirectiveFormAction     = "form-action"
+	DirectiveFrameAncestors = "frame-ancestors"
+
+	// Reporting directives
+	DirectiveReportURI = "report-uri"
+	DirectiveReportTo  = "report-to"
+
+	// 'Other' directives
+	DirectiveBlockAllMixedContent    = "block-all-mixed-content"
+	DirectiveUpgradeInsecureRequests = "upgrade-insecure-requests"
+)
+
+// ErrUnknownDirective is returned for a directive name that has no field on Policy
+var ErrUnknownDirective = errors.New("unknown directive")
+
+// Directives returns the name of every directive a Policy can express, in the order they are rendered
+func Directives() []string {
+	return append([]string(nil), directiveOrder...)
+}
+
+// Directive returns the field backing the named directive: a CSPSourceOptions for source list directives,
+// SandboxOptions, FrameAncestorOptions, UnquotedOptions for report-uri, UnquotedOption for report-to, or a bool for
+// the valueless directives.  ok is false for an unknown name.
+func (pol *Policy) Directive(name string) (v interface{}, ok bool) {
+	if cso := pol.sourceOptionsByName(name); cso != nil {
+		return *cso, true
+	}
+
+	switch name {
+	case DirectiveSandbox:
+		return pol.CSP.Sandbox, true
+	case DirectiveFrameAncestors:
+		return pol.CSP.FrameAncestors, true
+	case DirectiveReportURI:
+		return pol.CSP.ReportURI, true
+	case DirectiveReportTo:
+		return pol.CSP.ReportTo, true
+	case DirectiveBlockAllMixedContent:
+		return pol.CSP.BlockAllMixedContent, true
+	case DirectiveUpgradeInsecureRequests:
+		return pol.CSP.UpgradeInsecureRequests, true
+	}
+	return nil, false
+}
+
+// SetDirective sets the field backing the named directive to v, which must be of the type Directive returns for it
+func (pol *Policy) SetDirective(name string, v interface{}) error {
+	current, ok := pol.Directive(name)
+	if !ok {
+		return &DirectiveError{Directive: name, Err: ErrUnknownDirective}
+	}
+	mismatch := &DirectiveError{Directive: name, Err: fmt.Errorf("expected a %T, got a %T", current, v)}
+
+	if cso := pol.sourceOptionsByName(name); cso != nil {
+		sv, ok := v.(CSPSourceOptions)
+		if !ok {
+			return mismatch
+		}
+		*cso = sv
+		return nil
+	}
+
+	switch name {
+	case DirectiveSandbox:
+		so, ok := v.(SandboxOptions)
+		if !ok {
+			return mismatch
+		}
+		pol.CSP.Sandbox = so
+	case DirectiveFrameAncestors:
+		fao, ok := v.(FrameAncestorOptions)
+		if !ok {
+			return mismatch
+		}
+		pol.CSP.FrameAncestors = fao
+	case DirectiveReportURI:
+		uvs, ok := v.(UnquotedOptions)
+		if !ok {
+			return mismatch
+		}
+		pol.CSP.ReportURI = uvs
+	case DirectiveReportTo:
+		uv, ok := v.(UnquotedOption)
+		if !ok {
+			return mismatch
+		}
+		pol.CSP.ReportTo = uv
+	case DirectiveBlockAllMixedContent:
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch
+		}
+		pol.CSP.BlockAllMixedContent = b
+	case DirectiveUpgradeInsecureRequests:
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch
+		}
+		pol.CSP.UpgradeInsecureRequests = b
+	}
+	return nil
+}
+
+// EffectiveDirective returns the directive that governs the named fetch directive under this policy, following the
+// fallback list when the directive is left out of the header (Unset, at its zero value with OmitZeroDirectives, or
+// dropped for rendering the same as default-src without KeepRedundantDirectives):
+// worker-src falls back to child-src, then script-src, then default-src, for example.  When no directive applies,
+// loads of that kind are unrestricted: resolved is empty and opts has Unset set.  name must be a source list
+// directive.
+func (pol *Policy) EffectiveDirective(name string) (resolved string, opts CSPSourceOptions, err error) {
+	if pol.sourceOptionsByName(name) == nil {
+		if _, ok := pol.Directive(name); ok {
+			return "", CSPSourceOptions{}, &DirectiveError{Directive: name, Err: errors.New("not a source list directive")}
+		}
+		return "", CSPSourceOptions{}, &DirectiveError{Directive: name, Err: ErrUnknownDirective}
+	}
+
+	resolved, cso := pol.resolveDirective(name)
+	if cso == nil {
+		return "", CSPSourceOptions{Unset: true}, nil
+	}
+	return resolved, cso.Clone(), nil
+}
+
+// resolveDirective follows the fallback list from the named source list directive to the first directive that
+// is in the header, returning its name and options.  cso is nil when no directive applies at all.
+func (pol *Policy) resolveDirective(name string) (resolved string, cso *CSPSourceOptions) {
+	for _, candidate := range append([]string{name}, directiveFallbacks[name]...) {
+		cso = pol.sourceOptionsByName(candidate)
+		if cso == nil {
+			return "", nil
+		}
+
+		omitted := cso.Unset || len(cso.sourceSet()) == 0
+		// neither OmitZeroDirectives nor the redundancy pass apply to directives without a fallback
+		if len(directiveFallbacks[candidate]) > 0 && (pol.OmitZeroDirectives && cso.isZero() || pol.redundant(*cso)) {
+			omitted = true
+		}
+		if !omitted {
+			return candidate, cso
+		}
+	}
+	return "", nil
+}
+
+// redundant reports whether Load drops a fetch directive with these options for rendering the same as default-src.
+// the browser then falls back past it, which need not lead to default-src: script-src-elem goes to script-src first.
+func (pol *Policy) redundant(cso CSPSourceOptions) bool {
+	if pol.KeepRedundantDirectives || pol.CSP.DefaultSrc.Unset {
+		return false
+	}
+	// parsed from the text, as Load does, so an unloaded policy is resolved the same
+	tmplText := pol.SourceOptionTemplateText
+	if len(tmplText) == 0 {
+		tmplText = TemplateTextSourceOption
+	}
+	tmpl, err := parseTemplate("SourceOption", tmplText, pol.TemplateFuncs)
+	if err != nil {
+		return false
+	}
+	text, err := cso.Parse(tmpl)
+	if err != nil {
+		return false
+	}
+	defaultSrc, err := pol.CSP.DefaultSrc.Parse(tmpl)
+	return err == nil && text == defaultSrc
+}
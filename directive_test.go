@@ -0,0 +1,234 @@
+package cspheader
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDirectiveReturnsACopy(t *testing.T) {
+	pol := SecurityOptionsStaticSite()
+	v, _ := pol.Directive(DirectiveImgSrc)
+	cso := v.(CSPSourceOptions)
+	cso.Allow = !cso.Allow
+	if pol.CSP.ImgSrc.Allow == cso.Allow {
+		t.Errorf("modifying the value Directive returned changed the Policy")
+	}
+}
+
+func TestDirectiveUnknown(t *testing.T) {
+	var pol Policy
+	if v, ok := pol.Directive("script-source"); ok || v != nil {
+		t.Errorf("Directive(script-source) = %v, %v, want nil, false", v, ok)
+	}
+	err := pol.SetDirective("script-source", CSPSourceOptions{})
+	if !errors.Is(err, ErrUnknownDirective) {
+		t.Errorf("SetDirective(script-source) error = %v, want %v", err, ErrUnknownDirective)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	names := Directives()
+	if !reflect.DeepEqual(names, directiveOrder) {
+		t.Errorf("Directives() = %v, want the render order %v", names, directiveOrder)
+	}
+	names[0] = "changed"
+	if directiveOrder[0] == "changed" {
+		t.Errorf("Directives() returned the package's own slice")
+	}
+
+	// every name is backed by a field, and each is rendered under that name
+	pol := everyDirectivePolicy()
+	header := renderCSP(t, pol)
+	for _, name := range Directives() {
+		if _, ok := pol.Directive(name); !ok {
+			t.Errorf("Directive(%q) ok = false", name)
+		}
+		if !strings.Contains(header, name) {
+			t.Errorf("header %q does not include %s", header, name)
+		}
+	}
+}
+
+func TestSetDirective(t *testing.T) {
+	self := CSPSourceOptions{Allow: true, AllowSelf: true}
+	tests := []struct {
+		name  string
+		value interface{}
+		get   func(Policy) interface{}
+	}{
+		{DirectiveScriptSrcElem, self, func(p Policy) interface{} { return p.CSP.ScriptSrcElem }},
+		{DirectiveSandbox, SandboxOptions{AllowScripts: true}, func(p Policy) interface{} { return p.CSP.Sandbox }},
+		{DirectiveFrameAncestors, FrameAncestorOptions{Allow: true, AllowSelf: true}, func(p Policy) interface{} { return p.CSP.FrameAncestors }},
+		{DirectiveReportURI, UnquotedOptions{Values: []string{"/csp"}}, func(p Policy) interface{} { return p.CSP.ReportURI }},
+		{DirectiveReportTo, UnquotedOption{Value: "csp"}, func(p Policy) interface{} { return p.CSP.ReportTo }},
+		{DirectiveUpgradeInsecureRequests, true, func(p Policy) interface{} { return p.CSP.UpgradeInsecureRequests }},
+		{DirectiveBlockAllMixedContent, true, func(p Policy) interface{} { return p.CSP.BlockAllMixedContent }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pol Policy
+			if err := pol.SetDirective(tt.name, tt.value); err != nil {
+				t.Fatalf("SetDirective() error = %v", err)
+			}
+			if got := tt.get(pol); !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("field = %+v, want %+v", got, tt.value)
+			}
+			if got, _ := pol.Directive(tt.name); !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("Directive() = %+v, want %+v", got, tt.value)
+			}
+
+			// a value of the wrong type is rejected and leaves the field alone
+			var de *DirectiveError
+			if err := pol.SetDirective(tt.name, "https://example.com"); !errors.As(err, &de) || de.Directive != tt.name {
+				t.Errorf("SetDirective(string) error = %v, want a DirectiveError for %s", err, tt.name)
+			}
+			if got := tt.get(pol); !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("a rejected value changed the field to %+v", got)
+			}
+		})
+	}
+}
+
+func TestEffectiveDirective(t *testing.T) {
+	self := CSPSourceOptions{Allow: true, AllowSelf: true}
+	unset := CSPSourceOptions{Unset: true}
+
+	// omitted leaves every fetch directive but default-src 'none' out of the header, under OmitZeroDirectives
+	omitted := func() Policy {
+		return Policy{OmitZeroDirectives: true}
+	}
+	// dropped sets only default-src 'none' and script-src 'self', leaving Load to drop the zero valued fetch
+	// directives as redundant with default-src
+	dropped := func() Policy {
+		var pol Policy
+		pol.CSP.ScriptSrc = self
+		return pol
+	}
+
+	tests := []struct {
+		name      string
+		policy    func() Policy
+		directive string
+		want      string
+	}{
+		{"set", func() Policy { p := omitted(); p.CSP.ImgSrc = self; return p }, DirectiveImgSrc, DirectiveImgSrc},
+		{"default-src", omitted, DirectiveImgSrc, DirectiveDefaultSrc},
+		{"worker-src to child-src", func() Policy { p := omitted(); p.CSP.ChildSrc = self; p.CSP.ScriptSrc = self; return p },
+			DirectiveWorkerSrc, DirectiveChildSrc},
+		{"worker-src to script-src", func() Policy { p := omitted(); p.CSP.ScriptSrc = self; return p },
+			DirectiveWorkerSrc, DirectiveScriptSrc},
+		{"fenced-frame-src to frame-src", func() Policy { p := omitted(); p.CSP.FrameSrc = self; return p },
+			DirectiveFencedFrameSrc, DirectiveFrameSrc},
+		{"script-src-attr to script-src", func() Policy { p := omitted(); p.CSP.ScriptSrc = self; return p },
+			DirectiveScriptSrcAttr, DirectiveScriptSrc},
+		{"style-src-elem to default-src", omitted, DirectiveStyleSrcElem, DirectiveDefaultSrc},
+		{"unset", func() Policy {
+			p := SecurityOptionsStaticSite()
+			p.CSP.ImgSrc = unset
+			return p
+		}, DirectiveImgSrc, DirectiveDefaultSrc},
+		{"zero without OmitZeroDirectives is 'none'", func() Policy {
+			var p Policy
+			p.CSP.DefaultSrc = self
+			return p
+		}, DirectiveImgSrc, DirectiveImgSrc},
+		{"unrestricted", func() Policy {
+			p := omitted()
+			p.CSP.DefaultSrc = unset
+			return p
+		}, DirectiveImgSrc, ""},
+		{"dropped script-src-elem to script-src", dropped, DirectiveScriptSrcElem, DirectiveScriptSrc},
+		{"dropped worker-src to script-src", dropped, DirectiveWorkerSrc, DirectiveScriptSrc},
+		{"dropped script-src-attr to script-src", dropped, DirectiveScriptSrcAttr, DirectiveScriptSrc},
+		{"dropped img-src to default-src", dropped, DirectiveImgSrc, DirectiveDefaultSrc},
+		{"kept script-src-elem", func() Policy { p := dropped(); p.KeepRedundantDirectives = true; return p },
+			DirectiveScriptSrcElem, DirectiveScriptSrcElem},
+		{"set but the same as default-src", func() Policy {
+			p := dropped()
+			p.CSP.DefaultSrc = self
+			p.CSP.ImgSrc = self
+			return p
+		}, DirectiveImgSrc, DirectiveDefaultSrc},
+		{"ReactJS preset", func() Policy { return SecurityOptionsReactJS() }, DirectiveScriptSrcElem, DirectiveScriptSrc},
+		{"default-src zero under OmitZeroDirectives is 'none'", func() Policy { return Policy{OmitZeroDirectives: true} },
+			DirectiveImgSrc, DirectiveDefaultSrc},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := tt.policy()
+			resolved, opts, err := pol.EffectiveDirective(tt.directive)
+			if err != nil {
+				t.Fatalf("EffectiveDirective() error = %v", err)
+			}
+			if resolved != tt.want {
+				t.Errorf("EffectiveDirective(%s) = %q, want %q", tt.directive, resolved, tt.want)
+			}
+			if len(resolved) == 0 {
+				if !opts.Unset {
+					t.Errorf("options = %+v, want Unset when nothing applies", opts)
+				}
+				return
+			}
+			v, _ := pol.Directive(resolved)
+			if !reflect.DeepEqual(opts, v) {
+				t.Errorf("options = %+v, want those of %s: %+v", opts, resolved, v)
+			}
+
+			// the browser finds the same directive in the header Load renders
+			rendered := map[string]bool{}
+			for _, d := range strings.Split(renderCSP(t, pol), ";") {
+				if fields := strings.Fields(d); len(fields) > 0 {
+					rendered[fields[0]] = true
+				}
+			}
+			if !rendered[resolved] {
+				t.Errorf("%s is not in the header", resolved)
+			}
+			for _, name := range append([]string{tt.directive}, directiveFallbacks[tt.directive]...) {
+				if name == resolved {
+					break
+				}
+				if rendered[name] {
+					t.Errorf("%s is in the header, ahead of %s in the fallback list", name, resolved)
+				}
+			}
+		})
+	}
+}
+
+func TestEffectiveDirectiveErrors(t *testing.T) {
+	pol := SecurityOptionsStaticSite()
+	for _, tt := range []struct {
+		name    string
+		unknown bool
+	}{
+		{"script-source", true},
+		{DirectiveSandbox, false},
+		{DirectiveReportURI, false},
+	} {
+		_, _, err := pol.EffectiveDirective(tt.name)
+		var de *DirectiveError
+		if !errors.As(err, &de) || de.Directive != tt.name {
+			t.Errorf("EffectiveDirective(%s) error = %v, want a DirectiveError", tt.name, err)
+		}
+		if errors.Is(err, ErrUnknownDirective) != tt.unknown {
+			t.Errorf("EffectiveDirective(%s) error = %v, unknown directive %v", tt.name, err, tt.unknown)
+		}
+	}
+}
+
+func TestEffectiveDirectiveReturnsACopy(t *testing.T) {
+	pol := SecurityOptionsStaticSite()
+	pol.CSP.ImgSrc = CSPSourceOptions{Unset: true}
+	pol.CSP.DefaultSrc.Values = []string{"https://a.example.com"}
+	_, opts, err := pol.EffectiveDirective(DirectiveImgSrc)
+	if err != nil {
+		t.Fatalf("EffectiveDirective() error = %v", err)
+	}
+	opts.Values[0] = "https://evil.example"
+	if pol.CSP.DefaultSrc.Values[0] != "https://a.example.com" {
+		t.Errorf("modifying the returned options changed default-src")
+	}
+}
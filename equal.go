@@ -0,0 +1,184 @@
+package cspheader
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Equal reports whether two policies are semantically the same: directive by directive, the same sources in any
+// order, ignoring templates and duplicates.  A fetch directive left out of the header, as by EffectiveDirective, is
+// compared by its fallback, so it equals one set explicitly to the fallback's sources.
+// Report-only, the report-only candidate, the additional policies in order, and the reporting configuration are
+// compared as well; options that only change validation or warnings, such as Strict, are not.
+func (pol Policy) Equal(other Policy) bool {
+	for _, name := range directiveOrder {
+		if pol.sourceOptionsByName(name) == nil {
+			continue
+		}
+		a, aSet := pol.effectiveSources(name)
+		b, bSet := other.effectiveSources(name)
+		if aSet != bSet || !equalSets(a, b) {
+			return false
+		}
+	}
+
+	if pol.CSP.FrameAncestors.Unset != other.CSP.FrameAncestors.Unset ||
+		(!pol.CSP.FrameAncestors.Unset && !equalSets(pol.CSP.FrameAncestors.sourceSet(), other.CSP.FrameAncestors.sourceSet())) ||
+		!pol.CSP.Sandbox.equal(other.CSP.Sandbox) ||
+		!equalSets(valueSet(pol.CSP.ReportURI.Values), valueSet(other.CSP.ReportURI.Values)) ||
+		pol.CSP.ReportTo.Value != other.CSP.ReportTo.Value ||
+		pol.CSP.UpgradeInsecureRequests != other.CSP.UpgradeInsecureRequests ||
+		pol.CSP.BlockAllMixedContent != other.CSP.BlockAllMixedContent ||
+		!equalStringMaps(pol.CustomDirectives, other.CustomDirectives) {
+		return false
+	}
+
+	if pol.ReportOnly != other.ReportOnly ||
+		!reflect.DeepEqual(pol.ReportTo, other.ReportTo) ||
+		!equalStringMaps(pol.ReportingEndpoints, other.ReportingEndpoints) {
+		return false
+	}
+
+	if len(pol.Additional) != len(other.Additional) {
+		return false
+	}
+	for i := range pol.Additional {
+		if !pol.Additional[i].Equal(other.Additional[i]) {
+			return false
+		}
+	}
+
+	if pol.ReportOnlyCandidate == nil || other.ReportOnlyCandidate == nil {
+		return pol.ReportOnlyCandidate == other.ReportOnlyCandidate
+	}
+	return pol.ReportOnlyCandidate.Equal(*other.ReportOnlyCandidate)
+}
+
+// Equal reports whether two directives' options render the same sources, in any order.  Unset options are equal
+// only to Unset options.
+func (cso CSPSourceOptions) Equal(other CSPSourceOptions) bool {
+	if cso.Unset || other.Unset {
+		return cso.Unset == other.Unset
+	}
+	return equalSets(cso.sourceSet(), other.sourceSet())
+}
+
+// effectiveSources returns the sources that apply for the named source list directive, following the fallback
+// list for a fetch directive left out of the header.  set is false when no directive applies at all.
+func (pol *Policy) effectiveSources(name string) (sources map[string]bool, set bool) {
+	_, cso := pol.resolveDirective(name)
+	if cso == nil {
+		return nil, false
+	}
+	return cso.sourceSet(), true
+}
+
+// sourceExpressions returns the source expressions the default template renders for the options, in order
+func (cso CSPSourceOptions) sourceExpressions() []string {
+	if !cso.Allow {
+		return []string{SourceNone}
+	}
+
+	var exprs []string
+	if cso.AllowSelf {
+		exprs = append(exprs, SourceSelf)
+	}
+	exprs = append(exprs, dedupeValues(quoteKeywordValues(cso.Values))...)
+	for _, kw := range []struct {
+		set     bool
+		keyword string
+	}{
+		{cso.UnsafeEval, SourceUnsafeEval},
+		{cso.WasmUnsafeEval, SourceWasmUnsafeEval},
+		{cso.UnsafeHashes, SourceUnsafeHashes},
+		{cso.UnsafeInline, SourceUnsafeInline},
+	} {
+		if kw.set {
+			exprs = append(exprs, kw.keyword)
+		}
+	}
+	if len(cso.NonceBase64Value) > 0 {
+		exprs = append(exprs, "'nonce-"+trimNonce(cso.NonceBase64Value)+"'")
+	}
+	for _, n := range cso.Nonces {
+		exprs = append(exprs, "'nonce-"+trimNonce(n)+"'")
+	}
+	if len(cso.HashAlgorithmBase64Value) > 0 {
+		exprs = append(exprs, "'"+strings.Trim(cso.HashAlgorithmBase64Value, "'")+"'")
+	}
+	for _, h := range cso.Hashes {
+		exprs = append(exprs, "'"+h.String()+"'")
+	}
+	if cso.StrictDynamic {
+		exprs = append(exprs, SourceStrictDynamic)
+	}
+	if cso.ReportSample {
+		exprs = append(exprs, SourceReportSample)
+	}
+	return exprs
+}
+
+// sourceSet returns the rendered source expressions as a set.  'none' alongside other sources is dropped, as it
+// is by browsers.
+func (cso CSPSourceOptions) sourceSet() map[string]bool {
+	return valueSet(cso.sourceExpressions())
+}
+
+func (fao FrameAncestorOptions) sourceSet() map[string]bool {
+	if !fao.Allow {
+		return valueSet([]string{SourceNone})
+	}
+	values := append(append([]string(nil), fao.HostSources...), fao.SchemeSources...)
+	if fao.AllowSelf {
+		values = append(values, SourceSelf)
+	}
+	return valueSet(values)
+}
+
+// equal compares two sandbox directives.  without any token set, Enabled is what decides whether the directive
+// is present.
+func (so SandboxOptions) equal(other SandboxOptions) bool {
+	if so == (SandboxOptions{}) || other == (SandboxOptions{}) {
+		return so == other
+	}
+	so.Enabled, other.Enabled = true, true
+	return so == other
+}
+
+// valueSet returns the dedupe keys of values as a set
+func valueSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[dedupeKey(v)] = true
+	}
+	if len(set) > 1 {
+		delete(set, dedupeKey(SourceNone))
+	}
+	return set
+}
+
+func equalSets(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalStringMaps compares two maps, treating nil and empty as equal
+func equalStringMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
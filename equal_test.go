@@ -0,0 +1,108 @@
+package cspheader
+
+import "testing"
+
+func TestCSPSourceOptionsEqual(t *testing.T) {
+	self := CSPSourceOptions{Allow: true, AllowSelf: true}
+	tests := []struct {
+		name string
+		a, b CSPSourceOptions
+		want bool
+	}{
+		{"same", self, self, true},
+		{"self as a value", self, CSPSourceOptions{Allow: true, Values: []string{"'self'"}}, true},
+		{"zero is none", CSPSourceOptions{}, CSPSourceOptions{Allow: true, Values: []string{SourceNone}}, true},
+		{"none dropped beside a source", self, CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{SourceNone}}, true},
+		{"unset only equals unset", CSPSourceOptions{Unset: true}, CSPSourceOptions{Unset: true, Allow: true}, true},
+		{"unset and none", CSPSourceOptions{Unset: true}, CSPSourceOptions{}, false},
+		{"different nonce", CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj"}, CSPSourceOptions{Allow: true, NonceBase64Value: "ZGVm"}, false},
+		{"nonce field or list", CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj"}, CSPSourceOptions{Allow: true, Nonces: []string{"YWJj"}}, true},
+		{"extra keyword", self, CSPSourceOptions{Allow: true, AllowSelf: true, ReportSample: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Equal(tt.b); got != tt.want {
+				t.Errorf("Equal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyEqual(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Policy)
+		want   bool
+	}{
+		{"unchanged", func(p *Policy) {}, true},
+		{"values reordered", func(p *Policy) {
+			p.CSP.ImgSrc.Values = []string{"https://b.example.com", "https://a.example.com"}
+		}, true},
+		{"duplicate values", func(p *Policy) {
+			p.CSP.ImgSrc.Values = []string{"https://a.example.com", "https://b.example.com", "https://A.example.com"}
+		}, true},
+		{"self as a value", func(p *Policy) {
+			p.CSP.ImgSrc.AllowSelf = false
+			p.CSP.ImgSrc.Values = append(p.CSP.ImgSrc.Values, "'self'")
+		}, true},
+		{"templates ignored", func(p *Policy) { p.SourceOptionTemplateText = TemplateTextSourceOption }, true},
+		{"strict ignored", func(p *Policy) { p.Strict = true }, true},
+		{"unset fetch directive equals its fallback", func(p *Policy) {
+			p.CSP.FontSrc = CSPSourceOptions{Unset: true}
+		}, true},
+		{"dropped fetch directive equals the directive it falls back to", func(p *Policy) {
+			p.CSP.ScriptSrcElem = CSPSourceOptions{Allow: true, AllowSelf: true}
+		}, true},
+		{"redundant directives kept", func(p *Policy) { p.KeepRedundantDirectives = true }, false},
+		{"value added", func(p *Policy) { p.CSP.ImgSrc.Values = append(p.CSP.ImgSrc.Values, "https://c.example.com") }, false},
+		{"keyword added", func(p *Policy) { p.CSP.ScriptSrc.UnsafeEval = true }, false},
+		{"report-only", func(p *Policy) { p.ReportOnly = true }, false},
+		{"frame-ancestors", func(p *Policy) { p.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, AllowSelf: true} }, false},
+		{"frame-ancestors unset", func(p *Policy) { p.CSP.FrameAncestors.Unset = true }, false},
+		{"sandbox", func(p *Policy) { p.CSP.Sandbox.AllowScripts = true }, false},
+		{"report-uri", func(p *Policy) { p.CSP.ReportURI.Values = []string{"/csp"} }, false},
+		{"upgrade-insecure-requests", func(p *Policy) { p.CSP.UpgradeInsecureRequests = !p.CSP.UpgradeInsecureRequests }, false},
+		{"custom directive", func(p *Policy) { p.CustomDirectives = map[string]string{"trusted-types": "default"} }, false},
+		{"reporting endpoints", func(p *Policy) { p.ReportingEndpoints = map[string]string{"csp": "/csp"} }, false},
+		{"report-to groups", func(p *Policy) { p.ReportTo.Groups = []ReportToGroup{{Group: "csp"}} }, false},
+		{"additional policy", func(p *Policy) { p.Additional = []Policy{{}} }, false},
+		{"report-only candidate", func(p *Policy) {
+			candidate := p.Clone()
+			p.ReportOnlyCandidate = &candidate
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := func() Policy {
+				pol := SecurityOptionsStaticSite()
+				pol.CSP.ImgSrc.Values = []string{"https://a.example.com", "https://b.example.com"}
+				pol.CSP.FontSrc = pol.CSP.DefaultSrc
+				return pol
+			}
+			a, b := base(), base()
+			tt.modify(&b)
+			if got := a.Equal(b); got != tt.want {
+				t.Errorf("a.Equal(b) = %v, want %v", got, tt.want)
+			}
+			if got := b.Equal(a); got != tt.want {
+				t.Errorf("b.Equal(a) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyEqualAbsentFrameAncestors(t *testing.T) {
+	a, err := ParsePolicy("default-src 'self'")
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	b := a.Clone()
+	b.CSP.FrameAncestors = FrameAncestorOptions{Unset: true, Allow: true, AllowSelf: true}
+	if !a.Equal(b) || !b.Equal(a) {
+		t.Errorf("Equal() = false, want the sources of an Unset frame-ancestors ignored")
+	}
+	b.CSP.FrameAncestors.Unset = false
+	if a.Equal(b) || b.Equal(a) {
+		t.Errorf("Equal() = true for an absent frame-ancestors and frame-ancestors 'self'")
+	}
+}
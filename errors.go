@@ -0,0 +1,40 @@
+package cspheader
+
+import (
+	"fmt"
+)
+
+// DirectiveError records an error validating or rendering a single directive.  Use errors.As to recover the
+// directive name.
+type DirectiveError struct {
+	Directive string
+	Err       error
+}
+
+func (e *DirectiveError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Directive, e.Err)
+}
+
+func (e *DirectiveError) Unwrap() error {
+	return e.Err
+}
+
+// ReportToError records an error in the reporting configuration checked before any directive is rendered: the
+// Report-To and Reporting-Endpoints headers, their endpoints, and whether the report-to directive's Group is
+// configured in either.
+type ReportToError struct {
+	// Group is the report-to directive's value, when the error concerns it
+	Group string
+	Err   error
+}
+
+func (e *ReportToError) Error() string {
+	if len(e.Group) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("report-to %s: %v", e.Group, e.Err)
+}
+
+func (e *ReportToError) Unwrap() error {
+	return e.Err
+}
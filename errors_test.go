@@ -0,0 +1,64 @@
+package cspheader
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDirectiveError(t *testing.T) {
+	const broken = "{{.Missing}}"
+	tests := []struct {
+		name      string
+		configure func(*Policy)
+		directive string
+	}{
+		{"source option", func(pol *Policy) { pol.SourceOptionTemplateText = broken }, "default-src"},
+		{"sandbox", func(pol *Policy) {
+			pol.CSP.Sandbox = SandboxOptions{AllowForms: true}
+			pol.SandboxOptionTemplateText = broken
+		}, DirectiveSandbox},
+		{"frame ancestors", func(pol *Policy) { pol.FrameAncestorOptionsTemplateText = broken }, "frame-ancestors"},
+		{"unquoted options", func(pol *Policy) {
+			pol.CSP.ReportURI = UnquotedOptions{Values: []string{"/csp-reports"}}
+			pol.UnquotedOptionsTextTemplateText = broken
+		}, "report-uri"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsServerRendered()
+			tt.configure(&pol)
+			_, err := pol.Load()
+			var de *DirectiveError
+			if !errors.As(err, &de) {
+				t.Fatalf("Load() error = %v, want a *DirectiveError", err)
+			}
+			if de.Directive != tt.directive {
+				t.Errorf("Directive = %q, want %q", de.Directive, tt.directive)
+			}
+			if !strings.HasPrefix(err.Error(), tt.directive+": ") {
+				t.Errorf("Error() = %q, want it to name %s", err, tt.directive)
+			}
+		})
+	}
+}
+
+func TestReportToError(t *testing.T) {
+	pol := reportingPolicy()
+	pol.CSP.ReportTo = UnquotedOption{Value: "missing"}
+	_, err := pol.Load()
+	var rte *ReportToError
+	if !errors.As(err, &rte) {
+		t.Fatalf("Load() error = %v, want a *ReportToError", err)
+	}
+	if rte.Group != "missing" || !errors.Is(err, ErrReportToGroupNotFound) {
+		t.Errorf("Load() error = %+v, want group missing not found", rte)
+	}
+	if got, want := err.Error(), "report-to missing: "+ErrReportToGroupNotFound.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	var de *DirectiveError
+	if errors.As(err, &de) {
+		t.Errorf("Load() error = %v, want a distinct type from *DirectiveError", err)
+	}
+}
@@ -0,0 +1,229 @@
+package cspheader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// exportHeaders returns the policy's headers in the order RenderHeaderBlock writes them, compiling the Policy first
+// if it has not been.  a header sent for more than one policy is one value joining them with ", ", as Render returns
+// it, which is equivalent and which every config format can express.  config files have no per-request nonce, so a
+// policy using NoncePlaceholder fails with ErrNonceRequired.
+func (pol *Policy) exportHeaders() ([]headerField, error) {
+	if pol.compiled == nil {
+		_, err := pol.Compile()
+		if err != nil {
+			return nil, err
+		}
+	}
+	fields, err := pol.compiled.headerFields("", pol.compiled.reportOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make([]headerField, 0, len(fields))
+	index := make(map[string]int, len(fields))
+	for _, f := range fields {
+		if i, ok := index[f.name]; ok {
+			headers[i].value += ", " + f.value
+			continue
+		}
+		index[f.name] = len(headers)
+		headers = append(headers, f)
+	}
+	return headers, nil
+}
+
+// ExportNginx renders the policy's headers as nginx add_header directives, one per line, for pasting into a server
+// or location block, e.g.
+//
+//	add_header Content-Security-Policy "default-src 'self'; frame-ancestors 'none';" always;
+//
+// Double quotes and backslashes in a value, such as the JSON of Report-To, are backslash-escaped.  nginx expands
+// variables in add_header values and has no escape for '$', so a value containing '$' is an error.  The report-only
+// candidate, additional policies, Report-To, and Reporting-Endpoints headers are included when configured.
+func (pol *Policy) ExportNginx() (string, error) {
+	headers, err := pol.exportHeaders()
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, h := range headers {
+		if strings.Contains(h.value, "$") {
+			return "", fmt.Errorf("exporting nginx config: %s contains '$', which nginx would expand as a variable", h.name)
+		}
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(h.value)
+		fmt.Fprintf(&sb, "add_header %s \"%s\" always;\n", h.name, escaped)
+	}
+	return sb.String(), nil
+}
+
+// ExportApache renders the policy's headers as Apache httpd mod_headers directives, one per line, for a server,
+// virtual host, or .htaccess context, e.g.
+//
+//	Header always set Content-Security-Policy "default-src 'self'; frame-ancestors 'none';"
+//
+// The output requires mod_headers.  Double quotes and backslashes in a value, such as the JSON of Report-To, are
+// backslash-escaped for Apache's argument parsing, and '%' is doubled as mod_headers reads it as the start of a
+// format specifier.  The report-only candidate, additional policies, Report-To, and Reporting-Endpoints headers
+// are included when configured.
+func (pol *Policy) ExportApache() (string, error) {
+	headers, err := pol.exportHeaders()
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, h := range headers {
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`).Replace(h.value)
+		fmt.Fprintf(&sb, "Header always set %s \"%s\"\n", h.name, escaped)
+	}
+	return sb.String(), nil
+}
+
+// CaddyOption configures ExportCaddy
+type CaddyOption func(*caddyConfig)
+
+type caddyConfig struct {
+	json bool
+}
+
+// CaddyWithJSON exports a headers handler for Caddy's JSON config instead of a Caddyfile block
+func CaddyWithJSON() CaddyOption {
+	return func(cfg *caddyConfig) {
+		cfg.json = true
+	}
+}
+
+// ExportCaddy renders the policy's headers as a Caddyfile header block, e.g.
+//
+//	header {
+//		Content-Security-Policy "default-src 'self'; frame-ancestors 'none';"
+//	}
+//
+// or, with CaddyWithJSON, as a headers handler for Caddy's JSON config.  Caddy replaces {placeholders} in header
+// values, so braces are escaped as \{ and \}.  In a Caddyfile, a value containing double quotes or backslashes, such
+// as the JSON of Report-To, is written as a `backtick` token, which Caddy reads without further unescaping; a value
+// containing both those and a backtick is an error.  The report-only candidate, additional policies, Report-To,
+// and Reporting-Endpoints headers are included when configured.
+func (pol *Policy) ExportCaddy(opts ...CaddyOption) (string, error) {
+	cfg := &caddyConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	headers, err := pol.exportHeaders()
+	if err != nil {
+		return "", err
+	}
+	braces := strings.NewReplacer(`{`, `\{`, `}`, `\}`)
+
+	if cfg.json {
+		set := make(map[string][]string, len(headers))
+		for _, h := range headers {
+			set[h.name] = []string{braces.Replace(h.value)}
+		}
+		handler := struct {
+			Handler  string `json:"handler"`
+			Response struct {
+				Set map[string][]string `json:"set"`
+			} `json:"response"`
+		}{Handler: "headers"}
+		handler.Response.Set = set
+
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(handler)
+		if err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("header {\n")
+	for _, h := range headers {
+		token, err := caddyfileToken(braces.Replace(h.value))
+		if err != nil {
+			return "", fmt.Errorf("exporting caddyfile: %s: %w", h.name, err)
+		}
+		fmt.Fprintf(&sb, "\t%s %s\n", h.name, token)
+	}
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
+
+// caddyfileToken quotes a value as a single Caddyfile token.  the Caddyfile lexer only unescapes \" in a quoted
+// token, and leaves any other backslash in place, so a value that needs escaping goes in backticks instead.
+func caddyfileToken(v string) (string, error) {
+	if !strings.ContainsAny(v, `"\`) {
+		return `"` + v + `"`, nil
+	}
+	if strings.Contains(v, "`") {
+		return "", fmt.Errorf("value contains a quote or backslash and a backtick, which cannot be quoted together")
+	}
+	return "`" + v + "`", nil
+}
+
+// ExportHeadersFile renders the policy's headers as a section of a Netlify or Cloudflare Pages _headers file: the
+// path on its own line, followed by each header indented, e.g.
+//
+//	/*
+//	  Content-Security-Policy: default-src 'self'; frame-ancestors 'none';
+//
+// path may contain the * and :placeholder patterns both hosts support.  A path containing whitespace, or a value
+// containing a line break, would corrupt the file and is an error.  Colons in values are written as they are, as
+// only the first colon on a line separates a header's name from its value.
+func (pol *Policy) ExportHeadersFile(path string) (string, error) {
+	if len(path) == 0 || strings.IndexFunc(path, isHeadersFileSpace) >= 0 {
+		return "", fmt.Errorf("exporting _headers: path %q must be non-empty and contain no whitespace", path)
+	}
+
+	headers, err := pol.exportHeaders()
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(path + "\n")
+	for _, h := range headers {
+		if strings.ContainsAny(h.value, "\r\n") {
+			return "", fmt.Errorf("exporting _headers: %s for %s contains a line break", h.name, path)
+		}
+		fmt.Fprintf(&sb, "  %s: %s\n", h.name, h.value)
+	}
+	return sb.String(), nil
+}
+
+// ExportHeadersFileSections renders a _headers file with a section for each path, as ExportHeadersFile does, in
+// path order and separated by blank lines
+func ExportHeadersFileSections(policies map[string]*Policy) (string, error) {
+	paths := make([]string, 0, len(policies))
+	for path := range policies {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	sections := make([]string, len(paths))
+	for i, path := range paths {
+		if policies[path] == nil {
+			return "", fmt.Errorf("exporting _headers: nil policy for %s", path)
+		}
+		section, err := policies[path].ExportHeadersFile(path)
+		if err != nil {
+			return "", err
+		}
+		sections[i] = section
+	}
+	return strings.Join(sections, "\n"), nil
+}
+
+func isHeadersFileSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
@@ -0,0 +1,228 @@
+package cspheader
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const exportCSP = "default-src 'none'; script-src 'self'; style-src-attr 'self' 'unsafe-inline'; base-uri 'none'; " +
+	"form-action 'self'; frame-ancestors 'none'; report-to csp;"
+
+func TestExportNginx(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy func() *Policy
+		want   string
+	}{
+		{
+			name:   "with Report-To",
+			policy: exportPolicy,
+			want: `add_header Content-Security-Policy "` + exportCSP + `" always;` + "\n" +
+				`add_header Report-To "{\"group\":\"csp\",\"max_age\":3600,\"endpoints\":[{\"url\":\"https://r.example.com/csp\"}]}" always;` + "\n",
+		},
+		{
+			name: "report-only",
+			policy: func() *Policy {
+				pol := exportPolicy()
+				pol.ReportOnly = true
+				return pol
+			},
+			want: `add_header Content-Security-Policy-Report-Only "` + exportCSP + `" always;` + "\n" +
+				`add_header Report-To "{\"group\":\"csp\",\"max_age\":3600,\"endpoints\":[{\"url\":\"https://r.example.com/csp\"}]}" always;` + "\n",
+		},
+		{
+			name: "additional policy joined",
+			policy: func() *Policy {
+				pol := SecurityOptionsStaticSite()
+				var additional Policy
+				additional.OmitZeroDirectives = true
+				additional.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+				additional.CSP.BaseURI = CSPSourceOptions{Unset: true}
+				additional.CSP.FormAction = CSPSourceOptions{Unset: true}
+				additional.CSP.FrameAncestors = FrameAncestorOptions{Unset: true}
+				additional.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+				pol.Additional = []Policy{additional}
+				return &pol
+			},
+			want: `add_header Content-Security-Policy "default-src 'none'; connect-src 'self'; font-src 'self'; ` +
+				`img-src 'self' data:; script-src 'self'; style-src 'self'; base-uri 'none'; form-action 'none'; ` +
+				`frame-ancestors 'none'; upgrade-insecure-requests;, script-src 'self';" always;` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy().ExportNginx()
+			if err != nil {
+				t.Fatalf("ExportNginx() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExportNginx() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportNginxErrors(t *testing.T) {
+	variable := exportPolicy()
+	variable.CustomDirectives = map[string]string{"trusted-types": "$host"}
+	if _, err := variable.ExportNginx(); err == nil || !strings.Contains(err.Error(), "'$'") {
+		t.Errorf("ExportNginx() with a '$' error = %v, want one naming '$'", err)
+	}
+
+	nonce := SecurityOptionsStrict()
+	if _, err := nonce.ExportNginx(); !errors.Is(err, ErrNonceRequired) {
+		t.Errorf("ExportNginx() of a per-request nonce policy error = %v, want %v", err, ErrNonceRequired)
+	}
+}
+
+// exportPolicy returns the ReactJS preset with a Report-To group, whose JSON needs escaping in most config formats
+func exportPolicy() *Policy {
+	pol := SecurityOptionsReactJSWithReporting("csp", "https://r.example.com/csp", time.Hour)
+	return &pol
+}
+
+func TestExportApache(t *testing.T) {
+	got, err := exportPolicy().ExportApache()
+	if err != nil {
+		t.Fatalf("ExportApache() error = %v", err)
+	}
+	want := `Header always set Content-Security-Policy "` + exportCSP + `"` + "\n" +
+		`Header always set Report-To "{\"group\":\"csp\",\"max_age\":3600,\"endpoints\":[{\"url\":\"https://r.example.com/csp\"}]}"` + "\n"
+	if got != want {
+		t.Errorf("ExportApache() =\n%s\nwant\n%s", got, want)
+	}
+
+	percent := SecurityOptionsStaticSite()
+	percent.CustomDirectives = map[string]string{"trusted-types": "100%"}
+	got, err = percent.ExportApache()
+	if err != nil {
+		t.Fatalf("ExportApache() error = %v", err)
+	}
+	if !strings.Contains(got, " trusted-types 100%%;\"\n") {
+		t.Errorf("ExportApache() = %q, want '%%' doubled", got)
+	}
+
+	nonce := SecurityOptionsStrict()
+	if _, err := nonce.ExportApache(); !errors.Is(err, ErrNonceRequired) {
+		t.Errorf("ExportApache() of a per-request nonce policy error = %v, want %v", err, ErrNonceRequired)
+	}
+}
+
+func TestCaddyfileToken(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"default-src 'self';", `"default-src 'self';"`, false},
+		{`{"group":"csp"}`, "`{\"group\":\"csp\"}`", false},
+		{`a\b`, "`a\\b`", false},
+		{"a`b", "\"a`b\"", false},
+		{"\"a`b\"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := caddyfileToken(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("caddyfileToken(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("caddyfileToken(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExportCaddy(t *testing.T) {
+	const reportTo = `\{"group":"csp","max_age":3600,"endpoints":[\{"url":"https://r.example.com/csp"\}]\}`
+	tests := []struct {
+		name string
+		opts []CaddyOption
+		want string
+	}{
+		{
+			name: "caddyfile",
+			want: "header {\n" +
+				"\tContent-Security-Policy \"" + exportCSP + "\"\n" +
+				"\tReport-To `" + reportTo + "`\n" +
+				"}\n",
+		},
+		{
+			name: "json",
+			opts: []CaddyOption{CaddyWithJSON()},
+			want: "{\n" +
+				"\t\"handler\": \"headers\",\n" +
+				"\t\"response\": {\n" +
+				"\t\t\"set\": {\n" +
+				"\t\t\t\"Content-Security-Policy\": [\n" +
+				"\t\t\t\t\"" + exportCSP + "\"\n" +
+				"\t\t\t],\n" +
+				"\t\t\t\"Report-To\": [\n" +
+				"\t\t\t\t\"" + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(reportTo) + "\"\n" +
+				"\t\t\t]\n" +
+				"\t\t}\n" +
+				"\t}\n" +
+				"}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := exportPolicy().ExportCaddy(tt.opts...)
+			if err != nil {
+				t.Fatalf("ExportCaddy() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExportCaddy() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportHeadersFile(t *testing.T) {
+	got, err := exportPolicy().ExportHeadersFile("/app/*")
+	if err != nil {
+		t.Fatalf("ExportHeadersFile() error = %v", err)
+	}
+	want := "/app/*\n" +
+		"  Content-Security-Policy: " + exportCSP + "\n" +
+		`  Report-To: {"group":"csp","max_age":3600,"endpoints":[{"url":"https://r.example.com/csp"}]}` + "\n"
+	if got != want {
+		t.Errorf("ExportHeadersFile() =\n%s\nwant\n%s", got, want)
+	}
+
+	for _, path := range []string{"", "/a b", "/a\n/b", "/a\t"} {
+		if _, err := exportPolicy().ExportHeadersFile(path); err == nil {
+			t.Errorf("ExportHeadersFile(%q) error = nil, want an error", path)
+		}
+	}
+}
+
+func TestExportHeadersFileSections(t *testing.T) {
+	static := SecurityOptionsStaticSite()
+	got, err := ExportHeadersFileSections(map[string]*Policy{
+		"/app/*": exportPolicy(),
+		"/*":     &static,
+	})
+	if err != nil {
+		t.Fatalf("ExportHeadersFileSections() error = %v", err)
+	}
+	want := "/*\n" +
+		"  Content-Security-Policy: default-src 'none'; connect-src 'self'; font-src 'self'; img-src 'self' data:; " +
+		"script-src 'self'; style-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'; " +
+		"upgrade-insecure-requests;\n" +
+		"\n" +
+		"/app/*\n" +
+		"  Content-Security-Policy: " + exportCSP + "\n" +
+		`  Report-To: {"group":"csp","max_age":3600,"endpoints":[{"url":"https://r.example.com/csp"}]}` + "\n"
+	if got != want {
+		t.Errorf("ExportHeadersFileSections() =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := ExportHeadersFileSections(map[string]*Policy{"/*": nil}); err == nil {
+		t.Errorf("ExportHeadersFileSections() of a nil policy error = nil, want an error")
+	}
+	nonce := SecurityOptionsStrict()
+	if _, err := ExportHeadersFileSections(map[string]*Policy{"/*": &nonce}); !errors.Is(err, ErrNonceRequired) {
+		t.Errorf("ExportHeadersFileSections() of a per-request nonce policy error = %v, want %v", err, ErrNonceRequired)
+	}
+}
@@ -0,0 +1,31 @@
+package cspheader
+
+import (
+	"context"
+	"html"
+	"html/template"
+)
+
+// TemplateFuncs returns an html/template FuncMap exposing cspNonce, which renders the nonce stored in ctx by
+// Middleware's WithNonce option as an attribute:
+//
+//	<script {{ cspNonce }}>...</script>
+//
+// renders as <script nonce="...">.  If ctx has no nonce, cspNonce renders nothing.
+func TemplateFuncs(ctx context.Context) template.FuncMap {
+	nonce, _ := NonceFromContext(ctx)
+	return NonceTemplateFuncs(nonce)
+}
+
+// NonceTemplateFuncs is TemplateFuncs for a nonce that is already in hand
+func NonceTemplateFuncs(nonce string) template.FuncMap {
+	return template.FuncMap{
+		"cspNonce": func() template.HTMLAttr {
+			if len(nonce) == 0 {
+				return ""
+			}
+			// HTMLAttr is trusted by html/template, so escape the value ourselves
+			return template.HTMLAttr(`nonce="` + html.EscapeString(nonce) + `"`)
+		},
+	}
+}
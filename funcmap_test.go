@@ -0,0 +1,56 @@
+package cspheader
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNonceTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		name  string
+		nonce string
+		want  string
+	}{
+		{"nonce", "abc123", `<script nonce="abc123">x()</script>`},
+		{"no nonce", "", `<script >x()</script>`},
+		{"escaped", `a"b<c`, `<script nonce="a&#34;b&lt;c">x()</script>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := template.Must(template.New("page").Funcs(NonceTemplateFuncs(tt.nonce)).Parse(`<script {{ cspNonce }}>x()</script>`))
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, nil)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if sb.String() != tt.want {
+				t.Errorf("Execute() = %q, want %q", sb.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncsFromMiddleware(t *testing.T) {
+	mw, err := Middleware(noncePolicy(), WithNonce())
+	if err != nil {
+		t.Fatalf("Middleware() error = %v", err)
+	}
+	tmpl := template.Must(template.New("page").Funcs(TemplateFuncs(context.Background())).Parse(`<script {{ cspNonce }}></script>`))
+
+	rec := serve(mw, func(w http.ResponseWriter, r *http.Request) {
+		err := template.Must(tmpl.Clone()).Funcs(TemplateFuncs(r.Context())).Execute(w, nil)
+		if err != nil {
+			t.Errorf("Execute() error = %v", err)
+		}
+	}, nil)
+
+	csp := rec.Header().Get(HeaderContentSecurityPolicy)
+	body := rec.Body.String()
+	nonce := strings.TrimSuffix(strings.TrimPrefix(body, `<script nonce="`), `"></script>`)
+	if len(nonce) == 0 || nonce == body || !strings.Contains(csp, "'nonce-"+nonce+"'") {
+		t.Errorf("body %q does not carry the nonce of the header %q", body, csp)
+	}
+}
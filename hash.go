@@ -0,0 +1,112 @@
+package cspheader
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// HashAlgorithm is a hash algorithm permitted in a CSP hash source
+// https://www.w3.org/TR/CSP3/#grammardef-hash-algorithm
+type HashAlgorithm string
+
+const (
+	HashSHA256 HashAlgorithm = "sha256"
+	HashSHA384 HashAlgorithm = "sha384"
+	HashSHA512 HashAlgorithm = "sha512"
+)
+
+func (alg HashAlgorithm) valid() bool {
+	switch alg {
+	case HashSHA256, HashSHA384, HashSHA512:
+		return true
+	}
+	return false
+}
+
+// Hash is a hash source, rendered as '<hash-algorithm>-<base64-value>'
+type Hash struct {
+	Algorithm HashAlgorithm `json:"algorithm,omitempty"`
+	Base64    string        `json:"base64,omitempty"`
+}
+
+// String returns the unquoted <hash-algorithm>-<base64-value> form of the hash
+func (h Hash) String() string {
+	return fmt.Sprintf("%s-%s", h.Algorithm, h.Base64)
+}
+
+func (h Hash) validate() error {
+	if !h.Algorithm.valid() {
+		return fmt.Errorf("hash source %q must use sha256, sha384, or sha512", h.String())
+	}
+	if !isBase64Value(h.Base64) {
+		return fmt.Errorf("hash source %q does not have a valid base64 value", h.String())
+	}
+	return nil
+}
+
+// parseHash converts <hash-algorithm>-<base64-value> into a Hash
+func parseHash(hash string) (Hash, error) {
+	algorithm, b64, found := strings.Cut(hash, "-")
+	if !found {
+		return Hash{}, fmt.Errorf("hash source %q must be of the form <hash-algorithm>-<base64-value>", hash)
+	}
+
+	h := Hash{Algorithm: HashAlgorithm(strings.ToLower(algorithm)), Base64: b64}
+	return h, h.validate()
+}
+
+func (alg HashAlgorithm) newHash() (hash.Hash, error) {
+	switch alg {
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashSHA384:
+		return sha512.New384(), nil
+	case HashSHA512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q: must be sha256, sha384, or sha512", string(alg))
+}
+
+// HashFromBytes hashes b and returns the <hash-algorithm>-<base64-value> token for use in HashAlgorithmBase64Value.
+// The bytes are hashed exactly as given: browsers hash the element's content verbatim, so whitespace and newlines
+// (including a trailing newline) change the result.
+// HashFromBytes panics if alg is not sha256, sha384, or sha512.
+func HashFromBytes(alg HashAlgorithm, b []byte) string {
+	h, err := alg.newHash()
+	if err != nil {
+		panic(err)
+	}
+	h.Write(b)
+	return Hash{Algorithm: alg, Base64: base64.StdEncoding.EncodeToString(h.Sum(nil))}.String()
+}
+
+// HashFromReader hashes everything read from r and returns the <hash-algorithm>-<base64-value> token.
+// As with HashFromBytes, no trimming or newline normalization is performed.
+func HashFromReader(alg HashAlgorithm, r io.Reader) (string, error) {
+	h, err := alg.newHash()
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	return Hash{Algorithm: alg, Base64: base64.StdEncoding.EncodeToString(h.Sum(nil))}.String(), nil
+}
+
+// HashInlineScript hashes the body of an inline <script> (the text between the opening and closing tags, not
+// including the tags) and returns both the <hash-algorithm>-<base64-value> token and the raw base64 value.
+func HashInlineScript(alg HashAlgorithm, body string) (token string, b64 string, err error) {
+	h, err := alg.newHash()
+	if err != nil {
+		return "", "", err
+	}
+	h.Write([]byte(body))
+	src := Hash{Algorithm: alg, Base64: base64.StdEncoding.EncodeToString(h.Sum(nil))}
+	return src.String(), src.Base64, nil
+}
@@ -0,0 +1,196 @@
+package cspheader
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// emptySHA256 is the sha256 of no bytes
+const emptySHA256 = "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+func TestHashSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CSPSourceOptions
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "legacy field quoted",
+			options: CSPSourceOptions{Allow: true, HashAlgorithmBase64Value: "sha256-" + emptySHA256},
+			want:    "'sha256-" + emptySHA256 + "'",
+		},
+		{
+			name:    "legacy field already quoted",
+			options: CSPSourceOptions{Allow: true, HashAlgorithmBase64Value: "'sha256-" + emptySHA256 + "'"},
+			want:    "'sha256-" + emptySHA256 + "'",
+		},
+		{
+			name: "typed hashes after the legacy field",
+			options: CSPSourceOptions{
+				Allow:                    true,
+				AllowSelf:                true,
+				HashAlgorithmBase64Value: "sha256-" + emptySHA256,
+				Hashes:                   []Hash{{Algorithm: HashSHA384, Base64: "abc="}, {Algorithm: HashSHA512, Base64: "def="}},
+			},
+			want: "'self' 'sha256-" + emptySHA256 + "' 'sha384-abc=' 'sha512-def='",
+		},
+		{
+			name:    "invalid legacy algorithm",
+			options: CSPSourceOptions{Allow: true, HashAlgorithmBase64Value: "sha1-abc"},
+			wantErr: "must use sha256, sha384, or sha512",
+		},
+		{
+			name:    "invalid typed value",
+			options: CSPSourceOptions{Allow: true, Hashes: []Hash{{Algorithm: HashSHA256, Base64: "not base64"}}},
+			wantErr: "does not have a valid base64 value",
+		},
+		{
+			name:    "missing typed algorithm",
+			options: CSPSourceOptions{Allow: true, Hashes: []Hash{{Base64: emptySHA256}}},
+			wantErr: "must use sha256, sha384, or sha512",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := Policy{}
+			pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+			pol.CSP.ScriptSrc = tt.options
+			compiled, err := pol.Compile()
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Compile() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			headers, err := compiled.Render("")
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if want := "script-src " + tt.want + ";"; !strings.Contains(headers[HeaderContentSecurityPolicy], want) {
+				t.Errorf("header = %q, want %q", headers[HeaderContentSecurityPolicy], want)
+			}
+		})
+	}
+}
+
+func TestParseHash(t *testing.T) {
+	tests := []struct {
+		hash    string
+		want    Hash
+		wantErr string
+	}{
+		{hash: "sha256-" + emptySHA256, want: Hash{Algorithm: HashSHA256, Base64: emptySHA256}},
+		{hash: "SHA384-abc=", want: Hash{Algorithm: HashSHA384, Base64: "abc="}},
+		{hash: "sha512-a-b_c", want: Hash{Algorithm: HashSHA512, Base64: "a-b_c"}},
+		{hash: "md5-abc", wantErr: "must use sha256, sha384, or sha512"},
+		{hash: "sha256", wantErr: "must be of the form <hash-algorithm>-<base64-value>"},
+		{hash: "sha256-", wantErr: "does not have a valid base64 value"},
+		{hash: "sha256-abc'; script-src *", wantErr: "does not have a valid base64 value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hash, func(t *testing.T) {
+			got, err := parseHash(tt.hash)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseHash() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHash() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseHash() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashHelperErrors(t *testing.T) {
+	if _, err := HashFromReader("md5", strings.NewReader("")); err == nil {
+		t.Errorf("HashFromReader(md5) error = nil")
+	}
+	if _, _, err := HashInlineScript("sha1", ""); err == nil {
+		t.Errorf("HashInlineScript(sha1) error = nil")
+	}
+	if _, err := HashFromReader(HashSHA256, errReader{}); !errors.Is(err, errReadFailed) {
+		t.Errorf("HashFromReader() of a failing reader error = %v, want %v", err, errReadFailed)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("HashFromBytes(md5) did not panic")
+		}
+	}()
+	HashFromBytes("md5", nil)
+}
+
+// TestHashHelpers checks the helpers against known digests, including the example of the CSP3 specification
+func TestHashHelpers(t *testing.T) {
+	tests := []struct {
+		alg  HashAlgorithm
+		body string
+		want string
+	}{
+		// https://www.w3.org/TR/CSP3/#example-ff2e9efe
+		{HashSHA256, "alert('Hello, world.');", "sha256-qznLcsROx4GACP2dm0UCKCzCG+HiZ1guq6ZZDob/Tng="},
+		{HashSHA256, "", "sha256-" + emptySHA256},
+		{HashSHA384, "", "sha384-OLBgp1GsljhM2TJ+sbHjaiH9txEUvgdDTAzHv2P24donTt6/529l+9Ua0vFImLlb"},
+		{HashSHA512, "", "sha512-z4PhNX7vuL3xVChQ1m2AB9Yg5AULVxXcg/SpIdNs6c5H0NE8XYXysP+DGNKHfuwvY7kxvUdBeoGlODJ6+SfaPg=="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := HashFromBytes(tt.alg, []byte(tt.body)); got != tt.want {
+				t.Errorf("HashFromBytes() = %q, want %q", got, tt.want)
+			}
+
+			got, err := HashFromReader(tt.alg, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("HashFromReader() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("HashFromReader() = %q, want %q", got, tt.want)
+			}
+
+			token, b64, err := HashInlineScript(tt.alg, tt.body)
+			if err != nil {
+				t.Fatalf("HashInlineScript() error = %v", err)
+			}
+			if token != tt.want || string(tt.alg)+"-"+b64 != tt.want {
+				t.Errorf("HashInlineScript() = %q, %q, want %q", token, b64, tt.want)
+			}
+			if _, err := parseHash(token); err != nil {
+				t.Errorf("parseHash(%q) error = %v", token, err)
+			}
+		})
+	}
+}
+
+func TestHashHelpersVerbatim(t *testing.T) {
+	if HashFromBytes(HashSHA256, []byte("a")) == HashFromBytes(HashSHA256, []byte("a\n")) {
+		t.Errorf("HashFromBytes() ignores a trailing newline, which browsers hash")
+	}
+}
+
+func (errReader) Read([]byte) (int, error) { return 0, errReadFailed }
+
+type errReader struct{}
+
+var errReadFailed = errors.New("read failed")
+
+func TestHashJSON(t *testing.T) {
+	pol, err := NewPolicyFromJSON(strings.NewReader(`{"csp": {"script-src": {"allow": true, "hashes": [{"algorithm": "sha256", "base64": "` + emptySHA256 + `"}]}}}`))
+	if err != nil {
+		t.Fatalf("NewPolicyFromJSON() error = %v", err)
+	}
+	want := []Hash{{Algorithm: HashSHA256, Base64: emptySHA256}}
+	if !reflect.DeepEqual(pol.CSP.ScriptSrc.Hashes, want) {
+		t.Errorf("Hashes = %+v, want %+v", pol.CSP.ScriptSrc.Hashes, want)
+	}
+}
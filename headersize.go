@@ -0,0 +1,95 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxHeaderBytes is the header size over which Load warns when Policy.MaxHeaderBytes is unset.  Common CDN
+// and proxy limits on a single header value are around 8KB.
+const DefaultMaxHeaderBytes = 8 << 10
+
+// ErrHeaderTooLarge is returned when the rendered header is over Policy.MaxHeaderBytes
+var ErrHeaderTooLarge = errors.New("header is too large")
+
+// largestDirectivesReported is how many of the largest directives a header size warning or error lists
+const largestDirectivesReported = 3
+
+// checkHeaderSize measures the header rendered from the parsed directives against MaxHeaderBytes, or warns if it
+// is over DefaultMaxHeaderBytes when MaxHeaderBytes is unset.  nonce-bearing directives are measured with their
+// nonces as configured.
+func (pol *Policy) checkHeaderSize() error {
+	limit := pol.MaxHeaderBytes
+	if limit < 0 {
+		return nil
+	}
+	if limit == 0 {
+		limit = DefaultMaxHeaderBytes
+	}
+
+	total, sizes := pol.directiveSizes()
+	if total <= limit {
+		return nil
+	}
+
+	names := make([]string, 0, len(sizes))
+	for name := range sizes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sizes[names[i]] != sizes[names[j]] {
+			return sizes[names[i]] > sizes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > largestDirectivesReported {
+		names = names[:largestDirectivesReported]
+	}
+	largest := make([]string, len(names))
+	for i, name := range names {
+		largest[i] = fmt.Sprintf("%s (%d bytes)", name, sizes[name])
+	}
+	msg := fmt.Sprintf("header is %d bytes, over the limit of %d; largest directives: %s",
+		total, limit, strings.Join(largest, ", "))
+
+	if pol.MaxHeaderBytes > 0 {
+		return fmt.Errorf("%w: %s", ErrHeaderTooLarge, msg)
+	}
+	pol.warn(WarnHeaderTooLarge, names[0], "%s", msg)
+	return nil
+}
+
+// directiveSizes returns the size of the header value directiveString renders from the parsed directives, and the
+// size of each directive within it, including its trailing ';'
+func (pol *Policy) directiveSizes() (total int, sizes map[string]int) {
+	sizes = map[string]int{}
+	add := func(name, value string) {
+		size := len(name) + len(";")
+		if len(value) > 0 && value != name {
+			size += len(" ") + len(value)
+		}
+		sizes[name] = size
+	}
+
+	for _, directives := range []map[string]string{pol.cspStaticDirectives, pol.cspDynamicDirectives} {
+		for name, value := range directives {
+			if len(value) > 0 {
+				add(name, value)
+			}
+		}
+	}
+	for name, value := range pol.CustomDirectives {
+		add(name, strings.TrimSpace(value))
+	}
+
+	for _, size := range sizes {
+		total += size
+	}
+	// directives are separated by a single space
+	if len(sizes) > 1 {
+		total += len(sizes) - 1
+	}
+	return total, sizes
+}
@@ -0,0 +1,88 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDirectiveSizesMatchHeader(t *testing.T) {
+	policies := presets()
+	policies["every directive"] = everyDirectivePolicy()
+	policies["custom"] = func() Policy {
+		pol := SecurityOptionsStaticSite()
+		pol.CustomDirectives = map[string]string{"trusted-types": " default ", "webrtc": ""}
+		return pol
+	}()
+	for name, pol := range policies {
+		t.Run(name, func(t *testing.T) {
+			headers, err := pol.Load()
+			if err != nil {
+				// a policy with a per-request nonce is measured with its placeholder, which Load does not render
+				t.Skipf("Load() error = %v", err)
+			}
+			header := headers[HeaderContentSecurityPolicy] + headers[HeaderContentSecurityPolicyReportOnly]
+			if total, _ := pol.directiveSizes(); total != len(header) {
+				t.Errorf("directiveSizes() total = %d, want the header length %d: %q", total, len(header), header)
+			}
+		})
+	}
+}
+
+func TestHeaderTooLargeNamesTheLargestDirectives(t *testing.T) {
+	pol := largePolicy()
+	pol.MaxHeaderBytes = 64
+	_, err := pol.Load()
+	if err == nil {
+		t.Fatal("Load() error = nil")
+	}
+	msg := err.Error()
+	for _, want := range []string{"over the limit of 64", "largest directives: img-src (", "upgrade-insecure-requests (26 bytes)"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not mention %q", msg, want)
+		}
+	}
+	if strings.Count(msg, " bytes)") != largestDirectivesReported {
+		t.Errorf("error %q lists %d directives, want %d", msg, strings.Count(msg, " bytes)"), largestDirectivesReported)
+	}
+}
+
+func TestMaxHeaderBytes(t *testing.T) {
+	size := len(renderCSP(t, SecurityOptionsStaticSite()))
+	tests := []struct {
+		name        string
+		policy      func() Policy
+		wantErr     bool
+		wantWarning bool
+	}{
+		{"at the limit", func() Policy { p := SecurityOptionsStaticSite(); p.MaxHeaderBytes = size; return p }, false, false},
+		{"over the limit", func() Policy { p := SecurityOptionsStaticSite(); p.MaxHeaderBytes = size - 1; return p }, true, false},
+		{"default limit", largePolicy, false, true},
+		{"disabled", func() Policy { p := largePolicy(); p.MaxHeaderBytes = -1; return p }, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := tt.policy()
+			_, warnings, err := pol.LoadWithWarnings()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadWithWarnings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrHeaderTooLarge) {
+				t.Errorf("LoadWithWarnings() error = %v, want %v", err, ErrHeaderTooLarge)
+			}
+			if got := hasWarning(warnings, WarnHeaderTooLarge, DirectiveImgSrc); got != tt.wantWarning {
+				t.Errorf("WarnHeaderTooLarge for img-src = %v, want %v: %v", got, tt.wantWarning, warnings)
+			}
+		})
+	}
+}
+
+// largePolicy returns the static site preset with img-src grown to over DefaultMaxHeaderBytes
+func largePolicy() Policy {
+	pol := SecurityOptionsStaticSite()
+	for i := 0; len(strings.Join(pol.CSP.ImgSrc.Values, " ")) <= DefaultMaxHeaderBytes; i++ {
+		pol.CSP.ImgSrc.Values = append(pol.CSP.ImgSrc.Values, fmt.Sprintf("https://img%d.example.com", i))
+	}
+	return pol
+}
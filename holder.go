@@ -0,0 +1,54 @@
+package cspheader
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// PolicyHolder holds the active policy of a running server, so that it can be replaced, e.g. to add a vendor host,
+// without a restart.  Requests in flight keep the policy they started with.  A PolicyHolder is safe for concurrent
+// use and must not be copied after first use.
+type PolicyHolder struct {
+	current atomic.Pointer[CompiledPolicy]
+}
+
+// NewPolicyHolder compiles pol and returns a PolicyHolder with it as the active policy
+func NewPolicyHolder(pol Policy) (*PolicyHolder, error) {
+	h := &PolicyHolder{}
+	err := h.Swap(pol)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Load returns the active policy.  It returns nil for a zero PolicyHolder that has not had a policy swapped in.
+func (h *PolicyHolder) Load() *CompiledPolicy {
+	return h.current.Load()
+}
+
+// Swap compiles pol and makes it the active policy.  If pol fails to compile, the active policy is left in place
+// and the error is returned.
+func (h *PolicyHolder) Swap(pol Policy) error {
+	compiled, err := pol.Compile()
+	if err != nil {
+		return err
+	}
+	h.current.Store(compiled)
+	return nil
+}
+
+// Middleware returns net/http middleware that sets the headers of the holder's active policy on every response,
+// reading it afresh for each request.  opts are as for Middleware.  Unlike Middleware, headers are rendered per
+// request, and a policy that cannot be rendered (e.g. one needing a nonce without WithNonce) fails the request
+// with a 500, as does a holder with no policy.
+func (h *PolicyHolder) Middleware(opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := &middlewareConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg.handler(func() (*CompiledPolicy, http.Header) {
+		return h.Load(), nil
+	})
+}
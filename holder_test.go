@@ -0,0 +1,129 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestPolicyHolderConcurrentSwap swaps between two policies while a server using the holder's middleware serves
+// requests, and checks that every response carries one of the two policies whole.  Run it with -race.
+func TestPolicyHolderConcurrentSwap(t *testing.T) {
+	base, vendor := holderPolicies()
+	h, err := NewPolicyHolder(base)
+	if err != nil {
+		t.Fatalf("NewPolicyHolder() error = %v", err)
+	}
+	want := map[string]bool{}
+	for _, pol := range []Policy{base, vendor} {
+		want[renderCSP(t, pol)] = true
+	}
+
+	srv := httptest.NewServer(h.Middleware(WithNonce())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := NonceFromContext(r.Context()); !ok {
+			http.Error(w, "no nonce", http.StatusInternalServerError)
+		}
+	})))
+	defer srv.Close()
+
+	const clients, requests, swaps = 8, 25, 200
+	var wg sync.WaitGroup
+	errs := make(chan error, clients+1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < swaps; i++ {
+			pol := base
+			if i%2 == 0 {
+				pol = vendor
+			}
+			if err := h.Swap(pol); err != nil {
+				errs <- err
+				return
+			}
+			if h.Load() == nil {
+				errs <- errors.New("Load() = nil after a Swap")
+				return
+			}
+		}
+	}()
+
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- func() error {
+				for i := 0; i < requests; i++ {
+					resp, err := srv.Client().Get(srv.URL)
+					if err != nil {
+						return err
+					}
+					resp.Body.Close()
+					if resp.StatusCode != http.StatusOK {
+						return fmt.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+					}
+					if got := resp.Header.Get(HeaderContentSecurityPolicy); !want[got] {
+						return fmt.Errorf("%s = %q, want one of the swapped policies", HeaderContentSecurityPolicy, got)
+					}
+				}
+				return nil
+			}()
+		}()
+	}
+	wg.Wait()
+	<-done
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestPolicyHolderSwapInvalid(t *testing.T) {
+	base, _ := holderPolicies()
+	h, err := NewPolicyHolder(base)
+	if err != nil {
+		t.Fatalf("NewPolicyHolder() error = %v", err)
+	}
+	before := h.Load()
+
+	invalid := base.Clone()
+	invalid.CSP.ScriptSrc.Values = []string{"self"}
+	err = h.Swap(invalid)
+	if !errors.Is(err, ErrUnquotedKeyword) {
+		t.Errorf("Swap() error = %v, want %v", err, ErrUnquotedKeyword)
+	}
+	if h.Load() != before {
+		t.Errorf("Swap() of an invalid policy replaced the active policy")
+	}
+
+	_, err = NewPolicyHolder(invalid)
+	if !errors.Is(err, ErrUnquotedKeyword) {
+		t.Errorf("NewPolicyHolder() error = %v, want %v", err, ErrUnquotedKeyword)
+	}
+}
+
+func TestPolicyHolderZero(t *testing.T) {
+	var h PolicyHolder
+	if got := h.Load(); got != nil {
+		t.Errorf("Load() = %p, want nil for a zero PolicyHolder", got)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Middleware()(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Middleware() status = %d, want %d without a policy", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+// holderPolicies returns a policy and the same policy with a vendor host added, as a server would swap between
+func holderPolicies() (Policy, Policy) {
+	base := SecurityOptionsServerRendered()
+	vendor := SecurityOptionsServerRendered(WithScriptHosts("https://vendor.example.com"))
+	return base, vendor
+}
@@ -0,0 +1,162 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidHostSource is returned for a value that is not a valid host-source or scheme-source expression
+var ErrInvalidHostSource = errors.New("invalid host source")
+
+// ValidateHostSource checks s against the CSP source expression grammar for the values that are not quoted:
+//   - a scheme-source, e.g. https: or data:
+//   - a bare *
+//   - a host-source: an optional scheme followed by ://, a host whose leftmost label may be * (or which may be * in
+//     its entirety), an optional port that is a number or *, and an optional path beginning with /
+//
+// https://www.w3.org/TR/CSP3/#grammardef-host-source
+func ValidateHostSource(s string) error {
+	if len(s) == 0 {
+		return fmt.Errorf("%w: empty value", ErrInvalidHostSource)
+	}
+	if s == "*" {
+		return nil
+	}
+
+	rest := s
+	if i := strings.Index(rest, "://"); i >= 0 {
+		if !isSchemePart(rest[:i]) {
+			return fmt.Errorf("%w %q: invalid scheme", ErrInvalidHostSource, s)
+		}
+		rest = rest[i+len("://"):]
+	} else if strings.HasSuffix(rest, ":") && isSchemePart(rest[:len(rest)-1]) {
+		// scheme-source
+		return nil
+	}
+
+	host := rest
+	path := ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		host, path = rest[:i], rest[i:]
+	}
+
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		port := host[i+1:]
+		host = host[:i]
+		if port != "*" && !isDigits(port) {
+			return fmt.Errorf("%w %q: port must be a number or *", ErrInvalidHostSource, s)
+		}
+	}
+
+	if !isHostPart(host) {
+		return fmt.Errorf("%w %q: host must be * or dot separated labels of letters, digits, and -, optionally "+
+			"beginning with a * label", ErrInvalidHostSource, s)
+	}
+	if !isPathPart(path) {
+		return fmt.Errorf("%w %q: invalid path", ErrInvalidHostSource, s)
+	}
+	return nil
+}
+
+// isSchemePart checks scheme-part = ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+func isSchemePart(s string) bool {
+	if len(s) == 0 || !isAlpha(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !isAlpha(c) && !isDigit(c) && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// isHostPart checks host-part = "*" / [ "*." ] 1*host-char *( "." 1*host-char ) [ "." ]
+func isHostPart(s string) bool {
+	if s == "*" {
+		return true
+	}
+	s = strings.TrimPrefix(s, "*.")
+	s = strings.TrimSuffix(s, ".")
+	if len(s) == 0 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if len(label) == 0 {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !isAlpha(c) && !isDigit(c) && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isPathPart checks for an empty path or an absolute path of RFC 3986 pchars.  ';' and ',' are excluded, as they
+// would be read as the end of the directive or policy.
+func isPathPart(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	if s[0] != '/' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isAlpha(c), isDigit(c), strings.IndexByte("-._~!$&'()*+=:@/", c) >= 0:
+		case c == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return false
+			}
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func isDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateHostSources runs ValidateHostSource on each value that is not quoted.  quoted values are keywords,
+// nonces, or hashes, which are checked elsewhere.
+func validateHostSources(directive string, values []string) error {
+	for _, v := range values {
+		if strings.HasPrefix(v, "'") {
+			continue
+		}
+		err := ValidateHostSource(v)
+		if err != nil {
+			return &DirectiveError{Directive: directive, Err: err}
+		}
+	}
+	return nil
+}
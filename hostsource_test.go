@@ -0,0 +1,87 @@
+package cspheader
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHostSourceValidationOnLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Policy)
+		directive string
+	}{
+		{"source list", func(pol *Policy) { pol.CSP.ImgSrc.Values = []string{"example.*.com"} }, "img-src"},
+		{"frame-ancestors host", func(pol *Policy) {
+			pol.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, HostSources: []string{"https://exa_mple.com"}}
+		}, "frame-ancestors"},
+		{"frame-ancestors scheme", func(pol *Policy) {
+			pol.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, SchemeSources: []string{"1https:"}}
+		}, "frame-ancestors"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsServerRendered()
+			tt.configure(&pol)
+			_, err := pol.Load()
+			var de *DirectiveError
+			if !errors.Is(err, ErrInvalidHostSource) || !errors.As(err, &de) || de.Directive != tt.directive {
+				t.Errorf("Load() error = %v, want %v for %s", err, ErrInvalidHostSource, tt.directive)
+			}
+		})
+	}
+
+	// quoted values are keywords, nonces, or hashes and are not host sources
+	pol := SecurityOptionsServerRendered()
+	pol.CSP.ImgSrc.Values = []string{SourceReportSample}
+	_, err := pol.Load()
+	if err != nil {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestValidateHostSource(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr bool
+	}{
+		{"*", false},
+		{"https:", false},
+		{"data:", false},
+		{"example.com", false},
+		{"example.com.", false},
+		{"*.example.com", false},
+		{"https://*.example.com:*", false},
+		{"https://example.com:8443/path/to/file.js", false},
+		{"wss://example.com/socket", false},
+		{"https://example.com/a%20b", false},
+		{"https://example.com/~user/(x)", false},
+		{"localhost:3000", false},
+
+		{"", true},
+		{"https://", true},
+		{"1http://example.com", true},
+		{"example.*.com", true},
+		{"*example.com", true},
+		{"*.*.example.com", true},
+		{"example..com", true},
+		{"exa_mple.com", true},
+		{"example.com:80a", true},
+		{"https://example.com:", true},
+		{"https://example.com/a%2", true},
+		{"https://example.com/a%zz", true},
+		{"https://example.com/a\"b", true},
+		{"https://example.com?query", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			err := ValidateHostSource(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateHostSource(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrInvalidHostSource) {
+				t.Errorf("ValidateHostSource(%q) error = %v, want %v", tt.source, err, ErrInvalidHostSource)
+			}
+		})
+	}
+}
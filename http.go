@@ -0,0 +1,49 @@
+package cspheader
+
+import (
+	"net/http"
+)
+
+// Apply sets the policy's headers on h, compiling the Policy first if it has not been loaded or compiled.
+// Headers are replaced rather than added, so repeated calls do not stack duplicates.  Nothing is written to h if
+// rendering fails.
+func (pol *Policy) Apply(h http.Header) error {
+	if pol.compiled == nil {
+		_, err := pol.Compile()
+		if err != nil {
+			return err
+		}
+	}
+	return pol.compiled.Apply(h)
+}
+
+// Apply sets the compiled policy's headers on h, with a header line for each of the Additional policies.  Nothing is
+// written to h if rendering fails.
+func (cp *CompiledPolicy) Apply(h http.Header) error {
+	headers, err := cp.Header("")
+	if err != nil {
+		return err
+	}
+	setHeaders(h, headers)
+	return nil
+}
+
+// LoadHeaders is Load returning an http.Header, in which each of the Additional policies is its own value of
+// Content-Security-Policy (or Content-Security-Policy-Report-Only) rather than joined into one
+func (pol *Policy) LoadHeaders() (http.Header, error) {
+	compiled, err := pol.Compile()
+	if err != nil {
+		return nil, err
+	}
+	return compiled.Header("")
+}
+
+// setHeaders copies rendered headers onto h, replacing any values h already has for them
+func setHeaders(h http.Header, headers http.Header) {
+	for k, values := range headers {
+		h.Del(k)
+		for _, v := range values {
+			h.Add(k, v)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package cspheader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	pol := layeredWriterPolicy()
+	want, err := pol.LoadHeaders()
+	if err != nil {
+		t.Fatalf("LoadHeaders() error = %v", err)
+	}
+	if n := len(want.Values(HeaderContentSecurityPolicy)); n != 2 {
+		t.Fatalf("LoadHeaders() has %d Content-Security-Policy values, want one per policy", n)
+	}
+
+	h := http.Header{}
+	h.Set(HeaderContentSecurityPolicy, "default-src *")
+	h.Set("X-Frame-Options", "DENY")
+	for i := 0; i < 2; i++ {
+		err = pol.Apply(h)
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+	}
+	for name, values := range want {
+		if !reflect.DeepEqual(h.Values(name), values) {
+			t.Errorf("%s = %q after two Applys, want %q", name, h.Values(name), values)
+		}
+	}
+	if h.Get("X-Frame-Options") != "DENY" {
+		t.Errorf("Apply() removed an unrelated header")
+	}
+}
+
+func TestApplyFailureWritesNothing(t *testing.T) {
+	pol := SecurityOptionsStrict()
+	h := http.Header{}
+	err := pol.Apply(h)
+	if err == nil {
+		t.Fatalf("Apply() of a policy needing a nonce error = nil")
+	}
+	if len(h) != 0 {
+		t.Errorf("Apply() wrote %v before failing", h)
+	}
+
+	invalid := Policy{}
+	invalid.CSP.ScriptSrc = CSPSourceOptions{Allow: true, Values: []string{"a b"}}
+	err = invalid.Apply(h)
+	if err == nil || len(h) != 0 {
+		t.Errorf("Apply() of an invalid policy error = %v, wrote %v", err, h)
+	}
+}
+
+func TestAdditionalPoliciesOnTheWire(t *testing.T) {
+	pol := SecurityOptionsStaticSite()
+	pol.Additional = []Policy{additionalPolicy(DirectiveScriptSrc, false)}
+	mw, err := Middleware(pol)
+	if err != nil {
+		t.Fatalf("Middleware() error = %v", err)
+	}
+	srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	// the client keeps each header line as its own value
+	if got := resp.Header.Values(HeaderContentSecurityPolicy); len(got) != 2 || got[1] != "script-src 'self';" {
+		t.Errorf("Content-Security-Policy lines = %q, want the policy and then script-src 'self';", got)
+	}
+}
+
+func TestLoadHeadersAdditional(t *testing.T) {
+	static := "default-src 'none'; connect-src 'self'; font-src 'self'; img-src 'self' data:; script-src 'self'; " +
+		"style-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'; upgrade-insecure-requests;"
+	tests := []struct {
+		name           string
+		additional     []Policy
+		wantEnforced   []string
+		wantReportOnly []string
+	}{
+		{"none", nil, []string{static}, nil},
+		{"one", []Policy{additionalPolicy(DirectiveScriptSrc, false)}, []string{static, "script-src 'self';"}, nil},
+		{
+			name:         "two, in order",
+			additional:   []Policy{additionalPolicy(DirectiveScriptSrc, false), additionalPolicy(DirectiveImgSrc, false)},
+			wantEnforced: []string{static, "script-src 'self';", "img-src 'self';"},
+		},
+		{
+			name:           "report-only",
+			additional:     []Policy{additionalPolicy(DirectiveImgSrc, true)},
+			wantEnforced:   []string{static},
+			wantReportOnly: []string{"img-src 'self'; report-uri /csp;"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsStaticSite()
+			pol.Additional = tt.additional
+			h, err := pol.LoadHeaders()
+			if err != nil {
+				t.Fatalf("LoadHeaders() error = %v", err)
+			}
+			if got := h.Values(HeaderContentSecurityPolicy); !reflect.DeepEqual(got, tt.wantEnforced) {
+				t.Errorf("Content-Security-Policy = %q, want %q", got, tt.wantEnforced)
+			}
+			if got := h.Values(HeaderContentSecurityPolicyReportOnly); !reflect.DeepEqual(got, tt.wantReportOnly) {
+				t.Errorf("Content-Security-Policy-Report-Only = %q, want %q", got, tt.wantReportOnly)
+			}
+
+			// Load joins the values of a header into one
+			headers, err := pol.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got, want := headers[HeaderContentSecurityPolicy], strings.Join(tt.wantEnforced, ", "); got != want {
+				t.Errorf("Load() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// additionalPolicy returns a policy of only the given directive, to layer on another with Additional
+func additionalPolicy(name string, reportOnly bool) Policy {
+	pol := Policy{OmitZeroDirectives: true, ReportOnly: reportOnly}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+	pol.CSP.BaseURI = CSPSourceOptions{Unset: true}
+	pol.CSP.FormAction = CSPSourceOptions{Unset: true}
+	pol.CSP.FrameAncestors = FrameAncestorOptions{Unset: true}
+	*pol.sourceOptionsByName(name) = CSPSourceOptions{Allow: true, AllowSelf: true}
+	if reportOnly {
+		pol.CSP.ReportURI.Values = []string{"/csp"}
+	}
+	return pol
+}
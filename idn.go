@@ -0,0 +1,260 @@
+package cspheader
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// normalizeIDN rewrites internationalized host names in source values and report endpoints to their ASCII (punycode)
+// form, e.g. bücher.example to xn--bcher-kva.example.  Fields are assigned new slices rather than modified in place.
+func (pol *Policy) normalizeIDN() error {
+	for _, name := range directiveOrder {
+		cso := pol.sourceOptionsByName(name)
+		if cso == nil {
+			continue
+		}
+		values, err := mapValues(cso.Values, idnSource)
+		if err != nil {
+			return &DirectiveError{Directive: name, Err: err}
+		}
+		cso.Values = values
+	}
+
+	fa := &pol.CSP.FrameAncestors
+	hosts, err := mapValues(fa.HostSources, idnSource)
+	if err != nil {
+		return &DirectiveError{Directive: "frame-ancestors", Err: err}
+	}
+	fa.HostSources = hosts
+
+	reportURIs, err := mapValues(pol.CSP.ReportURI.Values, idnURL)
+	if err != nil {
+		return &DirectiveError{Directive: "report-uri", Err: err}
+	}
+	pol.CSP.ReportURI.Values = reportURIs
+
+	if len(pol.ReportTo.Groups) > 0 {
+		groups := make([]ReportToGroup, len(pol.ReportTo.Groups))
+		for i, g := range pol.ReportTo.Groups {
+			endpoints := make([]ReportToEndpoint, len(g.Endpoints))
+			for j, e := range g.Endpoints {
+				e.URL, err = idnURL(e.URL)
+				if err != nil {
+					return &ReportToError{Err: err}
+				}
+				endpoints[j] = e
+			}
+			g.Endpoints = endpoints
+			groups[i] = g
+		}
+		pol.ReportTo.Groups = groups
+	}
+
+	if len(pol.ReportingEndpoints) > 0 {
+		endpoints := make(map[string]string, len(pol.ReportingEndpoints))
+		for k, v := range pol.ReportingEndpoints {
+			endpoints[k], err = idnURL(v)
+			if err != nil {
+				return &ReportToError{Err: err}
+			}
+		}
+		pol.ReportingEndpoints = endpoints
+	}
+
+	return nil
+}
+
+// mapValues returns values with fn applied, or values itself if fn changed nothing
+func mapValues(values []string, fn func(string) (string, error)) ([]string, error) {
+	var mapped []string
+	for i, v := range values {
+		m, err := fn(v)
+		if err != nil {
+			return nil, err
+		}
+		if m == v {
+			continue
+		}
+		if mapped == nil {
+			mapped = append([]string(nil), values...)
+		}
+		mapped[i] = m
+	}
+	if mapped == nil {
+		return values, nil
+	}
+	return mapped, nil
+}
+
+// idnSource converts the host of a host-source expression, leaving any scheme, wildcard label, port, and path as is
+func idnSource(v string) (string, error) {
+	if isASCII(v) || strings.HasPrefix(v, "'") {
+		return v, nil
+	}
+
+	scheme := ""
+	rest := v
+	if i := strings.Index(rest, "://"); i >= 0 {
+		scheme, rest = rest[:i+len("://")], rest[i+len("://"):]
+	}
+	host := rest
+	suffix := ""
+	if i := strings.IndexAny(rest, ":/"); i >= 0 {
+		host, suffix = rest[:i], rest[i:]
+	}
+
+	ascii, err := idnHost(host)
+	if err != nil {
+		return "", err
+	}
+	return scheme + ascii + suffix, nil
+}
+
+// idnURL converts the host of an absolute URL.  paths are returned as is.
+func idnURL(v string) (string, error) {
+	if isASCII(v) {
+		return v, nil
+	}
+	u, err := url.Parse(v)
+	if err != nil || len(u.Host) == 0 {
+		return v, nil
+	}
+
+	host := u.Hostname()
+	ascii, err := idnHost(host)
+	if err != nil {
+		return "", err
+	}
+	if port := u.Port(); len(port) > 0 {
+		u.Host = ascii + ":" + port
+	} else {
+		u.Host = ascii
+	}
+	return u.String(), nil
+}
+
+// idnHost converts each non-ASCII label of host to its xn-- form.  a leading * label is kept.
+func idnHost(host string) (string, error) {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := punycodeEncode(strings.ToLower(label))
+		if err != nil {
+			return "", err
+		}
+		labels[i] = "xn--" + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// punycode parameters, https://www.rfc-editor.org/rfc/rfc3492#section-5
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+var errPunycodeOverflow = errors.New("punycode: label is too long to encode")
+
+// punycodeEncode encodes a single label, https://www.rfc-editor.org/rfc/rfc3492#section-6.3
+func punycodeEncode(label string) (string, error) {
+	runes := []rune(label)
+	out := make([]byte, 0, len(label)+8)
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n := rune(punycodeInitialN)
+	delta := 0
+	bias := punycodeInitialBias
+	for handled < len(runes) {
+		// the smallest code point not yet handled
+		m := rune(utf8.MaxRune + 1)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int(m-n) > (1<<31-1-delta)/(handled+1) {
+			return "", errPunycodeOverflow
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punycodeBase; ; k += punycodeBase {
+				t := k - bias
+				if t < punycodeTMin {
+					t = punycodeTMin
+				} else if t > punycodeTMax {
+					t = punycodeTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punycodeDigit(t+(q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+			out = append(out, punycodeDigit(q))
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+func punycodeAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+func punycodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
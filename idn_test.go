@@ -0,0 +1,72 @@
+package cspheader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIDNSource(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"https://bücher.example:8443/pfad", "https://xn--bcher-kva.example:8443/pfad"},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example"},
+		{"*.bücher.example", "*.xn--bcher-kva.example"},
+		{"https://*.BÜCHER.example", "https://*.xn--bcher-kva.example"},
+		{"münchen.bücher.example", "xn--mnchen-3ya.xn--bcher-kva.example"},
+		{"例え.jp", "xn--r8jz45g.jp"},
+		{"'self'", "'self'"},
+		{"https:", "https:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			got, err := idnSource(tt.source)
+			if err != nil {
+				t.Fatalf("idnSource(%q) error = %v", tt.source, err)
+			}
+			if got != tt.want {
+				t.Errorf("idnSource(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeIDN(t *testing.T) {
+	imgValues := []string{"https://*.bücher.example"}
+	configure := func(pol *Policy) {
+		pol.CSP.ImgSrc.Values = imgValues
+		pol.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, HostSources: []string{"bücher.example"}}
+		pol.CSP.ReportURI = UnquotedOptions{Values: []string{"https://bücher.example/csp"}}
+	}
+
+	pol := SecurityOptionsServerRendered()
+	configure(&pol)
+	pol.NormalizeIDN = true
+	headers, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	header := headers[HeaderContentSecurityPolicy]
+	for _, want := range []string{
+		"img-src 'self' https://*.xn--bcher-kva.example;",
+		"frame-ancestors xn--bcher-kva.example;",
+		"report-uri https://xn--bcher-kva.example/csp;",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("header = %q, want it to contain %q", header, want)
+		}
+	}
+	if imgValues[0] != "https://*.bücher.example" {
+		t.Errorf("Values = %q, want the caller's slice left as is", imgValues)
+	}
+
+	// normalization is opt-in; unicode hosts are otherwise rejected as invalid host sources
+	pol = SecurityOptionsServerRendered()
+	configure(&pol)
+	_, err = pol.Load()
+	if err == nil {
+		t.Error("Load() error = nil, want a unicode host rejected without NormalizeIDN")
+	}
+}
@@ -0,0 +1,300 @@
+package cspheader
+
+import (
+	"bytes"
+	"html"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// DefaultNonceInjectionLimit is the largest response WithNonceInjection buffers when no limit is given (1MiB)
+const DefaultNonceInjectionLimit = 1 << 20
+
+// WithNonceInjection implies WithNonce and additionally rewrites text/html responses so that every <script> and
+// <style> tag without a nonce attribute receives the per-request nonce.  This is intended for retrofitting nonces
+// into existing templates.
+//
+// Responses are buffered up to maxBytes (DefaultNonceInjectionLimit if maxBytes <= 0).  Responses that are not
+// text/html, are already content-encoded, are flushed by the handler, or grow past the limit are passed through
+// unmodified.
+func WithNonceInjection(maxBytes int) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.nonce = true
+		cfg.injectNonce = true
+		cfg.injectLimit = maxBytes
+		if cfg.injectLimit <= 0 {
+			cfg.injectLimit = DefaultNonceInjectionLimit
+		}
+	}
+}
+
+// nonceInjectingWriter buffers an html response so that nonces can be injected before it is written
+type nonceInjectingWriter struct {
+	http.ResponseWriter
+	nonce    string
+	maxBytes int
+
+	status int
+	buf    bytes.Buffer
+
+	// decided is set once we know whether the response is buffered or passed through
+	decided     bool
+	passthrough bool
+	// headerSent is set once WriteHeader has been called on the underlying ResponseWriter
+	headerSent bool
+}
+
+func (w *nonceInjectingWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if w.decided && w.passthrough {
+		w.sendHeader()
+	}
+}
+
+func (w *nonceInjectingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.decide(p)
+	}
+	if w.passthrough {
+		w.sendHeader()
+		return w.ResponseWriter.Write(p)
+	}
+
+	if w.buf.Len()+len(p) > w.maxBytes {
+		// too large to buffer: send what we have unmodified and stream the rest
+		w.passthrough = true
+		w.sendHeader()
+		_, err := w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+		if err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	return w.buf.Write(p)
+}
+
+// Flush switches to passthrough, as a handler that flushes expects the client to receive what it has written.
+func (w *nonceInjectingWriter) Flush() {
+	if !w.passthrough {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decided = true
+		w.passthrough = true
+		w.sendHeader()
+		if w.buf.Len() > 0 {
+			_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+			w.buf.Reset()
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide determines whether the response is html we can rewrite, sniffing the first chunk if the handler did not
+// set a Content-Type (as net/http would).
+func (w *nonceInjectingWriter) decide(p []byte) {
+	w.decided = true
+
+	h := w.Header()
+	contentType := h.Get("Content-Type")
+	if len(contentType) == 0 {
+		contentType = http.DetectContentType(p)
+		h.Set("Content-Type", contentType)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	w.passthrough = err != nil || mediaType != "text/html" || len(h.Get("Content-Encoding")) > 0
+}
+
+func (w *nonceInjectingWriter) sendHeader() {
+	if w.headerSent {
+		return
+	}
+	w.headerSent = true
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// finish writes out a buffered response with nonces injected.  it is called after the wrapped handler returns.
+func (w *nonceInjectingWriter) finish() error {
+	if w.passthrough {
+		return nil
+	}
+	if w.status == 0 {
+		// the handler wrote nothing at all; let net/http send its implicit 200
+		return nil
+	}
+
+	body := w.buf.Bytes()
+	if w.buf.Len() > 0 {
+		body = injectNonce(body, w.nonce)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.sendHeader()
+	_, err := w.ResponseWriter.Write(body)
+	return err
+}
+
+// injectNonce adds a nonce attribute to every <script> and <style> start tag in body that does not already have one.
+// the contents of script and style elements and html comments are skipped rather than scanned for tags.
+func injectNonce(body []byte, nonce string) []byte {
+	attr := []byte(` nonce="` + html.EscapeString(nonce) + `"`)
+	out := make([]byte, 0, len(body)+8*len(attr))
+
+	i := 0
+	for i < len(body) {
+		lt := bytes.IndexByte(body[i:], '<')
+		if lt < 0 {
+			break
+		}
+		lt += i
+
+		// skip comments
+		if bytes.HasPrefix(body[lt:], []byte("<!--")) {
+			end := bytes.Index(body[lt+4:], []byte("-->"))
+			if end < 0 {
+				break
+			}
+			end += lt + 4 + len("-->")
+			out = append(out, body[i:end]...)
+			i = end
+			continue
+		}
+
+		name := rawTextTagName(body[lt+1:])
+		if name == "" {
+			out = append(out, body[i:lt+1]...)
+			i = lt + 1
+			continue
+		}
+
+		tagEnd := findTagEnd(body, lt+1+len(name))
+		if tagEnd < 0 {
+			break
+		}
+
+		// copy through the tag name, then the nonce if needed, then the rest of the tag
+		nameEnd := lt + 1 + len(name)
+		out = append(out, body[i:nameEnd]...)
+		if !hasAttribute(body[nameEnd:tagEnd], "nonce") {
+			out = append(out, attr...)
+		}
+		out = append(out, body[nameEnd:tagEnd+1]...)
+		i = tagEnd + 1
+
+		// skip the element's raw text up to its end tag
+		end := indexFold(body[i:], []byte("</"+name))
+		if end < 0 {
+			break
+		}
+		out = append(out, body[i:i+end]...)
+		i += end
+	}
+
+	return append(out, body[i:]...)
+}
+
+// rawTextTagName returns "script" or "style" (as written) if b begins with either tag name followed by the end of
+// the name
+func rawTextTagName(b []byte) string {
+	for _, name := range []string{"script", "style"} {
+		if len(b) <= len(name) || !bytes.EqualFold(b[:len(name)], []byte(name)) {
+			continue
+		}
+		switch b[len(name)] {
+		case ' ', '\t', '\n', '\r', '\f', '/', '>':
+			return string(b[:len(name)])
+		}
+	}
+	return ""
+}
+
+// findTagEnd returns the index of the '>' closing the tag whose attributes begin at start, honoring quoted values
+func findTagEnd(b []byte, start int) int {
+	var quote byte
+	for i := start; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// hasAttribute reports whether the attribute section of a start tag contains the named attribute
+func hasAttribute(attrs []byte, name string) bool {
+	i := 0
+	for i < len(attrs) {
+		// skip whitespace and stray slashes between attributes
+		for i < len(attrs) && isAttrSeparator(attrs[i]) {
+			i++
+		}
+		start := i
+		for i < len(attrs) && !isAttrSeparator(attrs[i]) && attrs[i] != '=' {
+			i++
+		}
+		if i > start && bytes.EqualFold(attrs[start:i], []byte(name)) {
+			return true
+		}
+
+		for i < len(attrs) && (attrs[i] == ' ' || attrs[i] == '\t' || attrs[i] == '\n' || attrs[i] == '\r') {
+			i++
+		}
+		if i >= len(attrs) || attrs[i] != '=' {
+			continue
+		}
+		i++
+		for i < len(attrs) && (attrs[i] == ' ' || attrs[i] == '\t' || attrs[i] == '\n' || attrs[i] == '\r') {
+			i++
+		}
+
+		// skip the value
+		if i < len(attrs) && (attrs[i] == '"' || attrs[i] == '\'') {
+			end := bytes.IndexByte(attrs[i+1:], attrs[i])
+			if end < 0 {
+				return false
+			}
+			i += end + 2
+			continue
+		}
+		for i < len(attrs) && !isAttrSeparator(attrs[i]) {
+			i++
+		}
+	}
+	return false
+}
+
+func isAttrSeparator(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '\f', '/', '>':
+		return true
+	}
+	return false
+}
+
+// indexFold is a case-insensitive bytes.Index for ASCII needles
+func indexFold(b, needle []byte) int {
+	for i := 0; i+len(needle) <= len(b); i++ {
+		if bytes.EqualFold(b[i:i+len(needle)], needle) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,135 @@
+package cspheader
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestInjectNonce(t *testing.T) {
+	const n = ` nonce="abc"`
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"script", `<script>x()</script>`, `<script` + n + `>x()</script>`},
+		{"style", `<style>p{}</style>`, `<style` + n + `>p{}</style>`},
+		{"attributes", `<script src="/a.js" defer></script>`, `<script` + n + ` src="/a.js" defer></script>`},
+		{"upper case", `<SCRIPT>x()</SCRIPT>`, `<SCRIPT` + n + `>x()</SCRIPT>`},
+		{"already has nonce", `<script nonce="other">x()</script>`, `<script nonce="other">x()</script>`},
+		{"nonce attribute without value", `<script NONCE>x()</script>`, `<script NONCE>x()</script>`},
+		{"nonce in another value", `<script data-x="nonce">x()</script>`, `<script` + n + ` data-x="nonce">x()</script>`},
+		{"gt in a quoted value", `<script data-x="a>b">x()</script>`, `<script` + n + ` data-x="a>b">x()</script>`},
+		{"tag in script text", `<script>"<script>"</script>`, `<script` + n + `>"<script>"</script>`},
+		{"comment", `<!-- <script>x()</script> --><p>`, `<!-- <script>x()</script> --><p>`},
+		{"similar names", `<scripts><styled><p>`, `<scripts><styled><p>`},
+		{"several", `<style></style><p><script></script>`, `<style` + n + `></style><p><script` + n + `></script>`},
+		{"unterminated tag", `<script src="/a.js"`, `<script src="/a.js"`},
+		{"self closing", `<script/>`, `<script` + n + `/>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(injectNonce([]byte(tt.body), "abc")); got != tt.want {
+				t.Errorf("injectNonce(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectNonceEscapes(t *testing.T) {
+	got := string(injectNonce([]byte("<script></script>"), `a"b`))
+	if got != `<script nonce="a&#34;b"></script>` {
+		t.Errorf("injectNonce() = %q, want the nonce escaped", got)
+	}
+}
+
+func TestWithNonceInjection(t *testing.T) {
+	const page = "<html><script>x()</script></html>"
+	tests := []struct {
+		name     string
+		limit    int
+		handler  http.HandlerFunc
+		injected bool
+	}{
+		{"html", 0, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(page))
+		}, true},
+		{"sniffed html", 0, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(page))
+		}, true},
+		{"html in chunks", 0, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(page[:10]))
+			_, _ = w.Write([]byte(page[10:]))
+		}, true},
+		{"not html", 0, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(page))
+		}, false},
+		{"content encoded", 0, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Encoding", "identity")
+			_, _ = w.Write([]byte(page))
+		}, false},
+		{"over the limit", 16, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(page))
+		}, false},
+		{"flushed", 0, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(page[:10]))
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(page[10:]))
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := Middleware(noncePolicy(), WithNonceInjection(tt.limit))
+			if err != nil {
+				t.Fatalf("Middleware() error = %v", err)
+			}
+			var nonce string
+			rec := serve(mw, func(w http.ResponseWriter, r *http.Request) {
+				nonce, _ = NonceFromContext(r.Context())
+				tt.handler(w, r)
+			}, nil)
+
+			want := page
+			if tt.injected {
+				want = strings.Replace(page, "<script>", `<script nonce="`+nonce+`">`, 1)
+				if cl := rec.Header().Get("Content-Length"); cl != strconv.Itoa(len(want)) {
+					t.Errorf("Content-Length = %q, want %d", cl, len(want))
+				}
+			}
+			if rec.Body.String() != want {
+				t.Errorf("body = %q, want %q", rec.Body.String(), want)
+			}
+			if !strings.Contains(rec.Header().Get(HeaderContentSecurityPolicy), "'nonce-"+nonce+"'") {
+				t.Errorf("header lacks the request's nonce %q", nonce)
+			}
+		})
+	}
+}
+
+func TestWithNonceInjectionStatus(t *testing.T) {
+	mw, err := Middleware(noncePolicy(), WithNonceInjection(0))
+	if err != nil {
+		t.Fatalf("Middleware() error = %v", err)
+	}
+	rec := serve(mw, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("<script></script>"))
+	}, nil)
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "nonce=") {
+		t.Errorf("response = %d %q, want the handler's status with the nonce injected", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(mw, func(w http.ResponseWriter, r *http.Request) {}, nil)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("empty response = %d %q, want an implicit 200", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,33 @@
+package cspheader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NewPolicyFromJSON reads a Policy from its JSON form, in which directives are keyed by their CSP names, e.g.
+//
+//	{"csp": {"default-src": {"allow": true, "allow-self": true}, "script-src": {"allow": true, "values": ["https://cdn.example.com"]}}}
+//
+// Unknown keys are rejected so that a misspelled directive or option is not silently dropped.  Report-To groups
+// are read in the Report-To header's own JSON form (group, max_age, endpoints), which is lenient about extra keys.
+// Templates are not part of the JSON form; the *TemplateText fields are.
+func NewPolicyFromJSON(r io.Reader) (Policy, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	pol := Policy{}
+	err := dec.Decode(&pol)
+	if err != nil {
+		return Policy{}, fmt.Errorf("decoding policy: %w", err)
+	}
+
+	// a second document or trailing garbage is more likely a mistake than something to ignore
+	if dec.More() {
+		return Policy{}, errors.New("decoding policy: unexpected data after the policy")
+	}
+
+	return pol, nil
+}
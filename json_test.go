@@ -0,0 +1,93 @@
+package cspheader
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewPolicyFromJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"unknown directive", `{"csp": {"script-source": {"allow": true}}}`},
+		{"unknown option", `{"csp": {"script-src": {"allow": true, "allow-slef": true}}}`},
+		{"unknown top level key", `{"report-only": true, "reportonly": true}`},
+		{"trailing document", `{"csp": {}} {"csp": {}}`},
+		{"wrong type", `{"csp": {"script-src": {"allow": "yes"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPolicyFromJSON(strings.NewReader(tt.json))
+			if err == nil {
+				t.Errorf("NewPolicyFromJSON(%s) error = nil, want an error", tt.json)
+			}
+		})
+	}
+}
+
+func TestPolicyJSONKeys(t *testing.T) {
+	pol, err := NewPolicyFromJSON(strings.NewReader(`{
+		"csp": {
+			"default-src": {"allow": true, "allow-self": true},
+			"script-src": {"allow": true, "values": ["https://cdn.example.com"], "unsafe-eval": true},
+			"frame-ancestors": {"allow": true, "host-sources": ["https://partner.example"]},
+			"sandbox": {"allow-forms": true},
+			"upgrade-insecure-requests": true
+		},
+		"report-only": true,
+		"report-to": {"groups": [{"group": "csp", "max_age": 60, "endpoints": [{"url": "https://example.com/r"}]}]}
+	}`))
+	if err != nil {
+		t.Fatalf("NewPolicyFromJSON() error = %v", err)
+	}
+
+	want := Policy{ReportOnly: true}
+	want.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	want.CSP.ScriptSrc = CSPSourceOptions{Allow: true, Values: []string{"https://cdn.example.com"}, UnsafeEval: true}
+	want.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, HostSources: []string{"https://partner.example"}}
+	want.CSP.Sandbox = SandboxOptions{AllowForms: true}
+	want.CSP.UpgradeInsecureRequests = true
+	want.ReportTo.Groups = []ReportToGroup{{Group: "csp", MaxAge: 60 * 1e9, Endpoints: []ReportToEndpoint{{URL: "https://example.com/r"}}}}
+	if !pol.Equal(want) {
+		t.Errorf("NewPolicyFromJSON() = %+v, want %+v", pol, want)
+	}
+}
+
+func TestPolicyJSONRoundTrip(t *testing.T) {
+	policies := presets()
+	policies["every directive"] = everyDirectivePolicy()
+	policies["layered"] = layeredWriterPolicy()
+	for name, pol := range policies {
+		t.Run(name, func(t *testing.T) {
+			b, err := json.Marshal(pol)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			decoded, err := NewPolicyFromJSON(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("NewPolicyFromJSON() error = %v\n%s", err, b)
+			}
+			if got, want := renderHeaders(t, decoded), renderHeaders(t, pol); !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip headers = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// renderHeaders compiles pol and renders every header with the nonce abc123
+func renderHeaders(t *testing.T, pol Policy) map[string]string {
+	t.Helper()
+	compiled, err := pol.Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	headers, err := compiled.Render("abc123")
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	return headers
+}
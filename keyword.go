@@ -0,0 +1,86 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Keyword sources, quoted as they must appear in a policy.  Most have a CSPSourceOptions field of their own (e.g.
+// AllowSelf); the constants are for Values and for comparing parsed or rendered policies.
+const (
+	SourceSelf           = "'self'"
+	SourceNone           = "'none'"
+	SourceUnsafeInline   = "'unsafe-inline'"
+	SourceUnsafeEval     = "'unsafe-eval'"
+	SourceWasmUnsafeEval = "'wasm-unsafe-eval'"
+	SourceUnsafeHashes   = "'unsafe-hashes'"
+	SourceStrictDynamic  = "'strict-dynamic'"
+	SourceReportSample   = "'report-sample'"
+)
+
+// Scheme sources, as they must appear in a policy
+const (
+	SchemeHTTPS       = "https:"
+	SchemeHTTP        = "http:"
+	SchemeData        = "data:"
+	SchemeBlob        = "blob:"
+	SchemeWS          = "ws:"
+	SchemeWSS         = "wss:"
+	SchemeMediaStream = "mediastream:"
+	SchemeFilesystem  = "filesystem:"
+)
+
+// sourceKeywords are the keyword sources, keyed by their unquoted spelling
+var sourceKeywords = map[string]bool{}
+
+func init() {
+	for _, k := range []string{
+		SourceSelf, SourceNone, SourceUnsafeInline, SourceUnsafeEval, SourceWasmUnsafeEval, SourceUnsafeHashes,
+		SourceStrictDynamic, SourceReportSample,
+	} {
+		sourceKeywords[strings.Trim(k, "'")] = true
+	}
+}
+
+// isBareKeyword reports whether v is a keyword source missing its single quotes, e.g. self rather than 'self'
+func isBareKeyword(v string) bool {
+	return sourceKeywords[strings.ToLower(v)]
+}
+
+// ErrUnquotedKeyword is returned for a keyword source given in Values without its single quotes.  Unquoted, the
+// browser reads it as a host named e.g. "self".
+var ErrUnquotedKeyword = errors.New("keyword sources must be single-quoted")
+
+// validateKeywordValues checks that no value is an unquoted keyword
+func (cso CSPSourceOptions) validateKeywordValues(directive string) error {
+	for _, v := range cso.Values {
+		if isBareKeyword(v) {
+			return &DirectiveError{
+				Directive: directive,
+				Err: fmt.Errorf("%w: %s: use the CSPSourceOptions field for it (e.g. AllowSelf for self), "+
+					"quote it as '%s', or set Policy.QuoteKeywordValues", ErrUnquotedKeyword, v, v),
+			}
+		}
+	}
+	return nil
+}
+
+// quoteKeywordValues returns values with any unquoted keyword single-quoted.  values is returned as is when there
+// is nothing to quote.
+func quoteKeywordValues(values []string) []string {
+	var quoted []string
+	for i, v := range values {
+		if !isBareKeyword(v) {
+			continue
+		}
+		if quoted == nil {
+			quoted = append([]string(nil), values...)
+		}
+		quoted[i] = "'" + strings.ToLower(v) + "'"
+	}
+	if quoted == nil {
+		return values
+	}
+	return quoted
+}
@@ -0,0 +1,78 @@
+package cspheader
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuoteKeywordValues(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []string
+	}{
+		{nil, nil},
+		{[]string{"self"}, []string{SourceSelf}},
+		{[]string{"SELF", "Unsafe-Inline"}, []string{SourceSelf, SourceUnsafeInline}},
+		{[]string{SourceSelf, "https://example.com"}, []string{SourceSelf, "https://example.com"}},
+		{[]string{"self.example.com", "none"}, []string{"self.example.com", SourceNone}},
+		{[]string{"strict-dynamic", "report-sample", "wasm-unsafe-eval"}, []string{SourceStrictDynamic, SourceReportSample, SourceWasmUnsafeEval}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.values, " "), func(t *testing.T) {
+			values := append([]string(nil), tt.values...)
+			got := quoteKeywordValues(values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("quoteKeywordValues(%q) = %q, want %q", tt.values, got, tt.want)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("quoteKeywordValues(%q) modified its argument to %q", tt.values, values)
+			}
+		})
+	}
+}
+
+func TestQuoteKeywordValuesPolicy(t *testing.T) {
+	for _, quote := range []bool{false, true} {
+		pol := SecurityOptionsServerRendered()
+		pol.CSP.ImgSrc = CSPSourceOptions{Allow: true, Values: []string{"self", "'self'", "data:"}}
+		pol.QuoteKeywordValues = quote
+		headers, err := pol.Load()
+		if !quote {
+			var de *DirectiveError
+			if !errors.Is(err, ErrUnquotedKeyword) || !errors.As(err, &de) || de.Directive != "img-src" {
+				t.Errorf("QuoteKeywordValues false: Load() error = %v, want %v for img-src", err, ErrUnquotedKeyword)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("QuoteKeywordValues true: Load() error = %v", err)
+		}
+		if want := "img-src 'self' data:;"; !strings.Contains(headers[HeaderContentSecurityPolicy], want) {
+			t.Errorf("QuoteKeywordValues true: header = %q, want it to contain %q", headers[HeaderContentSecurityPolicy], want)
+		}
+	}
+}
+
+func TestSourceConstantsRenderVerbatim(t *testing.T) {
+	for _, c := range []string{
+		SourceSelf, SourceNone, SourceUnsafeInline, SourceUnsafeEval, SourceWasmUnsafeEval, SourceUnsafeHashes,
+		SourceStrictDynamic, SourceReportSample,
+		SchemeHTTPS, SchemeHTTP, SchemeData, SchemeBlob, SchemeWS, SchemeWSS, SchemeMediaStream, SchemeFilesystem,
+	} {
+		t.Run(c, func(t *testing.T) {
+			pol := SecurityOptionsServerRendered()
+			pol.CSP.ImgSrc = CSPSourceOptions{Allow: true, Values: []string{c}}
+			// img-src 'none' would otherwise be dropped as identical to default-src
+			pol.KeepRedundantDirectives = true
+			headers, err := pol.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if want := "img-src " + c + ";"; !strings.Contains(headers[HeaderContentSecurityPolicy], want) {
+				t.Errorf("header = %q, want it to contain %q", headers[HeaderContentSecurityPolicy], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MatchSource reports whether resource matches the source expression expr in a policy protecting a resource at
+// origin, following the CSP3 matching algorithm:
+//
+//   - * matches http, https, ws, and wss URLs, and URLs of origin's scheme, but not e.g. data:, blob:, or
+//     filesystem: URLs unless origin has that scheme
+//   - a scheme source such as https: matches URLs of that scheme and its secure counterpart: http: matches https,
+//     ws: matches wss, and https: matches wss
+//   - a host source without a scheme takes origin's scheme, so it matches URLs of that scheme or, from an http
+//     origin, https.  with a nil origin, it matches http and https URLs.
+//   - *.example.com matches subdomains of example.com, but not example.com itself
+//   - a host source without a port matches the default port of the URL's scheme, so example.com matches
+//     https://example.com:443
+//   - a path ending in / matches by prefix, e.g. /js/ matches /js/app.js, and any other path matches exactly
+//   - 'self' matches origin, and the same host over https or wss when origin is http on a default port
+//
+// Nonces, hashes, and keywords other than 'self' never match a URL.  A relative resource is resolved against
+// origin.  ErrSelfOriginRequired is returned if origin is needed but nil, and an error wrapping
+// ErrInvalidSourceExpression for an expression that is not a valid scheme or host source.
+// https://www.w3.org/TR/CSP3/#match-url-to-source-expression
+func MatchSource(expr string, resource *url.URL, origin *url.URL) (bool, error) {
+	if resource == nil {
+		return false, errors.New("matching source: nil resource")
+	}
+	if !resource.IsAbs() {
+		if origin == nil {
+			return false, ErrSelfOriginRequired
+		}
+		resource = origin.ResolveReference(resource)
+	}
+	scheme := strings.ToLower(resource.Scheme)
+
+	if strings.EqualFold(expr, SourceSelf) {
+		if origin == nil {
+			return false, ErrSelfOriginRequired
+		}
+		return selfMatches(origin, resource), nil
+	}
+	if strings.HasPrefix(expr, "'") {
+		return false, nil
+	}
+
+	e := parseSourceExpression(expr)
+	switch e.kind {
+	case sourceOther:
+		return false, fmt.Errorf("%w: %q", ErrInvalidSourceExpression, expr)
+	case sourceStar:
+		return containsString(starSchemes, scheme) || (origin != nil && strings.EqualFold(origin.Scheme, scheme)), nil
+	case sourceScheme:
+		return schemePartMatches(e.scheme, scheme), nil
+	}
+
+	exprScheme := e.scheme
+	if len(exprScheme) == 0 {
+		exprScheme = "http"
+		if origin != nil {
+			exprScheme = strings.ToLower(origin.Scheme)
+		}
+	}
+	if !schemePartMatches(exprScheme, scheme) {
+		return false, nil
+	}
+
+	return e.hostPartMatches(resource.Hostname()) && e.portPartMatches(resource) &&
+		pathPartMatches(e.path, resource.EscapedPath()), nil
+}
+
+// ErrInvalidSourceExpression is returned by MatchSource for an expression that is neither a keyword, nonce, or hash
+// nor a valid scheme or host source
+var ErrInvalidSourceExpression = errors.New("invalid source expression")
+
+// starSchemes are the URL schemes * matches regardless of the protected resource's scheme
+var starSchemes = []string{"http", "https", "ws", "wss"}
+
+// selfMatches reports whether u matches 'self' for a resource at origin: the same origin, or the same host with an
+// upgrade to a secure scheme where both ports are the same or the defaults of their schemes
+func selfMatches(origin, u *url.URL) bool {
+	if !strings.EqualFold(origin.Hostname(), u.Hostname()) {
+		return false
+	}
+	originScheme, scheme := strings.ToLower(origin.Scheme), strings.ToLower(u.Scheme)
+	if originScheme == scheme {
+		return portOf(origin) == portOf(u)
+	}
+
+	samePorts := portOf(origin) == portOf(u) ||
+		(portOf(origin) == defaultPorts[originScheme] && portOf(u) == defaultPorts[scheme])
+	if !samePorts {
+		return false
+	}
+	return scheme == "https" || scheme == "wss" || (originScheme == "http" && scheme == "ws")
+}
+
+// schemePartMatches reports whether the scheme of an expression matches a URL's scheme
+// https://www.w3.org/TR/CSP3/#match-schemes
+func schemePartMatches(expr, scheme string) bool {
+	return containsString(schemeMatches(expr), scheme)
+}
+
+// hostPartMatches reports whether host matches the expression's host: exactly, or as a subdomain for a host of
+// *.example.com.  a trailing dot on host is ignored.
+func (e sourceExpression) hostPartMatches(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	switch {
+	case e.anyHost:
+		return true
+	case e.wildcardHost:
+		return strings.HasSuffix(host, "."+e.host)
+	}
+	return host == e.host
+}
+
+// portPartMatches reports whether u's port matches the expression's port.  an expression without a port matches
+// the default port of u's scheme, whether or not u names it.
+// https://www.w3.org/TR/CSP3/#match-ports
+func (e sourceExpression) portPartMatches(u *url.URL) bool {
+	switch e.port {
+	case "*":
+		return true
+	case "":
+		return portOf(u) == defaultPorts[strings.ToLower(u.Scheme)]
+	}
+	return e.port == portOf(u)
+}
+
+// pathPartMatches reports whether a URL path matches the path of an expression.  an empty expression path matches
+// any path; one ending in / matches paths beneath it, segment by segment; any other matches exactly.  segments are
+// compared percent-decoded.
+// https://www.w3.org/TR/CSP3/#match-paths
+func pathPartMatches(exprPath, path string) bool {
+	if len(exprPath) == 0 {
+		return true
+	}
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	exact := !strings.HasSuffix(exprPath, "/")
+	exprSegments := strings.Split(exprPath, "/")
+	segments := strings.Split(path, "/")
+	if len(exprSegments) > len(segments) || (exact && len(exprSegments) != len(segments)) {
+		return false
+	}
+	if !exact {
+		exprSegments = exprSegments[:len(exprSegments)-1]
+	}
+
+	for i, exprSegment := range exprSegments {
+		if pathUnescape(exprSegment) != pathUnescape(segments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathUnescape percent-decodes a path segment, or returns it as is if it is not valid percent-encoding
+func pathUnescape(segment string) string {
+	unescaped, err := url.PathUnescape(segment)
+	if err != nil {
+		return segment
+	}
+	return unescaped
+}
+
+// defaultPorts are the ports implied by a URL scheme without an explicit port
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// portOf returns u's port, or the default port of its scheme
+func portOf(u *url.URL) string {
+	if port := u.Port(); len(port) > 0 {
+		return port
+	}
+	return defaultPorts[strings.ToLower(u.Scheme)]
+}
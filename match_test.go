@@ -0,0 +1,144 @@
+package cspheader
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+// TestMatchSource ports the examples of the CSP3 and CSP2 specifications, with the section each comes from
+func TestMatchSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		resource string
+		origin   string
+		want     bool
+	}{
+		// CSP3 2.3.1, source lists: scheme sources
+		{"https: matches https", "https:", "https://example.com/", "https://example.com", true},
+		{"https: does not match http", "https:", "http://example.com/", "https://example.com", false},
+		{"data: matches data", "data:", "data:text/plain,hi", "https://example.com", true},
+
+		// CSP3 6.7.2.8, scheme part matching: insecure schemes match their secure counterparts.  the ws: and wss:
+		// matches of http(s) URLs are left out, as documented on schemeMatches.
+		{"http: matches https", "http:", "https://example.com/", "https://example.com", true},
+		{"ws: matches wss", "ws:", "wss://example.com/", "https://example.com", true},
+		{"https: matches wss", "https:", "wss://example.com/", "https://example.com", true},
+		{"http: does not match ws", "http:", "ws://example.com/", "https://example.com", false},
+		{"ws: does not match http", "ws:", "http://example.com/", "https://example.com", false},
+		{"wss: does not match ws", "wss:", "ws://example.com/", "https://example.com", false},
+		{"scheme match is case-insensitive", "HTTPS:", "https://example.com/", "https://example.com", true},
+
+		// CSP3 6.7.2.12: * matches network schemes and the protected resource's own scheme only
+		{"* matches https", "*", "https://a.example.org/x", "https://example.com", true},
+		{"* matches ws", "*", "ws://a.example.org/x", "https://example.com", true},
+		{"* does not match data", "*", "data:text/plain,hi", "https://example.com", false},
+		{"* does not match blob", "*", "blob:https://example.com/uuid", "https://example.com", false},
+		{"* matches the origin's scheme", "*", "ftp://files.example.com/", "ftp://example.com", true},
+
+		// CSP3 6.7.2.9, host part matching
+		{"exact host", "example.com", "https://example.com/", "https://example.com", true},
+		{"host is case-insensitive", "EXAMPLE.com", "https://example.COM/", "https://example.com", true},
+		{"other host", "example.com", "https://example.org/", "https://example.com", false},
+		{"wildcard matches a subdomain", "*.example.com", "https://a.example.com/", "https://example.com", true},
+		{"wildcard matches a deeper subdomain", "*.example.com", "https://a.b.example.com/", "https://example.com", true},
+		{"wildcard does not match the bare host", "*.example.com", "https://example.com/", "https://example.com", false},
+		{"wildcard does not match a suffix", "*.example.com", "https://notexample.com/", "https://example.com", false},
+		{"trailing dot is ignored", "example.com", "https://example.com./", "https://example.com", true},
+
+		// CSP3 6.7.2.12: a host source without a scheme takes the protected resource's scheme, upgrades allowed
+		{"schemeless host from https", "example.com", "http://example.com/", "https://example.com", false},
+		{"schemeless host from http matches https", "example.com", "https://example.com/", "http://example.com", true},
+		{"schemeless host without origin", "example.com", "http://example.com/", "", true},
+		{"host with scheme", "https://example.com", "https://example.com/", "http://example.com", true},
+		{"http host matches https", "http://example.com", "https://example.com/", "https://example.com", true},
+		{"https host does not match http", "https://example.com", "http://example.com/", "https://example.com", false},
+
+		// CSP3 6.7.2.10, port part matching
+		{"no port matches the default", "example.com", "https://example.com:443/", "https://example.com", true},
+		{"no port does not match another", "example.com", "https://example.com:8443/", "https://example.com", false},
+		{"explicit port", "example.com:8443", "https://example.com:8443/", "https://example.com", true},
+		{"explicit port mismatch", "example.com:8443", "https://example.com/", "https://example.com", false},
+		{"any port", "example.com:*", "https://example.com:9000/", "https://example.com", true},
+		{"default port named", "https://example.com:443", "https://example.com/", "https://example.com", true},
+
+		// CSP3 6.7.2.11, path part matching, and the examples of CSP2 4.2.2.1
+		{"path prefix", "example.com/scripts/", "https://example.com/scripts/file.js", "https://example.com", true},
+		{"path prefix nested", "example.com/scripts/", "https://example.com/scripts/vendor/file.js", "https://example.com", true},
+		{"path prefix needs the slash", "example.com/scripts/", "https://example.com/scripts", "https://example.com", false},
+		{"exact path", "example.com/scripts/file.js", "https://example.com/scripts/file.js", "https://example.com", true},
+		{"exact path mismatch", "example.com/scripts/file.js", "https://example.com/scripts/other.js", "https://example.com", false},
+		{"exact path is not a prefix", "example.com/scripts/file.js", "https://example.com/scripts/file.js/x", "https://example.com", false},
+		{"path segments compared decoded", "example.com/my%20scripts/", "https://example.com/my scripts/a.js", "https://example.com", true},
+		{"query is ignored", "example.com/a.js", "https://example.com/a.js?v=2", "https://example.com", true},
+		{"empty resource path is /", "example.com/", "https://example.com", "https://example.com", true},
+
+		// CSP3 6.7.2.7, 'self'
+		{"self same origin", "'self'", "https://example.com/app.js", "https://example.com", true},
+		{"self other host", "'self'", "https://cdn.example.com/app.js", "https://example.com", false},
+		{"self upgrade from http", "'self'", "https://example.com/app.js", "http://example.com", true},
+		{"self wss from https", "'self'", "wss://example.com/live", "https://example.com", true},
+		{"self ws from http", "'self'", "ws://example.com/live", "http://example.com", true},
+		{"self no downgrade", "'self'", "http://example.com/app.js", "https://example.com", false},
+		{"self other port", "'self'", "https://example.com:8443/app.js", "https://example.com", false},
+		{"self upgrade from non-default port", "'self'", "https://example.com/app.js", "http://example.com:8080", false},
+		{"self relative URL", "'self'", "/app.js", "https://example.com", true},
+
+		// keywords, nonces, and hashes never match a URL
+		{"none", "'none'", "https://example.com/", "https://example.com", false},
+		{"unsafe-inline", "'unsafe-inline'", "https://example.com/", "https://example.com", false},
+		{"nonce", "'nonce-abc123'", "https://example.com/", "https://example.com", false},
+		{"hash", "'sha256-RFWPLDbv2BY+rCkDzsE+0fr8ylGr2R2faWMhq4lfEQc='", "https://example.com/", "https://example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var origin *url.URL
+			if len(tt.origin) > 0 {
+				origin = mustParseURL(t, tt.origin)
+			}
+			got, err := MatchSource(tt.expr, mustParseURL(t, tt.resource), origin)
+			if err != nil {
+				t.Fatalf("MatchSource(%q, %q) error = %v", tt.expr, tt.resource, err)
+			}
+			if got != tt.want {
+				t.Errorf("MatchSource(%q, %q, origin %q) = %v, want %v", tt.expr, tt.resource, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchSourceErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		resource string
+		origin   string
+		wantErr  error
+	}{
+		{"self without origin", "'self'", "https://example.com/", "", ErrSelfOriginRequired},
+		{"relative URL without origin", "example.com", "/app.js", "", ErrSelfOriginRequired},
+		{"invalid expression", "https://exa mple.com", "https://example.com/", "https://example.com", ErrInvalidSourceExpression},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var origin *url.URL
+			if len(tt.origin) > 0 {
+				origin = mustParseURL(t, tt.origin)
+			}
+			_, err := MatchSource(tt.expr, mustParseURL(t, tt.resource), origin)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("MatchSource(%q, %q) error = %v, want %v", tt.expr, tt.resource, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
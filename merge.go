@@ -0,0 +1,381 @@
+package cspheader
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// MergeMode decides how Merge resolves a directive that is 'none' in one policy and allows sources in the other
+type MergeMode int
+
+const (
+	// MergeTighten keeps the directive 'none', and keeps only the sandbox tokens both policies allow
+	MergeTighten MergeMode = iota
+	// MergeLoosen allows the sources of whichever policy has any, and every sandbox token either policy allows
+	MergeLoosen
+)
+
+// Merge layers other on top of the Policy, e.g. a product team's additions on an organization wide base policy,
+// and returns the result.  Neither policy is modified.  Conflicts are resolved with MergeTighten; see MergeWithMode.
+func (pol Policy) Merge(other Policy) Policy {
+	return pol.MergeWithMode(other, MergeTighten)
+}
+
+// MergeInto merges other into the Policy in place, with MergeTighten
+func (pol *Policy) MergeInto(other Policy) {
+	*pol = pol.Merge(other)
+}
+
+// MergeWithMode is Merge with the resolution of conflicting Allow settings chosen by mode.  Directive by directive:
+//
+//   - Values, frame-ancestors sources, and report-uri are unioned, and the keyword fields ORed
+//   - nonces and hashes come from other if it sets any, otherwise from the Policy
+//   - a directive that is Unset, or a fetch directive left at its zero value in a policy with OmitZeroDirectives,
+//     takes the other policy's setting.  An overlay need only set the directives it changes if it sets
+//     OmitZeroDirectives and Unset on base-uri and form-action.  Any other directive with Allow false, frame-ancestors
+//     included, is 'none', so it is kept with MergeTighten and gives way to the other policy's with MergeLoosen.
+//   - the report-to directive and template fields come from other if it sets them
+//
+// Report-To groups are concatenated, with other's replacing any of the same name.  Reporting-Endpoints and
+// CustomDirectives are combined with other's winning a shared name.  The result is enforced unless both policies are report-only (or,
+// with MergeLoosen, either is).  Additional policies are each enforced on their own, so both policies' are kept,
+// the Policy's first.  The rendered directives of any previous Load are not carried over.
+func (pol Policy) MergeWithMode(other Policy, mode MergeMode) Policy {
+	merged := pol.Clone()
+	other = other.Clone()
+
+	for _, name := range directiveOrder {
+		cso := merged.sourceOptionsByName(name)
+		if cso == nil {
+			continue
+		}
+		base := pol.mergeOperand(name, *cso, other.OmitZeroDirectives)
+		overlay := other.mergeOperand(name, *other.sourceOptionsByName(name), pol.OmitZeroDirectives)
+		*cso = mergeSourceOptions(base, overlay, mode)
+	}
+
+	merged.CSP.FrameAncestors = mergeFrameAncestorOptions(merged.CSP.FrameAncestors, other.CSP.FrameAncestors, mode)
+
+	merged.CSP.Sandbox = mergeSandboxOptions(merged.CSP.Sandbox, other.CSP.Sandbox, mode)
+
+	merged.CSP.ReportURI.Values = dedupeValues(append(merged.CSP.ReportURI.Values, other.CSP.ReportURI.Values...))
+	if len(other.CSP.ReportTo.Value) > 0 {
+		merged.CSP.ReportTo = other.CSP.ReportTo
+	}
+	merged.CSP.UpgradeInsecureRequests = merged.CSP.UpgradeInsecureRequests || other.CSP.UpgradeInsecureRequests
+	merged.CSP.BlockAllMixedContent = merged.CSP.BlockAllMixedContent || other.CSP.BlockAllMixedContent
+
+	if mode == MergeLoosen {
+		merged.ReportOnly = merged.ReportOnly || other.ReportOnly
+	} else {
+		merged.ReportOnly = merged.ReportOnly && other.ReportOnly
+	}
+	merged.OmitDeprecatedDirectives = merged.OmitDeprecatedDirectives || other.OmitDeprecatedDirectives
+	merged.Strict = merged.Strict || other.Strict
+	merged.QuoteKeywordValues = merged.QuoteKeywordValues || other.QuoteKeywordValues
+	merged.NormalizeIDN = merged.NormalizeIDN || other.NormalizeIDN
+	merged.KeepRedundantDirectives = merged.KeepRedundantDirectives || other.KeepRedundantDirectives
+	merged.OmitZeroDirectives = merged.OmitZeroDirectives || other.OmitZeroDirectives
+	merged.AllowInsecureReportEndpoints = merged.AllowInsecureReportEndpoints || other.AllowInsecureReportEndpoints
+	merged.MaxHeaderBytes = mergeMaxHeaderBytes(merged.MaxHeaderBytes, other.MaxHeaderBytes, mode)
+	if len(other.SelfOrigin) > 0 {
+		merged.SelfOrigin = other.SelfOrigin
+	}
+
+	switch {
+	case merged.ReportOnlyCandidate != nil && other.ReportOnlyCandidate != nil:
+		candidate := merged.ReportOnlyCandidate.MergeWithMode(*other.ReportOnlyCandidate, mode)
+		merged.ReportOnlyCandidate = &candidate
+	case other.ReportOnlyCandidate != nil:
+		merged.ReportOnlyCandidate = other.ReportOnlyCandidate
+	}
+
+	if len(other.Additional) > 0 {
+		merged.Additional = append(merged.Additional, other.Additional...)
+	}
+
+	mergeTemplates(&merged, other)
+
+	groups := make([]ReportToGroup, 0, len(merged.ReportTo.Groups)+len(other.ReportTo.Groups))
+	for _, g := range merged.ReportTo.Groups {
+		if !hasReportToGroup(other.ReportTo.Groups, g.Group) {
+			groups = append(groups, g)
+		}
+	}
+	merged.ReportTo.Groups = append(groups, other.ReportTo.Groups...)
+	if len(merged.ReportTo.Groups) == 0 {
+		merged.ReportTo.Groups = nil
+	}
+	merged.ReportTo.ReportTo = joinReportTo(merged.ReportTo.ReportTo, other.ReportTo.ReportTo)
+
+	merged.ReportingEndpoints = mergeStringMaps(merged.ReportingEndpoints, other.ReportingEndpoints)
+	merged.CustomDirectives = mergeStringMaps(merged.CustomDirectives, other.CustomDirectives)
+
+	merged.cspStaticDirectives = nil
+	merged.cspDynamicDirectives = nil
+	merged.reportToString = ""
+	merged.reportingEndpointsString = ""
+	merged.compiled = nil
+	merged.warnings = nil
+
+	return merged
+}
+
+// isNone reports whether the options render 'none', by leaving Allow false or by giving 'none' as a value
+func (cso CSPSourceOptions) isNone() bool {
+	return !cso.Allow || containsString(cso.Values, SourceNone)
+}
+
+// mergeOperand returns a directive's options as they read in pol, for merging with a policy whose
+// OmitZeroDirectives is otherOmitsZero.  the merged policy omits zero valued fetch directives if either policy does,
+// so a zero value that pol omits is made Unset, and one that pol renders as 'none' is made an explicit 'none' that
+// the merged policy renders the same way.
+func (pol Policy) mergeOperand(name string, cso CSPSourceOptions, otherOmitsZero bool) CSPSourceOptions {
+	// OmitZeroDirectives does not apply to directives without a fallback
+	if !cso.isZero() || len(directiveFallbacks[name]) == 0 {
+		return cso
+	}
+	if pol.OmitZeroDirectives {
+		return CSPSourceOptions{Unset: true}
+	}
+	if otherOmitsZero {
+		return CSPSourceOptions{Allow: true, Values: []string{SourceNone}}
+	}
+	return cso
+}
+
+// mergeSourceOptions combines a directive's options.  only Unset options defer to the other side; options with
+// Allow false are 'none', which MergeTighten keeps.
+func mergeSourceOptions(base, overlay CSPSourceOptions, mode MergeMode) CSPSourceOptions {
+	switch {
+	case overlay.Unset:
+		return base
+	case base.Unset:
+		return overlay
+	case base.isNone():
+		if mode == MergeLoosen {
+			return overlay
+		}
+		return base
+	case overlay.isNone():
+		if mode == MergeLoosen {
+			return base
+		}
+		return overlay
+	}
+
+	merged := base
+	merged.AllowSelf = base.AllowSelf || overlay.AllowSelf
+	merged.Values = dedupeValues(append(base.Values, overlay.Values...))
+	merged.UnsafeEval = base.UnsafeEval || overlay.UnsafeEval
+	merged.WasmUnsafeEval = base.WasmUnsafeEval || overlay.WasmUnsafeEval
+	merged.UnsafeHashes = base.UnsafeHashes || overlay.UnsafeHashes
+	merged.UnsafeInline = base.UnsafeInline || overlay.UnsafeInline
+	merged.StrictDynamic = base.StrictDynamic || overlay.StrictDynamic
+	merged.ReportSample = base.ReportSample || overlay.ReportSample
+	merged.err = errors.Join(base.err, overlay.err)
+
+	if overlay.hasNonce() {
+		merged.NonceBase64Value = overlay.NonceBase64Value
+		merged.Nonces = overlay.Nonces
+	}
+	if len(overlay.HashAlgorithmBase64Value) > 0 || len(overlay.Hashes) > 0 {
+		merged.HashAlgorithmBase64Value = overlay.HashAlgorithmBase64Value
+		merged.Hashes = overlay.Hashes
+	}
+
+	return merged
+}
+
+func mergeFrameAncestorOptions(base, overlay FrameAncestorOptions, mode MergeMode) FrameAncestorOptions {
+	switch {
+	case overlay.Unset:
+		return base
+	case base.Unset:
+		return overlay
+	case !base.Allow:
+		if mode == MergeLoosen {
+			return overlay
+		}
+		return base
+	case !overlay.Allow:
+		if mode == MergeLoosen {
+			return base
+		}
+		return overlay
+	}
+
+	return FrameAncestorOptions{
+		Allow:         true,
+		AllowSelf:     base.AllowSelf || overlay.AllowSelf,
+		HostSources:   dedupeValues(append(base.HostSources, overlay.HostSources...)),
+		SchemeSources: dedupeValues(append(base.SchemeSources, overlay.SchemeSources...)),
+	}
+}
+
+// mergeSandboxOptions combines the tokens of two sandbox directives.  a policy without a sandbox directive places
+// no restriction, so only when both have one are their tokens combined by mode.
+func mergeSandboxOptions(base, overlay SandboxOptions, mode MergeMode) SandboxOptions {
+	switch {
+	case overlay == (SandboxOptions{}):
+		return base
+	case base == (SandboxOptions{}):
+		return overlay
+	}
+
+	merged := SandboxOptions{}
+	mv, bv, ov := reflect.ValueOf(&merged).Elem(), reflect.ValueOf(base), reflect.ValueOf(overlay)
+	for i := 0; i < mv.NumField(); i++ {
+		if mode == MergeLoosen {
+			mv.Field(i).SetBool(bv.Field(i).Bool() || ov.Field(i).Bool())
+		} else {
+			mv.Field(i).SetBool(bv.Field(i).Bool() && ov.Field(i).Bool())
+		}
+	}
+	// both had a sandbox directive, so the result must have one even if no token survives
+	merged.Enabled = true
+	return merged
+}
+
+// mergeTemplates takes each template, template text, and template func that other sets
+func mergeTemplates(merged *Policy, other Policy) {
+	if len(other.SourceOptionTemplateText) > 0 {
+		merged.SourceOptionTemplateText = other.SourceOptionTemplateText
+	}
+	if other.SourceOptionTemplate != nil {
+		merged.SourceOptionTemplate = other.SourceOptionTemplate
+	}
+	if len(other.SandboxOptionTemplateText) > 0 {
+		merged.SandboxOptionTemplateText = other.SandboxOptionTemplateText
+	}
+	if other.SandboxOptionTemplate != nil {
+		merged.SandboxOptionTemplate = other.SandboxOptionTemplate
+	}
+	if len(other.FrameAncestorOptionsTemplateText) > 0 {
+		merged.FrameAncestorOptionsTemplateText = other.FrameAncestorOptionsTemplateText
+	}
+	if other.FrameAncestorOptionsTemplate != nil {
+		merged.FrameAncestorOptionsTemplate = other.FrameAncestorOptionsTemplate
+	}
+	if len(other.UnquotedOptionsTextTemplateText) > 0 {
+		merged.UnquotedOptionsTextTemplateText = other.UnquotedOptionsTextTemplateText
+	}
+	if other.UnquotedOptionsTemplate != nil {
+		merged.UnquotedOptionsTemplate = other.UnquotedOptionsTemplate
+	}
+	if len(other.UnquotedOptionTextTemplateText) > 0 {
+		merged.UnquotedOptionTextTemplateText = other.UnquotedOptionTextTemplateText
+	}
+	if other.UnquotedOptionTemplate != nil {
+		merged.UnquotedOptionTemplate = other.UnquotedOptionTemplate
+	}
+	for k, v := range other.TemplateFuncs {
+		if merged.TemplateFuncs == nil {
+			merged.TemplateFuncs = template.FuncMap{}
+		}
+		merged.TemplateFuncs[k] = v
+	}
+}
+
+// mergeStringMaps adds the entries of overlay to base, which is allocated if need be
+func mergeStringMaps(base, overlay map[string]string) map[string]string {
+	if len(overlay) > 0 && base == nil {
+		base = make(map[string]string, len(overlay))
+	}
+	for k, v := range overlay {
+		base[k] = v
+	}
+	return base
+}
+
+// mergeMaxHeaderBytes picks between two MaxHeaderBytes limits: an unset limit takes the other, and otherwise
+// tightening keeps the smaller limit while loosening keeps the larger, a disabled (negative) limit being the largest.
+func mergeMaxHeaderBytes(base, overlay int, mode MergeMode) int {
+	switch {
+	case base == 0:
+		return overlay
+	case overlay == 0:
+		return base
+	case (base < 0) != (overlay < 0):
+		if (mode == MergeLoosen) == (base < 0) {
+			return base
+		}
+		return overlay
+	case (mode == MergeLoosen) == (base > overlay):
+		return base
+	}
+	return overlay
+}
+
+func hasReportToGroup(groups []ReportToGroup, name string) bool {
+	for _, g := range groups {
+		if g.Group == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns the union of two directives' options without modifying either: Values, nonces, and hashes are
+// combined without duplicates and the keyword fields are ORed.  Allow is true if either is; Merge is for adding
+// sources, and sources added to a 'none' directive are meant to be allowed, not silently ignored.  Options that are
+// Unset take the other's.  Merging the same options again has no further effect.
+func (cso CSPSourceOptions) Merge(other CSPSourceOptions) CSPSourceOptions {
+	switch {
+	case other.Unset:
+		return cso.Clone()
+	case cso.Unset:
+		return other.Clone()
+	}
+
+	merged := cso.Clone()
+	merged.Allow = cso.Allow || other.Allow
+	merged.AllowSelf = cso.AllowSelf || other.AllowSelf
+	merged.Values = dedupeValues(append(merged.Values, other.Values...))
+	merged.UnsafeEval = cso.UnsafeEval || other.UnsafeEval
+	merged.WasmUnsafeEval = cso.WasmUnsafeEval || other.WasmUnsafeEval
+	merged.UnsafeHashes = cso.UnsafeHashes || other.UnsafeHashes
+	merged.UnsafeInline = cso.UnsafeInline || other.UnsafeInline
+	merged.StrictDynamic = cso.StrictDynamic || other.StrictDynamic
+	merged.ReportSample = cso.ReportSample || other.ReportSample
+	merged.err = errors.Join(cso.err, other.err)
+
+	// the first nonce stays in NonceBase64Value; any other is added to Nonces
+	nonces := append([]string{other.NonceBase64Value}, other.Nonces...)
+	if len(merged.NonceBase64Value) == 0 {
+		merged.NonceBase64Value, nonces = nonces[0], nonces[1:]
+	}
+	for _, n := range nonces {
+		if len(n) > 0 && n != merged.NonceBase64Value && !containsString(merged.Nonces, n) {
+			merged.Nonces = append(merged.Nonces, n)
+		}
+	}
+
+	if len(merged.HashAlgorithmBase64Value) == 0 {
+		merged.HashAlgorithmBase64Value = other.HashAlgorithmBase64Value
+	} else if len(other.HashAlgorithmBase64Value) > 0 && other.HashAlgorithmBase64Value != merged.HashAlgorithmBase64Value {
+		// there is only room for one deprecated hash, so the other's moves to Hashes.  an invalid one is dropped.
+		h, err := parseHash(strings.Trim(other.HashAlgorithmBase64Value, "'"))
+		if err == nil && !containsHash(merged.Hashes, h) {
+			merged.Hashes = append(merged.Hashes, h)
+		}
+	}
+	for _, h := range other.Hashes {
+		if !containsHash(merged.Hashes, h) {
+			merged.Hashes = append(merged.Hashes, h)
+		}
+	}
+
+	return merged
+}
+
+func containsHash(hashes []Hash, h Hash) bool {
+	for _, existing := range hashes {
+		if existing == h {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,385 @@
+package cspheader
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeFrameAncestorOptions(t *testing.T) {
+	self := FrameAncestorOptions{Allow: true, AllowSelf: true}
+	unset := FrameAncestorOptions{Unset: true}
+	tests := []struct {
+		name          string
+		base, overlay FrameAncestorOptions
+		mode          MergeMode
+		want          FrameAncestorOptions
+	}{
+		{"tighten keeps zero base", FrameAncestorOptions{}, self, MergeTighten, FrameAncestorOptions{}},
+		{"tighten keeps zero overlay", self, FrameAncestorOptions{}, MergeTighten, FrameAncestorOptions{}},
+		{"loosen takes overlay over zero", FrameAncestorOptions{}, self, MergeLoosen, self},
+		{"loosen keeps base over zero", self, FrameAncestorOptions{}, MergeLoosen, self},
+		{"tighten keeps base over unset overlay", self, unset, MergeTighten, self},
+		{"tighten takes overlay over unset base", unset, self, MergeTighten, self},
+		{"loosen keeps base over unset overlay", self, unset, MergeLoosen, self},
+		{"loosen takes overlay over unset base", unset, self, MergeLoosen, self},
+		{"both unset", unset, unset, MergeTighten, unset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeFrameAncestorOptions(tt.base, tt.overlay, tt.mode)
+			if got.Unset != tt.want.Unset || got.Allow != tt.want.Allow || got.AllowSelf != tt.want.AllowSelf {
+				t.Errorf("merged = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeOmitZeroOverlay(t *testing.T) {
+	base := SecurityOptionsStaticSite()
+	overlay := Policy{OmitZeroDirectives: true}
+	overlay.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+	overlay.CSP.BaseURI = CSPSourceOptions{Unset: true}
+	overlay.CSP.FormAction = CSPSourceOptions{Unset: true}
+	overlay.CSP.FrameAncestors = base.CSP.FrameAncestors
+	overlay.CSP.ImgSrc = CSPSourceOptions{Allow: true, Values: []string{"https://images.example.com"}}
+
+	merged := base.Merge(overlay)
+	if !containsString(merged.CSP.ImgSrc.Values, "https://images.example.com") {
+		t.Errorf("img-src = %+v, want the overlay's host added", merged.CSP.ImgSrc)
+	}
+
+	d, err := CompareHeaders(renderCSP(t, base), renderCSP(t, merged))
+	if err != nil {
+		t.Fatalf("CompareHeaders() error = %v", err)
+	}
+	for _, dd := range d.Directives {
+		if dd.Directive != DirectiveImgSrc {
+			t.Errorf("merging an img-src overlay changed %s", dd)
+		}
+	}
+}
+
+func TestMergeSourceOptions(t *testing.T) {
+	none := CSPSourceOptions{}
+	explicitNone := CSPSourceOptions{Allow: true, Values: []string{SourceNone}}
+	self := CSPSourceOptions{Allow: true, AllowSelf: true}
+	cdn := CSPSourceOptions{Allow: true, Values: []string{"https://cdn.example.com"}}
+	unset := CSPSourceOptions{Unset: true}
+
+	tests := []struct {
+		name          string
+		base, overlay CSPSourceOptions
+		mode          MergeMode
+		want          string
+	}{
+		{"tighten keeps zero base", none, self, MergeTighten, "'none'"},
+		{"tighten keeps zero overlay", self, none, MergeTighten, "'none'"},
+		{"tighten keeps explicit none", explicitNone, self, MergeTighten, "'none'"},
+		{"loosen takes overlay over zero", none, self, MergeLoosen, "'self'"},
+		{"loosen keeps base over zero", self, none, MergeLoosen, "'self'"},
+		{"unset base defers", unset, self, MergeTighten, "'self'"},
+		{"unset overlay defers", self, unset, MergeTighten, "'self'"},
+		{"unset overlay keeps none", none, unset, MergeTighten, "'none'"},
+		{"sources are unioned", self, cdn, MergeTighten, "'self' https://cdn.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := mergeSourceOptions(tt.base, tt.overlay, tt.mode)
+			got, err := merged.Parse(defaultTemplate("SourceOption", TemplateTextSourceOption))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("merged = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeInto(t *testing.T) {
+	pol := SecurityOptionsStaticSite()
+	overlay := SecurityOptionsStaticSite()
+	overlay.CSP.ImgSrc.Values = append(overlay.CSP.ImgSrc.Values, "https://images.example.com")
+	want := pol.Merge(overlay)
+
+	pol.MergeInto(overlay)
+	if !pol.Equal(want) {
+		t.Errorf("MergeInto() = %+v, want %+v", pol, want)
+	}
+}
+
+func TestMergePolicyFields(t *testing.T) {
+	group := func(name, url string) ReportToGroup {
+		return ReportToGroup{Group: name, MaxAge: time.Hour, Endpoints: []ReportToEndpoint{{URL: url}}}
+	}
+
+	base := SecurityOptionsStaticSite()
+	base.ReportTo.Groups = []ReportToGroup{group("csp", "https://a.example/r"), group("nel", "https://a.example/n")}
+	base.ReportingEndpoints = map[string]string{"csp": "https://a.example/r", "nel": "https://a.example/n"}
+	base.CustomDirectives = map[string]string{"trusted-types": "default"}
+	base.CSP.ReportURI.Values = []string{"/a"}
+	base.Additional = []Policy{SecurityOptionsStaticSite()}
+
+	overlay := Policy{OmitZeroDirectives: true}
+	overlay.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+	overlay.CSP.BaseURI = CSPSourceOptions{Unset: true}
+	overlay.CSP.FormAction = CSPSourceOptions{Unset: true}
+	overlay.CSP.FrameAncestors = FrameAncestorOptions{Unset: true}
+	overlay.CSP.ReportURI.Values = []string{"/a", "/b"}
+	overlay.CSP.UpgradeInsecureRequests = true
+	overlay.ReportTo.Groups = []ReportToGroup{group("csp", "https://b.example/r")}
+	overlay.ReportingEndpoints = map[string]string{"csp": "https://b.example/r"}
+	overlay.CustomDirectives = map[string]string{"require-trusted-types-for": "'script'"}
+	overlay.Additional = []Policy{SecurityOptionsReactJS()}
+
+	baseBefore, overlayBefore := base.Clone(), overlay.Clone()
+	merged := base.Merge(overlay)
+
+	if !base.Equal(baseBefore) || !overlay.Equal(overlayBefore) {
+		t.Errorf("Merge() modified its operands")
+	}
+	if want := []ReportToGroup{group("nel", "https://a.example/n"), group("csp", "https://b.example/r")}; !reflect.DeepEqual(merged.ReportTo.Groups, want) {
+		t.Errorf("ReportTo.Groups = %+v, want %+v", merged.ReportTo.Groups, want)
+	}
+	if want := map[string]string{"csp": "https://b.example/r", "nel": "https://a.example/n"}; !reflect.DeepEqual(merged.ReportingEndpoints, want) {
+		t.Errorf("ReportingEndpoints = %v, want %v", merged.ReportingEndpoints, want)
+	}
+	if want := map[string]string{"trusted-types": "default", "require-trusted-types-for": "'script'"}; !reflect.DeepEqual(merged.CustomDirectives, want) {
+		t.Errorf("CustomDirectives = %v, want %v", merged.CustomDirectives, want)
+	}
+	if want := []string{"/a", "/b"}; !reflect.DeepEqual(merged.CSP.ReportURI.Values, want) {
+		t.Errorf("report-uri = %v, want %v", merged.CSP.ReportURI.Values, want)
+	}
+	if !merged.CSP.UpgradeInsecureRequests {
+		t.Errorf("upgrade-insecure-requests was not carried over from the overlay")
+	}
+	if len(merged.Additional) != 2 || !merged.Additional[0].Equal(base.Additional[0]) || !merged.Additional[1].Equal(overlay.Additional[0]) {
+		t.Errorf("Additional = %d policies, want the base's then the overlay's", len(merged.Additional))
+	}
+	if !reflect.DeepEqual(merged.CSP.FrameAncestors, base.CSP.FrameAncestors) {
+		t.Errorf("frame-ancestors = %+v, want the base's kept over an Unset overlay", merged.CSP.FrameAncestors)
+	}
+}
+
+func TestMergeReportOnly(t *testing.T) {
+	tests := []struct {
+		base, overlay bool
+		mode          MergeMode
+		want          bool
+	}{
+		{false, false, MergeTighten, false},
+		{true, false, MergeTighten, false},
+		{false, true, MergeTighten, false},
+		{true, true, MergeTighten, true},
+		{true, false, MergeLoosen, true},
+		{false, true, MergeLoosen, true},
+		{false, false, MergeLoosen, false},
+	}
+	for _, tt := range tests {
+		base, overlay := Policy{ReportOnly: tt.base}, Policy{ReportOnly: tt.overlay}
+		if got := base.MergeWithMode(overlay, tt.mode).ReportOnly; got != tt.want {
+			t.Errorf("MergeWithMode(report-only %v, %v, mode %d).ReportOnly = %v, want %v",
+				tt.base, tt.overlay, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestMergeAbsentFrameAncestors(t *testing.T) {
+	absent, err := ParsePolicy("default-src 'self'")
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	present, err := ParsePolicy("default-src 'self'; frame-ancestors 'self'")
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+
+	// an absent frame-ancestors leaves the other policy's in place, in either order and mode
+	for _, mode := range []MergeMode{MergeTighten, MergeLoosen} {
+		for _, merged := range []Policy{absent.MergeWithMode(present, mode), present.MergeWithMode(absent, mode)} {
+			if got := renderCSP(t, merged); got != "default-src 'self'; frame-ancestors 'self';" {
+				t.Errorf("merged with mode %d = %q, want frame-ancestors 'self' kept", mode, got)
+			}
+		}
+	}
+	if merged := absent.Merge(absent); !merged.CSP.FrameAncestors.Unset {
+		t.Errorf("merged frame-ancestors = %+v, want two absent frame-ancestors to stay Unset", merged.CSP.FrameAncestors)
+	}
+}
+
+func TestCSPSourceOptionsMerge(t *testing.T) {
+	sha := Hash{Algorithm: HashSHA256, Base64: emptySHA256}
+	tests := []struct {
+		name       string
+		cso, other CSPSourceOptions
+		want       CSPSourceOptions
+	}{
+		{
+			name:  "values unioned",
+			cso:   CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{"https://a.example.com"}},
+			other: CSPSourceOptions{Allow: true, Values: []string{"https://A.example.com", "https://b.example.com"}},
+			want:  CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{"https://a.example.com", "https://b.example.com"}},
+		},
+		{
+			name:  "sources added to none are allowed",
+			cso:   CSPSourceOptions{},
+			other: CSPSourceOptions{Allow: true, Values: []string{"https://a.example.com"}},
+			want:  CSPSourceOptions{Allow: true, Values: []string{"https://a.example.com"}},
+		},
+		{
+			name:  "keywords ORed",
+			cso:   CSPSourceOptions{Allow: true, UnsafeEval: true},
+			other: CSPSourceOptions{Allow: true, StrictDynamic: true, ReportSample: true},
+			want:  CSPSourceOptions{Allow: true, UnsafeEval: true, StrictDynamic: true, ReportSample: true},
+		},
+		{
+			name:  "unset takes the other",
+			cso:   CSPSourceOptions{Unset: true},
+			other: CSPSourceOptions{Allow: true, AllowSelf: true},
+			want:  CSPSourceOptions{Allow: true, AllowSelf: true},
+		},
+		{
+			name:  "unset other",
+			cso:   CSPSourceOptions{Allow: true, AllowSelf: true},
+			other: CSPSourceOptions{Unset: true},
+			want:  CSPSourceOptions{Allow: true, AllowSelf: true},
+		},
+		{
+			name:  "nonces",
+			cso:   CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj"},
+			other: CSPSourceOptions{Allow: true, NonceBase64Value: "ZGVm", Nonces: []string{"YWJj", "Z2hp"}},
+			want:  CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj", Nonces: []string{"ZGVm", "Z2hp"}},
+		},
+		{
+			name:  "nonce field taken from the other",
+			cso:   CSPSourceOptions{Allow: true, Nonces: []string{"Z2hp"}},
+			other: CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj", Nonces: []string{"Z2hp"}},
+			want:  CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj", Nonces: []string{"Z2hp"}},
+		},
+		{
+			name:  "deprecated hash moved to Hashes",
+			cso:   CSPSourceOptions{Allow: true, HashAlgorithmBase64Value: "sha384-YWJj"},
+			other: CSPSourceOptions{Allow: true, HashAlgorithmBase64Value: "'sha256-" + emptySHA256 + "'", Hashes: []Hash{sha}},
+			want:  CSPSourceOptions{Allow: true, HashAlgorithmBase64Value: "sha384-YWJj", Hashes: []Hash{sha}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cso.Merge(tt.other)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %+v, want %+v", got, tt.want)
+			}
+			if again := got.Merge(tt.other); !reflect.DeepEqual(again, got) {
+				t.Errorf("merging again = %+v, want no change from %+v", again, got)
+			}
+		})
+	}
+}
+
+func TestCSPSourceOptionsMergeShares(t *testing.T) {
+	cso := CSPSourceOptions{Allow: true, Values: make([]string, 1, 4)}
+	cso.Values[0] = "https://a.example.com"
+	merged := cso.Merge(CSPSourceOptions{Allow: true, Values: []string{"https://b.example.com"}})
+	merged.Values[0] = "https://evil.example"
+	if cso.Values[0] != "https://a.example.com" {
+		t.Errorf("Merge() shares Values with its receiver: %v", cso.Values)
+	}
+}
+
+func TestMergeMaxHeaderBytes(t *testing.T) {
+	tests := []struct {
+		name          string
+		base, overlay int
+		mode          MergeMode
+		want          int
+	}{
+		{"unset base", 0, 4096, MergeTighten, 4096},
+		{"unset overlay", 4096, 0, MergeLoosen, 4096},
+		{"tighten keeps the smaller", 8192, 4096, MergeTighten, 4096},
+		{"loosen keeps the larger", 4096, 8192, MergeLoosen, 8192},
+		{"tighten keeps a limit over disabled", -1, 4096, MergeTighten, 4096},
+		{"loosen keeps disabled", 4096, -1, MergeLoosen, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeMaxHeaderBytes(tt.base, tt.overlay, tt.mode); got != tt.want {
+				t.Errorf("mergeMaxHeaderBytes(%d, %d) = %d, want %d", tt.base, tt.overlay, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMergeTightenIntoPresets merges overlays that add no sources into each preset, in both orders, and checks
+// that no directive of the preset gets looser
+func TestMergeTightenIntoPresets(t *testing.T) {
+	lockedDown := Policy{OmitZeroDirectives: true}
+	lockedDown.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+	lockedDown.CSP.ScriptSrc = CSPSourceOptions{Allow: true, Values: []string{SourceNone}}
+	lockedDown.CSP.ObjectSrc = CSPSourceOptions{Allow: true, Values: []string{SourceNone}}
+	lockedDown.CSP.BaseURI = CSPSourceOptions{Unset: true}
+	lockedDown.CSP.FormAction = CSPSourceOptions{Unset: true}
+
+	overlays := map[string]Policy{
+		"zero":        {},
+		"omit zero":   {OmitZeroDirectives: true},
+		"locked down": lockedDown,
+	}
+
+	for presetName, preset := range presets() {
+		before := renderCSP(t, preset)
+		for overlayName, overlay := range overlays {
+			for order, merged := range map[string]Policy{
+				"preset.Merge(overlay)": preset.Merge(overlay),
+				"overlay.Merge(preset)": overlay.Merge(preset),
+			} {
+				after := renderCSP(t, merged)
+				if name, loosened := loosenedDirective(t, before, after); loosened {
+					t.Errorf("%s with %s overlay, %s loosens %s:\nbefore: %s\nafter:  %s",
+						presetName, overlayName, order, name, before, after)
+				}
+			}
+		}
+	}
+}
+
+// effectiveValues returns the values of the directive that applies for name, itself or its nearest fallback
+func effectiveValues(hd headerDirectives, name string) ([]string, bool) {
+	for _, candidate := range append([]string{name}, directiveFallbacks[name]...) {
+		if values, ok := hd.values[candidate]; ok {
+			return values, true
+		}
+	}
+	return nil, false
+}
+
+// loosenedDirective returns the first directive whose effective value, following the fetch directive fallbacks,
+// allows more in the after header than in the before header
+func loosenedDirective(t *testing.T, before, after string) (string, bool) {
+	t.Helper()
+	hb, err := normalizedDirectives(before)
+	if err != nil {
+		t.Fatalf("normalizing %q: %v", before, err)
+	}
+	ha, err := normalizedDirectives(after)
+	if err != nil {
+		t.Fatalf("normalizing %q: %v", after, err)
+	}
+
+	for _, name := range directiveOrder {
+		vb, inBefore := effectiveValues(hb, name)
+		va, inAfter := effectiveValues(ha, name)
+		switch {
+		case !inBefore:
+		case inAfter && len(va) == 1 && va[0] == SourceNone:
+			// 'none' allows nothing, whatever changeLoosens makes of dropping 'strict-dynamic'
+		case !inAfter:
+			if removedLoosens(name) {
+				return name, true
+			}
+		case changeLoosens(name, subtractStrings(va, vb), subtractStrings(vb, va)):
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,50 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+)
+
+// metaForbiddenDirectives are not supported when a policy is delivered via a <meta> element and are ignored by
+// browsers if present.
+// https://www.w3.org/TR/CSP3/#meta-element
+var metaForbiddenDirectives = map[string]bool{
+	"frame-ancestors": true,
+	"report-uri":      true,
+	"report-to":       true,
+	"sandbox":         true,
+}
+
+// MetaElement renders the policy as a <meta http-equiv="Content-Security-Policy"> element for pages where headers
+// cannot be set (e.g. a static host).  Directives that are not permitted in a meta policy are removed, and a
+// description of each removal is returned alongside the element.  A meta element carries a single policy, so
+// Additional policies are not included; render each to its own element.
+func (pol Policy) MetaElement() (string, []string, error) {
+	if pol.ReportOnly {
+		return "", nil, errors.New("report-only policies cannot be delivered via a meta element")
+	}
+
+	compiled, err := pol.Compile()
+	if err != nil {
+		return "", nil, err
+	}
+
+	dropped := make([]string, 0)
+	for k := range metaForbiddenDirectives {
+		if len(compiled.staticDirectives[k]) > 0 || len(compiled.dynamicDirectives[k]) > 0 {
+			dropped = append(dropped, fmt.Sprintf("%s is not supported in a meta element and was removed", k))
+		}
+	}
+
+	sort.Strings(dropped)
+
+	content, err := compiled.directiveString(metaForbiddenDirectives, "")
+	if err != nil {
+		return "", nil, err
+	}
+	element := fmt.Sprintf(`<meta http-equiv="%s" content="%s">`, HeaderContentSecurityPolicy, html.EscapeString(content))
+
+	return element, dropped, nil
+}
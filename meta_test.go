@@ -0,0 +1,72 @@
+package cspheader
+
+import (
+	"html"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMetaElement(t *testing.T) {
+	pol := Policy{}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{"https://cdn.example.com/a&b/"}}
+	pol.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, AllowSelf: true}
+	pol.CSP.Sandbox = SandboxOptions{AllowScripts: true}
+	pol.CSP.ReportURI = UnquotedOptions{Values: []string{"/csp"}}
+
+	element, dropped, err := pol.MetaElement()
+	if err != nil {
+		t.Fatalf("MetaElement() error = %v", err)
+	}
+
+	wantDropped := []string{
+		"frame-ancestors is not supported in a meta element and was removed",
+		"report-uri is not supported in a meta element and was removed",
+		"sandbox is not supported in a meta element and was removed",
+	}
+	if !reflect.DeepEqual(dropped, wantDropped) {
+		t.Errorf("MetaElement() dropped %q, want %q", dropped, wantDropped)
+	}
+
+	const prefix, suffix = `<meta http-equiv="Content-Security-Policy" content="`, `">`
+	if !strings.HasPrefix(element, prefix) || !strings.HasSuffix(element, suffix) {
+		t.Fatalf("MetaElement() = %q, want a meta element", element)
+	}
+	content := strings.TrimSuffix(strings.TrimPrefix(element, prefix), suffix)
+	if strings.ContainsAny(content, `"'`) || !strings.Contains(content, "a&amp;b") {
+		t.Errorf("content %q is not HTML escaped", content)
+	}
+
+	unescaped := html.UnescapeString(content)
+	for directive := range metaForbiddenDirectives {
+		if strings.Contains(unescaped, directive) {
+			t.Errorf("content %q includes %s", unescaped, directive)
+		}
+	}
+	if !strings.Contains(unescaped, "script-src 'self' https://cdn.example.com/a&b/;") {
+		t.Errorf("content %q lacks script-src", unescaped)
+	}
+}
+
+func TestMetaElementReportOnly(t *testing.T) {
+	pol := SecurityOptionsStaticSite()
+	pol.ReportOnly = true
+	_, _, err := pol.MetaElement()
+	if err == nil || !strings.Contains(err.Error(), "report-only") {
+		t.Errorf("MetaElement() error = %v, want report-only policies rejected", err)
+	}
+}
+
+func TestMetaElementNothingDropped(t *testing.T) {
+	pol := Policy{}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	pol.CSP.FrameAncestors = FrameAncestorOptions{Unset: true}
+	_, dropped, err := pol.MetaElement()
+	if err != nil {
+		t.Fatalf("MetaElement() error = %v", err)
+	}
+	if len(dropped) != 0 {
+		t.Errorf("MetaElement() dropped %q, want nothing", dropped)
+	}
+}
@@ -0,0 +1,157 @@
+package cspheader
+
+import (
+	"context"
+	"net/http"
+)
+
+// MiddlewareOption configures the behavior of Middleware
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	nonce bool
+
+	injectNonce bool
+	injectLimit int
+
+	selector func(*http.Request) *CompiledPolicy
+	rollout  *EnforcementRollout
+}
+
+// WithNonce generates a fresh nonce for every request, renders it into each directive of the policy that carries
+// a nonce, and stores it in the request context for handlers to retrieve with NonceFromContext.
+// Directives receive the nonce only if they set NonceBase64Value or Nonces; any placeholder value will do.
+func WithNonce() MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.nonce = true
+	}
+}
+
+// WithPolicySelector chooses the policy for each request, e.g. loosening script-src for requests carrying an
+// internal preview cookie.  selector is called once per request before any headers are written; returning nil
+// uses the policy given to Middleware.  If selector panics, the panic is recovered and the default policy is used.
+func WithPolicySelector(selector func(*http.Request) *CompiledPolicy) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.selector = selector
+	}
+}
+
+// selectPolicy runs the configured selector, falling back to fallback if there is no selector, it returns nil,
+// or it panics
+func (cfg *middlewareConfig) selectPolicy(r *http.Request, fallback *CompiledPolicy) (selected *CompiledPolicy) {
+	if cfg.selector == nil {
+		return fallback
+	}
+
+	defer func() {
+		if recover() != nil {
+			selected = fallback
+		}
+	}()
+
+	selected = cfg.selector(r)
+	if selected == nil {
+		return fallback
+	}
+	return selected
+}
+
+// nonceContextKey is the unexported context key under which the per-request nonce is stored
+type nonceContextKey struct{}
+
+// NonceFromContext returns the per-request nonce stored by Middleware's WithNonce option
+func NonceFromContext(ctx context.Context) (string, bool) {
+	nonce, ok := ctx.Value(nonceContextKey{}).(string)
+	return nonce, ok
+}
+
+// Middleware returns net/http middleware that sets the policy's headers on every response.  The policy is compiled
+// once here, so a bad Policy is reported at startup rather than per request.
+//
+// Headers are set before the wrapped handler runs, so they are present whether the handler calls WriteHeader
+// explicitly or writes the body directly.  Each of the policy's Additional policies is sent as its own header line.
+func Middleware(pol Policy, opts ...MiddlewareOption) (func(http.Handler) http.Handler, error) {
+	cfg := &middlewareConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	compiled, err := pol.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	// without WithNonce every request renders without a nonce, so a policy that needs one fails here, at startup
+	var headers http.Header
+	if !cfg.nonce {
+		headers, err = compiled.Header("")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg.handler(func() (*CompiledPolicy, http.Header) {
+		return compiled, headers
+	}), nil
+}
+
+// handler builds the middleware around current, which returns the policy for a request and, if they are known
+// ahead of time, its headers rendered without a nonce.
+func (cfg *middlewareConfig) handler(current func() (*CompiledPolicy, http.Header)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			compiled, headers := current()
+			if compiled == nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			selected := cfg.selectPolicy(r, compiled)
+
+			reportOnly := selected.reportOnly
+			if cfg.rollout != nil {
+				reportOnly = !cfg.rollout.enforce(r)
+			}
+
+			// the common case needs no per-request rendering
+			if headers != nil && selected == compiled && !cfg.nonce && reportOnly == compiled.reportOnly {
+				setHeaders(w.Header(), headers)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var nonce string
+			if cfg.nonce {
+				var err error
+				nonce, err = GenerateNonce()
+				if err != nil {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			requestHeaders, err := selected.header(nonce, reportOnly)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			setHeaders(w.Header(), requestHeaders)
+
+			if !cfg.nonce {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), nonceContextKey{}, nonce))
+
+			if !cfg.injectNonce {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			iw := &nonceInjectingWriter{ResponseWriter: w, nonce: nonce, maxBytes: cfg.injectLimit}
+			next.ServeHTTP(iw, r)
+			// the response is already underway, so there is no one to report a failed write to
+			_ = iw.finish()
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package cspheader
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	pol := layeredWriterPolicy()
+	want, err := pol.LoadHeaders()
+	if err != nil {
+		t.Fatalf("LoadHeaders() error = %v", err)
+	}
+	mw, err := Middleware(pol)
+	if err != nil {
+		t.Fatalf("Middleware() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{"write body", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) }, http.StatusOK},
+		{"explicit WriteHeader", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }, http.StatusTeapot},
+		{"nothing written", func(w http.ResponseWriter, r *http.Request) {}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(mw, tt.handler, nil)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			got := rec.Result().Header
+			for _, name := range []string{HeaderContentSecurityPolicy, HeaderContentSecurityPolicyReportOnly, HeaderReportingEndpoints} {
+				if !reflect.DeepEqual(got.Values(name), want.Values(name)) {
+					t.Errorf("%s = %q, want %q", name, got.Values(name), want.Values(name))
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareStartupErrors(t *testing.T) {
+	invalid := Policy{}
+	invalid.CSP.ScriptSrc = CSPSourceOptions{Allow: true, Values: []string{"self"}}
+	_, err := Middleware(invalid)
+	if !errors.Is(err, ErrUnquotedKeyword) {
+		t.Errorf("Middleware() of an invalid policy error = %v, want %v", err, ErrUnquotedKeyword)
+	}
+
+	_, err = Middleware(SecurityOptionsStrict())
+	if !errors.Is(err, ErrNonceRequired) {
+		t.Errorf("Middleware() of a policy needing a nonce without WithNonce error = %v, want %v", err, ErrNonceRequired)
+	}
+}
+
+// serve runs a request through mw around handler and returns the response
+func serve(mw func(http.Handler) http.Handler, handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	if r == nil {
+		r = httptest.NewRequest(http.MethodGet, "/", nil)
+	}
+	rec := httptest.NewRecorder()
+	mw(handler).ServeHTTP(rec, r)
+	return rec
+}
+
+func TestMiddlewareWithNonce(t *testing.T) {
+	mw, err := Middleware(noncePolicy(), WithNonce())
+	if err != nil {
+		t.Fatalf("Middleware() error = %v", err)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		var nonce string
+		var ok bool
+		rec := serve(mw, func(w http.ResponseWriter, r *http.Request) {
+			nonce, ok = NonceFromContext(r.Context())
+		}, nil)
+
+		if !ok || !isBase64Value(nonce) {
+			t.Fatalf("NonceFromContext() = %q, %v, want a nonce", nonce, ok)
+		}
+		if seen[nonce] {
+			t.Fatalf("nonce %q repeated across requests", nonce)
+		}
+		seen[nonce] = true
+
+		csp := rec.Header().Get(HeaderContentSecurityPolicy)
+		if strings.Count(csp, "'nonce-"+nonce+"'") != 2 || strings.Contains(csp, "configured") {
+			t.Errorf("header = %q, want the request's nonce in script-src and style-src", csp)
+		}
+	}
+}
+
+func TestNonceFromContextWithoutNonce(t *testing.T) {
+	mw, err := Middleware(SecurityOptionsStaticSite())
+	if err != nil {
+		t.Fatalf("Middleware() error = %v", err)
+	}
+	serve(mw, func(w http.ResponseWriter, r *http.Request) {
+		if nonce, ok := NonceFromContext(r.Context()); ok {
+			t.Errorf("NonceFromContext() = %q without WithNonce", nonce)
+		}
+	}, nil)
+}
+
+func TestMiddlewareWithPolicySelector(t *testing.T) {
+	base := SecurityOptionsStaticSite()
+	preview := SecurityOptionsStaticSite()
+	preview.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{"https://preview.example.com"}}
+	previewCompiled := preview.MustCompile()
+
+	mw, err := Middleware(base, WithPolicySelector(func(r *http.Request) *CompiledPolicy {
+		switch r.URL.Path {
+		case "/preview":
+			return previewCompiled
+		case "/panic":
+			panic("selector failed")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("Middleware() error = %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want Policy
+	}{
+		{"/", base},
+		{"/preview", preview},
+		{"/panic", base},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := serve(mw, func(w http.ResponseWriter, r *http.Request) {}, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if got, want := rec.Header().Get(HeaderContentSecurityPolicy), renderCSP(t, tt.want); got != want {
+				t.Errorf("header = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithNonceStrict(t *testing.T) {
+	mw, err := Middleware(SecurityOptionsStrict(), WithNonce())
+	if err != nil {
+		t.Fatalf("Middleware() of a policy using NoncePlaceholder with WithNonce error = %v", err)
+	}
+	var nonce string
+	rec := serve(mw, func(w http.ResponseWriter, r *http.Request) {
+		nonce, _ = NonceFromContext(r.Context())
+	}, nil)
+	if csp := rec.Header().Get(HeaderContentSecurityPolicy); !strings.Contains(csp, "'nonce-"+nonce+"'") || strings.Contains(csp, NoncePlaceholder) {
+		t.Errorf("header = %q, want the placeholder replaced with %q", csp, nonce)
+	}
+}
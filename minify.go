@@ -0,0 +1,226 @@
+package cspheader
+
+import (
+	"strings"
+)
+
+// Minify removes source expressions that are covered by a broader expression in the same directive, e.g.
+// static.example.com alongside *.example.com, or https://example.com alongside https:.  The policy allows exactly
+// the same requests afterwards.  Keyword, nonce, and hash sources are never removed.
+// Fields are assigned new slices rather than modified in place.
+func (pol *Policy) Minify() {
+	for _, name := range directiveOrder {
+		cso := pol.sourceOptionsByName(name)
+		if cso == nil {
+			continue
+		}
+		cso.Values = minifyValues(cso.Values, nil)
+	}
+
+	fa := &pol.CSP.FrameAncestors
+	schemes := minifyValues(fa.SchemeSources, nil)
+	fa.HostSources = minifyValues(fa.HostSources, schemes)
+	fa.SchemeSources = schemes
+}
+
+// minifyValues drops each value subsumed by another value or by one of others.  of two values that subsume each
+// other, the first is kept.
+func minifyValues(values, others []string) []string {
+	exprs := make([]sourceExpression, len(values))
+	for i, v := range values {
+		exprs[i] = parseSourceExpression(v)
+	}
+	otherExprs := make([]sourceExpression, len(others))
+	for i, v := range others {
+		otherExprs[i] = parseSourceExpression(v)
+	}
+
+	var minified []string
+	for i, e := range exprs {
+		redundant := false
+		for _, o := range otherExprs {
+			if o.subsumes(e) {
+				redundant = true
+				break
+			}
+		}
+		for j := 0; j < len(exprs) && !redundant; j++ {
+			if j == i || !exprs[j].subsumes(e) {
+				continue
+			}
+			// equivalent expressions: keep the first
+			redundant = j < i || !e.subsumes(exprs[j])
+		}
+
+		if redundant && minified == nil {
+			minified = append(make([]string, 0, len(values)-1), values[:i]...)
+		}
+		if !redundant && minified != nil {
+			minified = append(minified, values[i])
+		}
+	}
+	if minified == nil {
+		return values
+	}
+	return minified
+}
+
+type sourceExpressionKind int
+
+const (
+	// sourceOther is anything Minify does not reason about: keywords, nonces, hashes, and unparseable values
+	sourceOther sourceExpressionKind = iota
+	sourceStar
+	sourceScheme
+	sourceHost
+)
+
+// sourceExpression is a parsed unquoted source expression.  scheme, host, and port are lowercase.
+type sourceExpression struct {
+	kind   sourceExpressionKind
+	scheme string // empty for a host-source without a scheme
+	// host is the host without any leading *. label.  empty with anyHost for a host of *.
+	host         string
+	wildcardHost bool // the host began with *.
+	anyHost      bool // the host was *
+	port         string
+	path         string
+}
+
+func parseSourceExpression(v string) sourceExpression {
+	if strings.HasPrefix(v, "'") || ValidateHostSource(v) != nil {
+		return sourceExpression{kind: sourceOther}
+	}
+	if v == "*" {
+		return sourceExpression{kind: sourceStar}
+	}
+
+	e := sourceExpression{kind: sourceHost}
+	rest := v
+	if i := strings.Index(rest, "://"); i >= 0 {
+		e.scheme = strings.ToLower(rest[:i])
+		rest = rest[i+len("://"):]
+	} else if strings.HasSuffix(rest, ":") {
+		return sourceExpression{kind: sourceScheme, scheme: strings.ToLower(rest[:len(rest)-1])}
+	}
+
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		rest, e.path = rest[:i], rest[i:]
+	}
+	if i := strings.LastIndexByte(rest, ':'); i >= 0 {
+		rest, e.port = rest[:i], rest[i+1:]
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(rest), ".")
+	switch {
+	case host == "*":
+		e.anyHost = true
+	case strings.HasPrefix(host, "*."):
+		e.wildcardHost = true
+		e.host = host[len("*."):]
+	default:
+		e.host = host
+	}
+	return e
+}
+
+// schemeMatches is the set of url schemes a scheme in an expression matches: the scheme itself and its secure
+// counterpart.  CSP3 additionally lets ws and wss match http(s) urls, which not every browser implements, so that is
+// left out: a narrower set only means less is allowed by MatchSource and less is removed by Minify.
+// https://www.w3.org/TR/CSP3/#match-schemes
+func schemeMatches(scheme string) []string {
+	switch scheme {
+	case "http":
+		return []string{"http", "https"}
+	case "https":
+		return []string{"https", "wss"}
+	case "ws":
+		return []string{"ws", "wss"}
+	}
+	return []string{scheme}
+}
+
+// schemeSubsumes reports whether every url scheme matched by b is matched by a
+func schemeSubsumes(a, b string) bool {
+	for _, s := range schemeMatches(b) {
+		if !containsString(schemeMatches(a), s) {
+			return false
+		}
+	}
+	return true
+}
+
+// subsumes reports whether every url matched by o is also matched by e.  it errs toward false: a host-source
+// without a scheme matches relative to the protected resource's scheme, which is not known here.
+func (e sourceExpression) subsumes(o sourceExpression) bool {
+	if e.kind == sourceOther || o.kind == sourceOther {
+		return false
+	}
+
+	switch e.kind {
+	case sourceStar:
+		// * matches starSchemes, and urls of the protected resource's own scheme
+		switch o.kind {
+		case sourceStar:
+			return true
+		case sourceScheme:
+			return starSubsumes(o.scheme)
+		case sourceHost:
+			return len(o.scheme) == 0 || starSubsumes(o.scheme)
+		}
+	case sourceScheme:
+		switch o.kind {
+		case sourceScheme:
+			return schemeSubsumes(e.scheme, o.scheme)
+		case sourceHost:
+			return len(o.scheme) > 0 && schemeSubsumes(e.scheme, o.scheme)
+		}
+	case sourceHost:
+		if o.kind != sourceHost {
+			return false
+		}
+		return e.schemeSubsumes(o) && e.hostSubsumes(o) && (e.port == "*" || e.port == o.port) && e.pathSubsumes(o)
+	}
+	return false
+}
+
+// starSubsumes reports whether every url scheme matched by scheme is matched by *
+func starSubsumes(scheme string) bool {
+	for _, s := range schemeMatches(scheme) {
+		if !containsString(starSchemes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e sourceExpression) schemeSubsumes(o sourceExpression) bool {
+	if len(e.scheme) == 0 || len(o.scheme) == 0 {
+		return e.scheme == o.scheme
+	}
+	return schemeSubsumes(e.scheme, o.scheme)
+}
+
+func (e sourceExpression) hostSubsumes(o sourceExpression) bool {
+	switch {
+	case e.anyHost:
+		return true
+	case o.anyHost:
+		return false
+	case e.wildcardHost:
+		// *.example.com matches subdomains of example.com, but not example.com itself
+		return strings.HasSuffix(o.host, "."+e.host) || (o.wildcardHost && o.host == e.host)
+	}
+	return !o.wildcardHost && e.host == o.host
+}
+
+// pathSubsumes reports whether every path matched by o's path is matched by e's, as by pathPartMatches
+func (e sourceExpression) pathSubsumes(o sourceExpression) bool {
+	switch {
+	case len(e.path) == 0:
+		return true
+	case len(o.path) == 0:
+		return false
+	}
+	return pathPartMatches(e.path, o.path)
+}
@@ -0,0 +1,146 @@
+package cspheader
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestMinifyValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{"nothing subsumed", []string{"static.example.com", "other.example"}, []string{"static.example.com", "other.example"}},
+		{"wildcard subdomain", []string{"static.example.com", "*.example.com", "a.b.example.com"}, []string{"*.example.com"}},
+		{"wildcard does not cover the apex", []string{"*.example.com", "example.com"}, []string{"*.example.com", "example.com"}},
+		{"scheme", []string{"https://static.example.com", "https:", "wss://example.com"}, []string{"https:"}},
+		// https: also matches wss urls, which http: does not
+		{"http does not cover https", []string{"http:", "https:"}, []string{"http:", "https:"}},
+		{"https does not cover http", []string{"https:", "http://example.com"}, []string{"https:", "http://example.com"}},
+		{"port wildcard", []string{"https://example.com:8443", "https://example.com:*"}, []string{"https://example.com:*"}},
+		{"path prefix", []string{"https://static.example.com/js/app.js", "https://static.example.com/js/"},
+			[]string{"https://static.example.com/js/"}},
+		{"star", []string{"*", "https://example.com", "data:"}, []string{"*", "data:"}},
+		{"equivalent keeps the first", []string{"https://Example.com", "https://example.com"}, []string{"https://Example.com"}},
+		{"keywords kept", []string{"'self'", "*", "'unsafe-inline'", "'nonce-YWJj'"}, []string{"'self'", "*", "'unsafe-inline'", "'nonce-YWJj'"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := append([]string(nil), tt.values...)
+			got := minifyValues(values, nil)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("minifyValues(%q) = %q, want %q", tt.values, got, tt.want)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("minifyValues(%q) modified its argument to %q", tt.values, values)
+			}
+			for _, s := range minifySamples {
+				if before, after := matchesAny(t, tt.values, s), matchesAny(t, got, s); before != after {
+					t.Errorf("%s matched %v before and %v after minifying", s, before, after)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyMinify(t *testing.T) {
+	pol := SecurityOptionsServerRendered()
+	scriptValues := []string{"https://static.example.com", "https://*.example.com"}
+	pol.CSP.ScriptSrc.Values = scriptValues
+	pol.CSP.FrameAncestors = FrameAncestorOptions{
+		Allow:         true,
+		HostSources:   []string{"https://partner.example"},
+		SchemeSources: []string{SchemeHTTPS},
+	}
+	pol.Minify()
+
+	if want := []string{"https://*.example.com"}; !reflect.DeepEqual(pol.CSP.ScriptSrc.Values, want) {
+		t.Errorf("script-src Values = %q, want %q", pol.CSP.ScriptSrc.Values, want)
+	}
+	if len(pol.CSP.FrameAncestors.HostSources) != 0 {
+		t.Errorf("frame-ancestors HostSources = %q, want the host covered by https: removed", pol.CSP.FrameAncestors.HostSources)
+	}
+	if !pol.CSP.ScriptSrc.AllowSelf {
+		t.Error("AllowSelf = false, want keywords kept")
+	}
+	if scriptValues[0] != "https://static.example.com" {
+		t.Errorf("Values = %q, want the caller's slice left as is", scriptValues)
+	}
+}
+
+// TestSubsumes checks each pair in both directions, and that a subsumed expression matches nothing the other
+// does not
+func TestSubsumes(t *testing.T) {
+	tests := []struct {
+		a, b       string
+		aSubsumesB bool
+		bSubsumesA bool
+	}{
+		{"*.example.com", "static.example.com", true, false},
+		{"*.example.com", "*.static.example.com", true, false},
+		{"https:", "https://example.com", true, false},
+		{"https:", "wss:", true, false},
+		{"http:", "https:", false, false},
+		{"http:", "http://example.com", true, false},
+		{"ws:", "wss:", true, false},
+		{"ws:", "https:", false, false},
+		{"*", "https://example.com", true, false},
+		{"*", "data:", false, false},
+		{"example.com", "https://example.com", false, false},
+		{"https://example.com:*", "https://example.com:8443", true, false},
+		{"https://example.com", "https://example.com:443", false, false},
+		{"https://example.com/js/", "https://example.com/js/app.js", true, false},
+		{"https://example.com/js", "https://example.com/js/app.js", false, false},
+		{"https://example.com", "https://EXAMPLE.com.", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, b := parseSourceExpression(tt.a), parseSourceExpression(tt.b)
+			if got := a.subsumes(b); got != tt.aSubsumesB {
+				t.Errorf("%q subsumes %q = %v, want %v", tt.a, tt.b, got, tt.aSubsumesB)
+			}
+			if got := b.subsumes(a); got != tt.bSubsumesA {
+				t.Errorf("%q subsumes %q = %v, want %v", tt.b, tt.a, got, tt.bSubsumesA)
+			}
+			for _, s := range minifySamples {
+				matchA, matchB := matchesAny(t, []string{tt.a}, s), matchesAny(t, []string{tt.b}, s)
+				if tt.aSubsumesB && matchB && !matchA {
+					t.Errorf("%q subsumes %q, but only the latter matches %s", tt.a, tt.b, s)
+				}
+				if tt.bSubsumesA && matchA && !matchB {
+					t.Errorf("%q subsumes %q, but only the latter matches %s", tt.b, tt.a, s)
+				}
+			}
+		})
+	}
+}
+
+func matchesAny(t *testing.T, values []string, resource string) bool {
+	t.Helper()
+	origin := mustParseURL(t, "https://app.example.com/")
+	u, err := url.Parse(resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range values {
+		ok, err := MatchSource(v, u, origin)
+		if err != nil {
+			t.Fatalf("MatchSource(%q, %q) error = %v", v, resource, err)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// minifySamples are resources matched against expressions before and after minification
+var minifySamples = []string{
+	"https://example.com/", "http://example.com/", "wss://example.com/", "ws://example.com/",
+	"https://static.example.com/app.js", "http://static.example.com/app.js", "https://a.b.example.com/",
+	"https://example.com:8443/", "https://static.example.com:8443/js/app.js", "https://static.example.com/js/app.js",
+	"https://static.example.com/css/app.css", "https://other.example/", "data:image/png;base64,AAAA",
+	"blob:https://example.com/0c9a", "ftp://example.com/file",
+}
@@ -0,0 +1,33 @@
+package cspheader
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// DefaultNonceBytes is the number of random bytes used by GenerateNonce (128 bits)
+const DefaultNonceBytes = 16
+
+// GenerateNonce returns a URL-safe base64 nonce with 128 bits of entropy, suitable for NonceBase64Value.
+// A nonce must be unique for every response: https://www.w3.org/TR/CSP3/#security-nonces
+func GenerateNonce() (string, error) {
+	return GenerateNonceN(DefaultNonceBytes)
+}
+
+// GenerateNonceN returns a URL-safe base64 nonce made from n random bytes.  n may not be fewer than
+// DefaultNonceBytes.  An error is returned if the system's secure random source fails; there is no fallback
+// to a weaker source.
+func GenerateNonceN(n int) (string, error) {
+	if n < DefaultNonceBytes {
+		return "", fmt.Errorf("nonces require at least %d random bytes, got %d", DefaultNonceBytes, n)
+	}
+
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
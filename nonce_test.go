@@ -0,0 +1,49 @@
+package cspheader
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestGenerateNonce(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		nonce, err := GenerateNonce()
+		if err != nil {
+			t.Fatalf("GenerateNonce() error = %v", err)
+		}
+		b, err := base64.RawURLEncoding.DecodeString(nonce)
+		if err != nil || len(b) != DefaultNonceBytes {
+			t.Fatalf("GenerateNonce() = %q, want %d bytes of unpadded URL-safe base64", nonce, DefaultNonceBytes)
+		}
+		if !isBase64Value(nonce) {
+			t.Errorf("GenerateNonce() = %q, which the policy would not accept", nonce)
+		}
+		if seen[nonce] {
+			t.Fatalf("GenerateNonce() repeated %q", nonce)
+		}
+		seen[nonce] = true
+	}
+}
+
+func TestGenerateNonceN(t *testing.T) {
+	tests := []struct {
+		n       int
+		wantErr bool
+	}{
+		{0, true},
+		{DefaultNonceBytes - 1, true},
+		{DefaultNonceBytes, false},
+		{32, false},
+	}
+	for _, tt := range tests {
+		nonce, err := GenerateNonceN(tt.n)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("GenerateNonceN(%d) error = %v, want error %v", tt.n, err, tt.wantErr)
+			continue
+		}
+		if err == nil && base64.RawURLEncoding.DecodedLen(len(nonce)) != tt.n {
+			t.Errorf("GenerateNonceN(%d) = %q, want %d bytes", tt.n, nonce, tt.n)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package cspheader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Normalize returns the canonical form of a Content-Security-Policy header value, so that headers from different
+// sources (this package, a proxy config, a scanner) can be compared as strings.  Two headers that differ only in
+// directive order, whitespace, trailing semicolons, case where it is insignificant, or the order of source
+// expressions normalize to the same string.
+//
+// Directives are written in the order this package renders them, followed by any unknown directives by name, each
+// ending in ';' and separated by a single space.  As in the spec, only the first occurrence of a repeated directive
+// is kept.  Within a source list, keywords come first, then scheme and host sources, then nonces and hashes, each
+// group sorted and without duplicates.  Directive names, keywords, sandbox tokens, schemes, and hosts are lowercased;
+// paths and nonce and hash values are case-sensitive and left as they are.
+//
+// Normalize does not otherwise validate the header: unknown directives and source expressions are kept.
+func Normalize(header string) (string, error) {
+	if strings.Contains(header, ",") {
+		return "", fmt.Errorf("normalizing policy: a ',' separates multiple policies, which must be normalized separately")
+	}
+
+	directives := map[string][]string{}
+	var names []string
+	for _, rawDirective := range strings.Split(header, ";") {
+		tokens := strings.Fields(rawDirective)
+		if len(tokens) == 0 {
+			continue
+		}
+		err := validateControlCharacters("normalizing policy: token", tokens...)
+		if err != nil {
+			return "", err
+		}
+
+		name := strings.ToLower(tokens[0])
+		// https://www.w3.org/TR/CSP3/#parse-serialized-policy - duplicate directives are ignored
+		if _, seen := directives[name]; seen {
+			continue
+		}
+		directives[name] = normalizeDirectiveValues(name, tokens[1:])
+		names = append(names, name)
+	}
+
+	sortDirectiveNames(names)
+
+	var sb strings.Builder
+	dw := &directiveWriter{w: &sb}
+	for _, name := range names {
+		dw.directive(name, strings.Join(directives[name], " "))
+	}
+	return sb.String(), nil
+}
+
+// sortDirectiveNames sorts directive names into the order this package renders them, followed by unknown
+// directives by name
+func sortDirectiveNames(names []string) {
+	order := make(map[string]int, len(directiveOrder))
+	for i, name := range directiveOrder {
+		order[name] = i
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		oi, iKnown := order[names[i]]
+		oj, jKnown := order[names[j]]
+		if iKnown != jKnown {
+			return iKnown
+		}
+		if iKnown {
+			return oi < oj
+		}
+		return names[i] < names[j]
+	})
+}
+
+// normalizeDirectiveValues puts a directive's values in canonical form.  source lists and sandbox tokens are sets,
+// so are sorted; the values of any other directive keep their order.
+func normalizeDirectiveValues(name string, values []string) []string {
+	switch {
+	case (&Policy{}).sourceOptionsByName(name) != nil, name == DirectiveFrameAncestors:
+		normalized := make([]string, len(values))
+		for i, v := range values {
+			normalized[i] = normalizeSourceExpression(v)
+		}
+		sort.SliceStable(normalized, func(i, j int) bool {
+			ri, rj := sourceExpressionRank(normalized[i]), sourceExpressionRank(normalized[j])
+			if ri != rj {
+				return ri < rj
+			}
+			return normalized[i] < normalized[j]
+		})
+		return uniqueSorted(normalized)
+	case name == DirectiveSandbox:
+		normalized := make([]string, len(values))
+		for i, v := range values {
+			normalized[i] = strings.ToLower(v)
+		}
+		sort.Strings(normalized)
+		return uniqueSorted(normalized)
+	}
+	return values
+}
+
+// normalizeSourceExpression lowercases the case-insensitive parts of a source expression: keywords, the prefix of
+// a nonce or hash, and the scheme and host of a scheme or host source
+func normalizeSourceExpression(v string) string {
+	switch {
+	case isQuotedPrefix(v, "nonce-"):
+		return "'nonce-" + v[len("'nonce-"):]
+	case isQuotedPrefix(v, "sha256-"), isQuotedPrefix(v, "sha384-"), isQuotedPrefix(v, "sha512-"):
+		return strings.ToLower(v[:len("'shaNNN-")]) + v[len("'shaNNN-"):]
+	case strings.HasPrefix(v, "'"):
+		return strings.ToLower(v)
+	}
+
+	// the path, if any, begins at the first '/' after the scheme's "://"
+	authorityStart := 0
+	if i := strings.Index(v, "://"); i >= 0 {
+		authorityStart = i + len("://")
+	}
+	if i := strings.IndexByte(v[authorityStart:], '/'); i >= 0 {
+		pathStart := authorityStart + i
+		return strings.ToLower(v[:pathStart]) + v[pathStart:]
+	}
+	return strings.ToLower(v)
+}
+
+// sourceExpressionRank orders the groups of a normalized source list: keywords, scheme and host sources, nonces,
+// then hashes
+func sourceExpressionRank(v string) int {
+	switch {
+	case strings.HasPrefix(v, "'nonce-"):
+		return 2
+	case strings.HasPrefix(v, "'sha"):
+		return 3
+	case strings.HasPrefix(v, "'"):
+		return 0
+	}
+	return 1
+}
+
+// uniqueSorted drops adjacent duplicates from a sorted slice, in place
+func uniqueSorted(values []string) []string {
+	if len(values) < 2 {
+		return values
+	}
+	unique := values[:1]
+	for _, v := range values[1:] {
+		if v != unique[len(unique)-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
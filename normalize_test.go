@@ -0,0 +1,105 @@
+package cspheader
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"empty", "", ""},
+		{"only separators", " ; ;; ", ""},
+		{
+			name:   "directive order",
+			header: "script-src 'self'; default-src 'none'",
+			want:   "default-src 'none'; script-src 'self';",
+		},
+		{
+			name:   "whitespace and trailing semicolons",
+			header: "  default-src\t'self'   https://a.example.com ;;; img-src  data: ;",
+			want:   "default-src 'self' https://a.example.com; img-src data:;",
+		},
+		{
+			name:   "source order and duplicates",
+			header: "script-src 'sha256-abc=' https://b.example.com 'nonce-xyz' 'self' https://a.example.com 'self' 'strict-dynamic'",
+			want:   "script-src 'self' 'strict-dynamic' https://a.example.com https://b.example.com 'nonce-xyz' 'sha256-abc=';",
+		},
+		{
+			name:   "case",
+			header: "Script-Src 'SELF' HTTPS://CDN.Example.COM/Path/JS 'NONCE-AbC' 'SHA256-AbC='",
+			want:   "script-src 'self' https://cdn.example.com/Path/JS 'nonce-AbC' 'sha256-AbC=';",
+		},
+		{
+			name:   "sandbox tokens",
+			header: "sandbox allow-scripts ALLOW-FORMS allow-scripts",
+			want:   "sandbox allow-forms allow-scripts;",
+		},
+		{
+			name:   "frame-ancestors is a source list",
+			header: "frame-ancestors https://b.example.com 'self'",
+			want:   "frame-ancestors 'self' https://b.example.com;",
+		},
+		{
+			name:   "other values keep their order",
+			header: "report-uri /b /a; report-to csp",
+			want:   "report-uri /b /a; report-to csp;",
+		},
+		{
+			name:   "first of a repeated directive",
+			header: "img-src 'self'; img-src *",
+			want:   "img-src 'self';",
+		},
+		{
+			name:   "unknown directives after the known, by name",
+			header: "trusted-types default; require-trusted-types-for 'script'; default-src 'self'",
+			want:   "default-src 'self'; require-trusted-types-for 'script'; trusted-types default;",
+		},
+		{"valueless", "upgrade-insecure-requests; default-src 'self'", "default-src 'self'; upgrade-insecure-requests;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.header)
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+			again, err := Normalize(got)
+			if err != nil || again != got {
+				t.Errorf("Normalize() of its own output = %q, %v, want it unchanged", again, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	for _, header := range []string{
+		"default-src 'self', img-src *",
+		"default-src 'self' \x00",
+	} {
+		if _, err := Normalize(header); err == nil {
+			t.Errorf("Normalize(%q) error = nil, want an error", header)
+		}
+	}
+}
+
+func TestNormalizeRenderedPresets(t *testing.T) {
+	for name, pol := range presets() {
+		t.Run(name, func(t *testing.T) {
+			header := renderCSP(t, pol)
+			got, err := Normalize(header)
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			d, err := CompareHeaders(header, got)
+			if err != nil {
+				t.Fatalf("CompareHeaders() error = %v", err)
+			}
+			if !d.Equal() {
+				t.Errorf("normalizing changed the policy:\n%s", d)
+			}
+		})
+	}
+}
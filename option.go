@@ -1,7 +1,11 @@
 package cspheader
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"text/template"
 )
 
@@ -9,97 +13,421 @@ import (
 // Definition here:
 // https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Security-Policy/Sources#sources
 type CSPSourceOptions struct {
-	Allow     bool // Overrides all other settings! set 'none'?
-	AllowSelf bool // 'self'?
+	// Unset leaves the directive out of the policy entirely, rather than rendering it as 'none'.  For fetch
+	// directives, browsers then fall back to the next directive in the fallback list, usually default-src.
+	// Unset overrides all other settings.
+	//
+	// An Unset default-src leaves loads unrestricted only where no fetch directive applies either.  Fetch directives
+	// left at their zero value still render 'none', so a policy without default-src usually also sets the Policy's
+	// OmitZeroDirectives, which leaves them out as well.
+	Unset bool `json:"unset,omitempty"`
+
+	Allow     bool `json:"allow,omitempty"`      // Overrides all other settings! set 'none'?
+	AllowSelf bool `json:"allow-self,omitempty"` // 'self'?
 	// <host-source>, <scheme-source>, etc
-	Values         []string
-	UnsafeEval     bool // 'unsafe-eval'?
-	WasmUnsafeEval bool // 'wasm-unsafe-eval'?
-	UnsafeHashes   bool // 'unsafe-hashes'?
-	UnsafeInline   bool // 'unsafe-inline'?
+	Values         []string `json:"values,omitempty"`
+	UnsafeEval     bool     `json:"unsafe-eval,omitempty"`      // 'unsafe-eval'?
+	WasmUnsafeEval bool     `json:"wasm-unsafe-eval,omitempty"` // 'wasm-unsafe-eval'?
+	UnsafeHashes   bool     `json:"unsafe-hashes,omitempty"`    // 'unsafe-hashes'?
+	UnsafeInline   bool     `json:"unsafe-inline,omitempty"`    // 'unsafe-inline'?
 	// https://developer.mozilla.org/en-US/docs/Web/HTML/Global_attributes/nonce
-	NonceBase64Value         string // If not empty, 'nonce-<base64-value>'? (set unique each time!)
-	HashAlgorithmBase64Value string // If not empty, '<hash-algorithm>-<base64-value>'?
-	StrictDynamic            bool   // 'strict-dynamic'?
-	ReportSample             bool   // 'report-sample'?
+	// NonceBase64Value is the raw base64 value, which is rendered as 'nonce-<base64-value>'.  a value that is
+	// already quoted or prefixed with nonce- is accepted and will not be double-wrapped.
+	NonceBase64Value string `json:"nonce-base64-value,omitempty"` // If not empty, 'nonce-<base64-value>'? (set unique each time!)
+	// Nonces are additional raw base64 nonce values, each rendered as 'nonce-<base64-value>' after NonceBase64Value
+	Nonces []string `json:"nonces,omitempty"`
+	// HashAlgorithmBase64Value is given as <hash-algorithm>-<base64-value>, e.g. sha256-<base64-value>, and is
+	// rendered single-quoted.  the algorithm must be one of sha256, sha384, or sha512.
+	//
+	// Deprecated: use Hashes, which supports more than one hash source.
+	HashAlgorithmBase64Value string `json:"hash-algorithm-base64-value,omitempty"` // If not empty, '<hash-algorithm>-<base64-value>'?
+	Hashes                   []Hash `json:"hashes,omitempty"`                      // each rendered as '<hash-algorithm>-<base64-value>'?
+	StrictDynamic            bool   `json:"strict-dynamic,omitempty"`              // 'strict-dynamic'?
+	ReportSample             bool   `json:"report-sample,omitempty"`               // 'report-sample'?
+
+	// err holds the errors recorded by the SourceOptions passed to NewSourceOptions
+	err error
 }
 
 func (cso CSPSourceOptions) Parse(tmpl *template.Template) (string, error) {
-	var cspBytes bytes.Buffer
-	err := tmpl.Execute(&cspBytes, cso)
+	cso = cso.prepared()
+	if tmpl == defaultTemplate("SourceOption", TemplateTextSourceOption) {
+		return cso.render(), nil
+	}
+	return executeTemplate(tmpl, cso)
+}
+
+// ParseTo writes the directive's value as Parse would return it to w
+func (cso CSPSourceOptions) ParseTo(w io.Writer, tmpl *template.Template) error {
+	cso = cso.prepared()
+	if tmpl == defaultTemplate("SourceOption", TemplateTextSourceOption) {
+		_, err := io.WriteString(w, cso.render())
+		return err
+	}
+	return executeTemplateTo(w, tmpl, cso)
+}
+
+// prepared returns the options as the template sees them: nonces and hash without their quoting and prefix, and
+// keyword values quoted and deduplicated.
+func (cso CSPSourceOptions) prepared() CSPSourceOptions {
+	cso.NonceBase64Value = trimNonce(cso.NonceBase64Value)
+	if len(cso.Nonces) > 0 {
+		nonces := make([]string, len(cso.Nonces))
+		for i, n := range cso.Nonces {
+			nonces[i] = trimNonce(n)
+		}
+		cso.Nonces = nonces
+	}
+	cso.HashAlgorithmBase64Value = strings.Trim(cso.HashAlgorithmBase64Value, "'")
+	// a policy not set to QuoteKeywordValues has already rejected these
+	cso.Values = dedupeValues(quoteKeywordValues(cso.Values))
+	return cso
+}
+
+// NoncePlaceholder marks where a per-request nonce belongs.  A policy using it must be rendered with a nonce, via
+// HeaderWithNonce, CompiledPolicy.Render, or the middleware's WithNonce option; Load returns ErrNonceRequired.
+const NoncePlaceholder = "CSP_NONCE_PLACEHOLDER"
+
+// hasNoncePlaceholder reports whether NoncePlaceholder is among the nonces
+func (cso CSPSourceOptions) hasNoncePlaceholder() bool {
+	if cso.NonceBase64Value == NoncePlaceholder {
+		return true
+	}
+	for _, n := range cso.Nonces {
+		if n == NoncePlaceholder {
+			return true
+		}
+	}
+	return false
+}
+
+// hasNonce reports whether any nonce is set
+func (cso CSPSourceOptions) hasNonce() bool {
+	return len(cso.NonceBase64Value) > 0 || len(cso.Nonces) > 0
+}
+
+// isDynamic reports whether the options carry values that are unique per page load or script tag
+func (cso CSPSourceOptions) isDynamic() bool {
+	return cso.hasNonce() || len(cso.HashAlgorithmBase64Value) > 0 || len(cso.Hashes) > 0
+}
+
+// ErrContradictorySourceOptions is returned by strict policies for source options that contradict each other:
+//   - Allow false with any other field set.  the directive renders 'none' and the other fields are ignored.  without
+//     Strict this is a WarnIgnoredOptions warning.
+//   - 'unsafe-inline' with a nonce or hash.  browsers ignore 'unsafe-inline' when either is present.  the strict CSP
+//     pattern of pairing them with 'strict-dynamic', as a fallback for old browsers, is permitted.
+//   - 'strict-dynamic' without a nonce or hash.  nothing is trusted to load further scripts.
+var ErrContradictorySourceOptions = errors.New("contradictory source options")
+
+// isZero reports whether every field is at its zero value
+func (cso CSPSourceOptions) isZero() bool {
+	return reflect.ValueOf(cso).IsZero()
+}
+
+// ignoredFields returns the names of the fields set alongside a false Allow, which the template ignores as it
+// renders 'none'
+func (cso CSPSourceOptions) ignoredFields() []string {
+	if cso.Allow {
+		return nil
+	}
+	var fields []string
+	v := reflect.ValueOf(cso)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if name == "Allow" || name == "Unset" || v.Field(i).IsZero() {
+			continue
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// ignoredFieldsMessage explains why fields set alongside a false Allow have no effect
+func ignoredFieldsMessage(fields []string) string {
+	verb := "are"
+	if len(fields) == 1 {
+		verb = "is"
+	}
+	return fmt.Sprintf("Allow is false, so the directive is 'none' and %s %s ignored; set Allow to true for them to take effect",
+		strings.Join(fields, ", "), verb)
+}
+
+// validateStrict checks the source options for combinations that are valid but ignored in part
+func (cso CSPSourceOptions) validateStrict(directive string) error {
+	if fields := cso.ignoredFields(); len(fields) > 0 {
+		return &DirectiveError{
+			Directive: directive,
+			Err:       fmt.Errorf("%w: %s", ErrContradictorySourceOptions, ignoredFieldsMessage(fields)),
+		}
+	}
+	if !cso.Allow {
+		return nil
+	}
+
+	if cso.UnsafeInline && !cso.StrictDynamic && cso.isDynamic() {
+		return &DirectiveError{
+			Directive: directive,
+			Err:       fmt.Errorf("%w: 'unsafe-inline' is ignored by browsers when a nonce or hash is present", ErrContradictorySourceOptions),
+		}
+	}
+	if cso.StrictDynamic && !cso.isDynamic() {
+		return &DirectiveError{
+			Directive: directive,
+			Err:       fmt.Errorf("%w: 'strict-dynamic' requires a nonce or hash", ErrContradictorySourceOptions),
+		}
+	}
+	return nil
+}
+
+// validate checks the source options for values that would render an invalid directive
+func (cso CSPSourceOptions) validate(directive string) error {
+	if cso.err != nil {
+		return &DirectiveError{Directive: directive, Err: cso.err}
+	}
+	err := validateSourceValues(directive, cso.Values)
+	if err != nil {
+		return err
+	}
+	err = validateHostSources(directive, cso.Values)
+	if err != nil {
+		return err
+	}
+	err = validateControlCharacters("NonceBase64Value", cso.NonceBase64Value)
+	if err == nil {
+		err = validateControlCharacters("Nonces", cso.Nonces...)
+	}
+	if err == nil {
+		err = validateControlCharacters("HashAlgorithmBase64Value", cso.HashAlgorithmBase64Value)
+	}
+	if err == nil && len(cso.NonceBase64Value) > 0 {
+		err = validateNonce("NonceBase64Value", cso.NonceBase64Value)
+	}
+	for i := 0; err == nil && i < len(cso.Nonces); i++ {
+		err = validateNonce("Nonces", cso.Nonces[i])
+	}
 	if err != nil {
-		return "", err
+		return &DirectiveError{Directive: directive, Err: err}
+	}
+	if len(cso.HashAlgorithmBase64Value) > 0 {
+		_, err := parseHash(strings.Trim(cso.HashAlgorithmBase64Value, "'"))
+		if err != nil {
+			return &DirectiveError{Directive: directive, Err: err}
+		}
+	}
+	for _, h := range cso.Hashes {
+		err := h.validate()
+		if err != nil {
+			return &DirectiveError{Directive: directive, Err: err}
+		}
 	}
-	return cspBytes.String(), nil
+	return nil
+}
+
+// ErrInvalidSourceValue is returned for a value that is not a single source expression.  A value containing a ';'
+// would otherwise end the directive early and let the rest of the value add directives of its own.
+var ErrInvalidSourceValue = errors.New("invalid source value")
+
+// validateSourceValues checks that each value is a single source expression
+func validateSourceValues(directive string, values []string) error {
+	err := validateControlCharacters("Values", values...)
+	if err != nil {
+		return &DirectiveError{Directive: directive, Err: err}
+	}
+	for _, v := range values {
+		if strings.ContainsAny(v, ";, \t\n\r\f\v") {
+			return &DirectiveError{
+				Directive: directive,
+				Err:       fmt.Errorf("%w %q: a value must not contain ';', ',', or whitespace", ErrInvalidSourceValue, v),
+			}
+		}
+	}
+	return nil
+}
+
+// ErrControlCharacter is returned for a value containing a control character.  Values are written into an HTTP
+// header, where a CR or LF would end the header.
+var ErrControlCharacter = errors.New("value contains a control character")
+
+// validateControlCharacters checks values for bytes below 0x20 and DEL.  field names the option the values came from.
+func validateControlCharacters(field string, values ...string) error {
+	for _, v := range values {
+		for i := 0; i < len(v); i++ {
+			if v[i] < 0x20 || v[i] == 0x7f {
+				return fmt.Errorf("%s %q: %w", field, v, ErrControlCharacter)
+			}
+		}
+	}
+	return nil
+}
+
+// ErrInvalidNonce is returned for a nonce that is not a base64 value.  A nonce containing a quote, ';', or
+// whitespace would otherwise end the source expression or directive early and let the rest add sources or
+// directives of its own.
+var ErrInvalidNonce = errors.New("nonce is not a valid base64 value")
+
+// validateNonce checks a nonce, given as its raw base64 value, as 'nonce-<base64-value>', or as NoncePlaceholder,
+// against the base64-value grammar.  field names the option or argument the nonce came from.
+func validateNonce(field, nonce string) error {
+	if nonce == NoncePlaceholder || isBase64Value(trimNonce(nonce)) {
+		return nil
+	}
+	return fmt.Errorf("%s %q: %w", field, nonce, ErrInvalidNonce)
+}
+
+// isBase64Value checks against the CSP base64-value grammar, which permits both the standard and URL-safe alphabets
+// https://www.w3.org/TR/CSP3/#grammardef-base64-value
+func isBase64Value(v string) bool {
+	trimmed := strings.TrimRight(v, "=")
+	if len(trimmed) == 0 || len(v)-len(trimmed) > 2 {
+		return false
+	}
+	for _, c := range trimmed {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '+', c == '/', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// trimNonce reduces a nonce given as 'nonce-<base64-value>' or nonce-<base64-value> to the raw base64 value
+func trimNonce(nonce string) string {
+	nonce = strings.Trim(nonce, "'")
+	if len(nonce) > len("nonce-") && strings.EqualFold(nonce[:len("nonce-")], "nonce-") {
+		nonce = nonce[len("nonce-"):]
+	}
+	return nonce
 }
 
 // UnquotedOption is an unquoted singular value
 type UnquotedOption struct {
-	Value string // unquoted
+	Value string `json:"value,omitempty"` // unquoted
 }
 
 func (uv UnquotedOption) Parse(tmpl *template.Template) (string, error) {
-	var cspBytes bytes.Buffer
-	err := tmpl.Execute(&cspBytes, uv)
-	if err != nil {
-		return "", err
+	if tmpl == defaultTemplate("UnquotedOption", TemplateTextUnquotedOption) {
+		return uv.render(), nil
 	}
-	return cspBytes.String(), nil
+	return executeTemplate(tmpl, uv)
+}
+
+// ParseTo writes the directive's value as Parse would return it to w
+func (uv UnquotedOption) ParseTo(w io.Writer, tmpl *template.Template) error {
+	if tmpl == defaultTemplate("UnquotedOption", TemplateTextUnquotedOption) {
+		_, err := io.WriteString(w, uv.render())
+		return err
+	}
+	return executeTemplateTo(w, tmpl, uv)
 }
 
 // UnquotedOptions is for one or more unquoted values
 type UnquotedOptions struct {
-	Values []string
+	Values []string `json:"values,omitempty"`
 }
 
 func (uvs UnquotedOptions) Parse(tmpl *template.Template) (string, error) {
-	var cspBytes bytes.Buffer
-	err := tmpl.Execute(&cspBytes, uvs)
-	if err != nil {
-		return "", err
+	uvs.Values = dedupeValues(uvs.Values)
+	if tmpl == defaultTemplate("UnquotedOptions", TemplateTextUnquotedOptions) {
+		return uvs.render(), nil
+	}
+	return executeTemplate(tmpl, uvs)
+}
+
+// ParseTo writes the directive's value as Parse would return it to w
+func (uvs UnquotedOptions) ParseTo(w io.Writer, tmpl *template.Template) error {
+	uvs.Values = dedupeValues(uvs.Values)
+	if tmpl == defaultTemplate("UnquotedOptions", TemplateTextUnquotedOptions) {
+		_, err := io.WriteString(w, uvs.render())
+		return err
 	}
-	return cspBytes.String(), nil
+	return executeTemplateTo(w, tmpl, uvs)
 }
 
 type SandboxOptions struct {
-	AllowDownloads                      bool // allow-downloads
-	AllowForms                          bool // allow-forms
-	AllowModals                         bool // allow-modals
-	AllowOrientationLock                bool // allow-orientation-lock
-	AllowPointerLock                    bool // allow-pointer-lock
-	AllowPopups                         bool // allow-popups
-	AllowPopupsToEscapeSandbox          bool // allow-popups-to-escape-sandbox
-	AllowPresentation                   bool // allow-presentation
-	AllowSameOrigin                     bool // allow-same-origin
-	AllowScripts                        bool // allow-scripts
-	AllowTopNavigation                  bool // allow-top-navigation
-	AllowTopNavigationByUserActivation  bool // allow-top-navigation-by-user-activation
-	AllowTopNavigationToCustomProtocols bool // allow-top-navigation-to-custom-protocols
+	// Enabled emits the directive even when no tokens are set.  a bare sandbox is the most restrictive form.
+	// without Enabled, the directive is emitted only when at least one token is set.
+	Enabled bool `json:"enabled,omitempty"`
+
+	AllowDownloads                      bool `json:"allow-downloads,omitempty"`                          // allow-downloads
+	AllowDownloadsWithoutUserActivation bool `json:"allow-downloads-without-user-activation,omitempty"`  // allow-downloads-without-user-activation (not supported by all browsers)
+	AllowForms                          bool `json:"allow-forms,omitempty"`                              // allow-forms
+	AllowModals                         bool `json:"allow-modals,omitempty"`                             // allow-modals
+	AllowOrientationLock                bool `json:"allow-orientation-lock,omitempty"`                   // allow-orientation-lock
+	AllowPointerLock                    bool `json:"allow-pointer-lock,omitempty"`                       // allow-pointer-lock
+	AllowPopups                         bool `json:"allow-popups,omitempty"`                             // allow-popups
+	AllowPopupsToEscapeSandbox          bool `json:"allow-popups-to-escape-sandbox,omitempty"`           // allow-popups-to-escape-sandbox
+	AllowPresentation                   bool `json:"allow-presentation,omitempty"`                       // allow-presentation
+	AllowSameOrigin                     bool `json:"allow-same-origin,omitempty"`                        // allow-same-origin
+	AllowScripts                        bool `json:"allow-scripts,omitempty"`                            // allow-scripts
+	AllowStorageAccessByUserActivation  bool `json:"allow-storage-access-by-user-activation,omitempty"`  // allow-storage-access-by-user-activation (not supported by all browsers)
+	AllowTopNavigation                  bool `json:"allow-top-navigation,omitempty"`                     // allow-top-navigation
+	AllowTopNavigationByUserActivation  bool `json:"allow-top-navigation-by-user-activation,omitempty"`  // allow-top-navigation-by-user-activation
+	AllowTopNavigationToCustomProtocols bool `json:"allow-top-navigation-to-custom-protocols,omitempty"` // allow-top-navigation-to-custom-protocols
 
 }
 
 func (so SandboxOptions) Parse(tmpl *template.Template) (string, error) {
-	var cspBytes bytes.Buffer
-	err := tmpl.Execute(&cspBytes, so)
-	if err != nil {
-		return "", err
+	if tmpl == defaultTemplate("Sandbox", TemplateTextSandbox) {
+		return so.render(), nil
+	}
+	return executeTemplate(tmpl, so)
+}
+
+// ParseTo writes the directive's value as Parse would return it to w
+func (so SandboxOptions) ParseTo(w io.Writer, tmpl *template.Template) error {
+	if tmpl == defaultTemplate("Sandbox", TemplateTextSandbox) {
+		_, err := io.WriteString(w, so.render())
+		return err
 	}
-	return cspBytes.String(), nil
+	return executeTemplateTo(w, tmpl, so)
 }
 
 // FrameAncestorOptions is for one or more unquoted values
 type FrameAncestorOptions struct {
-	Allow         bool // Overrides all other settings! should we set 'none'?
-	AllowSelf     bool // should we put in 'self'?
-	HostSources   []string
-	SchemeSources []string
+	// Unset leaves frame-ancestors out of the policy entirely, rather than rendering it as 'none', so that any page
+	// may embed this one.  Unset overrides all other settings.
+	Unset bool `json:"unset,omitempty"`
+
+	Allow         bool     `json:"allow,omitempty"`      // Overrides all other settings! should we set 'none'?
+	AllowSelf     bool     `json:"allow-self,omitempty"` // should we put in 'self'?
+	HostSources   []string `json:"host-sources,omitempty"`
+	SchemeSources []string `json:"scheme-sources,omitempty"`
 }
 
-func (fao FrameAncestorOptions) Parse(tmpl *template.Template) (string, error) {
-	var cspBytes bytes.Buffer
-	err := tmpl.Execute(&cspBytes, fao)
+func (fao FrameAncestorOptions) validate(directive string) error {
+	err := validateSourceValues(directive, fao.HostSources)
 	if err != nil {
-		return "", err
+		return err
+	}
+	err = validateSourceValues(directive, fao.SchemeSources)
+	if err != nil {
+		return err
+	}
+	err = validateHostSources(directive, fao.HostSources)
+	if err != nil {
+		return err
+	}
+	return validateHostSources(directive, fao.SchemeSources)
+}
+
+func (fao FrameAncestorOptions) Parse(tmpl *template.Template) (string, error) {
+	fao.HostSources = dedupeValues(fao.HostSources)
+	fao.SchemeSources = dedupeValues(fao.SchemeSources)
+	if tmpl == defaultTemplate("FrameAncestorOptions", TemplateTextFrameAncestorOptions) {
+		return fao.render(), nil
+	}
+	return executeTemplate(tmpl, fao)
+}
+
+// ParseTo writes the directive's value as Parse would return it to w
+func (fao FrameAncestorOptions) ParseTo(w io.Writer, tmpl *template.Template) error {
+	fao.HostSources = dedupeValues(fao.HostSources)
+	fao.SchemeSources = dedupeValues(fao.SchemeSources)
+	if tmpl == defaultTemplate("FrameAncestorOptions", TemplateTextFrameAncestorOptions) {
+		_, err := io.WriteString(w, fao.render())
+		return err
 	}
-	return cspBytes.String(), nil
+	return executeTemplateTo(w, tmpl, fao)
 }
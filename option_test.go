@@ -0,0 +1,356 @@
+package cspheader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNonceRendering(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CSPSourceOptions
+		want    string
+	}{
+		{"raw", CSPSourceOptions{Allow: true, NonceBase64Value: "abc123"}, "'nonce-abc123'"},
+		{"prefixed", CSPSourceOptions{Allow: true, NonceBase64Value: "nonce-abc123"}, "'nonce-abc123'"},
+		{"quoted", CSPSourceOptions{Allow: true, NonceBase64Value: "'nonce-abc123'"}, "'nonce-abc123'"},
+		{"after keywords", CSPSourceOptions{Allow: true, AllowSelf: true, UnsafeInline: true, NonceBase64Value: "abc123", StrictDynamic: true},
+			"'self' 'unsafe-inline' 'nonce-abc123' 'strict-dynamic'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.Parse(defaultTemplate("SourceOption", TemplateTextSourceOption))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultipleNonces(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     CSPSourceOptions
+		want        string
+		wantDynamic bool
+	}{
+		{"zero", CSPSourceOptions{Allow: true, AllowSelf: true}, "'self'", false},
+		{"one", CSPSourceOptions{Allow: true, Nonces: []string{"YWJj"}}, "'nonce-YWJj'", true},
+		{"three", CSPSourceOptions{Allow: true, Nonces: []string{"YWJj", "ZGVm", "Z2hp"}},
+			"'nonce-YWJj' 'nonce-ZGVm' 'nonce-Z2hp'", true},
+		{"after NonceBase64Value", CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj", Nonces: []string{"'nonce-ZGVm'"}},
+			"'nonce-YWJj' 'nonce-ZGVm'", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.Parse(defaultTemplate("SourceOption", TemplateTextSourceOption))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %q, want %q", got, tt.want)
+			}
+			if dynamic := tt.options.isDynamic(); dynamic != tt.wantDynamic {
+				t.Errorf("isDynamic() = %v, want %v", dynamic, tt.wantDynamic)
+			}
+		})
+	}
+}
+
+func TestStrictContradictorySourceOptions(t *testing.T) {
+	hash := []Hash{{Algorithm: HashSHA256, Base64: emptySHA256}}
+	tests := []struct {
+		name      string
+		scriptSrc CSPSourceOptions
+		wantErr   bool
+	}{
+		{"consistent", CSPSourceOptions{Allow: true, AllowSelf: true, Hashes: hash, StrictDynamic: true}, false},
+		{"fields set with Allow false", CSPSourceOptions{Allow: false, AllowSelf: true}, true},
+		{"unsafe-inline with a hash", CSPSourceOptions{Allow: true, UnsafeInline: true, Hashes: hash}, true},
+		{"unsafe-inline with a hash and strict-dynamic", CSPSourceOptions{Allow: true, UnsafeInline: true, Hashes: hash, StrictDynamic: true}, false},
+		{"strict-dynamic alone", CSPSourceOptions{Allow: true, AllowSelf: true, StrictDynamic: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, strict := range []bool{false, true} {
+				pol := SecurityOptionsServerRendered()
+				pol.CSP.ScriptSrc = tt.scriptSrc
+				pol.Strict = strict
+				_, err := pol.Load()
+				if !strict || !tt.wantErr {
+					if err != nil {
+						t.Errorf("Strict %v: Load() error = %v", strict, err)
+					}
+					continue
+				}
+				var de *DirectiveError
+				if !errors.Is(err, ErrContradictorySourceOptions) || !errors.As(err, &de) || de.Directive != DirectiveScriptSrc {
+					t.Errorf("Strict %v: Load() error = %v, want %v for %s", strict, err, ErrContradictorySourceOptions, DirectiveScriptSrc)
+				}
+			}
+		})
+	}
+}
+
+func TestStrictPresetPassesStrictMode(t *testing.T) {
+	pol := SecurityOptionsStrict()
+	pol.Strict = true
+	_, err := pol.Compile()
+	if err != nil {
+		t.Errorf("Compile() error = %v", err)
+	}
+}
+
+func TestInvalidSourceValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Policy, string)
+		directive string
+	}{
+		{"source list", func(pol *Policy, v string) { pol.CSP.ImgSrc.Values = []string{v} }, "img-src"},
+		{"frame-ancestors host", func(pol *Policy, v string) {
+			pol.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, HostSources: []string{v}}
+		}, "frame-ancestors"},
+		{"report-uri", func(pol *Policy, v string) { pol.CSP.ReportURI = UnquotedOptions{Values: []string{v}} }, "report-uri"},
+		{"report-to", func(pol *Policy, v string) { pol.CSP.ReportTo = UnquotedOption{Value: v} }, "report-to"},
+	}
+	for _, tt := range tests {
+		for _, v := range []string{"a.example.com;object-src", "a.example.com,b.example.com", "a.example.com b.example.com"} {
+			t.Run(tt.name+"/"+v, func(t *testing.T) {
+				pol := SecurityOptionsServerRendered()
+				tt.configure(&pol, v)
+				_, err := pol.Load()
+				var de *DirectiveError
+				if !errors.Is(err, ErrInvalidSourceValue) || !errors.As(err, &de) || de.Directive != tt.directive {
+					t.Errorf("Load() error = %v, want %v for %s", err, ErrInvalidSourceValue, tt.directive)
+				}
+			})
+		}
+	}
+}
+
+func TestControlCharactersRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Policy, string)
+	}{
+		{"Values", func(pol *Policy, v string) { pol.CSP.ImgSrc.Values = []string{"https://a.example.com" + v} }},
+		{"NonceBase64Value", func(pol *Policy, v string) { pol.CSP.ScriptSrc.NonceBase64Value = "YWJj" + v }},
+		{"Nonces", func(pol *Policy, v string) { pol.CSP.ScriptSrc.Nonces = []string{"YWJj" + v} }},
+		{"HashAlgorithmBase64Value", func(pol *Policy, v string) { pol.CSP.ScriptSrc.HashAlgorithmBase64Value = "sha256-YWJj" + v }},
+		{"frame-ancestors", func(pol *Policy, v string) {
+			pol.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, HostSources: []string{"https://a.example.com" + v}}
+		}},
+		{"report-uri", func(pol *Policy, v string) { pol.CSP.ReportURI = UnquotedOptions{Values: []string{"/csp-reports" + v}} }},
+		{"raw Report-To", func(pol *Policy, v string) {
+			pol.CSP.ReportTo = UnquotedOption{Value: "csp"}
+			pol.ReportTo.ReportTo = `{"group":"csp","max_age":60,"endpoints":[{"url":"/r"}]}` + v
+		}},
+		{"custom directive", func(pol *Policy, v string) { pol.CustomDirectives = map[string]string{"trusted-types": "default" + v} }},
+	}
+	for _, tt := range tests {
+		for _, c := range []string{"\r\nX-Injected: 1", "\x00", "\x7f"} {
+			t.Run(fmt.Sprintf("%s/%q", tt.name, c), func(t *testing.T) {
+				pol := SecurityOptionsServerRendered()
+				tt.configure(&pol, c)
+				_, err := pol.Compile()
+				if !errors.Is(err, ErrControlCharacter) {
+					t.Errorf("Compile() error = %v, want %v", err, ErrControlCharacter)
+				}
+			})
+		}
+	}
+
+	// reporting endpoints are structured field strings, which reject anything outside printable ascii
+	pol := reportingPolicy()
+	pol.ReportingEndpoints = map[string]string{"csp-endpoint": "/csp-reports\r\nX-Injected: 1"}
+	_, err := pol.Compile()
+	if err == nil {
+		t.Error("Compile() error = nil, want a reporting endpoint with a control character rejected")
+	}
+}
+
+func TestIgnoredOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CSPSourceOptions
+		want    string
+	}{
+		{"none set", CSPSourceOptions{Allow: false}, ""},
+		{"allowed", CSPSourceOptions{Allow: true, AllowSelf: true}, ""},
+		{"one field", CSPSourceOptions{Allow: false, UnsafeInline: true},
+			"Allow is false, so the directive is 'none' and UnsafeInline is ignored; set Allow to true for them to take effect"},
+		{"several fields", CSPSourceOptions{Allow: false, Values: []string{"cdn.example.com"}, UnsafeInline: true},
+			"Allow is false, so the directive is 'none' and Values, UnsafeInline are ignored; set Allow to true for them to take effect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsServerRendered()
+			pol.CSP.ImgSrc = tt.options
+			_, warnings := loadWithWarnings(t, pol)
+			var got string
+			for _, w := range warnings {
+				if w.Code == WarnIgnoredOptions && w.Directive == "img-src" {
+					got = w.Message
+				}
+			}
+			if got != tt.want {
+				t.Errorf("warning = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfiguredNonceValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CSPSourceOptions
+		wantErr error
+	}{
+		{"raw", CSPSourceOptions{Allow: true, NonceBase64Value: "abc123"}, nil},
+		{"quoted", CSPSourceOptions{Allow: true, NonceBase64Value: "'nonce-abc123'"}, nil},
+		{"placeholder", CSPSourceOptions{Allow: true, NonceBase64Value: NoncePlaceholder}, nil},
+		{"extra nonces", CSPSourceOptions{Allow: true, NonceBase64Value: "abc", Nonces: []string{"def", "nonce-ghi"}}, nil},
+		{"injected directive", CSPSourceOptions{Allow: true, NonceBase64Value: "abc'; script-src *; x-'"}, ErrInvalidNonce},
+		{"space", CSPSourceOptions{Allow: true, NonceBase64Value: "abc def"}, ErrInvalidNonce},
+		{"injected in nonces", CSPSourceOptions{Allow: true, NonceBase64Value: "abc", Nonces: []string{"def' 'unsafe-inline"}}, ErrInvalidNonce},
+		{"control character", CSPSourceOptions{Allow: true, NonceBase64Value: "abc\r\nX-Injected: 1"}, ErrControlCharacter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := Policy{}
+			pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+			pol.CSP.ScriptSrc = tt.options
+
+			_, err := pol.Compile()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Compile() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				return
+			}
+			var de *DirectiveError
+			if !errors.As(err, &de) || de.Directive != DirectiveScriptSrc {
+				t.Errorf("Compile() error = %v, want a DirectiveError for %s", err, DirectiveScriptSrc)
+			}
+		})
+	}
+}
+
+func TestIsBase64Value(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"abc123", true},
+		{"YWJjZA==", true},
+		{"a+b/c", true},
+		{"a-b_c", true},
+		{"abc=", true},
+		{"abc===", false},
+		{"", false},
+		{"==", false},
+		{"abc'", false},
+		{"abc;", false},
+		{"abc def", false},
+		{"abc,def", false},
+		{"abc\n", false},
+	}
+	for _, tt := range tests {
+		if got := isBase64Value(tt.value); got != tt.want {
+			t.Errorf("isBase64Value(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPerRequestNonceValidation(t *testing.T) {
+	pol := Policy{}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true, NonceBase64Value: NoncePlaceholder}
+	pol.MustCompile()
+
+	renderers := map[string]func(nonce string) (string, error){
+		"Render": func(nonce string) (string, error) {
+			headers, err := pol.compiled.Render(nonce)
+			return headers[HeaderContentSecurityPolicy], err
+		},
+		"HeaderWithNonce": func(nonce string) (string, error) {
+			headers, err := pol.HeaderWithNonce(nonce)
+			return headers[HeaderContentSecurityPolicy], err
+		},
+		"RenderHeaderBlock": func(nonce string) (string, error) {
+			var buf bytes.Buffer
+			err := pol.compiled.RenderHeaderBlock(&buf, nonce)
+			return buf.String(), err
+		},
+		"RenderTo": func(nonce string) (string, error) {
+			var buf bytes.Buffer
+			err := pol.compiled.RenderTo(&buf, nonce)
+			return buf.String(), err
+		},
+	}
+
+	tests := []struct {
+		nonce   string
+		want    string
+		wantErr error
+	}{
+		{"abc123", "'nonce-abc123'", nil},
+		{"'nonce-abc123'", "'nonce-abc123'", nil},
+		{"YWJj+/-_==", "'nonce-YWJj+/-_=='", nil},
+		{"", "", ErrNonceRequired},
+		{"zzz' 'unsafe-inline'; script-src *", "", ErrInvalidNonce},
+		{"abc;", "", ErrInvalidNonce},
+		{"abc def", "", ErrInvalidNonce},
+		{"abc\r\nSet-Cookie: x", "", ErrControlCharacter},
+	}
+	for name, render := range renderers {
+		for _, tt := range tests {
+			got, err := render(tt.nonce)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s(%q) error = %v, want %v", name, tt.nonce, err, tt.wantErr)
+				continue
+			}
+			if tt.wantErr != nil {
+				if len(got) > 0 {
+					t.Errorf("%s(%q) wrote %q along with its error", name, tt.nonce, got)
+				}
+				continue
+			}
+			if !strings.Contains(got, "script-src 'self' "+tt.want+";") {
+				t.Errorf("%s(%q) = %q, want script-src with %s", name, tt.nonce, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSourceWithNonceInvalid(t *testing.T) {
+	cso := NewSourceOptions(SourceWithNonce("abc' 'unsafe-inline"))
+	if !errors.Is(cso.Err(), ErrInvalidNonce) {
+		t.Errorf("SourceWithNonce error = %v, want %v", cso.Err(), ErrInvalidNonce)
+	}
+}
+
+func TestTrimNonce(t *testing.T) {
+	tests := []struct {
+		nonce string
+		want  string
+	}{
+		{"abc", "abc"},
+		{"nonce-abc", "abc"},
+		{"'nonce-abc'", "abc"},
+		{"'NONCE-abc'", "abc"},
+		{"nonce-", "nonce-"},
+	}
+	for _, tt := range tests {
+		if got := trimNonce(tt.nonce); got != tt.want {
+			t.Errorf("trimNonce(%q) = %q, want %q", tt.nonce, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package cspheader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParsePolicy converts an existing Content-Security-Policy header value into a Policy.  This is intended for
+// migrating hand-written headers into this package.
+//
+// Directives are separated by semicolons and whitespace is tolerated anywhere between tokens, including a missing
+// trailing semicolon.  As in the spec, only the first occurrence of a repeated directive is honored.
+// Directives without a mapping onto Policy return an error naming the directive.
+//
+// Fetch directives absent from the header are filled in from their fallback directive so that the browser's
+// fallback behavior is preserved when the Policy is rendered again.  An absent default-src, base-uri, form-action,
+// or frame-ancestors is Unset.
+func ParsePolicy(header string) (Policy, error) {
+	pol := Policy{}
+	seen := map[string]bool{}
+
+	for _, rawDirective := range strings.Split(header, ";") {
+		tokens := strings.Fields(rawDirective)
+		if len(tokens) == 0 {
+			continue
+		}
+
+		name := strings.ToLower(tokens[0])
+		values := tokens[1:]
+
+		// https://www.w3.org/TR/CSP3/#parse-serialized-policy - duplicate directives are ignored
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if cso := pol.sourceOptionsByName(name); cso != nil {
+			parsed, err := parseSourceOptions(name, values)
+			if err != nil {
+				return Policy{}, err
+			}
+			*cso = parsed
+			continue
+		}
+
+		switch name {
+		case "sandbox":
+			sandbox, err := parseSandboxOptions(values)
+			if err != nil {
+				return Policy{}, err
+			}
+			pol.CSP.Sandbox = sandbox
+		case "frame-ancestors":
+			pol.CSP.FrameAncestors = parseFrameAncestorOptions(values)
+		case "report-uri":
+			pol.CSP.ReportURI = UnquotedOptions{Values: values}
+		case "report-to":
+			if len(values) != 1 {
+				return Policy{}, fmt.Errorf("report-to expects exactly one group name, got %d", len(values))
+			}
+			pol.CSP.ReportTo = UnquotedOption{Value: values[0]}
+		case "upgrade-insecure-requests":
+			pol.CSP.UpgradeInsecureRequests = true
+		case "block-all-mixed-content":
+			pol.CSP.BlockAllMixedContent = true
+		default:
+			return Policy{}, fmt.Errorf("unsupported directive: %s", name)
+		}
+	}
+
+	for _, name := range []string{"default-src", "base-uri", "form-action"} {
+		if !seen[name] {
+			pol.sourceOptionsByName(name).Unset = true
+		}
+	}
+	if !seen["frame-ancestors"] {
+		pol.CSP.FrameAncestors.Unset = true
+	}
+
+	// copy from the header, not from fallbacks already filled in: worker-src falls back to script-src before
+	// default-src, though child-src, which comes first, does not
+	parsed := pol.CSP
+	for _, name := range directiveOrder {
+		fallbacks := directiveFallbacks[name]
+		if seen[name] || len(fallbacks) == 0 {
+			continue
+		}
+		cso := pol.sourceOptionsByName(name)
+		*cso = CSPSourceOptions{Unset: true}
+		for _, fb := range fallbacks {
+			if seen[fb] {
+				*cso = *(&Policy{CSP: parsed}).sourceOptionsByName(fb)
+				break
+			}
+		}
+	}
+
+	return pol, nil
+}
+
+// directiveFallbacks is the fallback list of each fetch directive: the directives whose source list applies, in
+// order, when it is absent.  default-src, base-uri, and form-action have no fallback.
+// https://www.w3.org/TR/CSP3/#directive-fallback-list
+var directiveFallbacks = map[string][]string{
+	DirectiveScriptSrcElem:  {DirectiveScriptSrc, DirectiveDefaultSrc},
+	DirectiveScriptSrcAttr:  {DirectiveScriptSrc, DirectiveDefaultSrc},
+	DirectiveStyleSrcElem:   {DirectiveStyleSrc, DirectiveDefaultSrc},
+	DirectiveStyleSrcAttr:   {DirectiveStyleSrc, DirectiveDefaultSrc},
+	DirectiveWorkerSrc:      {DirectiveChildSrc, DirectiveScriptSrc, DirectiveDefaultSrc},
+	DirectiveFrameSrc:       {DirectiveChildSrc, DirectiveDefaultSrc},
+	DirectiveFencedFrameSrc: {DirectiveFrameSrc, DirectiveChildSrc, DirectiveDefaultSrc},
+	DirectiveChildSrc:       {DirectiveDefaultSrc},
+	DirectiveConnectSrc:     {DirectiveDefaultSrc},
+	DirectiveFontSrc:        {DirectiveDefaultSrc},
+	DirectiveImgSrc:         {DirectiveDefaultSrc},
+	DirectiveManifestSrc:    {DirectiveDefaultSrc},
+	DirectiveMediaSrc:       {DirectiveDefaultSrc},
+	DirectiveObjectSrc:      {DirectiveDefaultSrc},
+	DirectivePrefetchSrc:    {DirectiveDefaultSrc},
+	DirectiveScriptSrc:      {DirectiveDefaultSrc},
+	DirectiveStyleSrc:       {DirectiveDefaultSrc},
+}
+
+// sourceOptionsByName returns the CSPSourceOptions field backing a source-list directive, or nil if the
+// directive is not a source-list directive.
+func (pol *Policy) sourceOptionsByName(name string) *CSPSourceOptions {
+	switch name {
+	// Fetch directives
+	case DirectiveDefaultSrc:
+		return &pol.CSP.DefaultSrc
+	case DirectiveChildSrc:
+		return &pol.CSP.ChildSrc
+	case DirectiveConnectSrc:
+		return &pol.CSP.ConnectSrc
+	case DirectiveFontSrc:
+		return &pol.CSP.FontSrc
+	case DirectiveFencedFrameSrc:
+		return &pol.CSP.FencedFrameSrc
+	case DirectiveFrameSrc:
+		return &pol.CSP.FrameSrc
+	case DirectiveImgSrc:
+		return &pol.CSP.ImgSrc
+	case DirectiveManifestSrc:
+		return &pol.CSP.ManifestSrc
+	case DirectiveMediaSrc:
+		return &pol.CSP.MediaSrc
+	case DirectiveObjectSrc:
+		return &pol.CSP.ObjectSrc
+	case DirectivePrefetchSrc:
+		return &pol.CSP.PrefetchSrc
+	case DirectiveScriptSrc:
+		return &pol.CSP.ScriptSrc
+	case DirectiveScriptSrcElem:
+		return &pol.CSP.ScriptSrcElem
+	case DirectiveScriptSrcAttr:
+		return &pol.CSP.ScriptSrcAttr
+	case DirectiveStyleSrc:
+		return &pol.CSP.StyleSrc
+	case DirectiveStyleSrcElem:
+		return &pol.CSP.StyleSrcElem
+	case DirectiveStyleSrcAttr:
+		return &pol.CSP.StyleSrcAttr
+	case DirectiveWorkerSrc:
+		return &pol.CSP.WorkerSrc
+
+	// Document directives
+	case DirectiveBaseURI:
+		return &pol.CSP.BaseURI
+
+	// Navigation directives
+	case DirectiveFormAction:
+		return &pol.CSP.FormAction
+	}
+	return nil
+}
+
+// parseSourceOptions maps a source list onto CSPSourceOptions.  quoted keywords become their boolean fields,
+// nonces and hashes their respective fields, and everything else is treated as a host or scheme source.
+func parseSourceOptions(directive string, values []string) (CSPSourceOptions, error) {
+	cso := CSPSourceOptions{}
+
+	for _, v := range values {
+		// an empty source list or 'none' leaves Allow false.  any other source expression overrides it.
+		switch strings.ToLower(v) {
+		case SourceNone:
+			continue
+		case SourceSelf:
+			cso.AllowSelf = true
+		case SourceUnsafeEval:
+			cso.UnsafeEval = true
+		case SourceWasmUnsafeEval:
+			cso.WasmUnsafeEval = true
+		case SourceUnsafeHashes:
+			cso.UnsafeHashes = true
+		case SourceUnsafeInline:
+			cso.UnsafeInline = true
+		case SourceStrictDynamic:
+			cso.StrictDynamic = true
+		case SourceReportSample:
+			cso.ReportSample = true
+		default:
+			switch {
+			case isQuotedPrefix(v, "nonce-"):
+				cso.Nonces = append(cso.Nonces, v[len("'nonce-"):len(v)-1])
+			case isQuotedPrefix(v, "sha256-"), isQuotedPrefix(v, "sha384-"), isQuotedPrefix(v, "sha512-"):
+				h, err := parseHash(v[1 : len(v)-1])
+				if err != nil {
+					return CSPSourceOptions{}, fmt.Errorf("%s: %w", directive, err)
+				}
+				cso.Hashes = append(cso.Hashes, h)
+			case strings.HasPrefix(v, "'"):
+				return CSPSourceOptions{}, fmt.Errorf("%s: unsupported keyword source %s", directive, v)
+			default:
+				cso.Values = append(cso.Values, v)
+			}
+		}
+		cso.Allow = true
+	}
+
+	return cso, nil
+}
+
+// isQuotedPrefix checks for a single-quoted source expression beginning with prefix, e.g. 'nonce-...'
+func isQuotedPrefix(v, prefix string) bool {
+	return len(v) > len(prefix)+2 &&
+		strings.HasSuffix(v, "'") &&
+		strings.HasPrefix(strings.ToLower(v), "'"+prefix)
+}
+
+func parseSandboxOptions(values []string) (SandboxOptions, error) {
+	so := SandboxOptions{Enabled: true}
+
+	for _, v := range values {
+		switch strings.ToLower(v) {
+		case "allow-downloads":
+			so.AllowDownloads = true
+		case "allow-downloads-without-user-activation":
+			so.AllowDownloadsWithoutUserActivation = true
+		case "allow-forms":
+			so.AllowForms = true
+		case "allow-modals":
+			so.AllowModals = true
+		case "allow-orientation-lock":
+			so.AllowOrientationLock = true
+		case "allow-pointer-lock":
+			so.AllowPointerLock = true
+		case "allow-popups":
+			so.AllowPopups = true
+		case "allow-popups-to-escape-sandbox":
+			so.AllowPopupsToEscapeSandbox = true
+		case "allow-presentation":
+			so.AllowPresentation = true
+		case "allow-same-origin":
+			so.AllowSameOrigin = true
+		case "allow-scripts":
+			so.AllowScripts = true
+		case "allow-storage-access-by-user-activation":
+			so.AllowStorageAccessByUserActivation = true
+		case "allow-top-navigation":
+			so.AllowTopNavigation = true
+		case "allow-top-navigation-by-user-activation":
+			so.AllowTopNavigationByUserActivation = true
+		case "allow-top-navigation-to-custom-protocols":
+			so.AllowTopNavigationToCustomProtocols = true
+		default:
+			return SandboxOptions{}, fmt.Errorf("sandbox: unsupported token %s", v)
+		}
+	}
+
+	return so, nil
+}
+
+func parseFrameAncestorOptions(values []string) FrameAncestorOptions {
+	fao := FrameAncestorOptions{}
+
+	for _, v := range values {
+		switch {
+		case strings.EqualFold(v, SourceNone):
+			continue
+		case strings.EqualFold(v, SourceSelf):
+			fao.AllowSelf = true
+		case strings.HasSuffix(v, ":"):
+			fao.SchemeSources = append(fao.SchemeSources, v)
+		default:
+			fao.HostSources = append(fao.HostSources, v)
+		}
+		fao.Allow = true
+	}
+
+	return fao
+}
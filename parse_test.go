@@ -0,0 +1,199 @@
+package cspheader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		check  func(Policy) interface{}
+		want   interface{}
+	}{
+		{
+			name:   "keywords",
+			header: "script-src 'self' 'unsafe-eval' 'wasm-unsafe-eval' 'unsafe-hashes' 'unsafe-inline' 'strict-dynamic' 'report-sample'",
+			check:  func(pol Policy) interface{} { return pol.CSP.ScriptSrc },
+			want: CSPSourceOptions{Allow: true, AllowSelf: true, UnsafeEval: true, WasmUnsafeEval: true, UnsafeHashes: true,
+				UnsafeInline: true, StrictDynamic: true, ReportSample: true},
+		},
+		{
+			name:   "keywords are case-insensitive",
+			header: "script-src 'SELF' 'Unsafe-Inline'",
+			check:  func(pol Policy) interface{} { return pol.CSP.ScriptSrc },
+			want:   CSPSourceOptions{Allow: true, AllowSelf: true, UnsafeInline: true},
+		},
+		{
+			name:   "hosts, nonces, and hashes",
+			header: "script-src https://cdn.example.com https: 'nonce-abc' 'nonce-def' 'sha256-RFWPLDbv2BY+rCkDzsE+0fr8ylGr2R2faWMhq4lfEQc='",
+			check:  func(pol Policy) interface{} { return pol.CSP.ScriptSrc },
+			want: CSPSourceOptions{
+				Allow:  true,
+				Values: []string{"https://cdn.example.com", "https:"},
+				Nonces: []string{"abc", "def"},
+				Hashes: []Hash{{Algorithm: HashSHA256, Base64: "RFWPLDbv2BY+rCkDzsE+0fr8ylGr2R2faWMhq4lfEQc="}},
+			},
+		},
+		{
+			name:   "none",
+			header: "object-src 'none'",
+			check:  func(pol Policy) interface{} { return pol.CSP.ObjectSrc },
+			want:   CSPSourceOptions{},
+		},
+		{
+			name:   "empty source list is none",
+			header: "object-src",
+			check:  func(pol Policy) interface{} { return pol.CSP.ObjectSrc },
+			want:   CSPSourceOptions{},
+		},
+		{
+			name:   "first duplicate wins",
+			header: "img-src 'self'; img-src *",
+			check:  func(pol Policy) interface{} { return pol.CSP.ImgSrc },
+			want:   CSPSourceOptions{Allow: true, AllowSelf: true},
+		},
+		{
+			name:   "whitespace and case",
+			header: "  IMG-SRC\t'self' ;;\n",
+			check:  func(pol Policy) interface{} { return pol.CSP.ImgSrc },
+			want:   CSPSourceOptions{Allow: true, AllowSelf: true},
+		},
+		{
+			name:   "absent default-src, base-uri, form-action, and frame-ancestors are unset",
+			header: "img-src 'self'",
+			check: func(pol Policy) interface{} {
+				return []bool{pol.CSP.DefaultSrc.Unset, pol.CSP.BaseURI.Unset, pol.CSP.FormAction.Unset, pol.CSP.FrameAncestors.Unset}
+			},
+			want: []bool{true, true, true, true},
+		},
+		{
+			name:   "absent fetch directive copies default-src",
+			header: "default-src 'self'",
+			check:  func(pol Policy) interface{} { return pol.CSP.FontSrc },
+			want:   CSPSourceOptions{Allow: true, AllowSelf: true},
+		},
+		{
+			name:   "worker-src falls back to script-src before default-src",
+			header: "default-src 'none'; script-src 'self'",
+			check:  func(pol Policy) interface{} { return pol.CSP.WorkerSrc },
+			want:   CSPSourceOptions{Allow: true, AllowSelf: true},
+		},
+		{
+			name:   "fallback without any directive is unset",
+			header: "img-src 'self'",
+			check:  func(pol Policy) interface{} { return pol.CSP.ScriptSrc },
+			want:   CSPSourceOptions{Unset: true},
+		},
+		{
+			name:   "sandbox",
+			header: "sandbox allow-scripts allow-forms",
+			check:  func(pol Policy) interface{} { return pol.CSP.Sandbox },
+			want:   SandboxOptions{Enabled: true, AllowScripts: true, AllowForms: true},
+		},
+		{
+			name:   "bare sandbox",
+			header: "sandbox",
+			check:  func(pol Policy) interface{} { return pol.CSP.Sandbox },
+			want:   SandboxOptions{Enabled: true},
+		},
+		{
+			name:   "frame-ancestors",
+			header: "frame-ancestors 'self' https://partner.example.com https:",
+			check:  func(pol Policy) interface{} { return pol.CSP.FrameAncestors },
+			want: FrameAncestorOptions{Allow: true, AllowSelf: true, HostSources: []string{"https://partner.example.com"},
+				SchemeSources: []string{"https:"}},
+		},
+		{
+			name:   "reporting and valueless directives",
+			header: "report-uri /a /b; report-to csp; upgrade-insecure-requests; block-all-mixed-content",
+			check: func(pol Policy) interface{} {
+				return []interface{}{pol.CSP.ReportURI, pol.CSP.ReportTo, pol.CSP.UpgradeInsecureRequests, pol.CSP.BlockAllMixedContent}
+			},
+			want: []interface{}{UnquotedOptions{Values: []string{"/a", "/b"}}, UnquotedOption{Value: "csp"}, true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol, err := ParsePolicy(tt.header)
+			if err != nil {
+				t.Fatalf("ParsePolicy(%q) error = %v", tt.header, err)
+			}
+			if got := tt.check(pol); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePolicy(%q) = %+v, want %+v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"navigate-to 'self'", "unsupported directive: navigate-to"},
+		{"script-src 'unsafe-allow-redirects'", "script-src: unsupported keyword source 'unsafe-allow-redirects'"},
+		{"script-src 'sha256-not base64'", "script-src:"},
+		{"sandbox allow-everything", "sandbox: unsupported token allow-everything"},
+		{"report-to a b", "report-to expects exactly one group name, got 2"},
+		{"report-to", "report-to expects exactly one group name, got 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			_, err := ParsePolicy(tt.header)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParsePolicy(%q) error = %v, want one containing %q", tt.header, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePolicyAbsentFrameAncestors(t *testing.T) {
+	pol, err := ParsePolicy("default-src 'self'; object-src 'none'")
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	if !pol.CSP.FrameAncestors.Unset {
+		t.Fatalf("frame-ancestors = %+v, want Unset", pol.CSP.FrameAncestors)
+	}
+
+	rendered := renderCSP(t, pol)
+	if strings.Contains(rendered, "frame-ancestors") {
+		t.Errorf("header = %q, want frame-ancestors left out", rendered)
+	}
+	again, err := ParsePolicy(rendered)
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	if !reflect.DeepEqual(again.CSP.FrameAncestors, pol.CSP.FrameAncestors) {
+		t.Errorf("frame-ancestors parsed from %q = %+v, want %+v", rendered, again.CSP.FrameAncestors, pol.CSP.FrameAncestors)
+	}
+}
+
+// TestParsePolicyRoundTrip parses headers and renders them again, and checks that every directive, following the
+// fallbacks, is neither looser nor tighter than in the original
+func TestParsePolicyRoundTrip(t *testing.T) {
+	headers := []string{
+		strictReference,
+		"default-src 'self'; img-src 'self' data:; object-src 'none'; frame-ancestors 'none'",
+		"default-src 'none'; script-src 'self' 'nonce-abc123'; style-src 'self'; worker-src blob:; base-uri 'self'; form-action 'self'",
+		"script-src https://cdn.example.com; report-uri /csp; upgrade-insecure-requests",
+	}
+	for _, header := range headers {
+		t.Run(header, func(t *testing.T) {
+			pol, err := ParsePolicy(header)
+			if err != nil {
+				t.Fatalf("ParsePolicy() error = %v", err)
+			}
+			rendered := renderCSP(t, pol)
+			if name, loosened := loosenedDirective(t, header, rendered); loosened {
+				t.Errorf("rendering loosens %s:\nparsed:   %s\nrendered: %s", name, header, rendered)
+			}
+			if name, tightened := loosenedDirective(t, rendered, header); tightened {
+				t.Errorf("rendering tightens %s:\nparsed:   %s\nrendered: %s", name, header, rendered)
+			}
+		})
+	}
+}
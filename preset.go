@@ -1,7 +1,46 @@
 package cspheader
 
-// SecurityOptionsReactJS returns a Policy set generally agreeable for React applications
-func SecurityOptionsReactJS() Policy {
+import (
+	"time"
+)
+
+// Defaults used by the presets' reporting configuration
+const (
+	DefaultReportGroup    = "default"
+	DefaultReportEndpoint = "/_/csp-reports"
+	DefaultReportMaxAge   = 24 * time.Hour
+)
+
+// setDefaultReporting points report-to at a "default" Report-To group delivering to /_/csp-reports
+func setDefaultReporting(securityOptions *Policy) {
+	setReporting(securityOptions, DefaultReportGroup, DefaultReportEndpoint, DefaultReportMaxAge)
+}
+
+// setReporting points report-to at a Report-To group delivering to endpoint.  An empty group leaves reporting
+// unconfigured.
+func setReporting(securityOptions *Policy, group, endpoint string, maxAge time.Duration) {
+	if len(group) == 0 {
+		return
+	}
+	securityOptions.CSP.ReportTo = UnquotedOption{Value: group}
+	// Report-to header key
+	// /_/csp_reports means self+/_/csp_reports
+	securityOptions.ReportTo.Groups = []ReportToGroup{{
+		Group:     group,
+		MaxAge:    maxAge,
+		Endpoints: []ReportToEndpoint{{URL: endpoint}},
+	}}
+}
+
+// SecurityOptionsReactJS returns a Policy set generally agreeable for React applications, reporting to the
+// DefaultReportGroup group at DefaultReportEndpoint
+func SecurityOptionsReactJS(opts ...PresetOption) Policy {
+	return SecurityOptionsReactJSWithReporting(DefaultReportGroup, DefaultReportEndpoint, DefaultReportMaxAge, opts...)
+}
+
+// SecurityOptionsReactJSWithReporting returns the SecurityOptionsReactJS policy with report-to pointed at a Report-To
+// group named group, delivering to endpoint and cached by the browser for maxAge.  An empty group disables reporting.
+func SecurityOptionsReactJSWithReporting(group, endpoint string, maxAge time.Duration, opts ...PresetOption) Policy {
 	securityOptions := Policy{}
 
 	// Fetch directives
@@ -23,9 +62,264 @@ func SecurityOptionsReactJS() Policy {
 	securityOptions.CSP.FormAction = CSPSourceOptions{Allow: true, AllowSelf: true} // don't allow submitting forms to other domains
 
 	// Reporting directives
-	securityOptions.CSP.ReportTo = UnquotedOption{Value: "default"}
-	// Report-to header key
-	// /_/csp_reports means self+/_/csp_reports
-	securityOptions.ReportTo.ReportTo = `{"group":"default","max_age": 86400, "endpoints": [{"url":"/_/csp-reports" }]}`
-	return securityOptions
+	setReporting(&securityOptions, group, endpoint, maxAge)
+	return applyPresetOptions(securityOptions, opts)
+}
+
+// SecurityOptionsStrict returns a Policy implementing Google's nonce-based strict CSP:
+// https://csp.withgoogle.com/docs/strict-csp.html
+//
+// The header has the reference policy's directives only, script-src, object-src 'none', and base-uri 'none', plus
+// report-to; with WithoutReporting it is exactly the reference policy.  Directives such as frame-ancestors and
+// form-action are left out, to be added by the application as it needs them.
+//
+// script-src carries NoncePlaceholder, so the policy must be rendered with a fresh nonce for every response, either
+// with HeaderWithNonce:
+//
+//	pol := cspheader.SecurityOptionsStrict()
+//	_, err := pol.Compile()
+//	...
+//	nonce, err := cspheader.GenerateNonce()
+//	headers, err := pol.HeaderWithNonce(nonce)
+//
+// or with the middleware, which exposes the nonce to templates via NonceFromContext:
+//
+//	mw, err := cspheader.Middleware(cspheader.SecurityOptionsStrict(), cspheader.WithNonce())
+//
+// Load fails with ErrNonceRequired, as there is no nonce to render.
+func SecurityOptionsStrict(opts ...PresetOption) Policy {
+	// only the directives of the reference policy are set: the others, default-src included, are left out so that
+	// the header matches it.  'none' is written out as OmitZeroDirectives leaves zero valued directives out.
+	securityOptions := Policy{OmitZeroDirectives: true}
+
+	// Fetch directives
+	securityOptions.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+
+	// strict-dynamic lets nonced scripts load further scripts.  browsers that support nonces and strict-dynamic
+	// ignore 'unsafe-inline' and https:, which are fallbacks for older browsers.
+	securityOptions.CSP.ScriptSrc = CSPSourceOptions{
+		Allow:            true,
+		Values:           []string{SchemeHTTPS},
+		UnsafeInline:     true,
+		NonceBase64Value: NoncePlaceholder,
+		StrictDynamic:    true,
+	}
+	securityOptions.CSP.ObjectSrc = CSPSourceOptions{Allow: true, Values: []string{SourceNone}}
+
+	// Document directives
+	securityOptions.CSP.BaseURI = CSPSourceOptions{Allow: true, Values: []string{SourceNone}}
+
+	// Navigation directives
+	securityOptions.CSP.FormAction = CSPSourceOptions{Unset: true}
+	securityOptions.CSP.FrameAncestors = FrameAncestorOptions{Unset: true}
+
+	// Reporting directives
+	setDefaultReporting(&securityOptions)
+	return applyPresetOptions(securityOptions, opts)
+}
+
+// AngularOptions configures SecurityOptionsAngular
+type AngularOptions struct {
+	// APIOrigin is added to connect-src, e.g. https://api.example.com
+	APIOrigin string
+
+	// Nonce selects strict nonce mode: script-src and style-src carry NoncePlaceholder, which must be rendered with a
+	// per-request nonce (see SecurityOptionsStrict) and provided to Angular via the CSP_NONCE token or the
+	// ngCspNonce attribute.  Without it, style-src falls back to 'unsafe-inline' for the styles Angular injects.
+	Nonce bool
+
+	// Dev loosens the policy for `ng serve`: 'unsafe-eval' for JIT compilation and websocket connections for live
+	// reload.  Never use it in production.
+	Dev bool
+}
+
+// SecurityOptionsAngular returns a Policy set generally agreeable for Angular applications.
+// The zero AngularOptions produces a policy that Loads with no further configuration.
+//
+// Trade-offs:
+//   - Angular injects component styles at runtime.  without a nonce this requires style-src 'unsafe-inline', which
+//     permits injected styles from any source on the page.  nonce mode removes that at the cost of per-request
+//     rendering.
+//   - script-src is 'self' only: Angular's production build emits no inline scripts.
+func SecurityOptionsAngular(opts AngularOptions, presetOpts ...PresetOption) Policy {
+	securityOptions := Policy{}
+
+	// Fetch directives
+	securityOptions.CSP.DefaultSrc = CSPSourceOptions{Allow: false}
+
+	securityOptions.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	securityOptions.CSP.StyleSrc = CSPSourceOptions{Allow: true, AllowSelf: true, UnsafeInline: true}
+	if opts.Nonce {
+		securityOptions.CSP.ScriptSrc.NonceBase64Value = NoncePlaceholder
+		securityOptions.CSP.ScriptSrc.StrictDynamic = true
+		securityOptions.CSP.StyleSrc = CSPSourceOptions{Allow: true, AllowSelf: true, NonceBase64Value: NoncePlaceholder}
+	}
+	if opts.Dev {
+		// JIT compilation in development builds
+		securityOptions.CSP.ScriptSrc.UnsafeEval = true
+	}
+
+	securityOptions.CSP.ConnectSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	if len(opts.APIOrigin) > 0 {
+		securityOptions.CSP.ConnectSrc.Values = append(securityOptions.CSP.ConnectSrc.Values, opts.APIOrigin)
+	}
+	if opts.Dev {
+		// live reload
+		securityOptions.CSP.ConnectSrc.Values = append(securityOptions.CSP.ConnectSrc.Values, SchemeWS, SchemeWSS)
+	}
+
+	securityOptions.CSP.ImgSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{SchemeData}}
+	securityOptions.CSP.FontSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+
+	// Document directives
+	securityOptions.CSP.BaseURI = CSPSourceOptions{Allow: true, AllowSelf: true} // <base href="/"> is standard in angular apps
+
+	// Navigation directives
+	securityOptions.CSP.FormAction = CSPSourceOptions{Allow: true, AllowSelf: true} // don't allow submitting forms to other domains
+
+	// Reporting directives
+	setDefaultReporting(&securityOptions)
+	return applyPresetOptions(securityOptions, presetOpts)
+}
+
+// VueOptions configures SecurityOptionsVue
+type VueOptions struct {
+	// APIOrigin is added to connect-src, e.g. https://api.example.com
+	APIOrigin string
+
+	// DevWebsocketOrigin enables the development variant, adding the Vite HMR websocket to connect-src, e.g.
+	// ws://localhost:5173.  Leave it empty in production.
+	DevWebsocketOrigin string
+
+	// Nonce adds NoncePlaceholder to script-src, which must then be rendered with a per-request nonce
+	// (see SecurityOptionsStrict).
+	Nonce bool
+
+	// StyleHashes opts into hash mode for styles: style-src omits 'unsafe-inline' and instead allows these hashes
+	// of the inline styles the build emits (see HashInlineScript, which works for style bodies too).
+	StyleHashes []Hash
+}
+
+// SecurityOptionsVue returns a Policy set generally agreeable for Vue 3 single page applications built with Vite.
+// The zero VueOptions produces a production policy that Loads with no further configuration.
+func SecurityOptionsVue(opts VueOptions, presetOpts ...PresetOption) Policy {
+	securityOptions := Policy{}
+
+	// Fetch directives
+	securityOptions.CSP.DefaultSrc = CSPSourceOptions{Allow: false}
+
+	securityOptions.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	if opts.Nonce {
+		securityOptions.CSP.ScriptSrc.NonceBase64Value = NoncePlaceholder
+	}
+
+	// vue's scoped styles and transitions inject inline styles unless the caller can hash them
+	securityOptions.CSP.StyleSrc = CSPSourceOptions{Allow: true, AllowSelf: true, UnsafeInline: true}
+	if len(opts.StyleHashes) > 0 {
+		securityOptions.CSP.StyleSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Hashes: opts.StyleHashes}
+	}
+
+	// vite bundles workers as blob: urls
+	securityOptions.CSP.WorkerSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{SchemeBlob}}
+	// vite inlines small assets as data: urls
+	securityOptions.CSP.ImgSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{SchemeData}}
+	securityOptions.CSP.FontSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+
+	securityOptions.CSP.ConnectSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	if len(opts.APIOrigin) > 0 {
+		securityOptions.CSP.ConnectSrc.Values = append(securityOptions.CSP.ConnectSrc.Values, opts.APIOrigin)
+	}
+	if len(opts.DevWebsocketOrigin) > 0 {
+		securityOptions.CSP.ConnectSrc.Values = append(securityOptions.CSP.ConnectSrc.Values, opts.DevWebsocketOrigin)
+	}
+
+	// Document directives
+	securityOptions.CSP.BaseURI = CSPSourceOptions{Allow: false} // disabled
+
+	// Navigation directives
+	securityOptions.CSP.FormAction = CSPSourceOptions{Allow: true, AllowSelf: true} // don't allow submitting forms to other domains
+
+	// Reporting directives
+	setDefaultReporting(&securityOptions)
+	return applyPresetOptions(securityOptions, presetOpts)
+}
+
+// SecurityOptionsNextJS returns a Policy set generally agreeable for Next.js and similar server-rendered React
+// frameworks.  script-src carries NoncePlaceholder alongside 'strict-dynamic', so the policy is rendered per request
+// with HeaderWithNonce or the middleware's WithNonce option; the nonce is then passed to the framework (Next.js reads
+// it from the request's Content-Security-Policy header).  Load fails with ErrNonceRequired.
+func SecurityOptionsNextJS(opts ...PresetOption) Policy {
+	securityOptions := Policy{}
+
+	// Fetch directives
+	securityOptions.CSP.DefaultSrc = CSPSourceOptions{Allow: false}
+
+	// next reads the nonce back from the request's Content-Security-Policy header and adds it to the scripts it renders;
+	// strict-dynamic then trusts the chunks those scripts load
+	securityOptions.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true, NonceBase64Value: NoncePlaceholder, StrictDynamic: true}
+	// next injects inline styles
+	securityOptions.CSP.StyleSrc = CSPSourceOptions{Allow: true, AllowSelf: true, UnsafeInline: true}
+	securityOptions.CSP.ImgSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{SchemeData, SchemeBlob}}
+	securityOptions.CSP.FontSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	// client-side navigation fetches server component payloads
+	securityOptions.CSP.ConnectSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+
+	// Document directives
+	securityOptions.CSP.BaseURI = CSPSourceOptions{Allow: false} // disabled
+
+	// Navigation directives
+	securityOptions.CSP.FormAction = CSPSourceOptions{Allow: true, AllowSelf: true} // don't allow submitting forms to other domains
+	securityOptions.CSP.FrameAncestors = FrameAncestorOptions{Allow: false}
+
+	// Reporting directives
+	setDefaultReporting(&securityOptions)
+	return applyPresetOptions(securityOptions, opts)
+}
+
+// SecurityOptionsServerRendered returns a tight Policy for plain server-rendered sites, including those using htmx or
+// Turbo.  Use WithCDNHosts to allow a CDN's scripts and stylesheets.
+func SecurityOptionsServerRendered(opts ...PresetOption) Policy {
+	securityOptions := Policy{}
+
+	// Fetch directives
+	securityOptions.CSP.DefaultSrc = CSPSourceOptions{Allow: false}
+
+	securityOptions.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	securityOptions.CSP.StyleSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	// htmx and turbo make XHR/fetch requests back to the origin
+	securityOptions.CSP.ConnectSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	securityOptions.CSP.ImgSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+
+	// Navigation directives
+	securityOptions.CSP.FormAction = CSPSourceOptions{Allow: true, AllowSelf: true} // don't allow submitting forms to other domains
+	securityOptions.CSP.FrameAncestors = FrameAncestorOptions{Allow: false}
+
+	return applyPresetOptions(securityOptions, opts)
+}
+
+// SecurityOptionsStaticSite returns a Policy for documentation or blog style static sites.  It is intended as a safe
+// starting point: loosen it by adding to the directives a site needs rather than starting from a permissive policy.
+func SecurityOptionsStaticSite(opts ...PresetOption) Policy {
+	securityOptions := Policy{}
+
+	// Fetch directives
+	securityOptions.CSP.DefaultSrc = CSPSourceOptions{Allow: false}
+
+	securityOptions.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	securityOptions.CSP.StyleSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	securityOptions.CSP.ImgSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{SchemeData}}
+	securityOptions.CSP.FontSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	securityOptions.CSP.ConnectSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+
+	// Document directives
+	securityOptions.CSP.BaseURI = CSPSourceOptions{Allow: false} // disabled
+
+	// Navigation directives
+	securityOptions.CSP.FormAction = CSPSourceOptions{Allow: false} // static sites have nothing to submit to
+	securityOptions.CSP.FrameAncestors = FrameAncestorOptions{Allow: false}
+
+	// 'Other' directives
+	securityOptions.CSP.UpgradeInsecureRequests = true
+
+	return applyPresetOptions(securityOptions, opts)
 }
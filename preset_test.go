@@ -0,0 +1,336 @@
+package cspheader
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// presets returns every preset in its default configuration and in its variants, by name
+func presets() map[string]Policy {
+	return map[string]Policy{
+		"ReactJS":              SecurityOptionsReactJS(),
+		"ReactJSWithReporting": SecurityOptionsReactJSWithReporting("csp", "https://reports.example.com/csp", time.Hour),
+		"Strict":               SecurityOptionsStrict(),
+		"Angular":              SecurityOptionsAngular(AngularOptions{}),
+		"Angular nonce":        SecurityOptionsAngular(AngularOptions{Nonce: true, APIOrigin: "https://api.example.com"}),
+		"Vue":                  SecurityOptionsVue(VueOptions{}),
+		"Vue nonce":            SecurityOptionsVue(VueOptions{Nonce: true}),
+		"NextJS":               SecurityOptionsNextJS(),
+		"ServerRendered":       SecurityOptionsServerRendered(WithCDNHosts("https://cdn.example.com")),
+		"StaticSite":           SecurityOptionsStaticSite(),
+	}
+}
+
+func TestPresetsCompile(t *testing.T) {
+	for name, pol := range presets() {
+		t.Run(name, func(t *testing.T) {
+			compiled, err := pol.Compile()
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			headers, err := compiled.Render("abc123")
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if len(headers[cspHeaderName(pol.ReportOnly)]) == 0 {
+				t.Errorf("Render() = %v, want a policy header", headers)
+			}
+		})
+	}
+}
+
+func TestSecurityOptionsStrict(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []PresetOption
+		want string
+	}{
+		{
+			name: "default reporting",
+			want: "object-src 'none'; script-src https: 'unsafe-inline' 'nonce-abc123' 'strict-dynamic'; base-uri 'none'; report-to default;",
+		},
+		{
+			name: "without reporting",
+			opts: []PresetOption{WithoutReporting()},
+			want: "object-src 'none'; script-src https: 'unsafe-inline' 'nonce-abc123' 'strict-dynamic'; base-uri 'none';",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderCSP(t, SecurityOptionsStrict(tt.opts...))
+			if got != tt.want {
+				t.Errorf("header = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecurityOptionsStrictRequiresNonce(t *testing.T) {
+	pol := SecurityOptionsStrict()
+	_, err := pol.Load()
+	if !errors.Is(err, ErrNonceRequired) {
+		t.Errorf("Load() error = %v, want %v", err, ErrNonceRequired)
+	}
+}
+
+func TestSecurityOptionsAngular(t *testing.T) {
+	tests := []struct {
+		name string
+		opts AngularOptions
+		want string
+	}{
+		{
+			name: "zero options",
+			want: "default-src 'none'; connect-src 'self'; font-src 'self'; img-src 'self' data:; script-src 'self'; " +
+				"style-src 'self' 'unsafe-inline'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'; report-to default;",
+		},
+		{
+			name: "nonce and api origin",
+			opts: AngularOptions{Nonce: true, APIOrigin: "https://api.example.com"},
+			want: "default-src 'none'; connect-src 'self' https://api.example.com; font-src 'self'; img-src 'self' data:; " +
+				"script-src 'self' 'nonce-abc123' 'strict-dynamic'; style-src 'self' 'nonce-abc123'; base-uri 'self'; " +
+				"form-action 'self'; frame-ancestors 'none'; report-to default;",
+		},
+		{
+			name: "dev",
+			opts: AngularOptions{Dev: true},
+			want: "default-src 'none'; connect-src 'self' ws: wss:; font-src 'self'; img-src 'self' data:; " +
+				"script-src 'self' 'unsafe-eval'; style-src 'self' 'unsafe-inline'; base-uri 'self'; form-action 'self'; " +
+				"frame-ancestors 'none'; report-to default;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderCSP(t, SecurityOptionsAngular(tt.opts))
+			if got != tt.want {
+				t.Errorf("header = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecurityOptionsAngularLoads(t *testing.T) {
+	pol := SecurityOptionsAngular(AngularOptions{})
+	_, err := pol.Load()
+	if err != nil {
+		t.Errorf("Load() error = %v", err)
+	}
+
+	pol = SecurityOptionsAngular(AngularOptions{Nonce: true})
+	_, err = pol.Load()
+	if !errors.Is(err, ErrNonceRequired) {
+		t.Errorf("Load() error = %v, want %v", err, ErrNonceRequired)
+	}
+}
+
+func TestSecurityOptionsVue(t *testing.T) {
+	tests := []struct {
+		name string
+		opts VueOptions
+		want string
+	}{
+		{
+			name: "production",
+			want: "default-src 'none'; connect-src 'self'; font-src 'self'; img-src 'self' data:; script-src 'self'; " +
+				"style-src 'self' 'unsafe-inline'; worker-src 'self' blob:; base-uri 'none'; form-action 'self'; " +
+				"frame-ancestors 'none'; report-to default;",
+		},
+		{
+			name: "dev with nonce and api origin",
+			opts: VueOptions{Nonce: true, APIOrigin: "https://api.example.com", DevWebsocketOrigin: "ws://localhost:5173"},
+			want: "default-src 'none'; connect-src 'self' https://api.example.com ws://localhost:5173; font-src 'self'; " +
+				"img-src 'self' data:; script-src 'self' 'nonce-abc123'; style-src 'self' 'unsafe-inline'; " +
+				"worker-src 'self' blob:; base-uri 'none'; form-action 'self'; frame-ancestors 'none'; report-to default;",
+		},
+		{
+			name: "style hashes",
+			opts: VueOptions{StyleHashes: []Hash{{Algorithm: HashSHA256, Base64: emptySHA256}}},
+			want: "default-src 'none'; connect-src 'self'; font-src 'self'; img-src 'self' data:; script-src 'self'; " +
+				"style-src 'self' 'sha256-" + emptySHA256 + "'; worker-src 'self' blob:; base-uri 'none'; " +
+				"form-action 'self'; frame-ancestors 'none'; report-to default;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderCSP(t, SecurityOptionsVue(tt.opts))
+			if got != tt.want {
+				t.Errorf("header = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecurityOptionsNextJS(t *testing.T) {
+	want := "default-src 'none'; connect-src 'self'; font-src 'self'; img-src 'self' data: blob:; " +
+		"script-src 'self' 'nonce-abc123' 'strict-dynamic'; style-src 'self' 'unsafe-inline'; base-uri 'none'; " +
+		"form-action 'self'; frame-ancestors 'none'; report-to default;"
+	if got := renderCSP(t, SecurityOptionsNextJS()); got != want {
+		t.Errorf("header = %q, want %q", got, want)
+	}
+}
+
+func TestSecurityOptionsNextJSWithGeneratedNonce(t *testing.T) {
+	pol := SecurityOptionsNextJS()
+	_, err := pol.Load()
+	if !errors.Is(err, ErrNonceRequired) {
+		t.Errorf("Load() error = %v, want %v", err, ErrNonceRequired)
+	}
+
+	nonce, err := GenerateNonce()
+	if err != nil {
+		t.Fatalf("GenerateNonce() error = %v", err)
+	}
+	headers, err := pol.HeaderWithNonce(nonce)
+	if err != nil {
+		t.Fatalf("HeaderWithNonce() error = %v", err)
+	}
+	if want := "script-src 'self' 'nonce-" + nonce + "' 'strict-dynamic';"; !strings.Contains(headers[HeaderContentSecurityPolicy], want) {
+		t.Errorf("HeaderWithNonce() = %q, want it to contain %q", headers[HeaderContentSecurityPolicy], want)
+	}
+
+	mw, err := Middleware(pol, WithNonce())
+	if err != nil {
+		t.Fatalf("Middleware() error = %v", err)
+	}
+	var contextNonce string
+	rec := serve(mw, func(w http.ResponseWriter, r *http.Request) {
+		contextNonce, _ = NonceFromContext(r.Context())
+	}, nil)
+	if len(contextNonce) == 0 || !strings.Contains(rec.Header().Get(HeaderContentSecurityPolicy), "'nonce-"+contextNonce+"'") {
+		t.Errorf("header = %q, want the context nonce %q", rec.Header().Get(HeaderContentSecurityPolicy), contextNonce)
+	}
+}
+
+func TestSecurityOptionsServerRendered(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []PresetOption
+		want string
+	}{
+		{
+			name: "same origin only",
+			want: "default-src 'none'; connect-src 'self'; img-src 'self'; script-src 'self'; style-src 'self'; base-uri 'none'; form-action 'self'; frame-ancestors 'none';",
+		},
+		{
+			name: "cdn hosts",
+			opts: []PresetOption{WithCDNHosts("https://cdn.example.com", "https://static.example.com")},
+			want: "default-src 'none'; connect-src 'self'; img-src 'self'; " +
+				"script-src 'self' https://cdn.example.com https://static.example.com; " +
+				"style-src 'self' https://cdn.example.com https://static.example.com; base-uri 'none'; form-action 'self'; frame-ancestors 'none';",
+		},
+		{
+			name: "cdn hosts and script hosts",
+			opts: []PresetOption{WithCDNHosts("https://cdn.example.com"), WithScriptHosts("https://js.example.com")},
+			want: "default-src 'none'; connect-src 'self'; img-src 'self'; " +
+				"script-src 'self' https://cdn.example.com https://js.example.com; " +
+				"style-src 'self' https://cdn.example.com; base-uri 'none'; form-action 'self'; frame-ancestors 'none';",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsServerRendered(tt.opts...)
+			got := renderCSP(t, pol)
+			if got != tt.want {
+				t.Errorf("header = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecurityOptionsServerRenderedLoads(t *testing.T) {
+	pol := SecurityOptionsServerRendered(WithCDNHosts("https://cdn.example.com"))
+	headers, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got, want := headers[HeaderContentSecurityPolicy], renderCSP(t, pol); got != want {
+		t.Errorf("Load() = %q, want %q", got, want)
+	}
+	if _, ok := headers[HeaderReportTo]; ok {
+		t.Errorf("Load() = %v, want no reporting", headers)
+	}
+}
+
+func TestSecurityOptionsStaticSite(t *testing.T) {
+	const want = "default-src 'none'; connect-src 'self'; font-src 'self'; img-src 'self' data:; script-src 'self'; " +
+		"style-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'; upgrade-insecure-requests;"
+	pol := SecurityOptionsStaticSite()
+	headers, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := headers[HeaderContentSecurityPolicy]; got != want {
+		t.Errorf("header = %q, want %q", got, want)
+	}
+
+	// loosening goes through the helpers rather than the fields
+	err = pol.CSP.ImgSrc.AddValues("https://images.example.com")
+	if err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	got := renderCSP(t, pol)
+	if directive, ok := loosenedDirective(t, want, got); !ok || directive != "img-src" {
+		t.Errorf("loosened directive = %q, %v, want img-src", directive, ok)
+	}
+}
+
+func TestSecurityOptionsReactJSWithReporting(t *testing.T) {
+	tests := []struct {
+		name         string
+		pol          Policy
+		wantReportTo string
+		wantHeader   string
+	}{
+		{
+			name:         "defaults",
+			pol:          SecurityOptionsReactJS(),
+			wantReportTo: "report-to " + DefaultReportGroup + ";",
+			wantHeader:   `{"group":"default","max_age":86400,"endpoints":[{"url":"` + DefaultReportEndpoint + `"}]}`,
+		},
+		{
+			name:         "custom group and endpoint",
+			pol:          SecurityOptionsReactJSWithReporting("csp", "https://reports.example.com/csp", time.Hour),
+			wantReportTo: "report-to csp;",
+			wantHeader:   `{"group":"csp","max_age":3600,"endpoints":[{"url":"https://reports.example.com/csp"}]}`,
+		},
+		{
+			name: "empty group disables reporting",
+			pol:  SecurityOptionsReactJSWithReporting("", "https://reports.example.com/csp", time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers, err := tt.pol.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			csp := headers[HeaderContentSecurityPolicy]
+			if len(tt.wantReportTo) > 0 && !strings.HasSuffix(csp, tt.wantReportTo) {
+				t.Errorf("header = %q, want it to end with %q", csp, tt.wantReportTo)
+			}
+			if len(tt.wantReportTo) == 0 && strings.Contains(csp, "report-to") {
+				t.Errorf("header = %q, want no report-to", csp)
+			}
+			if got := headers[HeaderReportTo]; got != tt.wantHeader {
+				t.Errorf("%s = %q, want %q", HeaderReportTo, got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+// strictReference is the policy of https://csp.withgoogle.com/docs/strict-csp.html, with its nonce filled in
+const strictReference = "script-src 'nonce-abc123' 'strict-dynamic' https: 'unsafe-inline'; object-src 'none'; base-uri 'none';"
+
+func TestSecurityOptionsStrictMatchesReference(t *testing.T) {
+	got := renderCSP(t, SecurityOptionsStrict(WithoutReporting()))
+	d, err := CompareHeaders(strictReference, got)
+	if err != nil {
+		t.Fatalf("CompareHeaders() error = %v", err)
+	}
+	if !d.Equal() {
+		t.Errorf("header differs from the reference strict CSP:\n%s", d)
+	}
+}
@@ -0,0 +1,66 @@
+package cspheader
+
+// PresetOption customizes a preset after its base policy is built.  It is a plain func(*Policy), so it can also be
+// applied directly to a Policy obtained elsewhere:
+//
+//	pol := cspheader.SecurityOptionsServerRendered()
+//	cspheader.WithoutReporting()(&pol)
+type PresetOption func(*Policy)
+
+// WithReportEndpoint sends reports for the policy's report-to group to url.  If the policy has no reporting
+// configured, the preset's default reporting is set up first.
+func WithReportEndpoint(url string) PresetOption {
+	return func(pol *Policy) {
+		if len(pol.CSP.ReportTo.Value) == 0 {
+			setDefaultReporting(pol)
+		}
+		for i := range pol.ReportTo.Groups {
+			if pol.ReportTo.Groups[i].Group == pol.CSP.ReportTo.Value {
+				pol.ReportTo.Groups[i].Endpoints = []ReportToEndpoint{{URL: url}}
+			}
+		}
+		if _, ok := pol.ReportingEndpoints[pol.CSP.ReportTo.Value]; ok {
+			pol.ReportingEndpoints[pol.CSP.ReportTo.Value] = url
+		}
+	}
+}
+
+// WithScriptHosts adds hosts to script-src
+func WithScriptHosts(hosts ...string) PresetOption {
+	return func(pol *Policy) {
+		addSources(&pol.CSP.ScriptSrc, hosts...)
+	}
+}
+
+// WithCDNHosts adds hosts to script-src and style-src, for scripts and stylesheets served from a CDN
+func WithCDNHosts(hosts ...string) PresetOption {
+	return func(pol *Policy) {
+		addSources(&pol.CSP.ScriptSrc, hosts...)
+		addSources(&pol.CSP.StyleSrc, hosts...)
+	}
+}
+
+// WithoutReporting removes report-uri, report-to, and the Report-To and Reporting-Endpoints headers
+func WithoutReporting() PresetOption {
+	return func(pol *Policy) {
+		pol.CSP.ReportURI = UnquotedOptions{}
+		pol.CSP.ReportTo = UnquotedOption{}
+		pol.ReportTo.Groups = nil
+		pol.ReportTo.ReportTo = ""
+		pol.ReportingEndpoints = nil
+	}
+}
+
+// WithUpgradeInsecureRequests adds upgrade-insecure-requests
+func WithUpgradeInsecureRequests() PresetOption {
+	return func(pol *Policy) {
+		pol.CSP.UpgradeInsecureRequests = true
+	}
+}
+
+func applyPresetOptions(pol Policy, opts []PresetOption) Policy {
+	for _, opt := range opts {
+		opt(&pol)
+	}
+	return pol
+}
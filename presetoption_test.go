@@ -0,0 +1,86 @@
+package cspheader
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresetOptionAppliedDirectly(t *testing.T) {
+	pol := SecurityOptionsReactJSWithReporting("csp", "/csp", time.Hour)
+	WithoutReporting()(&pol)
+	if pol.CSP.ReportTo.Value != "" || pol.ReportTo.Groups != nil || pol.ReportingEndpoints != nil {
+		t.Errorf("WithoutReporting() left reporting configured: %+v", pol)
+	}
+
+	pol = SecurityOptionsReactJSWithReporting("csp", "/csp", time.Hour)
+	pol.ReportingEndpoints = map[string]string{"csp": "/csp"}
+	WithReportEndpoint("https://reports.example.com/csp")(&pol)
+	if got := pol.ReportTo.Groups[0].Endpoints; len(got) != 1 || got[0].URL != "https://reports.example.com/csp" {
+		t.Errorf("Report-To endpoints = %+v, want the new endpoint only", got)
+	}
+	if got := pol.ReportingEndpoints["csp"]; got != "https://reports.example.com/csp" {
+		t.Errorf("Reporting-Endpoints csp = %q, want the new endpoint", got)
+	}
+}
+
+func TestPresetOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		pol         Policy
+		wantCSP     string
+		wantReports string
+	}{
+		{
+			name:        "report endpoint replaces the preset's",
+			pol:         SecurityOptionsVue(VueOptions{}, WithReportEndpoint("https://reports.example.com/csp")),
+			wantCSP:     "report-to default;",
+			wantReports: `"endpoints":[{"url":"https://reports.example.com/csp"}]`,
+		},
+		{
+			name:        "report endpoint sets up reporting",
+			pol:         SecurityOptionsServerRendered(WithReportEndpoint("/csp-reports")),
+			wantCSP:     "report-to default;",
+			wantReports: `"endpoints":[{"url":"/csp-reports"}]`,
+		},
+		{
+			name:    "without reporting",
+			pol:     SecurityOptionsAngular(AngularOptions{}, WithoutReporting()),
+			wantCSP: "frame-ancestors 'none';",
+		},
+		{
+			name:    "upgrade insecure requests",
+			pol:     SecurityOptionsServerRendered(WithUpgradeInsecureRequests()),
+			wantCSP: "frame-ancestors 'none'; upgrade-insecure-requests;",
+		},
+		{
+			name:        "cdn hosts",
+			pol:         SecurityOptionsReactJS(WithCDNHosts("https://cdn.example.com")),
+			wantCSP:     "script-src 'self' https://cdn.example.com; style-src https://cdn.example.com;",
+			wantReports: `"endpoints":[{"url":"/_/csp-reports"}]`,
+		},
+		{
+			name:    "script hosts",
+			pol:     SecurityOptionsStaticSite(WithScriptHosts("https://js.example.com", "https://js.example.com")),
+			wantCSP: "script-src 'self' https://js.example.com;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers, err := tt.pol.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := headers[HeaderContentSecurityPolicy]; !strings.Contains(got, tt.wantCSP) {
+				t.Errorf("header = %q, want it to contain %q", got, tt.wantCSP)
+			}
+			got, ok := headers[HeaderReportTo]
+			if len(tt.wantReports) == 0 && (ok || strings.Contains(headers[HeaderContentSecurityPolicy], "report-to")) {
+				t.Errorf("Load() = %v, want no reporting", headers)
+			}
+			if !strings.Contains(got, tt.wantReports) {
+				t.Errorf("%s = %q, want it to contain %q", HeaderReportTo, got, tt.wantReports)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package cspheader
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxAuditBodyBytes is how much of a response body AuditURL scans for meta elements
+const maxAuditBodyBytes = 1 << 20
+
+// DeliveryMechanism is how a policy reached the browser
+type DeliveryMechanism string
+
+const (
+	// DeliveryHeader is a Content-Security-Policy header
+	DeliveryHeader DeliveryMechanism = "header"
+	// DeliveryReportOnlyHeader is a Content-Security-Policy-Report-Only header
+	DeliveryReportOnlyHeader DeliveryMechanism = "report-only-header"
+	// DeliveryMeta is a <meta http-equiv="Content-Security-Policy"> element
+	DeliveryMeta DeliveryMechanism = "meta"
+)
+
+// DeliveredPolicy is one policy found by AuditURL
+type DeliveredPolicy struct {
+	Delivery DeliveryMechanism
+	// Header is the policy as delivered
+	Header string
+	// Policy is Header parsed by ParsePolicy, with ReportOnly set for a report-only header and the response's
+	// Report-To header for a policy delivered by header.  it is the zero Policy if Err is set.
+	Policy Policy
+	// Err is the error parsing Header, e.g. for a directive without a mapping onto Policy
+	Err error
+	// Findings are the Audit of Policy
+	Findings []Finding
+}
+
+// RemotePolicy is the Content Security Policy of a live page, as found by AuditURL
+type RemotePolicy struct {
+	// URL is the URL of the final response, after any redirects
+	URL        string
+	StatusCode int
+	// Policies are every policy the page delivers, in order: Content-Security-Policy headers, then
+	// Content-Security-Policy-Report-Only headers, then meta elements.  A header listing several policies separated
+	// by commas gives one DeliveredPolicy each.  The browser enforces all of them, so a load must be allowed by each.
+	Policies []DeliveredPolicy
+	// ReportTo is the Report-To header, if any, with multiple headers joined by ", "
+	ReportTo string
+	// Delivery lists each mechanism found, in the order of Policies
+	Delivery []DeliveryMechanism
+}
+
+// AuditURL fetches url with a GET and returns the policies the page delivers, parsed and audited, for bringing an
+// existing site under this package.  Policies are read from the Content-Security-Policy and
+// Content-Security-Policy-Report-Only headers and from meta elements in the first MiB of the body.  client may be
+// nil to use http.DefaultClient.
+//
+// A policy that cannot be parsed is reported in its DeliveredPolicy rather than failing the audit; an error is
+// returned only if the page cannot be fetched.  Meta elements are found by a simple scan of the HTML, not by a full
+// parser, and a report-only meta element is ignored, as it is by browsers.
+func AuditURL(ctx context.Context, client *http.Client, url string) (*RemotePolicy, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("auditing %s: %w", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("auditing %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAuditBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("auditing %s: reading body: %w", url, err)
+	}
+
+	rp := &RemotePolicy{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		ReportTo:   strings.Join(resp.Header.Values(HeaderReportTo), ", "),
+	}
+	for _, header := range resp.Header.Values(HeaderContentSecurityPolicy) {
+		rp.add(DeliveryHeader, header)
+	}
+	for _, header := range resp.Header.Values(HeaderContentSecurityPolicyReportOnly) {
+		rp.add(DeliveryReportOnlyHeader, header)
+	}
+	for _, content := range metaPolicies(string(body)) {
+		rp.add(DeliveryMeta, content)
+	}
+	return rp, nil
+}
+
+// add parses and audits each policy of a delivered header value
+func (rp *RemotePolicy) add(delivery DeliveryMechanism, header string) {
+	// https://www.w3.org/TR/CSP3/#parse-serialized-policy-list
+	for _, serialized := range strings.Split(header, ",") {
+		serialized = strings.TrimSpace(serialized)
+		if len(serialized) == 0 {
+			continue
+		}
+
+		dp := DeliveredPolicy{Delivery: delivery, Header: serialized}
+		dp.Policy, dp.Err = ParsePolicy(serialized)
+		if dp.Err == nil {
+			dp.Policy.ReportOnly = delivery == DeliveryReportOnlyHeader
+			if delivery != DeliveryMeta {
+				dp.Policy.ReportTo.ReportTo = rp.ReportTo
+			}
+			dp.Findings = dp.Policy.Audit()
+		}
+		rp.Policies = append(rp.Policies, dp)
+
+		if !containsDelivery(rp.Delivery, delivery) {
+			rp.Delivery = append(rp.Delivery, delivery)
+		}
+	}
+}
+
+func containsDelivery(mechanisms []DeliveryMechanism, m DeliveryMechanism) bool {
+	for _, v := range mechanisms {
+		if v == m {
+			return true
+		}
+	}
+	return false
+}
+
+// metaPolicies returns the content of each <meta http-equiv="Content-Security-Policy"> element in an HTML document
+func metaPolicies(document string) []string {
+	var policies []string
+	lower := strings.ToLower(document)
+	for offset := 0; ; {
+		i := strings.Index(lower[offset:], "<meta")
+		if i < 0 {
+			return policies
+		}
+		start := offset + i + len("<meta")
+		end := tagEnd(document, start)
+		offset = end
+
+		// <metadata> and the like are not meta elements
+		if start < len(document) && !isHTMLSpace(document[start]) && document[start] != '/' && document[start] != '>' {
+			continue
+		}
+		attrs := parseHTMLAttributes(document[start:end])
+		if strings.EqualFold(attrs["http-equiv"], HeaderContentSecurityPolicy) {
+			if content, ok := attrs["content"]; ok {
+				policies = append(policies, content)
+			}
+		}
+	}
+}
+
+// tagEnd returns the index of the '>' closing the tag whose attributes begin at start, skipping '>' in quoted
+// attribute values, or the length of the document if the tag is not closed
+func tagEnd(document string, start int) int {
+	var quote byte
+	for i := start; i < len(document); i++ {
+		c := document[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return len(document)
+}
+
+// parseHTMLAttributes parses the attributes of a start tag into a map of lowercased names to unescaped values.  as
+// in HTML, the first occurrence of a repeated attribute wins.
+func parseHTMLAttributes(tag string) map[string]string {
+	attrs := map[string]string{}
+	i := 0
+	for i < len(tag) {
+		for i < len(tag) && (isHTMLSpace(tag[i]) || tag[i] == '/') {
+			i++
+		}
+		nameStart := i
+		for i < len(tag) && !isHTMLSpace(tag[i]) && tag[i] != '=' && tag[i] != '/' {
+			i++
+		}
+		name := strings.ToLower(tag[nameStart:i])
+		if len(name) == 0 {
+			break
+		}
+
+		for i < len(tag) && isHTMLSpace(tag[i]) {
+			i++
+		}
+		value := ""
+		if i < len(tag) && tag[i] == '=' {
+			i++
+			for i < len(tag) && isHTMLSpace(tag[i]) {
+				i++
+			}
+			valueStart := i
+			if i < len(tag) && (tag[i] == '"' || tag[i] == '\'') {
+				quote := tag[i]
+				valueStart++
+				i = valueStart
+				for i < len(tag) && tag[i] != quote {
+					i++
+				}
+				value = tag[valueStart:i]
+				i++
+			} else {
+				for i < len(tag) && !isHTMLSpace(tag[i]) {
+					i++
+				}
+				value = tag[valueStart:i]
+			}
+		}
+
+		if _, seen := attrs[name]; !seen {
+			attrs[name] = html.UnescapeString(value)
+		}
+	}
+	return attrs
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
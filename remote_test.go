@@ -0,0 +1,189 @@
+package cspheader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuditURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       http.Header
+		body         string
+		wantDelivery []DeliveryMechanism
+		wantHeaders  []string
+		wantReportTo string
+	}{
+		{
+			name:         "header",
+			header:       http.Header{HeaderContentSecurityPolicy: {"default-src 'self'; object-src 'none'"}},
+			wantDelivery: []DeliveryMechanism{DeliveryHeader},
+			wantHeaders:  []string{"default-src 'self'; object-src 'none'"},
+		},
+		{
+			name: "policy list and repeated headers",
+			header: http.Header{HeaderContentSecurityPolicy: {
+				"default-src 'self', script-src 'none'",
+				"img-src https:",
+			}},
+			wantDelivery: []DeliveryMechanism{DeliveryHeader},
+			wantHeaders:  []string{"default-src 'self'", "script-src 'none'", "img-src https:"},
+		},
+		{
+			name: "report-only and Report-To",
+			header: http.Header{
+				HeaderContentSecurityPolicyReportOnly: {"script-src 'self'; report-to csp"},
+				HeaderReportTo:                        {`{"group":"csp","max_age":3600,"endpoints":[{"url":"https://r.example.com"}]}`},
+			},
+			wantDelivery: []DeliveryMechanism{DeliveryReportOnlyHeader},
+			wantHeaders:  []string{"script-src 'self'; report-to csp"},
+			wantReportTo: `{"group":"csp","max_age":3600,"endpoints":[{"url":"https://r.example.com"}]}`,
+		},
+		{
+			name: "meta elements",
+			body: `<html><head>
+<metadata http-equiv="Content-Security-Policy" content="img-src *">
+<meta charset="utf-8">
+<META HTTP-EQUIV='content-security-policy' CONTENT='script-src &#39;self&#39;'>
+<meta http-equiv="Content-Security-Policy-Report-Only" content="style-src 'self'">
+<meta content="object-src 'none'" http-equiv=Content-Security-Policy />
+</head></html>`,
+			wantDelivery: []DeliveryMechanism{DeliveryMeta},
+			wantHeaders:  []string{"script-src 'self'", "object-src 'none'"},
+		},
+		{
+			name: "every mechanism in order",
+			header: http.Header{
+				HeaderContentSecurityPolicyReportOnly: {"script-src 'none'"},
+				HeaderContentSecurityPolicy:           {"default-src 'self'"},
+			},
+			body:         `<meta http-equiv="Content-Security-Policy" content="img-src 'self'">`,
+			wantDelivery: []DeliveryMechanism{DeliveryHeader, DeliveryReportOnlyHeader, DeliveryMeta},
+			wantHeaders:  []string{"default-src 'self'", "script-src 'none'", "img-src 'self'"},
+		},
+		{
+			name: "no policy",
+			body: "<html></html>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for name, values := range tt.header {
+					for _, v := range values {
+						w.Header().Add(name, v)
+					}
+				}
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			rp, err := AuditURL(context.Background(), srv.Client(), srv.URL)
+			if err != nil {
+				t.Fatalf("AuditURL() error = %v", err)
+			}
+			if rp.StatusCode != http.StatusOK || rp.URL != srv.URL {
+				t.Errorf("AuditURL() = %d %s, want %d %s", rp.StatusCode, rp.URL, http.StatusOK, srv.URL)
+			}
+			if !reflect.DeepEqual(rp.Delivery, tt.wantDelivery) {
+				t.Errorf("Delivery = %v, want %v", rp.Delivery, tt.wantDelivery)
+			}
+			var headers []string
+			for _, dp := range rp.Policies {
+				if dp.Err != nil {
+					t.Errorf("%q: parse error %v", dp.Header, dp.Err)
+				}
+				if dp.Policy.ReportOnly != (dp.Delivery == DeliveryReportOnlyHeader) {
+					t.Errorf("%q: ReportOnly = %v for delivery %s", dp.Header, dp.Policy.ReportOnly, dp.Delivery)
+				}
+				headers = append(headers, dp.Header)
+			}
+			if !reflect.DeepEqual(headers, tt.wantHeaders) {
+				t.Errorf("policies = %q, want %q", headers, tt.wantHeaders)
+			}
+			if rp.ReportTo != tt.wantReportTo {
+				t.Errorf("ReportTo = %q, want %q", rp.ReportTo, tt.wantReportTo)
+			}
+		})
+	}
+}
+
+func TestAuditURLFetchErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	_, err := AuditURL(context.Background(), nil, url)
+	if err == nil || !strings.Contains(err.Error(), "auditing "+url) {
+		t.Errorf("AuditURL() of a closed server error = %v, want one naming the URL", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = AuditURL(ctx, nil, "http://example.com")
+	if err == nil {
+		t.Errorf("AuditURL() with a canceled context error = nil")
+	}
+
+	_, err = AuditURL(context.Background(), nil, "http://exa mple.com")
+	if err == nil {
+		t.Errorf("AuditURL() of an invalid URL error = nil")
+	}
+}
+
+func TestAuditURLFindingsAndErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add(HeaderContentSecurityPolicy, "script-src 'self' 'unsafe-inline'")
+		w.Header().Add(HeaderContentSecurityPolicy, "navigate-to 'self'")
+	}))
+	defer srv.Close()
+
+	rp, err := AuditURL(context.Background(), srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatalf("AuditURL() error = %v", err)
+	}
+	if len(rp.Policies) != 2 {
+		t.Fatalf("AuditURL() found %d policies, want 2", len(rp.Policies))
+	}
+	weak, unparsed := rp.Policies[0], rp.Policies[1]
+	if weak.Err != nil || !hasFinding(weak.Findings, FindingScriptUnsafeInline) {
+		t.Errorf("findings of %q = %v, error %v, want %s", weak.Header, weak.Findings, weak.Err, FindingScriptUnsafeInline)
+	}
+	if unparsed.Err == nil || !strings.Contains(unparsed.Err.Error(), "unsupported directive") {
+		t.Errorf("error parsing %q = %v, want an unsupported directive", unparsed.Header, unparsed.Err)
+	}
+}
+
+func TestAuditURLRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentSecurityPolicy, "default-src 'self'")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	rp, err := AuditURL(context.Background(), srv.Client(), srv.URL+"/old")
+	if err != nil {
+		t.Fatalf("AuditURL() error = %v", err)
+	}
+	if rp.URL != srv.URL+"/new" || len(rp.Policies) != 1 {
+		t.Errorf("AuditURL() = %s with %d policies, want the policy of %s/new", rp.URL, len(rp.Policies), srv.URL)
+	}
+}
+
+// hasFinding reports whether findings include code
+func hasFinding(findings []Finding, code FindingCode) bool {
+	for _, f := range findings {
+		if f.Code == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package cspheader
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// bufferPool holds the buffers templates are executed into, so that repeated Loads and Renders reuse them
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// maxPooledBuffer bounds the buffers returned to bufferPool, so one very large template output is not kept around
+const maxPooledBuffer = 64 << 10
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// executeTemplate executes tmpl with data, returning the output with surrounding whitespace trimmed.  source
+// expressions are space-prefixed in the default templates, so the first one may lead with a space.
+func executeTemplate(tmpl *template.Template, data interface{}) (string, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	err := tmpl.Execute(buf, data)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+// executeTemplateTo is executeTemplate writing to w
+func executeTemplateTo(w io.Writer, tmpl *template.Template, data interface{}) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	err := tmpl.Execute(buf, data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes.TrimSpace(buf.Bytes()))
+	return err
+}
+
+// The renderers below are used in place of executing a default template, which they match byte for byte.  A
+// directive's Parse selects them when given the shared parse of its default template text; any other template,
+// including a default text parsed with TemplateFuncs by hand, is executed as usual.
+
+func (cso CSPSourceOptions) render() string {
+	if !cso.Allow {
+		return SourceNone
+	}
+
+	var b strings.Builder
+	if cso.AllowSelf {
+		b.WriteString(SourceSelf)
+	}
+	for _, v := range cso.Values {
+		b.WriteString(" ")
+		b.WriteString(v)
+	}
+	writeIf(&b, cso.UnsafeEval, SourceUnsafeEval)
+	writeIf(&b, cso.WasmUnsafeEval, SourceWasmUnsafeEval)
+	writeIf(&b, cso.UnsafeHashes, SourceUnsafeHashes)
+	writeIf(&b, cso.UnsafeInline, SourceUnsafeInline)
+	if len(cso.NonceBase64Value) > 0 {
+		b.WriteString(" 'nonce-")
+		b.WriteString(cso.NonceBase64Value)
+		b.WriteString("'")
+	}
+	for _, n := range cso.Nonces {
+		b.WriteString(" 'nonce-")
+		b.WriteString(n)
+		b.WriteString("'")
+	}
+	if len(cso.HashAlgorithmBase64Value) > 0 {
+		b.WriteString(" '")
+		b.WriteString(cso.HashAlgorithmBase64Value)
+		b.WriteString("'")
+	}
+	for _, h := range cso.Hashes {
+		b.WriteString(" '")
+		b.WriteString(h.String())
+		b.WriteString("'")
+	}
+	writeIf(&b, cso.StrictDynamic, SourceStrictDynamic)
+	writeIf(&b, cso.ReportSample, SourceReportSample)
+	return strings.TrimSpace(b.String())
+}
+
+func (so SandboxOptions) render() string {
+	var b strings.Builder
+	writeIf(&b, so.AllowDownloads, "allow-downloads")
+	writeIf(&b, so.AllowDownloadsWithoutUserActivation, "allow-downloads-without-user-activation")
+	writeIf(&b, so.AllowForms, "allow-forms")
+	writeIf(&b, so.AllowModals, "allow-modals")
+	writeIf(&b, so.AllowOrientationLock, "allow-orientation-lock")
+	writeIf(&b, so.AllowPointerLock, "allow-pointer-lock")
+	writeIf(&b, so.AllowPopups, "allow-popups")
+	writeIf(&b, so.AllowPopupsToEscapeSandbox, "allow-popups-to-escape-sandbox")
+	writeIf(&b, so.AllowPresentation, "allow-presentation")
+	writeIf(&b, so.AllowSameOrigin, "allow-same-origin")
+	writeIf(&b, so.AllowScripts, "allow-scripts")
+	writeIf(&b, so.AllowStorageAccessByUserActivation, "allow-storage-access-by-user-activation")
+	writeIf(&b, so.AllowTopNavigation, "allow-top-navigation")
+	writeIf(&b, so.AllowTopNavigationByUserActivation, "allow-top-navigation-by-user-activation")
+	writeIf(&b, so.AllowTopNavigationToCustomProtocols, "allow-top-navigation-to-custom-protocols")
+	return strings.TrimSpace(b.String())
+}
+
+func (fao FrameAncestorOptions) render() string {
+	if !fao.Allow {
+		return SourceNone
+	}
+
+	var b strings.Builder
+	if fao.AllowSelf {
+		b.WriteString(SourceSelf)
+	}
+	for _, v := range fao.HostSources {
+		b.WriteString(" ")
+		b.WriteString(v)
+	}
+	for _, v := range fao.SchemeSources {
+		b.WriteString(" ")
+		b.WriteString(v)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (uvs UnquotedOptions) render() string {
+	var b strings.Builder
+	for _, v := range uvs.Values {
+		b.WriteString(v)
+		b.WriteString(" ")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (uv UnquotedOption) render() string {
+	return strings.TrimSpace(uv.Value)
+}
+
+// writeIf writes a space and s to b if set
+func writeIf(b *strings.Builder, set bool, s string) {
+	if set {
+		b.WriteString(" ")
+		b.WriteString(s)
+	}
+}
@@ -0,0 +1,334 @@
+package cspheader
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// BenchmarkSourceOptionFastPath renders with the shared default template, which selects the template-free renderer
+func BenchmarkSourceOptionFastPath(b *testing.B) {
+	tmpl := defaultTemplate("SourceOption", TemplateTextSourceOption)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := benchmarkSourceOptions.Parse(tmpl)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSourceOptionTemplate renders the same options by executing the default template text
+func BenchmarkSourceOptionTemplate(b *testing.B) {
+	tmpl := templateFor("SourceOption", TemplateTextSourceOption)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := benchmarkSourceOptions.Parse(tmpl)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestFrameAncestorRenderMatchesTemplate(t *testing.T) {
+	fast := defaultTemplate("FrameAncestorOptions", TemplateTextFrameAncestorOptions)
+	slow := templateFor("FrameAncestorOptions", TemplateTextFrameAncestorOptions)
+	hosts := [][]string{nil, {"https://partner.example.com"}, {"https://a.example.com", "https://b.example.com", "https://a.example.com"}}
+	schemes := [][]string{nil, {"https:"}, {"https:", "data:"}}
+
+	for _, allow := range []bool{false, true} {
+		for _, self := range []bool{false, true} {
+			for _, h := range hosts {
+				for _, s := range schemes {
+					fao := FrameAncestorOptions{Allow: allow, AllowSelf: self, HostSources: h, SchemeSources: s}
+					got, err := fao.Parse(fast)
+					if err != nil {
+						t.Fatalf("Parse(%+v) error = %v", fao, err)
+					}
+					want, err := fao.Parse(slow)
+					if err != nil {
+						t.Fatalf("Parse(%+v) with the template error = %v", fao, err)
+					}
+					if got != want {
+						t.Errorf("Parse(%+v) = %q, template renders %q", fao, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestSandboxRenderMatchesTemplate sets every combination of the sandbox tokens
+func TestSandboxRenderMatchesTemplate(t *testing.T) {
+	fast := defaultTemplate("Sandbox", TemplateTextSandbox)
+	slow := templateFor("Sandbox", TemplateTextSandbox)
+
+	var tokens []int
+	typ := reflect.TypeOf(SandboxOptions{})
+	for i := 0; i < typ.NumField(); i++ {
+		if f := typ.Field(i); f.Type.Kind() == reflect.Bool && f.Name != "Enabled" {
+			tokens = append(tokens, i)
+		}
+	}
+	for mask := 0; mask < 1<<len(tokens); mask++ {
+		var so SandboxOptions
+		v := reflect.ValueOf(&so).Elem()
+		for bit, field := range tokens {
+			v.Field(field).SetBool(mask&(1<<bit) != 0)
+		}
+
+		got, err := so.Parse(fast)
+		if err != nil {
+			t.Fatalf("Parse(%+v) error = %v", so, err)
+		}
+		want, err := so.Parse(slow)
+		if err != nil {
+			t.Fatalf("Parse(%+v) with the template error = %v", so, err)
+		}
+		if got != want {
+			t.Fatalf("Parse(%+v) = %q, template renders %q", so, got, want)
+		}
+	}
+}
+
+// TestSourceOptionRenderMatchesTemplate renders each CSPSourceOptions of the matrix through the fast path and
+// through the default template text, which must agree byte for byte
+func TestSourceOptionRenderMatchesTemplate(t *testing.T) {
+	fast := defaultTemplate("SourceOption", TemplateTextSourceOption)
+	slow := templateFor("SourceOption", TemplateTextSourceOption)
+	for _, cso := range sourceOptionsMatrix() {
+		got, err := cso.Parse(fast)
+		if err != nil {
+			t.Fatalf("Parse(%+v) error = %v", cso, err)
+		}
+		want, err := cso.Parse(slow)
+		if err != nil {
+			t.Fatalf("Parse(%+v) with the template error = %v", cso, err)
+		}
+		if got != want {
+			t.Errorf("Parse(%+v) = %q, template renders %q", cso, got, want)
+		}
+	}
+}
+
+func TestUnquotedRenderMatchesTemplate(t *testing.T) {
+	values := []string{"", "default", "  padded  ", "/csp-reports"}
+
+	fast := defaultTemplate("UnquotedOption", TemplateTextUnquotedOption)
+	slow := templateFor("UnquotedOption", TemplateTextUnquotedOption)
+	for _, v := range values {
+		uv := UnquotedOption{Value: v}
+		got, _ := uv.Parse(fast)
+		want, err := uv.Parse(slow)
+		if err != nil {
+			t.Fatalf("Parse(%+v) with the template error = %v", uv, err)
+		}
+		if got != want {
+			t.Errorf("Parse(%+v) = %q, template renders %q", uv, got, want)
+		}
+	}
+
+	fast = defaultTemplate("UnquotedOptions", TemplateTextUnquotedOptions)
+	slow = templateFor("UnquotedOptions", TemplateTextUnquotedOptions)
+	for _, vs := range [][]string{nil, values[1:2], values[1:], {"/a", "/b", "/a"}} {
+		uvs := UnquotedOptions{Values: vs}
+		got, _ := uvs.Parse(fast)
+		want, err := uvs.Parse(slow)
+		if err != nil {
+			t.Fatalf("Parse(%+v) with the template error = %v", uvs, err)
+		}
+		if got != want {
+			t.Errorf("Parse(%+v) = %q, template renders %q", uvs, got, want)
+		}
+	}
+}
+
+// sourceOptionsMatrix returns CSPSourceOptions covering every combination of the keyword flags, with and without
+// values, nonces, and hashes
+func sourceOptionsMatrix() []CSPSourceOptions {
+	flags := []func(*CSPSourceOptions){
+		func(cso *CSPSourceOptions) { cso.Allow = true },
+		func(cso *CSPSourceOptions) { cso.AllowSelf = true },
+		func(cso *CSPSourceOptions) { cso.UnsafeEval = true },
+		func(cso *CSPSourceOptions) { cso.WasmUnsafeEval = true },
+		func(cso *CSPSourceOptions) { cso.UnsafeHashes = true },
+		func(cso *CSPSourceOptions) { cso.UnsafeInline = true },
+		func(cso *CSPSourceOptions) { cso.StrictDynamic = true },
+		func(cso *CSPSourceOptions) { cso.ReportSample = true },
+	}
+	values := [][]string{nil, {"https://cdn.example.com"}, {"https:", "'self'", "https://a.example.com"}}
+	nonces := []func(*CSPSourceOptions){
+		func(*CSPSourceOptions) {},
+		func(cso *CSPSourceOptions) { cso.NonceBase64Value = "abc123" },
+		func(cso *CSPSourceOptions) {
+			cso.NonceBase64Value = "'nonce-abc123'"
+			cso.Nonces = []string{"def456", "ghi789"}
+		},
+	}
+	hashes := []func(*CSPSourceOptions){
+		func(*CSPSourceOptions) {},
+		func(cso *CSPSourceOptions) {
+			cso.HashAlgorithmBase64Value = "'sha256-RFWPLDbv2BY+rCkDzsE+0fr8ylGr2R2faWMhq4lfEQc='"
+		},
+		func(cso *CSPSourceOptions) {
+			cso.Hashes = []Hash{
+				{Algorithm: HashSHA256, Base64: "RFWPLDbv2BY+rCkDzsE+0fr8ylGr2R2faWMhq4lfEQc="},
+				{Algorithm: HashSHA384, Base64: "oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC"},
+			}
+		},
+	}
+
+	var matrix []CSPSourceOptions
+	for mask := 0; mask < 1<<len(flags); mask++ {
+		for _, v := range values {
+			for _, setNonce := range nonces {
+				for _, setHash := range hashes {
+					cso := CSPSourceOptions{Values: v}
+					for i, set := range flags {
+						if mask&(1<<i) != 0 {
+							set(&cso)
+						}
+					}
+					setNonce(&cso)
+					setHash(&cso)
+					matrix = append(matrix, cso)
+				}
+			}
+		}
+	}
+	return matrix
+}
+
+// templateFor parses text on its own, so that Parse executes it rather than selecting the renderer for the shared
+// default parse
+func templateFor(name, text string) *template.Template {
+	return template.Must(template.New(name).Parse(text))
+}
+
+// benchmarkSourceOptions is a script-src typical of a nonce-based policy
+var benchmarkSourceOptions = CSPSourceOptions{
+	Allow:            true,
+	AllowSelf:        true,
+	Values:           []string{"https://cdn.example.com"},
+	NonceBase64Value: "cmVxdWVzdA",
+	StrictDynamic:    true,
+	ReportSample:     true,
+}
+
+// BenchmarkExecuteUnpooled executes the template into a fresh buffer, as Parse did before the pool, for comparison
+// with BenchmarkSourceOptionTemplate
+func BenchmarkExecuteUnpooled(b *testing.B) {
+	tmpl := templateFor("SourceOption", TemplateTextSourceOption)
+	data := benchmarkSourceOptions.prepared()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_ = strings.TrimSpace(buf.String())
+	}
+}
+
+// BenchmarkParseToDiscard is BenchmarkParseToTemplate with the output discarded
+func BenchmarkParseToDiscard(b *testing.B) {
+	tmpl := templateFor("SourceOption", TemplateTextSourceOption)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := benchmarkSourceOptions.ParseTo(io.Discard, tmpl)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseToTemplate executes the template of BenchmarkSourceOptionTemplate into a reused buffer, without
+// converting the output to a string
+func BenchmarkParseToTemplate(b *testing.B) {
+	tmpl := templateFor("SourceOption", TemplateTextSourceOption)
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		err := benchmarkSourceOptions.ParseTo(&buf, tmpl)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestParseToMatchesParse writes each option through ParseTo, with the shared default templates and with templates
+// that are executed, and compares the output to Parse
+func TestParseToMatchesParse(t *testing.T) {
+	type parser interface {
+		Parse(*template.Template) (string, error)
+		ParseTo(io.Writer, *template.Template) error
+	}
+	tests := []struct {
+		name, text string
+		options    []parser
+	}{
+		{"SourceOption", TemplateTextSourceOption, []parser{
+			CSPSourceOptions{},
+			benchmarkSourceOptions,
+			CSPSourceOptions{Allow: true, Values: []string{"self", "https:", "self"}, Nonces: []string{"'nonce-abc123'"}},
+		}},
+		{"Sandbox", TemplateTextSandbox, []parser{
+			SandboxOptions{},
+			SandboxOptions{AllowScripts: true, AllowForms: true},
+		}},
+		{"FrameAncestorOptions", TemplateTextFrameAncestorOptions, []parser{
+			FrameAncestorOptions{},
+			FrameAncestorOptions{Allow: true, AllowSelf: true, HostSources: []string{"https://a.example.com", "https://a.example.com"}},
+		}},
+		{"UnquotedOptions", TemplateTextUnquotedOptions, []parser{
+			UnquotedOptions{},
+			UnquotedOptions{Values: []string{"/a", "/b", "/a"}},
+		}},
+		{"UnquotedOption", TemplateTextUnquotedOption, []parser{
+			UnquotedOption{},
+			UnquotedOption{Value: " default "},
+		}},
+	}
+	for _, tt := range tests {
+		templates := map[string]*template.Template{
+			"default":  defaultTemplate(tt.name, tt.text),
+			"executed": templateFor(tt.name, tt.text),
+		}
+		for kind, tmpl := range templates {
+			t.Run(tt.name+"/"+kind, func(t *testing.T) {
+				var buf bytes.Buffer
+				for _, opt := range tt.options {
+					want, err := opt.Parse(tmpl)
+					if err != nil {
+						t.Fatalf("Parse(%+v) error = %v", opt, err)
+					}
+					buf.Reset()
+					err = opt.ParseTo(&buf, tmpl)
+					if err != nil {
+						t.Fatalf("ParseTo(%+v) error = %v", opt, err)
+					}
+					if buf.String() != want {
+						t.Errorf("ParseTo(%+v) wrote %q, Parse returns %q", opt, buf.String(), want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPutBufferDropsLargeBuffers(t *testing.T) {
+	buf := getBuffer()
+	buf.Grow(maxPooledBuffer + 1)
+	putBuffer(buf)
+	// the pool may drop anything at any time, so only the oversized buffer coming back is a failure
+	for i := 0; i < 10; i++ {
+		if got := getBuffer(); got == buf {
+			t.Fatalf("getBuffer() returned a buffer of capacity %d, larger than maxPooledBuffer", got.Cap())
+		}
+	}
+}
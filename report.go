@@ -0,0 +1,237 @@
+package cspheader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxReportBytes is the largest report body the parsers will read (64KiB)
+const MaxReportBytes = 64 << 10
+
+// ErrReportTooLarge is returned when a report body exceeds the size cap
+var ErrReportTooLarge = errors.New("violation report exceeds the maximum size")
+
+// ViolationReport is a CSP violation report normalized across browsers and across the report-uri and report-to
+// delivery mechanisms.  Fields a browser did not send are left empty.
+// https://www.w3.org/TR/CSP3/#deprecated-serialize-violation
+type ViolationReport struct {
+	DocumentURI        string
+	Referrer           string
+	ViolatedDirective  string
+	EffectiveDirective string
+	OriginalPolicy     string
+	Disposition        string // "enforce" or "report"
+	BlockedURI         string
+	StatusCode         int
+	SourceFile         string
+	LineNumber         int
+	ColumnNumber       int
+	ScriptSample       string
+}
+
+// violationReportFieldAliases maps each ViolationReport field to the names browsers have used for it, in the legacy
+// csp-report body and in the Reporting API body.
+var violationReportFieldAliases = map[string][]string{
+	"DocumentURI":        {"document-uri", "documentURL", "document-url"},
+	"Referrer":           {"referrer"},
+	"ViolatedDirective":  {"violated-directive", "violatedDirective"},
+	"EffectiveDirective": {"effective-directive", "effectiveDirective"},
+	"OriginalPolicy":     {"original-policy", "originalPolicy"},
+	"Disposition":        {"disposition"},
+	"BlockedURI":         {"blocked-uri", "blockedURL", "blocked-url"},
+	"StatusCode":         {"status-code", "statusCode"},
+	"SourceFile":         {"source-file", "sourceFile"},
+	"LineNumber":         {"line-number", "lineNumber", "lineno"},
+	"ColumnNumber":       {"column-number", "columnNumber", "colno"},
+	"ScriptSample":       {"script-sample", "sample"},
+}
+
+// ParseViolationReport parses a legacy report-uri violation report of the form {"csp-report": {...}}, as sent with
+// Content-Type application/csp-report.  Missing fields are tolerated, and bodies larger than MaxReportBytes are
+// rejected.
+func ParseViolationReport(r io.Reader) (*ViolationReport, error) {
+	return parseViolationReport(r, MaxReportBytes)
+}
+
+func parseViolationReport(r io.Reader, maxBytes int64) (*ViolationReport, error) {
+	body, err := readReportBody(r, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope struct {
+		CSPReport map[string]json.RawMessage `json:"csp-report"`
+	}
+	err = json.Unmarshal(body, &envelope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid violation report: %w", err)
+	}
+	if envelope.CSPReport == nil {
+		return nil, errors.New("invalid violation report: missing csp-report")
+	}
+
+	return newViolationReport(envelope.CSPReport), nil
+}
+
+// ReportTypeCSPViolation is the Reporting API report type for CSP violations
+const ReportTypeCSPViolation = "csp-violation"
+
+// Report is a CSP violation delivered via the Reporting API (report-to).  The body is normalized onto the same
+// ViolationReport as legacy reports so downstream code doesn't need to care which transport was used.
+// https://www.w3.org/TR/reporting-1/#serialize-reports
+type Report struct {
+	Type      string
+	Age       time.Duration // how long ago the violation occurred, relative to when the report was sent
+	URL       string
+	UserAgent string
+	Violation ViolationReport
+}
+
+// ParseReports parses a batch of Reporting API reports, as sent with Content-Type application/reports+json.
+// Only csp-violation reports are returned; other report types are skipped.  Bodies larger than MaxReportBytes are
+// rejected.
+func ParseReports(r io.Reader) ([]Report, error) {
+	return parseReports(r, MaxReportBytes)
+}
+
+func parseReports(r io.Reader, maxBytes int64) ([]Report, error) {
+	body, err := readReportBody(r, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	type envelope struct {
+		Type      string                     `json:"type"`
+		Age       int64                      `json:"age"` // milliseconds
+		URL       string                     `json:"url"`
+		UserAgent string                     `json:"user_agent"`
+		Body      map[string]json.RawMessage `json:"body"`
+	}
+
+	var envelopes []envelope
+	err = json.Unmarshal(body, &envelopes)
+	if err != nil {
+		// tolerate a single report sent outside of an array
+		var single envelope
+		if json.Unmarshal(body, &single) != nil {
+			return nil, fmt.Errorf("invalid reports: %w", err)
+		}
+		envelopes = []envelope{single}
+	}
+
+	reports := make([]Report, 0, len(envelopes))
+	for _, e := range envelopes {
+		if e.Type != ReportTypeCSPViolation || e.Body == nil {
+			continue
+		}
+		violation := newViolationReport(e.Body)
+		if len(violation.DocumentURI) == 0 {
+			violation.DocumentURI = e.URL
+		}
+		reports = append(reports, Report{
+			Type:      e.Type,
+			Age:       time.Duration(e.Age) * time.Millisecond,
+			URL:       e.URL,
+			UserAgent: e.UserAgent,
+			Violation: *violation,
+		})
+	}
+
+	return reports, nil
+}
+
+// readReportBody reads up to maxBytes, erroring rather than truncating if there is more
+func readReportBody(r io.Reader, maxBytes int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, ErrReportTooLarge
+	}
+	return body, nil
+}
+
+// newViolationReport normalizes the raw fields of a report body
+func newViolationReport(fields map[string]json.RawMessage) *ViolationReport {
+	vr := &ViolationReport{
+		DocumentURI:        reportString(fields, "DocumentURI"),
+		Referrer:           reportString(fields, "Referrer"),
+		ViolatedDirective:  reportString(fields, "ViolatedDirective"),
+		EffectiveDirective: reportString(fields, "EffectiveDirective"),
+		OriginalPolicy:     reportString(fields, "OriginalPolicy"),
+		Disposition:        reportString(fields, "Disposition"),
+		BlockedURI:         reportString(fields, "BlockedURI"),
+		StatusCode:         reportInt(fields, "StatusCode"),
+		SourceFile:         reportString(fields, "SourceFile"),
+		LineNumber:         reportInt(fields, "LineNumber"),
+		ColumnNumber:       reportInt(fields, "ColumnNumber"),
+		ScriptSample:       reportString(fields, "ScriptSample"),
+	}
+
+	// older browsers only send violated-directive, which may include the directive's value
+	if len(vr.EffectiveDirective) == 0 {
+		if fields := strings.Fields(vr.ViolatedDirective); len(fields) > 0 {
+			vr.EffectiveDirective = fields[0]
+		}
+	}
+	// the reporting API only sends effectiveDirective
+	if len(vr.ViolatedDirective) == 0 {
+		vr.ViolatedDirective = vr.EffectiveDirective
+	}
+
+	return vr
+}
+
+// reportRaw returns the first alias of field present in the report
+func reportRaw(fields map[string]json.RawMessage, field string) (json.RawMessage, bool) {
+	for _, name := range violationReportFieldAliases[field] {
+		if v, ok := fields[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func reportString(fields map[string]json.RawMessage, field string) string {
+	raw, ok := reportRaw(fields, field)
+	if !ok {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) != nil {
+		// not a string (e.g. null).  keep whatever is there rather than failing the report.
+		return strings.Trim(string(raw), `"`)
+	}
+	return s
+}
+
+// reportInt accepts numbers sent either as JSON numbers or as strings
+func reportInt(fields map[string]json.RawMessage, field string) int {
+	raw, ok := reportRaw(fields, field)
+	if !ok {
+		return 0
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) != nil {
+		var s string
+		if json.Unmarshal(raw, &s) != nil {
+			return 0
+		}
+		n = json.Number(s)
+	}
+	i, err := strconv.Atoi(n.String())
+	if err != nil {
+		f, err := n.Float64()
+		if err != nil {
+			return 0
+		}
+		return int(f)
+	}
+	return i
+}
@@ -0,0 +1,107 @@
+package cspheader
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseViolationReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    *ViolationReport
+		wantErr bool
+	}{
+		{
+			name: "chrome",
+			body: `{"csp-report":{"document-uri":"https://example.com/page","referrer":"","violated-directive":"script-src-elem",` +
+				`"effective-directive":"script-src-elem","original-policy":"default-src 'self'","disposition":"enforce",` +
+				`"blocked-uri":"https://evil.example.com/x.js","status-code":200,"source-file":"https://example.com/page",` +
+				`"line-number":10,"column-number":4,"script-sample":""}}`,
+			want: &ViolationReport{
+				DocumentURI: "https://example.com/page", ViolatedDirective: "script-src-elem", EffectiveDirective: "script-src-elem",
+				OriginalPolicy: "default-src 'self'", Disposition: "enforce", BlockedURI: "https://evil.example.com/x.js",
+				StatusCode: 200, SourceFile: "https://example.com/page", LineNumber: 10, ColumnNumber: 4,
+			},
+		},
+		{
+			name: "violated directive with its value",
+			body: `{"csp-report":{"document-uri":"https://example.com/","violated-directive":"img-src 'self'","blocked-uri":"data"}}`,
+			want: &ViolationReport{
+				DocumentURI: "https://example.com/", ViolatedDirective: "img-src 'self'", EffectiveDirective: "img-src", BlockedURI: "data",
+			},
+		},
+		{
+			name: "numbers as strings",
+			body: `{"csp-report":{"line-number":"12","column-number":3.0,"status-code":null}}`,
+			want: &ViolationReport{LineNumber: 12, ColumnNumber: 3},
+		},
+		{name: "missing csp-report", body: `{"report":{}}`, wantErr: true},
+		{name: "invalid json", body: `{"csp-report":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseViolationReport(strings.NewReader(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseViolationReport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseViolationReport() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseViolationReportTooLarge(t *testing.T) {
+	body := `{"csp-report":{"script-sample":"` + strings.Repeat("a", MaxReportBytes) + `"}}`
+	_, err := ParseViolationReport(strings.NewReader(body))
+	if !errors.Is(err, ErrReportTooLarge) {
+		t.Errorf("ParseViolationReport() error = %v, want %v", err, ErrReportTooLarge)
+	}
+}
+
+func TestParseReports(t *testing.T) {
+	violation := `{"type":"csp-violation","age":1500,"url":"https://example.com/page","user_agent":"Mozilla/5.0",` +
+		`"body":{"documentURL":"https://example.com/page","blockedURL":"inline","effectiveDirective":"script-src-elem",` +
+		`"originalPolicy":"script-src 'self'","disposition":"report","statusCode":200,"lineNumber":3,"sample":"alert(1)"}}`
+	want := Report{
+		Type:      ReportTypeCSPViolation,
+		Age:       1500 * time.Millisecond,
+		URL:       "https://example.com/page",
+		UserAgent: "Mozilla/5.0",
+		Violation: ViolationReport{
+			DocumentURI: "https://example.com/page", ViolatedDirective: "script-src-elem", EffectiveDirective: "script-src-elem",
+			OriginalPolicy: "script-src 'self'", Disposition: "report", BlockedURI: "inline", StatusCode: 200, LineNumber: 3,
+			ScriptSample: "alert(1)",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		want    []Report
+		wantErr bool
+	}{
+		{"batch", "[" + violation + "]", []Report{want}, false},
+		{"single object", violation, []Report{want}, false},
+		{"other types skipped", `[{"type":"deprecation","body":{"id":"x"}},` + violation + `]`, []Report{want}, false},
+		{"document url from the report", `[{"type":"csp-violation","url":"https://example.com/","body":{}}]`,
+			[]Report{{Type: ReportTypeCSPViolation, URL: "https://example.com/", Violation: ViolationReport{DocumentURI: "https://example.com/"}}}, false},
+		{"empty batch", `[]`, []Report{}, false},
+		{"invalid json", `[{"type":`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReports(strings.NewReader(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReports() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseReports() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
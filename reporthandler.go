@@ -0,0 +1,97 @@
+package cspheader
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+)
+
+// Content types used to deliver violation reports
+const (
+	ContentTypeCSPReport   = "application/csp-report"
+	ContentTypeReportsJSON = "application/reports+json"
+)
+
+// ReportHandlerOption configures ReportHandler
+type ReportHandlerOption func(*reportHandler)
+
+// WithMaxReportBytes sets the largest request body ReportHandler will read.  The default is MaxReportBytes.
+func WithMaxReportBytes(n int64) ReportHandlerOption {
+	return func(rh *reportHandler) {
+		if n > 0 {
+			rh.maxBytes = n
+		}
+	}
+}
+
+type reportHandler struct {
+	fn       func(ViolationReport)
+	maxBytes int64
+}
+
+// ReportHandler returns an http.Handler that receives violation reports sent via report-uri
+// (application/csp-report) or report-to (application/reports+json), calls fn once per CSP violation, and responds
+// 204 No Content.  Methods other than POST, unsupported content types, oversized bodies, and malformed JSON are
+// rejected with an appropriate 4xx status.
+//
+// The /_/csp-reports endpoint used by SecurityOptionsReactJS can be served with:
+//
+//	mux.Handle("/_/csp-reports", cspheader.ReportHandler(func(vr cspheader.ViolationReport) { ... }))
+func ReportHandler(fn func(ViolationReport), opts ...ReportHandlerOption) http.Handler {
+	rh := &reportHandler{fn: fn, maxBytes: MaxReportBytes}
+	for _, opt := range opts {
+		opt(rh)
+	}
+	return rh
+}
+
+func (rh *reportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, rh.maxBytes)
+	defer body.Close()
+
+	switch mediaType {
+	// some browsers have sent legacy reports as application/json
+	case ContentTypeCSPReport, "application/json":
+		report, err := parseViolationReport(body, rh.maxBytes)
+		if err != nil {
+			rh.parseError(w, err)
+			return
+		}
+		rh.fn(*report)
+	case ContentTypeReportsJSON:
+		reports, err := parseReports(body, rh.maxBytes)
+		if err != nil {
+			rh.parseError(w, err)
+			return
+		}
+		for _, report := range reports {
+			rh.fn(report.Violation)
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rh *reportHandler) parseError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, ErrReportTooLarge) || errors.As(err, &maxBytesErr) {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+}
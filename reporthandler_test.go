@@ -0,0 +1,57 @@
+package cspheader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReportHandler(t *testing.T) {
+	legacy := `{"csp-report":{"document-uri":"https://example.com/","effective-directive":"img-src","blocked-uri":"https://cdn.example.com/a.png"}}`
+	batch := `[{"type":"csp-violation","url":"https://example.com/","body":{"effectiveDirective":"script-src-elem","blockedURL":"inline"}},` +
+		`{"type":"csp-violation","url":"https://example.com/","body":{"effectiveDirective":"style-src-elem","blockedURL":"inline"}}]`
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		opts        []ReportHandlerOption
+		wantStatus  int
+		wantReports []string // effective directives
+	}{
+		{"legacy", http.MethodPost, ContentTypeCSPReport, legacy, nil, http.StatusNoContent, []string{"img-src"}},
+		{"legacy as json", http.MethodPost, "application/json; charset=utf-8", legacy, nil, http.StatusNoContent, []string{"img-src"}},
+		{"reporting api", http.MethodPost, ContentTypeReportsJSON, batch, nil, http.StatusNoContent,
+			[]string{"script-src-elem", "style-src-elem"}},
+		{"get", http.MethodGet, ContentTypeCSPReport, "", nil, http.StatusMethodNotAllowed, nil},
+		{"unsupported content type", http.MethodPost, "text/plain", legacy, nil, http.StatusUnsupportedMediaType, nil},
+		{"missing content type", http.MethodPost, "", legacy, nil, http.StatusUnsupportedMediaType, nil},
+		{"malformed", http.MethodPost, ContentTypeCSPReport, `{"csp-report":`, nil, http.StatusBadRequest, nil},
+		{"too large", http.MethodPost, ContentTypeCSPReport, legacy, []ReportHandlerOption{WithMaxReportBytes(16)},
+			http.StatusRequestEntityTooLarge, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			handler := ReportHandler(func(vr ViolationReport) {
+				got = append(got, vr.EffectiveDirective)
+			}, tt.opts...)
+
+			r := httptest.NewRequest(tt.method, "/_/csp-reports", strings.NewReader(tt.body))
+			if len(tt.contentType) > 0 {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantReports, ",") {
+				t.Errorf("reports = %v, want %v", got, tt.wantReports)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package cspheader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrReportToInvalid is returned when a raw Report-To value cannot be parsed as JSON
+	ErrReportToInvalid = errors.New("report-to is not valid json")
+	// ErrReportToGroupNotFound is returned when the CSP report-to directive names a group that is not configured
+	ErrReportToGroupNotFound = errors.New("report-to target not found")
+)
+
+// ReportToGroup is a Report-To endpoint group.  It is marshaled to the JSON the Report-To header expects.
+// https://www.w3.org/TR/reporting/#header
+type ReportToGroup struct {
+	// Group is the name referenced by the CSP report-to directive
+	Group string
+	// MaxAge is how long the browser should remember the group, serialized as whole seconds.  zero removes the group.
+	MaxAge            time.Duration
+	IncludeSubdomains bool
+	Endpoints         []ReportToEndpoint
+}
+
+// reportToGroupJSON is the wire form of ReportToGroup
+type reportToGroupJSON struct {
+	Group             string             `json:"group,omitempty"`
+	MaxAge            int64              `json:"max_age"`
+	IncludeSubdomains bool               `json:"include_subdomains,omitempty"`
+	Endpoints         []ReportToEndpoint `json:"endpoints"`
+}
+
+// MarshalJSON renders the group as Report-To JSON with max_age in seconds
+func (g ReportToGroup) MarshalJSON() ([]byte, error) {
+	err := validateMaxAge(g.MaxAge)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(reportToGroupJSON{
+		Group:             g.Group,
+		MaxAge:            int64(g.MaxAge / time.Second),
+		IncludeSubdomains: g.IncludeSubdomains,
+		Endpoints:         g.Endpoints,
+	})
+}
+
+// UnmarshalJSON reads Report-To JSON, converting max_age from seconds
+func (g *ReportToGroup) UnmarshalJSON(b []byte) error {
+	var wire reportToGroupJSON
+	err := json.Unmarshal(b, &wire)
+	if err != nil {
+		return err
+	}
+	*g = ReportToGroup{
+		Group:             wire.Group,
+		MaxAge:            time.Duration(wire.MaxAge) * time.Second,
+		IncludeSubdomains: wire.IncludeSubdomains,
+		Endpoints:         wire.Endpoints,
+	}
+	return nil
+}
+
+func validateMaxAge(maxAge time.Duration) error {
+	if maxAge < 0 {
+		return fmt.Errorf("report-to max age %s must not be negative", maxAge)
+	}
+	if maxAge%time.Second != 0 {
+		return fmt.Errorf("report-to max age %s must be a whole number of seconds", maxAge)
+	}
+	return nil
+}
+
+// ReportToEndpoint is a single endpoint in a Report-To group
+type ReportToEndpoint struct {
+	URL      string `json:"url"`
+	Priority int    `json:"priority,omitempty"`
+	Weight   int    `json:"weight,omitempty"`
+}
+
+func (g ReportToGroup) validate() error {
+	if len(g.Group) == 0 {
+		return errors.New("report-to group name is required")
+	}
+	err := validateMaxAge(g.MaxAge)
+	if err != nil {
+		return fmt.Errorf("report-to group %s: %w", g.Group, err)
+	}
+	if len(g.Endpoints) == 0 {
+		return fmt.Errorf("report-to group %s requires at least one endpoint", g.Group)
+	}
+	for _, e := range g.Endpoints {
+		if len(e.URL) == 0 {
+			return fmt.Errorf("report-to group %s has an endpoint without a url", g.Group)
+		}
+	}
+	return nil
+}
+
+// reportToHeader returns the Report-To header value: the raw ReportTo string if set, otherwise the typed Groups
+// marshaled to JSON.
+func (pol *Policy) reportToHeader() (string, error) {
+	if len(pol.ReportTo.ReportTo) > 0 || len(pol.ReportTo.Groups) == 0 {
+		return pol.ReportTo.ReportTo, nil
+	}
+
+	seen := make(map[string]bool, len(pol.ReportTo.Groups))
+	groups := make([]string, 0, len(pol.ReportTo.Groups))
+	for _, g := range pol.ReportTo.Groups {
+		err := g.validate()
+		if err != nil {
+			return "", err
+		}
+		if seen[g.Group] {
+			return "", fmt.Errorf("report-to group %s is configured more than once", g.Group)
+		}
+		seen[g.Group] = true
+
+		b, err := json.Marshal(g)
+		if err != nil {
+			return "", err
+		}
+		groups = append(groups, string(b))
+	}
+	return strings.Join(groups, ", "), nil
+}
+
+// hasReportToGroup checks whether the Report-To configuration defines the named group.  a raw ReportTo string is
+// parsed to find its group names.
+func (pol *Policy) hasReportToGroup(name string) (bool, error) {
+	groups := pol.ReportTo.Groups
+	if len(pol.ReportTo.ReportTo) > 0 {
+		var err error
+		groups, err = ParseReportTo(pol.ReportTo.ReportTo)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	for _, g := range groups {
+		if g.Group == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ParseReportTo parses a Report-To header value, which may be a single group object, a comma separated list of
+// group objects, or a JSON array of them.  A group without a name is given the implicit name "default".
+func ParseReportTo(header string) ([]ReportToGroup, error) {
+	header = strings.TrimSpace(header)
+	if !strings.HasPrefix(header, "[") {
+		header = "[" + header + "]"
+	}
+
+	var groups []ReportToGroup
+	err := json.Unmarshal([]byte(header), &groups)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrReportToInvalid, err)
+	}
+
+	for i := range groups {
+		if len(groups[i].Group) == 0 {
+			groups[i].Group = "default"
+		}
+	}
+	return groups, nil
+}
+
+// renderReportingEndpoints renders the Reporting-Endpoints header, a structured field dictionary of name="url"
+// members, in name order.
+// https://www.w3.org/TR/reporting-1/#header
+func renderReportingEndpoints(endpoints map[string]string) (string, error) {
+	if len(endpoints) == 0 {
+		return "", nil
+	}
+
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		err := validateEndpointName(name)
+		if err != nil {
+			return "", err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	members := make([]string, 0, len(names))
+	for _, name := range names {
+		url := endpoints[name]
+		if len(url) == 0 {
+			return "", fmt.Errorf("reporting endpoint %s requires a url", name)
+		}
+		for _, c := range url {
+			// sf-string permits printable ASCII only
+			if c < 0x20 || c > 0x7e {
+				return "", fmt.Errorf("reporting endpoint %s url contains a character that is not printable ascii", name)
+			}
+		}
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(url)
+		members = append(members, fmt.Sprintf(`%s="%s"`, name, escaped))
+	}
+
+	return strings.Join(members, ", "), nil
+}
+
+// validateEndpointName checks a Reporting-Endpoints name against the structured field key grammar:
+// a lowercase letter or "*" followed by lowercase letters, digits, "_", "-", ".", or "*".
+// https://www.rfc-editor.org/rfc/rfc8941#name-dictionaries
+func validateEndpointName(name string) error {
+	if len(name) == 0 {
+		return errors.New("reporting endpoint name is required")
+	}
+	for i, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z', c == '*':
+		case i > 0 && ('0' <= c && c <= '9' || c == '_' || c == '-' || c == '.'):
+		default:
+			return fmt.Errorf("reporting endpoint name %q must be lowercase letters, digits, _, -, ., or * and start with a letter or *", name)
+		}
+	}
+	return nil
+}
+
+// validateReportEndpoints checks every configured report endpoint: report-uri values, Report-To endpoints, and
+// Reporting-Endpoints urls.
+func (pol *Policy) validateReportEndpoints() error {
+	for _, v := range pol.CSP.ReportURI.Values {
+		err := validateReportEndpoint(v, pol.AllowInsecureReportEndpoints)
+		if err != nil {
+			return fmt.Errorf("report-uri: %w", err)
+		}
+	}
+
+	groups := pol.ReportTo.Groups
+	if len(pol.ReportTo.ReportTo) > 0 {
+		// a raw value that cannot be parsed is reported by the report-to group check, if it matters
+		groups, _ = ParseReportTo(pol.ReportTo.ReportTo)
+	}
+	for _, g := range groups {
+		for _, e := range g.Endpoints {
+			err := validateReportEndpoint(e.URL, pol.AllowInsecureReportEndpoints)
+			if err != nil {
+				return fmt.Errorf("report-to group %s: %w", g.Group, err)
+			}
+		}
+	}
+
+	for name, v := range pol.ReportingEndpoints {
+		err := validateReportEndpoint(v, pol.AllowInsecureReportEndpoints)
+		if err != nil {
+			return fmt.Errorf("reporting endpoint %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateReportEndpoint requires an absolute https url or a rooted path such as /_/csp-reports.  plain http is
+// permitted only if allowInsecure is set.
+func validateReportEndpoint(endpoint string, allowInsecure bool) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid report endpoint %q: %w", endpoint, err)
+	}
+
+	switch {
+	case u.Scheme == "https" && len(u.Host) > 0:
+		return nil
+	case u.Scheme == "http" && len(u.Host) > 0:
+		if allowInsecure {
+			return nil
+		}
+		return fmt.Errorf("report endpoint %q uses plain http: reports contain page urls and should be sent over https", endpoint)
+	case len(u.Scheme) == 0 && len(u.Host) == 0 && strings.HasPrefix(u.Path, "/"):
+		return nil
+	}
+
+	return fmt.Errorf("invalid report endpoint %q: must be an absolute https url or a path beginning with /", endpoint)
+}
@@ -0,0 +1,272 @@
+package cspheader
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportToGroupRoundTrip(t *testing.T) {
+	group := ReportToGroup{
+		Group:             "csp-endpoint",
+		MaxAge:            7 * 24 * time.Hour,
+		IncludeSubdomains: true,
+		Endpoints: []ReportToEndpoint{
+			{URL: "https://a.example.com/reports", Priority: 1, Weight: 2},
+			{URL: "https://b.example.com/reports"},
+		},
+	}
+
+	b, err := json.Marshal(group)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `{"group":"csp-endpoint","max_age":604800,"include_subdomains":true,"endpoints":[` +
+		`{"url":"https://a.example.com/reports","priority":1,"weight":2},{"url":"https://b.example.com/reports"}]}`
+	if string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+
+	var got ReportToGroup
+	err = json.Unmarshal(b, &got)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, group) {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, group)
+	}
+}
+
+func TestReportToGroupValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   ReportToGroup
+		wantErr bool
+	}{
+		{"valid", ReportToGroup{Group: "csp-endpoint", Endpoints: []ReportToEndpoint{{URL: "https://example.com/r"}}}, false},
+		{"empty group name", ReportToGroup{Endpoints: []ReportToEndpoint{{URL: "https://example.com/r"}}}, true},
+		{"no endpoints", ReportToGroup{Group: "csp-endpoint"}, true},
+		{"endpoint without url", ReportToGroup{Group: "csp-endpoint", Endpoints: []ReportToEndpoint{{Priority: 1}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := reportingPolicy()
+			pol.ReportTo.Groups = []ReportToGroup{tt.group}
+			pol.CSP.ReportTo = UnquotedOption{Value: tt.group.Group}
+			_, err := pol.Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var reportToErr *ReportToError
+			if tt.wantErr && !errors.As(err, &reportToErr) {
+				t.Errorf("Load() error = %T, want *ReportToError", err)
+			}
+		})
+	}
+}
+
+func TestReportToRawOverridesGroups(t *testing.T) {
+	raw := `{"group":"csp-endpoint","max_age":60,"endpoints":[{"url":"https://raw.example.com/reports"}]}`
+	pol := reportingPolicy()
+	pol.ReportTo.ReportTo = raw
+	headers, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := headers[HeaderReportTo]; got != raw {
+		t.Errorf("Load()[%s] = %s, want %s", HeaderReportTo, got, raw)
+	}
+}
+
+// reportingPolicy is the static site preset reporting to the csp-endpoint Report-To group
+func reportingPolicy() Policy {
+	pol := SecurityOptionsStaticSite()
+	pol.CSP.ReportTo = UnquotedOption{Value: "csp-endpoint"}
+	pol.ReportTo.Groups = []ReportToGroup{{
+		Group:     "csp-endpoint",
+		MaxAge:    24 * time.Hour,
+		Endpoints: []ReportToEndpoint{{URL: "https://example.com/csp-reports"}},
+	}}
+	return pol
+}
+
+func TestReportingEndpoints(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints map[string]string
+		want      string
+		wantErr   bool
+	}{
+		{"none", nil, "", false},
+		{"sorted by name", map[string]string{"nel": "https://example.com/nel", "csp": "https://example.com/csp"},
+			`csp="https://example.com/csp", nel="https://example.com/nel"`, false},
+		{"escaped", map[string]string{"csp": `https://example.com/csp?q="a"`}, `csp="https://example.com/csp?q=\"a\""`, false},
+		{"uppercase name", map[string]string{"CSP": "https://example.com/csp"}, "", true},
+		{"leading digit", map[string]string{"1csp": "https://example.com/csp"}, "", true},
+		{"empty url", map[string]string{"csp": ""}, "", true},
+		{"non-ascii url", map[string]string{"csp": "https://exämple.com/csp"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderReportingEndpoints(tt.endpoints)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderReportingEndpoints() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderReportingEndpoints() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportingEndpointsSatisfyReportTo(t *testing.T) {
+	pol := reportingPolicy()
+	pol.ReportTo.Groups = nil
+	pol.ReportingEndpoints = map[string]string{"csp-endpoint": "https://example.com/csp-reports"}
+	headers, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := `csp-endpoint="https://example.com/csp-reports"`; headers[HeaderReportingEndpoints] != want {
+		t.Errorf("Load()[%s] = %s, want %s", HeaderReportingEndpoints, headers[HeaderReportingEndpoints], want)
+	}
+	if _, ok := headers[HeaderReportTo]; ok {
+		t.Errorf("Load() = %v, want no %s", headers, HeaderReportTo)
+	}
+
+	pol.ReportingEndpoints = map[string]string{"other": "https://example.com/csp-reports"}
+	_, err = pol.Load()
+	if err == nil {
+		t.Error("Load() error = nil, want report-to without a matching endpoint rejected")
+	}
+}
+
+func TestMultipleReportToGroups(t *testing.T) {
+	pol := reportingPolicy()
+	pol.ReportTo.Groups = append(pol.ReportTo.Groups, ReportToGroup{
+		Group:     "nel",
+		MaxAge:    time.Hour,
+		Endpoints: []ReportToEndpoint{{URL: "https://example.com/nel-reports"}},
+	})
+	headers, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := `{"group":"csp-endpoint","max_age":86400,"endpoints":[{"url":"https://example.com/csp-reports"}]}, ` +
+		`{"group":"nel","max_age":3600,"endpoints":[{"url":"https://example.com/nel-reports"}]}`
+	if got := headers[HeaderReportTo]; got != want {
+		t.Errorf("Load()[%s] = %s, want %s", HeaderReportTo, got, want)
+	}
+
+	groups, err := ParseReportTo(headers[HeaderReportTo])
+	if err != nil {
+		t.Fatalf("ParseReportTo() error = %v", err)
+	}
+	if !reflect.DeepEqual(groups, pol.ReportTo.Groups) {
+		t.Errorf("ParseReportTo() = %+v, want %+v", groups, pol.ReportTo.Groups)
+	}
+
+	pol.ReportTo.Groups = append(pol.ReportTo.Groups, pol.ReportTo.Groups[0])
+	_, err = pol.Load()
+	if err == nil {
+		t.Error("Load() error = nil, want a duplicate group rejected")
+	}
+}
+
+func TestReportToGroupMatching(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   string
+		raw     string
+		wantErr error
+	}{
+		{"exact", "csp-endpoint", `{"group":"csp-endpoint","max_age":60,"endpoints":[{"url":"https://example.com/r"}]}`, nil},
+		{"implicit default", "default", `{"max_age":60,"endpoints":[{"url":"https://example.com/r"}]}`, nil},
+		{"array", "nel", `[{"group":"csp","max_age":60,"endpoints":[{"url":"https://example.com/r"}]},` +
+			`{"group":"nel","max_age":60,"endpoints":[{"url":"https://example.com/r"}]}]`, nil},
+		{"substring of a group", "csp", `{"group":"csp-endpoint","max_age":60,"endpoints":[{"url":"https://example.com/r"}]}`,
+			ErrReportToGroupNotFound},
+		{"endpoint url mentions the group", "reports", `{"group":"csp","max_age":60,"endpoints":[{"url":"https://example.com/reports"}]}`,
+			ErrReportToGroupNotFound},
+		{"invalid json", "csp", `{"group":"csp"`, ErrReportToInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := reportingPolicy()
+			pol.CSP.ReportTo = UnquotedOption{Value: tt.group}
+			pol.ReportTo.ReportTo = tt.raw
+			_, err := pol.Load()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReportToMaxAge(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxAge  time.Duration
+		want    string
+		wantErr bool
+	}{
+		{"zero removes the group", 0, `"max_age":0`, false},
+		{"one week", 7 * 24 * time.Hour, `"max_age":604800`, false},
+		{"negative", -time.Second, "", true},
+		{"fractional second", 1500 * time.Millisecond, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := reportingPolicy()
+			pol.ReportTo.Groups[0].MaxAge = tt.maxAge
+			headers, err := pol.Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := headers[HeaderReportTo]; !strings.Contains(got, tt.want) {
+				t.Errorf("Load()[%s] = %s, want %s", HeaderReportTo, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportEndpointValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		endpoint      string
+		allowInsecure bool
+		wantErr       bool
+	}{
+		{"https", "https://example.com/csp-reports", false, false},
+		{"rooted path", "/_/csp-reports", false, false},
+		{"http", "http://example.com/csp-reports", false, true},
+		{"http allowed", "http://localhost:8080/csp-reports", true, false},
+		{"relative path", "csp-reports", false, true},
+		{"no host", "https:///csp-reports", false, true},
+		{"other scheme", "ftp://example.com/csp-reports", true, true},
+		{"unparseable", "https://example.com/%zz", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, configure := range []func(*Policy){
+				func(pol *Policy) { pol.CSP.ReportURI = UnquotedOptions{Values: []string{tt.endpoint}} },
+				func(pol *Policy) { pol.ReportTo.Groups[0].Endpoints[0].URL = tt.endpoint },
+				func(pol *Policy) {
+					pol.ReportTo.Groups = nil
+					pol.ReportingEndpoints = map[string]string{"csp-endpoint": tt.endpoint}
+				},
+			} {
+				pol := reportingPolicy()
+				pol.AllowInsecureReportEndpoints = tt.allowInsecure
+				configure(&pol)
+				_, err := pol.Load()
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
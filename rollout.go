@@ -0,0 +1,95 @@
+package cspheader
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+)
+
+// EnforcementRollout splits traffic between enforcing a policy and delivering the same directives as
+// Content-Security-Policy-Report-Only, so that a tightened policy can be ramped up gradually.
+// The fraction can be changed at runtime with SetFraction without restarting.
+type EnforcementRollout struct {
+	// bucketKey returns a stable key for the request, such as a session cookie, so a client stays in the same
+	// bucket across requests.  requests without a key are bucketed randomly.
+	bucketKey func(*http.Request) string
+	// fraction holds the float64 bits of the enforced fraction
+	fraction atomic.Uint64
+}
+
+// NewEnforcementRollout returns an EnforcementRollout enforcing the policy for fraction (0 to 1) of requests.
+// bucketKey may be nil, in which case every request is bucketed randomly.
+func NewEnforcementRollout(fraction float64, bucketKey func(*http.Request) string) *EnforcementRollout {
+	er := &EnforcementRollout{bucketKey: bucketKey}
+	er.SetFraction(fraction)
+	return er
+}
+
+// CookieBucketKey returns a bucket key function that reads the named cookie, e.g. a session cookie
+func CookieBucketKey(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
+
+// SetFraction changes the fraction of requests that are enforced.  values are clamped to between 0 and 1.
+// It is safe to call while requests are being served.
+func (er *EnforcementRollout) SetFraction(fraction float64) {
+	if math.IsNaN(fraction) || fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	er.fraction.Store(math.Float64bits(fraction))
+}
+
+// Fraction returns the fraction of requests that are enforced
+func (er *EnforcementRollout) Fraction() float64 {
+	return math.Float64frombits(er.fraction.Load())
+}
+
+// enforce reports whether the request falls in the enforced bucket
+func (er *EnforcementRollout) enforce(r *http.Request) bool {
+	fraction := er.Fraction()
+
+	var key string
+	if er.bucketKey != nil {
+		key = er.bucketKey(r)
+	}
+	if len(key) == 0 {
+		// rollout sampling, not a security decision
+		return rand.Float64() < fraction
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	// the top 53 bits make an evenly distributed float in [0, 1)
+	bucket := float64(mix64(h.Sum64())>>11) / (1 << 53)
+	return bucket < fraction
+}
+
+// mix64 is the murmur3 finalizer.  FNV's high bits barely change between keys that differ only in their last
+// bytes, such as sequential session IDs, so they are mixed before the bucket is taken from them.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// WithEnforcementFraction delivers the policy as Content-Security-Policy for the rollout's fraction of requests and
+// as Content-Security-Policy-Report-Only for the rest, with the same directives either way.
+func WithEnforcementFraction(rollout *EnforcementRollout) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.rollout = rollout
+	}
+}
@@ -0,0 +1,111 @@
+package cspheader
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnforcementRolloutBuckets(t *testing.T) {
+	er := NewEnforcementRollout(0.3, CookieBucketKey("session"))
+
+	const sessions = 2000
+	enforced := 0
+	for i := 0; i < sessions; i++ {
+		r := rolloutRequest(fmt.Sprintf("session-%d", i))
+		first := er.enforce(r)
+		for j := 0; j < 3; j++ {
+			if er.enforce(r) != first {
+				t.Fatalf("session-%d changed bucket between requests", i)
+			}
+		}
+		if first {
+			enforced++
+		}
+	}
+	if got := float64(enforced) / sessions; got < 0.25 || got > 0.35 {
+		t.Errorf("enforced %v of sessions, want about 0.3", got)
+	}
+
+	// raising the fraction only moves sessions into the enforced bucket
+	wasEnforced := map[int]bool{}
+	for i := 0; i < sessions; i++ {
+		wasEnforced[i] = er.enforce(rolloutRequest(fmt.Sprintf("session-%d", i)))
+	}
+	er.SetFraction(0.6)
+	for i := 0; i < sessions; i++ {
+		if wasEnforced[i] && !er.enforce(rolloutRequest(fmt.Sprintf("session-%d", i))) {
+			t.Fatalf("session-%d left the enforced bucket when the fraction was raised", i)
+		}
+	}
+}
+
+func TestEnforcementRolloutExtremes(t *testing.T) {
+	for _, fraction := range []float64{0, 1} {
+		er := NewEnforcementRollout(fraction, CookieBucketKey("session"))
+		for i := 0; i < 100; i++ {
+			for _, r := range []*http.Request{rolloutRequest(""), rolloutRequest(fmt.Sprint(i))} {
+				if got := er.enforce(r); got != (fraction == 1) {
+					t.Fatalf("fraction %v: enforce() = %v", fraction, got)
+				}
+			}
+		}
+	}
+}
+
+func TestEnforcementRolloutFraction(t *testing.T) {
+	tests := []struct {
+		fraction float64
+		want     float64
+	}{
+		{0.25, 0.25},
+		{-1, 0},
+		{2, 1},
+		{math.NaN(), 0},
+	}
+	for _, tt := range tests {
+		er := NewEnforcementRollout(tt.fraction, nil)
+		if got := er.Fraction(); got != tt.want {
+			t.Errorf("NewEnforcementRollout(%v).Fraction() = %v, want %v", tt.fraction, got, tt.want)
+		}
+	}
+}
+
+func TestWithEnforcementFraction(t *testing.T) {
+	pol := SecurityOptionsStaticSite()
+	er := NewEnforcementRollout(0, CookieBucketKey("session"))
+	mw, err := Middleware(pol, WithEnforcementFraction(er))
+	if err != nil {
+		t.Fatalf("Middleware() error = %v", err)
+	}
+	want := renderCSP(t, pol)
+
+	for _, tt := range []struct {
+		fraction   float64
+		header     string
+		notPresent string
+	}{
+		{0, HeaderContentSecurityPolicyReportOnly, HeaderContentSecurityPolicy},
+		{1, HeaderContentSecurityPolicy, HeaderContentSecurityPolicyReportOnly},
+	} {
+		er.SetFraction(tt.fraction)
+		rec := serve(mw, func(w http.ResponseWriter, r *http.Request) {}, rolloutRequest("abc"))
+		if got := rec.Header().Get(tt.header); got != want {
+			t.Errorf("fraction %v: %s = %q, want %q", tt.fraction, tt.header, got, want)
+		}
+		if got := rec.Header().Get(tt.notPresent); len(got) > 0 {
+			t.Errorf("fraction %v: %s = %q, want it absent", tt.fraction, tt.notPresent, got)
+		}
+	}
+}
+
+// rolloutRequest returns a request carrying the session cookie
+func rolloutRequest(session string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if len(session) > 0 {
+		r.AddCookie(&http.Cookie{Name: "session", Value: session})
+	}
+	return r
+}
@@ -0,0 +1,136 @@
+package cspheader
+
+import "errors"
+
+// SourceOption configures the CSPSourceOptions built by NewSourceOptions.  Invalid input is recorded rather than
+// panicking, and is returned by CSPSourceOptions.Err and by Load.
+type SourceOption func(*CSPSourceOptions)
+
+// NewSourceOptions builds a directive's options from opts, as an alternative to a struct literal:
+//
+//	pol.CSP.ScriptSrc = cspheader.NewSourceOptions(cspheader.SourceWithSelf(), cspheader.SourceWithHosts("cdn.example.com"))
+//
+// Options that add a source set Allow.  With no options, the directive is 'none'.
+func NewSourceOptions(opts ...SourceOption) CSPSourceOptions {
+	cso := CSPSourceOptions{}
+	for _, opt := range opts {
+		opt(&cso)
+	}
+	return cso
+}
+
+// Err returns the errors recorded by the SourceOptions the options were built with, if any
+func (cso CSPSourceOptions) Err() error {
+	return cso.err
+}
+
+func (cso *CSPSourceOptions) addErr(err error) {
+	cso.err = errors.Join(cso.err, err)
+}
+
+// SourceWithSelf adds 'self'
+func SourceWithSelf() SourceOption {
+	return func(cso *CSPSourceOptions) {
+		cso.Allow = true
+		cso.AllowSelf = true
+	}
+}
+
+// SourceWithHosts adds host or scheme sources, skipping duplicates.  Each is validated as by AddValues.
+func SourceWithHosts(hosts ...string) SourceOption {
+	return func(cso *CSPSourceOptions) {
+		err := cso.AddValues(hosts...)
+		if err != nil {
+			cso.addErr(err)
+		}
+	}
+}
+
+// SourceWithUnsafeEval adds 'unsafe-eval'
+func SourceWithUnsafeEval() SourceOption {
+	return func(cso *CSPSourceOptions) {
+		cso.Allow = true
+		cso.UnsafeEval = true
+	}
+}
+
+// SourceWithWasmUnsafeEval adds 'wasm-unsafe-eval'
+func SourceWithWasmUnsafeEval() SourceOption {
+	return func(cso *CSPSourceOptions) {
+		cso.Allow = true
+		cso.WasmUnsafeEval = true
+	}
+}
+
+// SourceWithUnsafeInline adds 'unsafe-inline'
+func SourceWithUnsafeInline() SourceOption {
+	return func(cso *CSPSourceOptions) {
+		cso.Allow = true
+		cso.UnsafeInline = true
+	}
+}
+
+// SourceWithUnsafeHashes adds 'unsafe-hashes'
+func SourceWithUnsafeHashes() SourceOption {
+	return func(cso *CSPSourceOptions) {
+		cso.Allow = true
+		cso.UnsafeHashes = true
+	}
+}
+
+// SourceWithStrictDynamic adds 'strict-dynamic'
+func SourceWithStrictDynamic() SourceOption {
+	return func(cso *CSPSourceOptions) {
+		cso.Allow = true
+		cso.StrictDynamic = true
+	}
+}
+
+// SourceWithReportSample adds 'report-sample'
+func SourceWithReportSample() SourceOption {
+	return func(cso *CSPSourceOptions) {
+		cso.Allow = true
+		cso.ReportSample = true
+	}
+}
+
+// SourceWithNonce adds a nonce, given as its raw base64 value or as NoncePlaceholder.  The first nonce is set as
+// NonceBase64Value and any others are added to Nonces.
+func SourceWithNonce(nonce string) SourceOption {
+	return func(cso *CSPSourceOptions) {
+		err := validateNonce("nonce", nonce)
+		if err != nil {
+			cso.addErr(err)
+			return
+		}
+		cso.Allow = true
+		if len(cso.NonceBase64Value) == 0 {
+			cso.NonceBase64Value = nonce
+			return
+		}
+		cso.Nonces = append(cso.Nonces, nonce)
+	}
+}
+
+// SourceWithHash adds a hash source
+func SourceWithHash(alg HashAlgorithm, b64 string) SourceOption {
+	return func(cso *CSPSourceOptions) {
+		h := Hash{Algorithm: alg, Base64: b64}
+		err := h.validate()
+		if err != nil {
+			cso.addErr(err)
+			return
+		}
+		cso.Allow = true
+		if !containsHash(cso.Hashes, h) {
+			cso.Hashes = append(cso.Hashes, h)
+		}
+	}
+}
+
+// SourceDeny makes the directive 'none', discarding the sources added by the options before it
+func SourceDeny() SourceOption {
+	return func(cso *CSPSourceOptions) {
+		*cso = CSPSourceOptions{err: cso.err}
+	}
+}
@@ -0,0 +1,93 @@
+package cspheader
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNewSourceOptions(t *testing.T) {
+	sha := Hash{Algorithm: HashSHA256, Base64: emptySHA256}
+	tests := []struct {
+		name string
+		opts []SourceOption
+		want CSPSourceOptions
+	}{
+		{"none", nil, CSPSourceOptions{}},
+		{"self", []SourceOption{SourceWithSelf()}, CSPSourceOptions{Allow: true, AllowSelf: true}},
+		{
+			name: "hosts",
+			opts: []SourceOption{SourceWithHosts("https://a.example.com"), SourceWithHosts("https://a.example.com", "data:")},
+			want: CSPSourceOptions{Allow: true, Values: []string{"https://a.example.com", "data:"}},
+		},
+		{
+			name: "keywords",
+			opts: []SourceOption{SourceWithUnsafeEval(), SourceWithWasmUnsafeEval(), SourceWithUnsafeInline(),
+				SourceWithUnsafeHashes(), SourceWithStrictDynamic(), SourceWithReportSample()},
+			want: CSPSourceOptions{Allow: true, UnsafeEval: true, WasmUnsafeEval: true, UnsafeInline: true,
+				UnsafeHashes: true, StrictDynamic: true, ReportSample: true},
+		},
+		{
+			name: "nonces",
+			opts: []SourceOption{SourceWithNonce("YWJj"), SourceWithNonce(NoncePlaceholder)},
+			want: CSPSourceOptions{Allow: true, NonceBase64Value: "YWJj", Nonces: []string{NoncePlaceholder}},
+		},
+		{
+			name: "hashes",
+			opts: []SourceOption{SourceWithHash(HashSHA256, emptySHA256), SourceWithHash(HashSHA256, emptySHA256)},
+			want: CSPSourceOptions{Allow: true, Hashes: []Hash{sha}},
+		},
+		{
+			name: "deny discards what came before",
+			opts: []SourceOption{SourceWithSelf(), SourceWithHosts("https://a.example.com"), SourceDeny()},
+			want: CSPSourceOptions{},
+		},
+		{
+			name: "sources after deny",
+			opts: []SourceOption{SourceDeny(), SourceWithSelf()},
+			want: CSPSourceOptions{Allow: true, AllowSelf: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewSourceOptions(tt.opts...)
+			if got.Err() != nil {
+				t.Fatalf("Err() = %v", got.Err())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewSourceOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSourceOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []SourceOption
+		wantErr error // nil for errors without a sentinel
+	}{
+		{"invalid host", []SourceOption{SourceWithHosts("https://a.example.com;")}, ErrInvalidSourceValue},
+		{"invalid nonce", []SourceOption{SourceWithNonce("abc; def")}, ErrInvalidNonce},
+		{"invalid hash algorithm", []SourceOption{SourceWithHash("md5", emptySHA256)}, nil},
+		{"invalid hash value", []SourceOption{SourceWithHash(HashSHA256, "not base64!")}, nil},
+		{"kept through deny", []SourceOption{SourceWithNonce("abc; def"), SourceDeny()}, ErrInvalidNonce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cso := NewSourceOptions(tt.opts...)
+			if cso.Err() == nil {
+				t.Fatal("Err() = nil, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(cso.Err(), tt.wantErr) {
+				t.Errorf("Err() = %v, want %v", cso.Err(), tt.wantErr)
+			}
+
+			pol := SecurityOptionsStaticSite()
+			pol.CSP.ScriptSrc = cso
+			if _, err := pol.Load(); err == nil {
+				t.Errorf("Load() error = nil, want the recorded error")
+			}
+		})
+	}
+}
@@ -1,5 +1,13 @@
 package cspheader
 
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"text/template"
+	"unicode"
+)
+
 // TemplateTextSourceOption is the default parsing of CSP source options.  Note the intentional whitespace and single quotes.
 const TemplateTextSourceOption = "" +
 	"{{ if not .Allow }}'none'{{ else }}" +
@@ -9,15 +17,19 @@ const TemplateTextSourceOption = "" +
 	"{{ if .WasmUnsafeEval }} 'wasm-unsafe-eval'{{ end }}" +
 	"{{ if .UnsafeHashes }} 'unsafe-hashes'{{ end }}" +
 	"{{ if .UnsafeInline }} 'unsafe-inline'{{ end }}" +
-	"{{ if gt (len .NonceBase64Value) 0 }}{{ .NonceBase64Value}}{{ end }}" +
-	"{{ if gt (len .HashAlgorithmBase64Value) 0 }}{{ .HashAlgorithmBase64Value}}{{ end }}" +
+	"{{ if gt (len .NonceBase64Value) 0 }} 'nonce-{{ .NonceBase64Value }}'{{ end }}" +
+	"{{ range $v := .Nonces }} 'nonce-{{$v}}'{{ end }}" +
+	"{{ if gt (len .HashAlgorithmBase64Value) 0 }} '{{ .HashAlgorithmBase64Value }}'{{ end }}" +
+	"{{ range $v := .Hashes }} '{{$v}}'{{ end }}" +
 	"{{ if .StrictDynamic }} 'strict-dynamic'{{ end }}" +
 	"{{ if .ReportSample }} 'report-sample'{{ end }}" +
 	"{{ end }}" // if not .Allow
 
-// TemplateTextSandbox is the default parsing of Sandbox options.  Note the intentional whitespace and no single quotes.
+// TemplateTextSandbox is the default parsing of Sandbox options.  Note the intentional whitespace and no single quotes;
+// the leading space is trimmed.
 const TemplateTextSandbox = "" +
-	"{{ if .AllowDownloads }}allow-downloads{{ end }}" +
+	"{{ if .AllowDownloads }} allow-downloads{{ end }}" +
+	"{{ if .AllowDownloadsWithoutUserActivation }} allow-downloads-without-user-activation{{ end }}" +
 	"{{ if .AllowForms }} allow-forms{{ end }}" +
 	"{{ if .AllowModals }} allow-modals{{ end }}" +
 	"{{ if .AllowOrientationLock }} allow-orientation-lock{{ end }}" +
@@ -27,6 +39,7 @@ const TemplateTextSandbox = "" +
 	"{{ if .AllowPresentation }} allow-presentation{{ end }}" +
 	"{{ if .AllowSameOrigin }} allow-same-origin{{ end }}" +
 	"{{ if .AllowScripts }} allow-scripts{{ end }}" +
+	"{{ if .AllowStorageAccessByUserActivation }} allow-storage-access-by-user-activation{{ end }}" +
 	"{{ if .AllowTopNavigation }} allow-top-navigation{{ end }}" +
 	"{{ if .AllowTopNavigationByUserActivation }} allow-top-navigation-by-user-activation{{ end }}" +
 	"{{ if .AllowTopNavigationToCustomProtocols }} allow-top-navigation-to-custom-protocols{{ end }}"
@@ -41,3 +54,76 @@ const TemplateTextFrameAncestorOptions = "" +
 const TemplateTextUnquotedOptions = "{{ range $v := .Values }}{{$v}} {{ end }}"
 
 const TemplateTextUnquotedOption = "{{ .Value }}"
+
+// templateBuiltins are the functions predefined by text/template, which a Policy's TemplateFuncs may not replace
+var templateBuiltins = map[string]bool{
+	"and": true, "call": true, "html": true, "index": true, "slice": true, "js": true, "len": true, "not": true,
+	"or": true, "print": true, "printf": true, "println": true, "urlquery": true,
+	"eq": true, "ge": true, "gt": true, "le": true, "lt": true, "ne": true,
+}
+
+// validateTemplateFuncs checks funcs as template.Funcs would, returning an error where it would panic, and
+// rejects names that would shadow a builtin.
+func validateTemplateFuncs(funcs template.FuncMap) error {
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	for name, fn := range funcs {
+		if templateBuiltins[name] {
+			return fmt.Errorf("template func %s: shadows the text/template builtin of the same name", name)
+		}
+		if !isTemplateIdentifier(name) {
+			return fmt.Errorf("template func %q: not a valid identifier", name)
+		}
+		t := reflect.TypeOf(fn)
+		if t == nil || t.Kind() != reflect.Func {
+			return fmt.Errorf("template func %s: not a function", name)
+		}
+		if t.NumOut() != 1 && (t.NumOut() != 2 || t.Out(1) != errorType) {
+			return fmt.Errorf("template func %s: must return a value, or a value and an error", name)
+		}
+	}
+	return nil
+}
+
+func isTemplateIdentifier(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultTemplates are the parsed default template texts, keyed by template name and text.  they are parsed once and
+// shared by every Policy using them, as a parsed template is safe for concurrent execution.
+var (
+	defaultTemplatesOnce sync.Once
+	defaultTemplates     map[[2]string]*template.Template
+)
+
+// defaultTemplate returns the shared parse of a default template text, or nil if text is not the default for name
+func defaultTemplate(name, text string) *template.Template {
+	defaultTemplatesOnce.Do(func() {
+		defaultTemplates = map[[2]string]*template.Template{}
+		for _, t := range [][2]string{
+			{"SourceOption", TemplateTextSourceOption},
+			{"Sandbox", TemplateTextSandbox},
+			{"FrameAncestorOptions", TemplateTextFrameAncestorOptions},
+			{"UnquotedOptions", TemplateTextUnquotedOptions},
+			{"UnquotedOption", TemplateTextUnquotedOption},
+		} {
+			defaultTemplates[t] = template.Must(template.New(t[0]).Parse(t[1]))
+		}
+	})
+	return defaultTemplates[[2]string{name, text}]
+}
+
+// parseTemplate parses text as the template name, reusing the shared parse of a default template text
+func parseTemplate(name, text string, funcs template.FuncMap) (*template.Template, error) {
+	if tmpl := defaultTemplate(name, text); tmpl != nil {
+		return tmpl, nil
+	}
+	return template.New(name).Funcs(funcs).Parse(text)
+}
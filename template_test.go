@@ -0,0 +1,174 @@
+package cspheader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTemplateFuncsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		funcs template.FuncMap
+		want  string
+	}{
+		{"shadows a builtin", template.FuncMap{"printf": fmt.Sprintf}, "shadows the text/template builtin"},
+		{"not an identifier", template.FuncMap{"to-upper": strings.ToUpper}, "not a valid identifier"},
+		{"empty name", template.FuncMap{"": strings.ToUpper}, "not a valid identifier"},
+		{"not a function", template.FuncMap{"upper": "UPPER"}, "not a function"},
+		{"nil", template.FuncMap{"upper": nil}, "not a function"},
+		{"no result", template.FuncMap{"upper": func(string) {}}, "must return a value"},
+		{"second result not an error", template.FuncMap{"upper": func(s string) (string, bool) { return s, true }}, "must return a value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsReactJS()
+			pol.TemplateFuncs = tt.funcs
+			_, err := pol.Load()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// a func returning a value and an error is accepted, and its error fails Load
+	pol := SecurityOptionsReactJS()
+	pol.TemplateFuncs = template.FuncMap{"fail": func(string) (string, error) { return "", errors.New("no upper") }}
+	pol.UnquotedOptionTextTemplateText = "{{ fail .Value }}"
+	if _, err := pol.Load(); err == nil || !strings.Contains(err.Error(), "no upper") {
+		t.Errorf("Load() error = %v, want the template func's error", err)
+	}
+}
+
+// BenchmarkLoadCustomTemplates loads the same policy with custom template texts, which are parsed on every Load
+func BenchmarkLoadCustomTemplates(b *testing.B) {
+	pol := SecurityOptionsReactJS()
+	customTemplateTexts(&pol)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := pol.Load()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoadDefaultTemplates loads a policy using the default templates, which are parsed once and shared
+func BenchmarkLoadDefaultTemplates(b *testing.B) {
+	pol := SecurityOptionsReactJS()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := pol.Load()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCustomTemplates(t *testing.T) {
+	base := SecurityOptionsReactJS()
+	want, err := base.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	pol := SecurityOptionsReactJS()
+	customTemplateTexts(&pol)
+	got, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() with custom templates error = %v", err)
+	}
+	if got[HeaderContentSecurityPolicy] != want[HeaderContentSecurityPolicy] {
+		t.Errorf("custom templates render %q, want %q", got[HeaderContentSecurityPolicy], want[HeaderContentSecurityPolicy])
+	}
+	if pol.SourceOptionTemplate == defaultTemplate("SourceOption", TemplateTextSourceOption) {
+		t.Errorf("a custom template text was given the shared default parse")
+	}
+}
+
+func TestDefaultTemplatesShared(t *testing.T) {
+	a, b := SecurityOptionsReactJS(), SecurityOptionsStaticSite()
+	for _, pol := range []*Policy{&a, &b} {
+		_, err := pol.Load()
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+	}
+
+	for name, pair := range map[string][2]*template.Template{
+		"SourceOption":         {a.SourceOptionTemplate, b.SourceOptionTemplate},
+		"Sandbox":              {a.SandboxOptionTemplate, b.SandboxOptionTemplate},
+		"FrameAncestorOptions": {a.FrameAncestorOptionsTemplate, b.FrameAncestorOptionsTemplate},
+		"UnquotedOptions":      {a.UnquotedOptionsTemplate, b.UnquotedOptionsTemplate},
+		"UnquotedOption":       {a.UnquotedOptionTemplate, b.UnquotedOptionTemplate},
+	} {
+		if pair[0] == nil || pair[0] != pair[1] {
+			t.Errorf("%s: policies with the default text have templates %p and %p, want one shared parse", name, pair[0], pair[1])
+		}
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*Policy)
+		want  string
+	}{
+		{
+			name:  "unclosed action",
+			setup: func(pol *Policy) { pol.SourceOptionTemplateText = "{{ if .Allow }}" },
+			want:  "unexpected EOF",
+		},
+		{
+			name:  "unknown field",
+			setup: func(pol *Policy) { pol.UnquotedOptionTextTemplateText = "{{ .Missing }}" },
+			want:  "can't evaluate field Missing",
+		},
+		{
+			name:  "builtin shadowed",
+			setup: func(pol *Policy) { pol.TemplateFuncs = template.FuncMap{"len": func(string) int { return 0 }} },
+			want:  "shadows the text/template builtin",
+		},
+		{
+			name:  "not a function",
+			setup: func(pol *Policy) { pol.TemplateFuncs = template.FuncMap{"upper": "upper"} },
+			want:  "not a function",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsReactJS()
+			tt.setup(&pol)
+			_, err := pol.Load()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	pol := SecurityOptionsReactJS()
+	pol.TemplateFuncs = template.FuncMap{"upper": strings.ToUpper}
+	pol.UnquotedOptionTextTemplateText = "{{ upper .Value }}"
+	headers, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !strings.Contains(headers[HeaderContentSecurityPolicy], "report-to DEFAULT;") {
+		t.Errorf("Load() = %q, want report-to rendered by the custom template", headers[HeaderContentSecurityPolicy])
+	}
+}
+
+// customTemplateTexts sets each template text to a copy of the default that differs only by a comment, so that
+// it renders the same but is parsed by the Policy
+func customTemplateTexts(pol *Policy) {
+	const comment = "{{/* custom */}}"
+	pol.SourceOptionTemplateText = TemplateTextSourceOption + comment
+	pol.SandboxOptionTemplateText = TemplateTextSandbox + comment
+	pol.FrameAncestorOptionsTemplateText = TemplateTextFrameAncestorOptions + comment
+	pol.UnquotedOptionsTextTemplateText = TemplateTextUnquotedOptions + comment
+	pol.UnquotedOptionTextTemplateText = TemplateTextUnquotedOption + comment
+}
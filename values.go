@@ -0,0 +1,113 @@
+package cspheader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddValues appends source expressions to Values, skipping any already present.  It sets Allow, as sources added to
+// a 'none' directive would otherwise be ignored.  Each value is checked as Load would check it; if any is invalid,
+// nothing is added.
+func (cso *CSPSourceOptions) AddValues(vals ...string) error {
+	for _, v := range vals {
+		err := validateSourceValue(v)
+		if err != nil {
+			return err
+		}
+	}
+
+	cso.Allow = true
+	for _, v := range vals {
+		if !containsString(cso.Values, v) {
+			cso.Values = append(cso.Values, v)
+		}
+	}
+	return nil
+}
+
+// RemoveValues removes each of vals from Values.  Allow is left as is: a directive with no sources or keywords
+// left renders empty and is left out of the header.
+func (cso *CSPSourceOptions) RemoveValues(vals ...string) {
+	cso.Values = removeStrings(cso.Values, vals)
+}
+
+// ClearValues removes all Values
+func (cso *CSPSourceOptions) ClearValues() {
+	cso.Values = nil
+}
+
+// AddHostSources appends host sources, skipping any already present, and sets Allow.  If any is invalid, nothing
+// is added.
+func (fao *FrameAncestorOptions) AddHostSources(vals ...string) error {
+	return fao.addSources(&fao.HostSources, vals)
+}
+
+// AddSchemeSources appends scheme sources (e.g. https:), skipping any already present, and sets Allow.  If any is
+// invalid, nothing is added.
+func (fao *FrameAncestorOptions) AddSchemeSources(vals ...string) error {
+	for _, v := range vals {
+		if !strings.HasSuffix(v, ":") {
+			return fmt.Errorf("%w %q: a scheme source ends in ':'", ErrInvalidSourceValue, v)
+		}
+	}
+	return fao.addSources(&fao.SchemeSources, vals)
+}
+
+func (fao *FrameAncestorOptions) addSources(sources *[]string, vals []string) error {
+	for _, v := range vals {
+		err := validateSourceValue(v)
+		if err != nil {
+			return err
+		}
+	}
+
+	fao.Allow = true
+	for _, v := range vals {
+		if !containsString(*sources, v) {
+			*sources = append(*sources, v)
+		}
+	}
+	return nil
+}
+
+// RemoveSources removes each of vals from HostSources and SchemeSources
+func (fao *FrameAncestorOptions) RemoveSources(vals ...string) {
+	fao.HostSources = removeStrings(fao.HostSources, vals)
+	fao.SchemeSources = removeStrings(fao.SchemeSources, vals)
+}
+
+// ClearSources removes all HostSources and SchemeSources
+func (fao *FrameAncestorOptions) ClearSources() {
+	fao.HostSources = nil
+	fao.SchemeSources = nil
+}
+
+// validateSourceValue applies the checks Load makes of each value: no control characters or separators, and a
+// well-formed host or scheme source unless the value is a quoted keyword, nonce, or hash.
+func validateSourceValue(v string) error {
+	err := validateControlCharacters("value", v)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(v, ";, \t\n\r\f\v") {
+		return fmt.Errorf("%w %q: a value must not contain ';', ',', or whitespace", ErrInvalidSourceValue, v)
+	}
+	if strings.HasPrefix(v, "'") {
+		return nil
+	}
+	return ValidateHostSource(v)
+}
+
+// removeStrings returns values without any of remove, as a new slice
+func removeStrings(values, remove []string) []string {
+	if values == nil {
+		return nil
+	}
+	kept := make([]string, 0, len(values))
+	for _, v := range values {
+		if !containsString(remove, v) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
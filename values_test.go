@@ -0,0 +1,124 @@
+package cspheader
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		cso       CSPSourceOptions
+		add       []string
+		want      CSPSourceOptions
+		wantError error
+	}{
+		{
+			name: "to none",
+			add:  []string{"https://a.example.com"},
+			want: CSPSourceOptions{Allow: true, Values: []string{"https://a.example.com"}},
+		},
+		{
+			name: "duplicates skipped",
+			cso:  CSPSourceOptions{Allow: true, Values: []string{"https://a.example.com"}},
+			add:  []string{"https://a.example.com", "https://b.example.com", "https://b.example.com"},
+			want: CSPSourceOptions{Allow: true, Values: []string{"https://a.example.com", "https://b.example.com"}},
+		},
+		{
+			name: "keywords",
+			add:  []string{"'nonce-YWJj'", "data:"},
+			want: CSPSourceOptions{Allow: true, Values: []string{"'nonce-YWJj'", "data:"}},
+		},
+		{
+			name:      "invalid value adds nothing",
+			cso:       CSPSourceOptions{Values: []string{"https://a.example.com"}},
+			add:       []string{"https://b.example.com", "https://c.example.com; script-src *"},
+			want:      CSPSourceOptions{Values: []string{"https://a.example.com"}},
+			wantError: ErrInvalidSourceValue,
+		},
+		{
+			name:      "control character",
+			add:       []string{"https://a.example.com\x00"},
+			wantError: ErrControlCharacter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cso := tt.cso
+			err := cso.AddValues(tt.add...)
+			if !errors.Is(err, tt.wantError) {
+				t.Fatalf("AddValues() error = %v, want %v", err, tt.wantError)
+			}
+			if !reflect.DeepEqual(cso, tt.want) {
+				t.Errorf("AddValues() = %+v, want %+v", cso, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrameAncestorSources(t *testing.T) {
+	var fao FrameAncestorOptions
+	if err := fao.AddHostSources("https://a.example.com", "https://a.example.com"); err != nil {
+		t.Fatalf("AddHostSources() error = %v", err)
+	}
+	if err := fao.AddSchemeSources("https:"); err != nil {
+		t.Fatalf("AddSchemeSources() error = %v", err)
+	}
+	want := FrameAncestorOptions{Allow: true, HostSources: []string{"https://a.example.com"}, SchemeSources: []string{"https:"}}
+	if !reflect.DeepEqual(fao, want) {
+		t.Errorf("FrameAncestorOptions = %+v, want %+v", fao, want)
+	}
+
+	for _, invalid := range []func() error{
+		func() error { return fao.AddSchemeSources("https") },
+		func() error { return fao.AddHostSources("https://b.example.com 'self'") },
+	} {
+		if err := invalid(); !errors.Is(err, ErrInvalidSourceValue) {
+			t.Errorf("error = %v, want %v", err, ErrInvalidSourceValue)
+		}
+	}
+	if !reflect.DeepEqual(fao, want) {
+		t.Errorf("an invalid source changed the options to %+v", fao)
+	}
+
+	fao.RemoveSources("https:", "https://b.example.com")
+	if len(fao.SchemeSources) != 0 || len(fao.HostSources) != 1 {
+		t.Errorf("RemoveSources() = %+v, want only the host source left", fao)
+	}
+	fao.ClearSources()
+	if fao.HostSources != nil || fao.SchemeSources != nil {
+		t.Errorf("ClearSources() = %+v", fao)
+	}
+}
+
+func TestRemoveValues(t *testing.T) {
+	values := []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}
+	cso := CSPSourceOptions{Allow: true, Values: values}
+	cso.RemoveValues("https://b.example.com", "https://d.example.com")
+
+	if want := []string{"https://a.example.com", "https://c.example.com"}; !reflect.DeepEqual(cso.Values, want) {
+		t.Errorf("Values = %v, want %v", cso.Values, want)
+	}
+	if values[1] != "https://b.example.com" {
+		t.Errorf("RemoveValues() modified the caller's slice: %v", values)
+	}
+	if !cso.Allow {
+		t.Errorf("RemoveValues() cleared Allow")
+	}
+
+	// with nothing left, the directive renders empty and is left out of the header
+	cso.RemoveValues(cso.Values...)
+	pol := SecurityOptionsStaticSite()
+	pol.CSP.ImgSrc = cso
+	if got := renderCSP(t, pol); strings.Contains(got, DirectiveImgSrc) {
+		t.Errorf("header = %q, want no img-src", got)
+	}
+
+	cso.Values = values
+	cso.ClearValues()
+	if cso.Values != nil {
+		t.Errorf("ClearValues() left %v", cso.Values)
+	}
+}
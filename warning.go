@@ -0,0 +1,100 @@
+package cspheader
+
+import (
+	"fmt"
+)
+
+// WarningCode identifies the kind of a Warning
+type WarningCode string
+
+const (
+	// WarnDeprecatedDirective is a directive that browsers no longer implement
+	WarnDeprecatedDirective WarningCode = "deprecated-directive"
+	// WarnSupersededDirective is a directive made redundant by another directive in the policy
+	WarnSupersededDirective WarningCode = "superseded-directive"
+	// WarnIneffectiveSource is a source expression browsers ignore in the context it is used
+	WarnIneffectiveSource WarningCode = "ineffective-source"
+	// WarnIgnoredOptions is source options set alongside a false Allow, which renders 'none' regardless
+	WarnIgnoredOptions WarningCode = "ignored-options"
+	// WarnBroadSource is a source expression that allows far more than is likely intended
+	WarnBroadSource WarningCode = "broad-source"
+	// WarnBrowserCompat is a value not supported by every browser
+	WarnBrowserCompat WarningCode = "browser-compat"
+	// WarnRedundantDirective is a directive dropped from the header as it is identical to default-src
+	WarnRedundantDirective WarningCode = "redundant-directive"
+	// WarnReportOnlySandbox is sandbox set on a report-only policy, where browsers ignore it
+	WarnReportOnlySandbox WarningCode = "report-only-sandbox"
+	// WarnOverriddenDirective is a known directive replaced by one of CustomDirectives
+	WarnOverriddenDirective WarningCode = "overridden-directive"
+	// WarnHeaderTooLarge is a header value over DefaultMaxHeaderBytes, which some CDNs and proxies will not pass
+	WarnHeaderTooLarge WarningCode = "header-too-large"
+)
+
+// Warning is a non-fatal finding about a Policy.  The policy still renders, but likely not as intended.
+type Warning struct {
+	Code      WarningCode
+	Directive string
+	Message   string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s (%s)", w.Directive, w.Message, w.Code)
+}
+
+// LoadWithWarnings is Load, additionally returning the non-fatal findings about the policy
+func (pol *Policy) LoadWithWarnings() (map[string]string, []Warning, error) {
+	compiled, err := pol.Compile()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers, err := compiled.Render("")
+	if err != nil {
+		return nil, nil, err
+	}
+	return headers, compiled.Warnings(), nil
+}
+
+// Warnings returns the non-fatal findings about the policy, including those about its report-only candidate
+func (cp *CompiledPolicy) Warnings() []Warning {
+	return append([]Warning(nil), cp.warnings...)
+}
+
+func (pol *Policy) warn(code WarningCode, directive, format string, args ...interface{}) {
+	pol.warnings = append(pol.warnings, Warning{
+		Code:      code,
+		Directive: directive,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// warnSourceOptions checks a single source-list directive
+func (pol *Policy) warnSourceOptions(directive string, cso CSPSourceOptions) {
+	if fields := cso.ignoredFields(); len(fields) > 0 {
+		pol.warn(WarnIgnoredOptions, directive, "%s", ignoredFieldsMessage(fields))
+	}
+	if !cso.Allow {
+		return
+	}
+
+	for _, v := range cso.Values {
+		if v == "*" {
+			pol.warn(WarnBroadSource, directive, "* allows any host")
+		}
+	}
+
+	// the strict CSP pattern pairs 'unsafe-inline' with 'strict-dynamic' deliberately, as a fallback for old browsers
+	if cso.UnsafeInline && !cso.StrictDynamic && cso.isDynamic() {
+		pol.warn(WarnIneffectiveSource, directive,
+			"'unsafe-inline' is ignored by browsers when a nonce or hash is present")
+	}
+
+	if directive == "fenced-frame-src" {
+		if cso.AllowSelf {
+			pol.warn(WarnIneffectiveSource, directive, "'self' has no effect; fenced frames are always cross-origin")
+		}
+		if cso.UnsafeInline {
+			pol.warn(WarnIneffectiveSource, directive, "'unsafe-inline' has no effect on fenced frames")
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package cspheader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// hasWarning reports whether warnings include one with code for directive
+func hasWarning(warnings []Warning, code WarningCode, directive string) bool {
+	for _, w := range warnings {
+		if w.Code == code && w.Directive == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// loadWithWarnings loads pol, returning its Content-Security-Policy (or report-only) header and warnings
+func loadWithWarnings(t *testing.T, pol Policy) (string, []Warning) {
+	t.Helper()
+	headers, warnings, err := pol.LoadWithWarnings()
+	if err != nil {
+		t.Fatalf("LoadWithWarnings() error = %v", err)
+	}
+	return headers[cspHeaderName(pol.ReportOnly)], warnings
+}
+
+func TestReportOnlySandboxWarning(t *testing.T) {
+	for _, reportOnly := range []bool{false, true} {
+		pol := SecurityOptionsReactJS()
+		pol.ReportOnly = reportOnly
+		pol.CSP.Sandbox = SandboxOptions{AllowScripts: true}
+		header, warnings := loadWithWarnings(t, pol)
+		if !strings.Contains(header, "sandbox allow-scripts;") {
+			t.Errorf("ReportOnly %v: header = %q, want sandbox rendered", reportOnly, header)
+		}
+		if got := hasWarning(warnings, WarnReportOnlySandbox, DirectiveSandbox); got != reportOnly {
+			t.Errorf("ReportOnly %v: warnings = %v, want report-only sandbox warning %v", reportOnly, warnings, reportOnly)
+		}
+	}
+}
+
+func TestLoadWithWarningsMatchesLoad(t *testing.T) {
+	pol := SecurityOptionsServerRendered()
+	want, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	got, warnings, err := pol.LoadWithWarnings()
+	if err != nil {
+		t.Fatalf("LoadWithWarnings() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadWithWarnings() = %v, want %v", got, want)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("LoadWithWarnings() warnings = %v, want none", warnings)
+	}
+}
+
+func TestWarningString(t *testing.T) {
+	w := Warning{Code: WarnBroadSource, Directive: "img-src", Message: "* allows any host"}
+	if got, want := w.String(), "img-src: * allows any host (broad-source)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestPrefetchSrcDeprecation(t *testing.T) {
+	tests := []struct {
+		name          string
+		omit          bool
+		wantPrefetch  bool
+		wantReportURI bool
+	}{
+		{"default", false, true, true},
+		{"omit deprecated directives", true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsReactJS()
+			pol.CSP.PrefetchSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+			pol.CSP.ReportURI = UnquotedOptions{Values: []string{"/csp-reports"}}
+			pol.OmitDeprecatedDirectives = tt.omit
+			header, warnings := loadWithWarnings(t, pol)
+			if got := strings.Contains(header, "prefetch-src 'self';"); got != tt.wantPrefetch {
+				t.Errorf("header = %q, want prefetch-src %v", header, tt.wantPrefetch)
+			}
+			if got := strings.Contains(header, "report-uri /csp-reports;"); got != tt.wantReportURI {
+				t.Errorf("header = %q, want report-uri %v", header, tt.wantReportURI)
+			}
+			if !hasWarning(warnings, WarnDeprecatedDirective, "prefetch-src") {
+				t.Errorf("warnings = %v, want prefetch-src deprecated", warnings)
+			}
+		})
+	}
+
+	// report-uri is the only reporting, so it is kept
+	pol := SecurityOptionsServerRendered()
+	pol.CSP.ReportURI = UnquotedOptions{Values: []string{"/csp-reports"}}
+	pol.OmitDeprecatedDirectives = true
+	header, warnings := loadWithWarnings(t, pol)
+	if !strings.HasSuffix(header, "report-uri /csp-reports;") {
+		t.Errorf("header = %q, want report-uri kept without report-to", header)
+	}
+	if hasWarning(warnings, WarnDeprecatedDirective, "prefetch-src") {
+		t.Errorf("warnings = %v, want none about an unset prefetch-src", warnings)
+	}
+}
+
+func TestLoadWithWarnings(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Policy)
+		code      WarningCode
+		directive string
+	}{
+		{"wildcard host", func(pol *Policy) { pol.CSP.ImgSrc.Values = []string{"*"} }, WarnBroadSource, "img-src"},
+		{"unsafe-inline with a hash", func(pol *Policy) {
+			pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, UnsafeInline: true, Hashes: []Hash{{Algorithm: HashSHA256, Base64: emptySHA256}}}
+		}, WarnIneffectiveSource, "script-src"},
+		{"options ignored by a false Allow", func(pol *Policy) {
+			pol.CSP.MediaSrc = CSPSourceOptions{Allow: false, AllowSelf: true}
+		}, WarnIgnoredOptions, "media-src"},
+		{"identical to default-src", func(pol *Policy) {
+			pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+		}, WarnRedundantDirective, "script-src"},
+		{"overridden by a custom directive", func(pol *Policy) {
+			pol.CustomDirectives = map[string]string{"img-src": "'none'"}
+		}, WarnOverriddenDirective, "img-src"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := SecurityOptionsServerRendered()
+			tt.configure(&pol)
+			_, warnings := loadWithWarnings(t, pol)
+			if !hasWarning(warnings, tt.code, tt.directive) {
+				t.Errorf("warnings = %v, want %s for %s", warnings, tt.code, tt.directive)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package cspheader
+
+import "io"
+
+// Render writes the Content-Security-Policy header value to w, as String returns it, without building the value
+// as an intermediate string.  Like String, it compiles the Policy first if it has not been loaded or compiled.
+func (pol *Policy) Render(w io.Writer) error {
+	if pol.compiled == nil {
+		_, err := pol.Compile()
+		if err != nil {
+			return err
+		}
+	}
+	return pol.compiled.RenderTo(w, "")
+}
+
+// RenderHeaderBlock writes each of the policy's headers to w as a "Name: value\r\n" line, as for an HTTP/1.1
+// response or a server config file.  Like Render, it compiles the Policy first if it has not been.
+func (pol *Policy) RenderHeaderBlock(w io.Writer) error {
+	if pol.compiled == nil {
+		_, err := pol.Compile()
+		if err != nil {
+			return err
+		}
+	}
+	return pol.compiled.RenderHeaderBlock(w, "")
+}
+
+// RenderTo writes the Content-Security-Policy header value to w, substituting nonce as Render does.  A missing or
+// invalid nonce is reported before anything is written.
+func (cp *CompiledPolicy) RenderTo(w io.Writer, nonce string) error {
+	return cp.writeDirectives(w, nil, nonce)
+}
+
+// RenderHeaderBlock writes each header Render returns to w as a "Name: value\r\n" line, substituting nonce.
+// Headers are written in a fixed order: the policy, the report-only candidate, the additional policies, each on its
+// own line, Report-To, and Reporting-Endpoints.
+func (cp *CompiledPolicy) RenderHeaderBlock(w io.Writer, nonce string) error {
+	err := cp.checkNonce(nil, nonce)
+	if err != nil {
+		return err
+	}
+	// the candidate is only delivered alongside an enforced policy, where the report-only header is free
+	candidate := cp.candidate
+	if cp.reportOnly {
+		candidate = nil
+	}
+	if candidate != nil {
+		err = candidate.checkNonce(nil, nonce)
+		if err != nil {
+			return err
+		}
+	}
+	for _, additional := range cp.additional {
+		err = additional.checkNonce(nil, nonce)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeHeaderLine(w, cspHeaderName(cp.reportOnly), func(w io.Writer) error { return cp.writeDirectives(w, nil, nonce) })
+	if err != nil {
+		return err
+	}
+
+	if candidate != nil {
+		err = writeHeaderLine(w, HeaderContentSecurityPolicyReportOnly, func(w io.Writer) error {
+			return candidate.writeDirectives(w, nil, nonce)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, additional := range cp.additional {
+		err = writeHeaderLine(w, cspHeaderName(additional.reportOnly), func(w io.Writer) error {
+			return additional.writeDirectives(w, nil, nonce)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, h := range []struct {
+		name, value string
+	}{
+		{HeaderReportTo, cp.reportTo},
+		{HeaderReportingEndpoints, cp.reportingEndpoints},
+	} {
+		if len(h.value) == 0 {
+			continue
+		}
+		err = writeHeaderLine(w, h.name, func(w io.Writer) error {
+			_, err := io.WriteString(w, h.value)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHeaderLine writes a "Name: value\r\n" line, with the value written by value
+func writeHeaderLine(w io.Writer, name string, value func(io.Writer) error) error {
+	_, err := io.WriteString(w, name+": ")
+	if err != nil {
+		return err
+	}
+	err = value(w)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\r\n")
+	return err
+}
@@ -0,0 +1,201 @@
+package cspheader
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func BenchmarkRenderTo(b *testing.B) {
+	pol := noncePolicy()
+	compiled, err := pol.Compile()
+	if err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		err := compiled.RenderTo(&buf, "cmVxdWVzdA")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCompiledRenderToMatchesRender(t *testing.T) {
+	pol := noncePolicy()
+	compiled, err := pol.Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	for _, nonce := range []string{"", "cmVxdWVzdA"} {
+		headers, err := compiled.Render(nonce)
+		if err != nil {
+			t.Fatalf("Render(%q) error = %v", nonce, err)
+		}
+		var buf bytes.Buffer
+		err = compiled.RenderTo(&buf, nonce)
+		if err != nil {
+			t.Fatalf("RenderTo(%q) error = %v", nonce, err)
+		}
+		if buf.String() != headers[HeaderContentSecurityPolicy] {
+			t.Errorf("RenderTo(%q) wrote %q, Render returns %q", nonce, buf.String(), headers[HeaderContentSecurityPolicy])
+		}
+	}
+}
+
+func TestPolicyRenderMatchesLoad(t *testing.T) {
+	for name, pol := range presets() {
+		t.Run(name, func(t *testing.T) {
+			headers, err := pol.Load()
+			if errors.Is(err, ErrNonceRequired) {
+				t.Skip("the preset needs a per-request nonce, which Load cannot give it")
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			var buf bytes.Buffer
+			err = pol.Render(&buf)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if want := headers[cspHeaderName(pol.ReportOnly)]; buf.String() != want {
+				t.Errorf("Render() wrote %q, Load returns %q", buf.String(), want)
+			}
+		})
+	}
+}
+
+// TestRenderHeaderBlockMatchesLoad reads the lines RenderHeaderBlock writes back into a map, joining repeated
+// headers as Load does, and compares it with Load's
+func TestRenderHeaderBlockMatchesLoad(t *testing.T) {
+	pol := layeredWriterPolicy()
+	want, err := pol.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = pol.RenderHeaderBlock(&buf)
+	if err != nil {
+		t.Fatalf("RenderHeaderBlock() error = %v", err)
+	}
+	block := buf.String()
+	if !strings.HasSuffix(block, "\r\n") {
+		t.Fatalf("RenderHeaderBlock() wrote %q, want CRLF-terminated lines", block)
+	}
+
+	got := map[string]string{}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSuffix(block, "\r\n"), "\r\n") {
+		name, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			t.Fatalf("RenderHeaderBlock() wrote the line %q, want \"Name: value\"", line)
+		}
+		names = append(names, name)
+		if v, ok := got[name]; ok {
+			value = v + ", " + value
+		}
+		got[name] = value
+	}
+
+	wantNames := []string{
+		HeaderContentSecurityPolicy,
+		HeaderContentSecurityPolicyReportOnly,
+		HeaderContentSecurityPolicy,
+		HeaderReportTo,
+		HeaderReportingEndpoints,
+	}
+	if strings.Join(names, ",") != strings.Join(wantNames, ",") {
+		t.Errorf("RenderHeaderBlock() wrote headers %v, want %v", names, wantNames)
+	}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("%s: RenderHeaderBlock() wrote %q, Load returns %q", name, got[name], v)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("RenderHeaderBlock() wrote %d headers, Load returns %d", len(got), len(want))
+	}
+}
+
+func TestRenderHeaderBlockWriteError(t *testing.T) {
+	pol := layeredWriterPolicy()
+	compiled, err := pol.Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	var full bytes.Buffer
+	err = compiled.RenderHeaderBlock(&full, "")
+	if err != nil {
+		t.Fatalf("RenderHeaderBlock() error = %v", err)
+	}
+
+	// fail at a point in each line
+	for _, n := range []int{0, 10, full.Len() / 2, full.Len() - 1} {
+		err := compiled.RenderHeaderBlock(&failingWriter{n: n}, "")
+		if !errors.Is(err, errWriteFailed) {
+			t.Errorf("RenderHeaderBlock() failing after %d bytes error = %v, want %v", n, err, errWriteFailed)
+		}
+	}
+}
+
+func TestRenderToMissingNonceWritesNothing(t *testing.T) {
+	pol := SecurityOptionsStrict()
+	compiled, err := pol.Compile()
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = compiled.RenderTo(&buf, "")
+	if !errors.Is(err, ErrNonceRequired) {
+		t.Errorf("RenderTo() error = %v, want %v", err, ErrNonceRequired)
+	}
+	err = compiled.RenderHeaderBlock(&buf, "")
+	if !errors.Is(err, ErrNonceRequired) {
+		t.Errorf("RenderHeaderBlock() error = %v, want %v", err, ErrNonceRequired)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q before failing, want nothing", buf.String())
+	}
+}
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > fw.n {
+		n := fw.n
+		fw.n = 0
+		return n, errWriteFailed
+	}
+	fw.n -= len(p)
+	return len(p), nil
+}
+
+// layeredWriterPolicy has a report-only candidate, an additional policy, and Report-To, so that RenderHeaderBlock
+// writes every kind of line
+func layeredWriterPolicy() Policy {
+	pol := SecurityOptionsReactJSWithReporting("csp", "https://reports.example.com/csp", time.Hour)
+	candidate := pol.Clone()
+	candidate.CSP.ScriptSrc.UnsafeInline = false
+	pol.ReportOnlyCandidate = &candidate
+	pol.ReportingEndpoints = map[string]string{"csp": "https://reports.example.com/csp"}
+
+	additional := Policy{OmitZeroDirectives: true}
+	additional.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+	additional.CSP.BaseURI = CSPSourceOptions{Unset: true}
+	additional.CSP.FormAction = CSPSourceOptions{Unset: true}
+	additional.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	pol.Additional = []Policy{additional}
+	return pol
+}
+
+// failingWriter accepts n bytes and then fails every write
+type failingWriter struct {
+	n int
+}
+
+var errWriteFailed = errors.New("write failed")
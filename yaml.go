@@ -0,0 +1,700 @@
+package cspheader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// NewPolicyFromYAML reads a Policy from YAML using the same keys as the JSON form (see NewPolicyFromJSON).  Unknown
+// keys are rejected.  Directives also accept a source list in place of their options, e.g.
+//
+//	csp:
+//	  default-src: ["'self'"]
+//	  script-src: ["'self'", cdn.example.com, nonce]
+//	  object-src: "'none'"
+//	  frame-ancestors: [self]
+//	  sandbox: [allow-scripts, allow-forms]
+//	  report-uri: [/csp-reports]
+//
+// A source list is a sequence, or a string of space separated sources as in a header.  Keywords may be given
+// without their single quotes, and nonce stands for NoncePlaceholder.  An empty list is 'none'.
+//
+// Only the subset of YAML needed for configuration is understood: block and flow mappings and sequences, plain and
+// quoted scalars, and comments.  Anchors, aliases, tags, multi-line scalars and flow collections, complex keys,
+// directives, and multiple documents are not supported, and are reported as errors rather than misread.  Errors are
+// a *YAMLError carrying the line and the path of the offending key.
+func NewPolicyFromYAML(r io.Reader) (Policy, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	root, err := parseYAML(string(b))
+	if err != nil {
+		return Policy{}, err
+	}
+
+	pol := Policy{}
+	if root == nil {
+		return pol, nil
+	}
+	err = decodeYAML(root, reflect.ValueOf(&pol).Elem(), "")
+	if err != nil {
+		return Policy{}, err
+	}
+	return pol, nil
+}
+
+// YAMLError records an error reading a YAML policy.  Path is the dotted path of the offending key, e.g.
+// csp.script-src[1], and is empty for syntax errors.
+type YAMLError struct {
+	Line int
+	Path string
+	Err  error
+}
+
+func (e *YAMLError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("yaml: line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("yaml: line %d: %s: %v", e.Line, e.Path, e.Err)
+}
+
+func (e *YAMLError) Unwrap() error {
+	return e.Err
+}
+
+type yamlKind int
+
+const (
+	yamlScalar yamlKind = iota
+	yamlMapping
+	yamlSequence
+)
+
+type yamlNode struct {
+	kind yamlKind
+	line int
+
+	// scalars
+	value  string
+	quoted bool
+
+	// mappings keep their keys in document order
+	keys   []string
+	values []*yamlNode
+
+	// sequences
+	items []*yamlNode
+}
+
+func (n *yamlNode) isNull() bool {
+	return n.kind == yamlScalar && !n.quoted && (n.value == "" || n.value == "~" || n.value == "null")
+}
+
+// yamlLine is a line with its comment and indentation removed
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func parseYAML(doc string) (*yamlNode, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(doc, "\n") {
+		text := strings.TrimRight(stripYAMLComment(strings.TrimRight(raw, "\r")), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if len(trimmed) == 0 {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, &YAMLError{Line: i + 1, Err: errors.New("tabs are not allowed in indentation")}
+		}
+		if trimmed == "---" && len(p.lines) == 0 {
+			continue
+		}
+		if trimmed == "---" || trimmed == "..." {
+			return nil, &YAMLError{Line: i + 1, Err: errors.New("multiple documents are not supported")}
+		}
+		if strings.HasPrefix(trimmed, "%") && len(p.lines) == 0 {
+			return nil, &YAMLError{Line: i + 1, Err: errors.New("directives such as %YAML are not supported")}
+		}
+		p.lines = append(p.lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+
+	root, err := p.parseBlock(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, &YAMLError{Line: p.lines[p.pos].number, Err: errors.New("unexpected indentation")}
+	}
+	return root, nil
+}
+
+// stripYAMLComment removes a # comment, which starts a line or follows whitespace outside of quotes
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			if i == 0 || strings.ContainsRune(" \t[{,:-", rune(s[i-1])) {
+				quote = c
+			}
+		case c == '#':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '\t' {
+				return s[:i]
+			}
+		}
+	}
+	return s
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseBlock(indent int) (*yamlNode, error) {
+	if isYAMLSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseSequence(indent int) (*yamlNode, error) {
+	seq := &yamlNode{kind: yamlSequence, line: p.lines[p.pos].number}
+
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		content := strings.TrimLeft(line.text[1:], " ")
+
+		switch {
+		case len(content) == 0:
+			p.pos++
+			item, err := p.parseNested(indent, line.number)
+			if err != nil {
+				return nil, err
+			}
+			seq.items = append(seq.items, item)
+		case isYAMLSequenceItem(content) || yamlKeyEnd(content) >= 0:
+			// a block collection starting on the item's own line, indented to where its content begins
+			p.lines[p.pos] = yamlLine{number: line.number, indent: line.indent + len(line.text) - len(content), text: content}
+			item, err := p.parseBlock(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			seq.items = append(seq.items, item)
+		default:
+			item, err := parseYAMLFlow(content, line.number)
+			if err != nil {
+				return nil, err
+			}
+			seq.items = append(seq.items, item)
+			p.pos++
+			err = p.checkContinuation(indent)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return seq, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (*yamlNode, error) {
+	m := &yamlNode{kind: yamlMapping, line: p.lines[p.pos].number}
+
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		if isYAMLSequenceItem(line.text) {
+			return nil, &YAMLError{Line: line.number, Err: errors.New("sequence item where a key was expected")}
+		}
+
+		if line.text == "?" || strings.HasPrefix(line.text, "? ") {
+			return nil, &YAMLError{Line: line.number, Err: errors.New("complex keys are not supported")}
+		}
+		end := yamlKeyEnd(line.text)
+		if end < 0 {
+			return nil, &YAMLError{Line: line.number, Err: fmt.Errorf("expected key: value, got %q", line.text)}
+		}
+		keyNode, err := parseYAMLScalar(strings.TrimSpace(line.text[:end]), line.number)
+		if err != nil {
+			return nil, err
+		}
+		key := keyNode.value
+		for _, existing := range m.keys {
+			if existing == key {
+				return nil, &YAMLError{Line: line.number, Err: fmt.Errorf("duplicate key %s", key)}
+			}
+		}
+
+		rest := strings.TrimSpace(line.text[end+1:])
+		p.pos++
+
+		var value *yamlNode
+		if len(rest) == 0 {
+			value, err = p.parseNested(indent, line.number)
+		} else {
+			value, err = parseYAMLFlow(rest, line.number)
+			if err == nil {
+				err = p.checkContinuation(indent)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		m.keys = append(m.keys, key)
+		m.values = append(m.values, value)
+	}
+
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, &YAMLError{Line: p.lines[p.pos].number, Err: errors.New("unexpected indentation")}
+	}
+	return m, nil
+}
+
+// checkContinuation rejects a line indented past a value that was complete on its own line, which YAML would read
+// as the value continuing
+func (p *yamlParser) checkContinuation(indent int) error {
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return &YAMLError{Line: p.lines[p.pos].number, Err: errors.New("multi-line scalars and flow collections are not supported")}
+	}
+	return nil
+}
+
+// parseNested parses the block belonging to a key or sequence item with no value on its own line.  A sequence may
+// sit at the same indentation as its key.
+func (p *yamlParser) parseNested(parentIndent, line int) (*yamlNode, error) {
+	if p.pos < len(p.lines) {
+		next := p.lines[p.pos]
+		if next.indent > parentIndent || (next.indent == parentIndent && isYAMLSequenceItem(next.text)) {
+			return p.parseBlock(next.indent)
+		}
+	}
+	return &yamlNode{kind: yamlScalar, line: line}, nil
+}
+
+// yamlKeyEnd returns the index of the colon ending a mapping key, or -1 if text is not a key: value pair
+func yamlKeyEnd(text string) int {
+	if strings.HasPrefix(text, "'") || strings.HasPrefix(text, `"`) {
+		end := quotedYAMLEnd(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return -1
+		}
+		if end+2 < len(text) && text[end+2] != ' ' {
+			return -1
+		}
+		return end + 1
+	}
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return -1
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return i
+		}
+	}
+	return -1
+}
+
+// quotedYAMLEnd returns the index of the quote closing the scalar text begins with, or -1
+func quotedYAMLEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseYAMLFlow parses a value written on a single line: a scalar, or a flow sequence or mapping
+func parseYAMLFlow(text string, line int) (*yamlNode, error) {
+	if text == "|" || text == ">" || strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">") {
+		return nil, &YAMLError{Line: line, Err: errors.New("multi-line scalars are not supported")}
+	}
+	if strings.HasPrefix(text, "&") || strings.HasPrefix(text, "*") || strings.HasPrefix(text, "!") {
+		return nil, &YAMLError{Line: line, Err: errors.New("anchors, aliases, and tags are not supported")}
+	}
+
+	if !strings.HasPrefix(text, "[") && !strings.HasPrefix(text, "{") {
+		return parseYAMLScalar(text, line)
+	}
+
+	closing := byte(']')
+	if text[0] == '{' {
+		closing = '}'
+	}
+	if text[len(text)-1] != closing {
+		return nil, &YAMLError{Line: line, Err: fmt.Errorf("unterminated flow collection %q", text)}
+	}
+
+	parts, err := splitYAMLFlow(text[1:len(text)-1], line)
+	if err != nil {
+		return nil, err
+	}
+
+	if closing == ']' {
+		seq := &yamlNode{kind: yamlSequence, line: line}
+		for _, part := range parts {
+			item, err := parseYAMLFlow(part, line)
+			if err != nil {
+				return nil, err
+			}
+			seq.items = append(seq.items, item)
+		}
+		return seq, nil
+	}
+
+	m := &yamlNode{kind: yamlMapping, line: line}
+	for _, part := range parts {
+		end := yamlKeyEnd(part)
+		if end < 0 {
+			return nil, &YAMLError{Line: line, Err: fmt.Errorf("expected key: value, got %q", part)}
+		}
+		key, err := parseYAMLScalar(strings.TrimSpace(part[:end]), line)
+		if err != nil {
+			return nil, err
+		}
+		value, err := parseYAMLFlow(strings.TrimSpace(part[end+1:]), line)
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, key.value)
+		m.values = append(m.values, value)
+	}
+	return m, nil
+}
+
+// splitYAMLFlow splits the inside of a flow collection on its top level commas
+func splitYAMLFlow(text string, line int) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '\'', '"':
+			// a quote only opens a string at the start of an item or of a flow mapping value
+			before := strings.TrimSpace(text[start:i])
+			if len(before) > 0 && !strings.HasSuffix(before, ":") {
+				continue
+			}
+			end := quotedYAMLEnd(text[i:])
+			if end < 0 {
+				return nil, &YAMLError{Line: line, Err: fmt.Errorf("unterminated quoted string in %q", text)}
+			}
+			i += end
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(text[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, &YAMLError{Line: line, Err: fmt.Errorf("unbalanced brackets in %q", text)}
+	}
+
+	last := strings.TrimSpace(text[start:])
+	if len(last) > 0 {
+		parts = append(parts, last)
+	} else if len(parts) > 0 {
+		// a trailing comma is allowed, an empty item is not
+		for _, part := range parts {
+			if len(part) == 0 {
+				return nil, &YAMLError{Line: line, Err: fmt.Errorf("empty item in %q", text)}
+			}
+		}
+	}
+	return parts, nil
+}
+
+func parseYAMLScalar(text string, line int) (*yamlNode, error) {
+	n := &yamlNode{kind: yamlScalar, line: line, value: text}
+	if len(text) == 0 || (text[0] != '\'' && text[0] != '"') {
+		return n, nil
+	}
+
+	end := quotedYAMLEnd(text)
+	if end != len(text)-1 {
+		return nil, &YAMLError{Line: line, Err: fmt.Errorf("malformed quoted string %s", text)}
+	}
+	n.quoted = true
+	if text[0] == '\'' {
+		n.value = strings.ReplaceAll(text[1:end], "''", "'")
+		return n, nil
+	}
+	value, err := strconv.Unquote(text)
+	if err != nil {
+		return nil, &YAMLError{Line: line, Err: fmt.Errorf("malformed quoted string %s", text)}
+	}
+	n.value = value
+	return n, nil
+}
+
+// decodeYAML stores n in v, which is addressable, following v's json tags
+func decodeYAML(n *yamlNode, v reflect.Value, path string) error {
+	if n.isNull() {
+		return nil
+	}
+
+	fail := func(format string, args ...interface{}) error {
+		return &YAMLError{Line: n.line, Path: path, Err: fmt.Errorf(format, args...)}
+	}
+
+	if n.kind != yamlMapping {
+		handled, err := decodeYAMLSourceList(n, v, path)
+		if handled {
+			return err
+		}
+	}
+
+	// e.g. ReportToGroup, which has its own JSON form
+	if u, ok := v.Addr().Interface().(json.Unmarshaler); ok {
+		b, err := json.Marshal(n.generic())
+		if err != nil {
+			return fail("%v", err)
+		}
+		err = u.UnmarshalJSON(b)
+		if err != nil {
+			return fail("%v", err)
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if n.kind != yamlMapping {
+			return fail("expected a mapping")
+		}
+		for i, key := range n.keys {
+			field, ok := yamlField(v, key)
+			if !ok {
+				return &YAMLError{Line: n.values[i].line, Path: joinYAMLPath(path, key), Err: errors.New("unknown field")}
+			}
+			err := decodeYAML(n.values[i], field, joinYAMLPath(path, key))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeYAML(n, v.Elem(), path)
+	case reflect.Slice:
+		if n.kind != yamlSequence {
+			return fail("expected a sequence")
+		}
+		s := reflect.MakeSlice(v.Type(), len(n.items), len(n.items))
+		for i, item := range n.items {
+			err := decodeYAML(item, s.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Map:
+		if n.kind != yamlMapping || v.Type().Key().Kind() != reflect.String {
+			return fail("expected a mapping")
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(n.keys))
+		for i, key := range n.keys {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			err := decodeYAML(n.values[i], elem, joinYAMLPath(path, key))
+			if err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		v.Set(m)
+	case reflect.String:
+		if n.kind != yamlScalar {
+			return fail("expected a string")
+		}
+		v.SetString(n.value)
+	case reflect.Bool:
+		b, ok := n.bool()
+		if !ok {
+			return fail("expected true or false, got %q", n.value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(n.value, 10, v.Type().Bits())
+		if n.kind != yamlScalar || n.quoted || err != nil {
+			return fail("expected an integer, got %q", n.value)
+		}
+		v.SetInt(i)
+	default:
+		return fail("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// decodeYAMLSourceList handles the source list shorthand for directive options.  handled is false when v is not a
+// directive's options.
+func decodeYAMLSourceList(n *yamlNode, v reflect.Value, path string) (handled bool, err error) {
+	switch v.Addr().Interface().(type) {
+	case *CSPSourceOptions, *FrameAncestorOptions, *SandboxOptions, *UnquotedOptions, *UnquotedOption:
+	default:
+		return false, nil
+	}
+
+	var values []string
+	switch n.kind {
+	case yamlScalar:
+		values = strings.Fields(n.value)
+	case yamlSequence:
+		for i, item := range n.items {
+			if item.kind != yamlScalar {
+				// e.g. an unquoted https: in a block sequence, which YAML reads as a key
+				return true, &YAMLError{
+					Line: item.line,
+					Path: fmt.Sprintf("%s[%d]", path, i),
+					Err:  errors.New("expected a source; quote scheme sources such as 'https:'"),
+				}
+			}
+			values = append(values, item.value)
+		}
+	}
+
+	// the directive name is the last element of the path
+	directive := path[strings.LastIndex(path, ".")+1:]
+
+	switch v.Addr().Interface().(type) {
+	case *CSPSourceOptions:
+		for i, s := range values {
+			if strings.EqualFold(s, "nonce") {
+				values[i] = "'nonce-" + NoncePlaceholder + "'"
+			}
+		}
+		var cso CSPSourceOptions
+		cso, err = parseSourceOptions(directive, quoteKeywordValues(values))
+		v.Set(reflect.ValueOf(cso))
+	case *FrameAncestorOptions:
+		v.Set(reflect.ValueOf(parseFrameAncestorOptions(quoteKeywordValues(values))))
+	case *SandboxOptions:
+		var so SandboxOptions
+		so, err = parseSandboxOptions(values)
+		v.Set(reflect.ValueOf(so))
+	case *UnquotedOptions:
+		v.Set(reflect.ValueOf(UnquotedOptions{Values: values}))
+	case *UnquotedOption:
+		if n.kind != yamlScalar {
+			err = errors.New("expected a single value")
+			break
+		}
+		v.Set(reflect.ValueOf(UnquotedOption{Value: n.value}))
+	}
+
+	if err != nil {
+		// the parse errors name the directive, which the path already does
+		msg := strings.TrimPrefix(err.Error(), directive+": ")
+		return true, &YAMLError{Line: n.line, Path: path, Err: errors.New(msg)}
+	}
+	return true, nil
+}
+
+// yamlField returns the field of the struct v whose json name is key
+func yamlField(v reflect.Value, key string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		if name == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func joinYAMLPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+func (n *yamlNode) bool() (bool, bool) {
+	if n.kind != yamlScalar || n.quoted {
+		return false, false
+	}
+	switch n.value {
+	case "true", "True", "TRUE":
+		return true, true
+	case "false", "False", "FALSE":
+		return false, true
+	}
+	return false, false
+}
+
+// generic converts n into the values encoding/json produces when decoding into an interface{}
+func (n *yamlNode) generic() interface{} {
+	switch n.kind {
+	case yamlMapping:
+		m := make(map[string]interface{}, len(n.keys))
+		for i, key := range n.keys {
+			m[key] = n.values[i].generic()
+		}
+		return m
+	case yamlSequence:
+		s := make([]interface{}, len(n.items))
+		for i, item := range n.items {
+			s[i] = item.generic()
+		}
+		return s
+	}
+
+	if n.isNull() {
+		return nil
+	}
+	if b, ok := n.bool(); ok {
+		return b
+	}
+	if !n.quoted {
+		f, err := strconv.ParseFloat(n.value, 64)
+		if err == nil {
+			return f
+		}
+	}
+	return n.value
+}
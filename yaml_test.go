@@ -0,0 +1,218 @@
+package cspheader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestYAMLFixtures loads each fixture and its JSON equivalent and checks both against the Policy built in code,
+// by Equal and by the headers they render
+func TestYAMLFixtures(t *testing.T) {
+	tests := []struct {
+		name string
+		want func() Policy
+	}{
+		{"source-lists", sourceListsPolicy},
+		{"options", optionsPolicy},
+		{"layered", layeredPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want()
+			loaded := map[string]Policy{
+				"yaml": loadYAMLFixture(t, tt.name+".yaml"),
+				"json": loadJSONFixture(t, tt.name+".json"),
+			}
+
+			compiled, err := want.Compile()
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			wantHeaders, err := compiled.Render("abc123")
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			for form, pol := range loaded {
+				if !pol.Equal(want) {
+					t.Errorf("%s fixture does not equal the Policy built in code:\ngot  %+v\nwant %+v", form, pol.CSP, want.CSP)
+				}
+				compiled, err := pol.Compile()
+				if err != nil {
+					t.Fatalf("%s fixture: Compile() error = %v", form, err)
+				}
+				headers, err := compiled.Render("abc123")
+				if err != nil {
+					t.Fatalf("%s fixture: Render() error = %v", form, err)
+				}
+				if !reflect.DeepEqual(headers, wantHeaders) {
+					t.Errorf("%s fixture renders\n%v\nwant\n%v", form, headers, wantHeaders)
+				}
+			}
+		})
+	}
+}
+
+func TestYAMLScalars(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"plain", "csp:\n  report-to: default\n", "default"},
+		{"single quoted", "csp:\n  report-to: 'it''s'\n", "it's"},
+		{"double quoted", "csp:\n  report-to: \"a\\tb\"\n", "a\tb"},
+		{"comment", "csp:\n  report-to: default # the group\n", "default"},
+		{"hash in value", "csp:\n  report-to: a#b\n", "a#b"},
+		{"flow mapping", "csp: {report-to: {value: default}}\n", "default"},
+		{"document start", "---\ncsp:\n  report-to: default\n", "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol, err := NewPolicyFromYAML(strings.NewReader(tt.doc))
+			if err != nil {
+				t.Fatalf("NewPolicyFromYAML() error = %v", err)
+			}
+			if pol.CSP.ReportTo.Value != tt.want {
+				t.Errorf("report-to = %q, want %q", pol.CSP.ReportTo.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLUnsupported(t *testing.T) {
+	tests := []struct {
+		file string
+		line int
+		want string
+	}{
+		{"anchor.yaml", 1, "anchors, aliases, and tags are not supported"},
+		{"alias.yaml", 2, "anchors, aliases, and tags are not supported"},
+		{"tag.yaml", 2, "anchors, aliases, and tags are not supported"},
+		{"literal-block.yaml", 2, "multi-line scalars are not supported"},
+		{"multi-line-plain.yaml", 3, "multi-line scalars and flow collections are not supported"},
+		{"multi-line-flow.yaml", 2, "unterminated flow collection"},
+		{"multiple-documents.yaml", 3, "multiple documents are not supported"},
+		{"directive.yaml", 1, "directives such as %YAML are not supported"},
+		{"complex-key.yaml", 2, "complex keys are not supported"},
+		{"unknown-field.yaml", 3, "csp.unknown-src: unknown field"},
+		{"tab.yaml", 2, "tabs are not allowed in indentation"},
+		{"unquoted-scheme.yaml", 3, "quote scheme sources"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Join("testdata", "yaml", "invalid", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewPolicyFromYAML(strings.NewReader(string(b)))
+			var ye *YAMLError
+			if !errors.As(err, &ye) {
+				t.Fatalf("NewPolicyFromYAML() error = %v, want a *YAMLError", err)
+			}
+			if ye.Line != tt.line || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewPolicyFromYAML() error = %q, want line %d and %q", err, tt.line, tt.want)
+			}
+		})
+	}
+}
+
+func layeredPolicy() Policy {
+	pol := Policy{}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	pol.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+
+	candidate := Policy{}
+	candidate.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true, NonceBase64Value: NoncePlaceholder}
+	candidate.CSP.ReportURI = UnquotedOptions{Values: []string{"/csp-reports"}}
+	pol.ReportOnlyCandidate = &candidate
+
+	additional := Policy{OmitZeroDirectives: true}
+	additional.CSP.DefaultSrc = CSPSourceOptions{Unset: true}
+	additional.CSP.BaseURI = CSPSourceOptions{Unset: true}
+	additional.CSP.FormAction = CSPSourceOptions{Unset: true}
+	additional.CSP.ScriptSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{"https://cdn.example.com"}}
+	pol.Additional = []Policy{additional}
+	return pol
+}
+
+func loadJSONFixture(t *testing.T, name string) Policy {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "yaml", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pol, err := NewPolicyFromJSON(f)
+	if err != nil {
+		t.Fatalf("NewPolicyFromJSON(%s) error = %v", name, err)
+	}
+	return pol
+}
+
+func loadYAMLFixture(t *testing.T, name string) Policy {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "yaml", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pol, err := NewPolicyFromYAML(f)
+	if err != nil {
+		t.Fatalf("NewPolicyFromYAML(%s) error = %v", name, err)
+	}
+	return pol
+}
+
+func optionsPolicy() Policy {
+	pol := Policy{
+		OmitDeprecatedDirectives: true,
+		Strict:                   true,
+		MaxHeaderBytes:           4096,
+		SelfOrigin:               "https://example.com",
+		ReportingEndpoints:       map[string]string{"csp": "https://reports.example.com/csp"},
+		CustomDirectives:         map[string]string{"require-trusted-types-for": "'script'"},
+	}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	pol.CSP.ScriptSrc = CSPSourceOptions{
+		Allow:        true,
+		AllowSelf:    true,
+		Values:       []string{"https://cdn.example.com"},
+		Hashes:       []Hash{{Algorithm: HashSHA256, Base64: "RFWPLDbv2BY+rCkDzsE+0fr8ylGr2R2faWMhq4lfEQc="}},
+		ReportSample: true,
+	}
+	pol.CSP.ConnectSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{"wss://live.example.com"}}
+	pol.CSP.FormAction = CSPSourceOptions{Unset: true}
+	pol.CSP.ReportTo = UnquotedOption{Value: "csp"}
+	pol.ReportTo.Groups = []ReportToGroup{{
+		Group:     "csp",
+		MaxAge:    24 * time.Hour,
+		Endpoints: []ReportToEndpoint{{URL: "https://reports.example.com/csp"}},
+	}}
+	return pol
+}
+
+func sourceListsPolicy() Policy {
+	pol := Policy{}
+	pol.CSP.DefaultSrc = CSPSourceOptions{Allow: true, AllowSelf: true}
+	pol.CSP.ScriptSrc = CSPSourceOptions{
+		Allow:            true,
+		AllowSelf:        true,
+		Values:           []string{"https://cdn.example.com"},
+		NonceBase64Value: NoncePlaceholder,
+		StrictDynamic:    true,
+	}
+	pol.CSP.StyleSrc = CSPSourceOptions{Allow: true, AllowSelf: true, UnsafeInline: true}
+	pol.CSP.ImgSrc = CSPSourceOptions{Allow: true, AllowSelf: true, Values: []string{"data:", "https://images.example.com"}}
+	pol.CSP.FrameAncestors = FrameAncestorOptions{Allow: true, AllowSelf: true, HostSources: []string{"https://partner.example.com"}}
+	pol.CSP.Sandbox = SandboxOptions{AllowScripts: true, AllowForms: true}
+	pol.CSP.ReportURI = UnquotedOptions{Values: []string{"/csp-reports"}}
+	pol.CSP.ReportTo = UnquotedOption{Value: "default"}
+	pol.CSP.UpgradeInsecureRequests = true
+	pol.ReportingEndpoints = map[string]string{"default": "https://reports.example.com/csp"}
+	return pol
+}